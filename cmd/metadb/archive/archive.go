@@ -0,0 +1,314 @@
+// Package archive writes history partitions of tables to Parquet files.
+package archive
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/metadb-project/metadb/cmd/metadb/catalog"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+	"github.com/metadb-project/metadb/cmd/metadb/eout"
+	"github.com/metadb-project/metadb/cmd/metadb/option"
+	"github.com/metadb-project/metadb/cmd/metadb/process"
+	"github.com/metadb-project/metadb/cmd/metadb/types"
+	"github.com/metadb-project/metadb/cmd/metadb/util"
+	"github.com/parquet-go/parquet-go"
+)
+
+// Archive writes each history partition of a table for a year to a Parquet
+// file, and records it in the table metadb.archive.  If opt.Drop is true,
+// the partition is then detached and dropped; this requires that the
+// server is not running, because the server caches the list of partitions.
+func Archive(opt *option.Archive) error {
+	name, ok := strings.CutSuffix(opt.Table, "__")
+	if !ok {
+		return fmt.Errorf("%q is not a main table name", opt.Table)
+	}
+	table, err := dbx.ParseTable(name)
+	if err != nil || table.Schema == "" {
+		return fmt.Errorf("%q is not a valid table name", opt.Table)
+	}
+	if opt.Drop && opt.Year >= time.Now().UTC().Year() {
+		return fmt.Errorf("partition for year %d cannot be dropped because it may still be written to", opt.Year)
+	}
+	db, err := util.ReadConfigDatabase(opt.Datadir)
+	if err != nil {
+		return err
+	}
+	if opt.Drop {
+		// Check if server is already running.
+		running, pid, err := process.IsServerRunning(opt.Datadir)
+		if err != nil {
+			return err
+		}
+		if running {
+			return fmt.Errorf("lock file %q already exists and server (PID %d) appears to be running", util.SystemPIDFileName(opt.Datadir), pid)
+		}
+		// Write lock file for new server instance.
+		if err = process.WritePIDFile(opt.Datadir); err != nil {
+			return err
+		}
+		defer process.RemovePIDFile(opt.Datadir)
+	}
+	var dp *pgxpool.Pool
+	dp, err = dbx.NewPool(context.TODO(), db.ConnString(db.User, db.Password))
+	if err != nil {
+		return fmt.Errorf("creating database connection pool: %w", err)
+	}
+	defer dp.Close()
+	// Check that database version is compatible.
+	if err = catalog.CheckDatabaseCompatible(dp); err != nil {
+		return err
+	}
+	cat, err := catalog.Initialize(db, dp)
+	if err != nil {
+		return err
+	}
+	if !cat.TableExists(&table) {
+		return fmt.Errorf("table %q does not exist", opt.Table)
+	}
+	// Tables may be partitioned by year, quarter, or month, and all of the
+	// partitions within the year are archived.
+	var parts []catalog.Partition
+	for _, p := range cat.Partitions(table) {
+		if p.Start.Year() == opt.Year {
+			parts = append(parts, p)
+		}
+	}
+	if len(parts) == 0 {
+		return fmt.Errorf("table %q has no history partition for year %d", opt.Table, opt.Year)
+	}
+
+	columns := tableColumns(cat.TableSchema(&table))
+	for _, p := range parts {
+		path := filepath.Join(opt.Dir, table.Schema+"."+table.Table+"__."+p.Name+".parquet")
+		eout.Info("archiving %s to %s", catalog.PartitionTable(table, p.Name).SQL(), path)
+		n, err := writeFile(dp, table, p.Start, p.End, columns, path)
+		if err != nil {
+			return err
+		}
+		if err = recordArchive(dp, table, p.Name, path, n, false); err != nil {
+			return err
+		}
+		eout.Info("archived %d rows", n)
+		if !opt.Drop {
+			continue
+		}
+		// The partition is recreated, empty, if current records started
+		// within it, and in that case it is not recorded as dropped.
+		recreated, err := cat.DropPartition(table, p)
+		if err != nil {
+			return err
+		}
+		if recreated {
+			eout.Info("dropped %s and created it again for current records",
+				catalog.PartitionTable(table, p.Name).SQL())
+			continue
+		}
+		eout.Info("dropped %s", catalog.PartitionTable(table, p.Name).SQL())
+		if err = recordArchive(dp, table, p.Name, path, n, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFile writes the non-current records of a table whose __start is
+// within [start, end) to a Parquet file.  The file is written under a
+// temporary name and renamed when it is complete.
+func writeFile(dp *pgxpool.Pool, table dbx.Table, start, end time.Time, columns []column, path string) (int64, error) {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return 0, fmt.Errorf("creating file: %w", err)
+	}
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(tmp)
+	}()
+	exprs := make([]string, len(columns))
+	for i, c := range columns {
+		exprs[i] = c.expr
+	}
+	// A single transaction provides a consistent snapshot of the
+	// partitions.
+	tx, err := dp.BeginTx(context.TODO(), pgx.TxOptions{AccessMode: pgx.ReadOnly, IsoLevel: pgx.RepeatableRead})
+	if err != nil {
+		return 0, err
+	}
+	defer dbx.Rollback(tx)
+	history := catalog.HistoryTable(table).SQL()
+	rows, err := tx.Query(context.TODO(), "SELECT "+strings.Join(exprs, ", ")+" FROM "+history+
+		" WHERE __start >= $1 AND __start < $2 ORDER BY __id, __start", start, end)
+	if err != nil {
+		return 0, fmt.Errorf("selecting from table %s: %w", history, err)
+	}
+	defer rows.Close()
+	n, err := write(f, columns, func() ([]any, error) {
+		if !rows.Next() {
+			return nil, rows.Err()
+		}
+		return rows.Values()
+	})
+	if err != nil {
+		return 0, fmt.Errorf("writing table %s: %w", history, err)
+	}
+	if err = f.Close(); err != nil {
+		return 0, fmt.Errorf("closing file: %w", err)
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		return 0, fmt.Errorf("renaming file: %w", err)
+	}
+	return n, nil
+}
+
+func recordArchive(dq dbx.Queryable, table dbx.Table, partition string, path string, rows int64, dropped bool) error {
+	q := "INSERT INTO metadb.archive (schema_name, table_name, partition_name, path, row_count, archived, dropped) " +
+		"VALUES ($1, $2, $3, $4, $5, now(), $6) ON CONFLICT (schema_name, table_name, partition_name) " +
+		"DO UPDATE SET path=EXCLUDED.path, row_count=EXCLUDED.row_count, archived=EXCLUDED.archived, dropped=EXCLUDED.dropped"
+	if _, err := dq.Exec(context.TODO(), q, table.Schema, table.Table, partition, path, rows, dropped); err != nil {
+		return fmt.Errorf("writing to table metadb.archive: %w", err)
+	}
+	return nil
+}
+
+// column defines how a table column is selected and written to Parquet.
+type column struct {
+	name string
+	expr string       // SQL expression that selects the value
+	node parquet.Node // Parquet type
+}
+
+// tableColumns returns the columns of a table, given the column map from
+// the catalog.  The Metadb system columns are first, followed by the data
+// columns in order of their names.
+func tableColumns(schema map[string]string) []column {
+	columns := []column{
+		makeColumn("__id", "bigint"),
+		makeColumn("__start", "timestamptz"),
+		makeColumn("__end", "timestamptz"),
+		makeColumn("__current", "boolean"),
+		makeColumn("__origin", "text"),
+	}
+	names := make([]string, 0, len(schema))
+	for name := range schema {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		columns = append(columns, makeColumn(name, schema[name]))
+	}
+	return columns
+}
+
+// makeColumn maps a column and its database type to a Parquet type.  Types
+// that have no direct equivalent, such as numeric and arrays, are written as
+// strings.  Infinite dates and timestamps are written as null.
+func makeColumn(name, dataType string) column {
+	c := "\"" + name + "\""
+	dtype, size := types.MakeDataType(dataType)
+	switch dtype {
+	case types.BooleanType:
+		return column{name: name, expr: c, node: parquet.Optional(parquet.Leaf(parquet.BooleanType))}
+	case types.IntegerType:
+		if size == 8 {
+			return column{name: name, expr: c + "::bigint", node: parquet.Optional(parquet.Int(64))}
+		}
+		return column{name: name, expr: c + "::integer", node: parquet.Optional(parquet.Int(32))}
+	case types.FloatType:
+		return column{name: name, expr: c + "::double precision", node: parquet.Optional(parquet.Leaf(parquet.DoubleType))}
+	case types.DateType:
+		return column{name: name, expr: "CASE WHEN isfinite(" + c + ") THEN " + c + " - DATE '1970-01-01' END",
+			node: parquet.Optional(parquet.Date())}
+	case types.TimestampType, types.TimestamptzType:
+		return column{name: name,
+			expr: "CASE WHEN isfinite(" + c + ") THEN (extract(epoch FROM " + c + ") * 1000000)::bigint END",
+			node: parquet.Optional(parquet.TimestampAdjusted(parquet.Microsecond, dtype == types.TimestamptzType))}
+	case types.JSONType:
+		return column{name: name, expr: c + "::text", node: parquet.Optional(parquet.JSON())}
+	case types.ByteaType:
+		return column{name: name, expr: c, node: parquet.Optional(parquet.Leaf(parquet.ByteArrayType))}
+	default:
+		return column{name: name, expr: c + "::text", node: parquet.Optional(parquet.String())}
+	}
+}
+
+// write writes rows to a Parquet file, reading each row from next until it
+// returns nil, and returns the number of rows written.
+func write(w io.Writer, columns []column, next func() ([]any, error)) (int64, error) {
+	group := make(parquet.Group)
+	for _, c := range columns {
+		group[c.name] = c.node
+	}
+	schema := parquet.NewSchema("metadb", group)
+	// Leaf columns of a group are ordered by name.
+	index := make(map[string]int)
+	for i, f := range schema.Fields() {
+		index[f.Name()] = i
+	}
+	pw := parquet.NewWriter(w, schema, parquet.Compression(&parquet.Zstd))
+	var n int64
+	row := make(parquet.Row, len(columns))
+	for {
+		values, err := next()
+		if err != nil {
+			return 0, err
+		}
+		if values == nil {
+			break
+		}
+		for i, v := range values {
+			j := index[columns[i].name]
+			pv, err := parquetValue(v)
+			if err != nil {
+				return 0, fmt.Errorf("column %q: %w", columns[i].name, err)
+			}
+			if v != nil && pv.Kind() != columns[i].node.Type().Kind() {
+				return 0, fmt.Errorf("column %q: value of type %T does not match %s", columns[i].name, v,
+					columns[i].node.Type())
+			}
+			if v == nil {
+				row[j] = pv.Level(0, 0, j)
+			} else {
+				row[j] = pv.Level(0, 1, j)
+			}
+		}
+		if _, err = pw.WriteRows([]parquet.Row{row}); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	if err := pw.Close(); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func parquetValue(v any) (parquet.Value, error) {
+	switch v := v.(type) {
+	case nil:
+		return parquet.NullValue(), nil
+	case bool:
+		return parquet.BooleanValue(v), nil
+	case int32:
+		return parquet.Int32Value(v), nil
+	case int64:
+		return parquet.Int64Value(v), nil
+	case float64:
+		return parquet.DoubleValue(v), nil
+	case string:
+		return parquet.ByteArrayValue([]byte(v)), nil
+	case []byte:
+		return parquet.ByteArrayValue(v), nil
+	default:
+		return parquet.Value{}, fmt.Errorf("unexpected value type %T", v)
+	}
+}
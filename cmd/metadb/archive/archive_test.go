@@ -0,0 +1,85 @@
+package archive
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+func TestWrite(t *testing.T) {
+	columns := tableColumns(map[string]string{
+		"id":      "uuid",
+		"count":   "integer",
+		"price":   "numeric",
+		"created": "date",
+	})
+	data := [][]any{
+		{int64(1), int64(1700000000000000), int64(1710000000000000), false, "", int32(5), int32(19000), "a", "1.50"},
+		{int64(2), int64(1700000000000000), nil, true, "", nil, nil, "b", nil},
+	}
+	var buf bytes.Buffer
+	i := 0
+	n, err := write(&buf, columns, func() ([]any, error) {
+		if i == len(data) {
+			return nil, nil
+		}
+		i++
+		return data[i-1], nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("rows written = %d, want 2", n)
+	}
+
+	f, err := parquet.OpenFile(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.NumRows() != 2 {
+		t.Fatalf("rows read = %d, want 2", f.NumRows())
+	}
+	index := make(map[string]int)
+	for i, field := range f.Schema().Fields() {
+		index[field.Name()] = i
+	}
+	rows := make([]parquet.Row, 2)
+	r := parquet.NewReader(bytes.NewReader(buf.Bytes()))
+	if _, err = r.ReadRows(rows); err != nil && err != io.EOF {
+		t.Fatal(err)
+	}
+	value := func(row int, name string) parquet.Value { return rows[row][index[name]] }
+	if got := value(0, "__id").Int64(); got != 1 {
+		t.Errorf("__id = %d, want 1", got)
+	}
+	if got := value(0, "count").Int32(); got != 5 {
+		t.Errorf("count = %d, want 5", got)
+	}
+	if got := string(value(0, "price").ByteArray()); got != "1.50" {
+		t.Errorf("price = %q, want \"1.50\"", got)
+	}
+	if got := value(0, "created").Int32(); got != 19000 {
+		t.Errorf("created = %d, want 19000", got)
+	}
+	if !value(1, "__end").IsNull() || !value(1, "count").IsNull() || !value(1, "price").IsNull() {
+		t.Errorf("row 2: expected null values: %v", rows[1])
+	}
+	if !value(1, "__current").Boolean() {
+		t.Error("__current = false, want true")
+	}
+
+	data[0][5] = "5"
+	i = 0
+	if _, err = write(io.Discard, columns, func() ([]any, error) {
+		if i == len(data) {
+			return nil, nil
+		}
+		i++
+		return data[i-1], nil
+	}); err == nil {
+		t.Error("mismatched value type: expected error")
+	}
+}
@@ -111,6 +111,28 @@ type ListStmt struct {
 func (*ListStmt) node()     {}
 func (*ListStmt) stmtNode() {}
 
+// DeadLetterStmt retries or discards dead letters.  If ID is 0, the
+// statement applies to all dead letters, or to those of DataSourceName if
+// it is not empty.
+type DeadLetterStmt struct {
+	Action         string // "retry" or "discard"
+	ID             int64
+	DataSourceName string
+}
+
+func (*DeadLetterStmt) node()     {}
+func (*DeadLetterStmt) stmtNode() {}
+
+// PreviewTableStmt shows how a table name in a data source is mapped to a
+// table in Metadb.
+type PreviewTableStmt struct {
+	TableName      string
+	DataSourceName string
+}
+
+func (*PreviewTableStmt) node()     {}
+func (*PreviewTableStmt) stmtNode() {}
+
 type RefreshInferredColumnTypesStmt struct {
 }
 
@@ -135,6 +157,40 @@ type AlterTableAlterColumnStmt struct {
 func (*AlterTableAlterColumnStmt) node()     {}
 func (*AlterTableAlterColumnStmt) stmtNode() {}
 
+// AlterTableSetPrimaryKeyStmt sets the primary key override of a table,
+// either as a list of columns or, if RowHash is true, as a hash of all
+// columns.
+type AlterTableSetPrimaryKeyStmt struct {
+	TableName string
+	Columns   []string
+	RowHash   bool
+}
+
+func (*AlterTableSetPrimaryKeyStmt) node()     {}
+func (*AlterTableSetPrimaryKeyStmt) stmtNode() {}
+
+type AlterTableDropPrimaryKeyStmt struct {
+	TableName string
+}
+
+func (*AlterTableDropPrimaryKeyStmt) node()     {}
+func (*AlterTableDropPrimaryKeyStmt) stmtNode() {}
+
+type AlterTableSetHistoryRetentionStmt struct {
+	TableName string
+	Retention string
+}
+
+func (*AlterTableSetHistoryRetentionStmt) node()     {}
+func (*AlterTableSetHistoryRetentionStmt) stmtNode() {}
+
+type AlterTableDropHistoryRetentionStmt struct {
+	TableName string
+}
+
+func (*AlterTableDropHistoryRetentionStmt) node()     {}
+func (*AlterTableDropHistoryRetentionStmt) stmtNode() {}
+
 type VerifyConsistencyStmt struct {
 }
 
@@ -224,3 +280,18 @@ type AlterSystemStmt struct {
 
 func (*AlterSystemStmt) node()     {}
 func (*AlterSystemStmt) stmtNode() {}
+
+type BeginStmt struct{}
+
+func (*BeginStmt) node()     {}
+func (*BeginStmt) stmtNode() {}
+
+type CommitStmt struct{}
+
+func (*CommitStmt) node()     {}
+func (*CommitStmt) stmtNode() {}
+
+type RollbackStmt struct{}
+
+func (*RollbackStmt) node()     {}
+func (*RollbackStmt) stmtNode() {}
@@ -0,0 +1,40 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+	"github.com/metadb-project/metadb/cmd/metadb/util"
+)
+
+// AsOfFunction returns the SQL name of the function that selects the rows
+// of a table that were current at a specified time.
+func AsOfFunction(table *dbx.Table) string {
+	return "\"" + table.Schema + "\".\"" + table.Table + "__asof\""
+}
+
+// CreateAsOfFunction creates or replaces the "as of" function for a table.
+// The function takes a time as an optional argument; if it is NULL, the
+// time is read from the session setting metadb.asof, or otherwise the
+// current time is used.  The function returns the row type of the table
+// and its body is planned when it is called, so columns that are added to
+// the table later are included without replacing the function.
+func CreateAsOfFunction(dq dbx.Queryable, table *dbx.Table) error {
+	t := "coalesce($1, nullif(current_setting('metadb.asof', true), '')::timestamptz, now())"
+	q := "CREATE OR REPLACE FUNCTION " + AsOfFunction(table) + "(asof timestamptz DEFAULT NULL) " +
+		"RETURNS SETOF " + table.MainSQL() + " LANGUAGE sql STABLE AS $$ " +
+		"SELECT * FROM " + table.MainSQL() + " WHERE __start <= " + t + " AND __end > " + t + " $$"
+	if _, err := dq.Exec(context.TODO(), q); err != nil {
+		return fmt.Errorf("creating function %s: %w", AsOfFunction(table), util.PGErr(err))
+	}
+	return nil
+}
+
+func dropAsOfFunction(dq dbx.Queryable, table *dbx.Table) error {
+	q := "DROP FUNCTION IF EXISTS " + AsOfFunction(table) + "(timestamptz)"
+	if _, err := dq.Exec(context.TODO(), q); err != nil {
+		return fmt.Errorf("dropping function %s: %w", AsOfFunction(table), util.PGErr(err))
+	}
+	return nil
+}
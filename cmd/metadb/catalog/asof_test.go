@@ -0,0 +1,112 @@
+package catalog
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+)
+
+func testConn(t *testing.T) *pgx.Conn {
+	db, err := dbx.TestDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db == nil {
+		t.Skipf("%s not set", dbx.TestDatabaseEnv)
+	}
+	dc, err := db.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dbx.Close(dc) })
+	return dc
+}
+
+// asOf returns the values of column v of the rows selected by a query,
+// in order.
+func asOf(t *testing.T, dc *pgx.Conn, q string, args ...any) []string {
+	t.Helper()
+	rows, err := dc.Query(context.Background(), q, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestAsOfFunction(t *testing.T) {
+	dc := testConn(t)
+	ctx := context.Background()
+	drop := func() {
+		_, _ = dc.Exec(ctx, "DROP SCHEMA IF EXISTS metadb_test CASCADE")
+	}
+	drop()
+	t.Cleanup(drop)
+	for _, q := range []string{
+		"CREATE SCHEMA metadb_test",
+		"CREATE TABLE metadb_test.t__ (__id bigint GENERATED BY DEFAULT AS IDENTITY, " +
+			"__start timestamptz NOT NULL, __end timestamptz NOT NULL, __current boolean NOT NULL, " +
+			"__origin varchar(63) NOT NULL DEFAULT '', v text)",
+		"INSERT INTO metadb_test.t__ (__start, __end, __current, v) VALUES " +
+			"('2020-01-01Z', '2020-02-01Z', FALSE, 'a'), " +
+			"('2020-02-01Z', '9999-12-31Z', TRUE, 'b')",
+	} {
+		if _, err := dc.Exec(ctx, q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	table := &dbx.Table{Schema: "metadb_test", Table: "t"}
+	if err := CreateAsOfFunction(dc, table); err != nil {
+		t.Fatal(err)
+	}
+	f := AsOfFunction(table)
+	// A row is current from __start up to but not including __end.
+	tests := []struct {
+		asof string
+		want []string
+	}{
+		{"2019-12-31Z", nil},
+		{"2020-01-01Z", []string{"a"}},
+		{"2020-01-31Z", []string{"a"}},
+		{"2020-02-01Z", []string{"b"}},
+	}
+	for _, tt := range tests {
+		if got := asOf(t, dc, "SELECT v FROM "+f+"($1)", tt.asof); !slices.Equal(got, tt.want) {
+			t.Errorf("%s(%s) = %v; want %v", f, tt.asof, got, tt.want)
+		}
+	}
+	// Without an argument, the time is read from metadb.asof, or
+	// otherwise the current time is used.
+	if got := asOf(t, dc, "SELECT v FROM "+f+"()"); !slices.Equal(got, []string{"b"}) {
+		t.Errorf("%s() = %v; want [b]", f, got)
+	}
+	if _, err := dc.Exec(ctx, "SET metadb.asof = '2020-01-15Z'"); err != nil {
+		t.Fatal(err)
+	}
+	if got := asOf(t, dc, "SELECT v FROM "+f+"()"); !slices.Equal(got, []string{"a"}) {
+		t.Errorf("%s() with metadb.asof = %v; want [a]", f, got)
+	}
+	if got := asOf(t, dc, "SELECT v FROM "+f+"($1)", "2020-03-01Z"); !slices.Equal(got, []string{"b"}) {
+		t.Errorf("%s(2020-03-01Z) with metadb.asof = %v; want [b]", f, got)
+	}
+	if _, err := dc.Exec(ctx, "RESET metadb.asof"); err != nil {
+		t.Fatal(err)
+	}
+	// Columns added to the table are returned without replacing the
+	// function.
+	if _, err := dc.Exec(ctx, "ALTER TABLE metadb_test.t__ ADD COLUMN w text"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dc.Exec(ctx, "UPDATE metadb_test.t__ SET w = v || v"); err != nil {
+		t.Fatal(err)
+	}
+	if got := asOf(t, dc, "SELECT w FROM "+f+"()"); !slices.Equal(got, []string{"bb"}) {
+		t.Errorf("%s() after adding column = %v; want [bb]", f, got)
+	}
+}
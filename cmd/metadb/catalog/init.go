@@ -19,17 +19,26 @@ import (
 
 var catalogSchema = "metadb"
 
-var ExecMutex sync.Mutex
+// ExecMutex serializes changes to tables made while executing commands with
+// other changes to the tables.  Commands that are applied by concurrent
+// workers hold a read lock; all other uses hold the write lock.
+var ExecMutex sync.RWMutex
+
+// SchemaMutex serializes schema changes made while executing commands, which
+// may be applied by concurrent workers.
+var SchemaMutex sync.Mutex
 
 type Catalog struct {
 	mu                 sync.Mutex
 	tableDir           map[dbx.Table]tableEntry
-	partYears          map[string]map[int]struct{}
+	partitions         map[dbx.Table]map[string]Partition
+	granularity        map[dbx.Table]string
 	columns            map[dbx.Column]string
 	indexes            map[dbx.Column]struct{}
 	origins            []string
 	config             map[string]string
 	jsonTransform      map[types.JSONPath]string
+	primaryKeys        map[dbx.Table]*PrimaryKeyOverride
 	lastSnapshotRecord time.Time
 	dp                 *pgxpool.Pool
 	lz4                bool
@@ -65,7 +74,7 @@ func Initialize(db *dbx.DB, dp *pgxpool.Pool) (*Catalog, error) {
 	if err := c.initTableDir(); err != nil {
 		return nil, err
 	}
-	if err := c.initPartYears(); err != nil {
+	if err := c.initPartitions(); err != nil {
 		return nil, err
 	}
 	if err := c.initSchema(); err != nil {
@@ -83,12 +92,34 @@ func Initialize(db *dbx.DB, dp *pgxpool.Pool) (*Catalog, error) {
 	if err := c.initJSON(); err != nil {
 		return nil, err
 	}
+	if err := c.initPrimaryKeyOverrides(); err != nil {
+		return nil, err
+	}
 	c.initSnapshot()
 	c.lz4 = isLZ4Available(c.dp)
 
 	return c, nil
 }
 
+// ReloadDefinitions reads the JSON mappings and primary key overrides from
+// the database.  It is called after a transaction block that changed them is
+// committed.
+func (c *Catalog) ReloadDefinitions() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.initJSON(); err != nil {
+		return err
+	}
+	return c.initPrimaryKeyOverrides()
+}
+
+// inTransaction returns true if a database connection is in a transaction
+// block, in which case changes made by the connection are not yet visible
+// and are not applied to the in-memory catalog.
+func inTransaction(dc *pgx.Conn) bool {
+	return dc.PgConn().TxStatus() != 'I'
+}
+
 func isLZ4Available(dq dbx.Queryable) bool {
 	var c string
 	q := "SHOW default_toast_compression"
@@ -148,12 +179,17 @@ type systemTableDef struct {
 
 var systemTables = []systemTableDef{
 	{table: dbx.Table{Schema: catalogSchema, Table: "acl"}, create: createTableACL},
+	{table: dbx.Table{Schema: catalogSchema, Table: "archive"}, create: createTableArchive},
 	{table: dbx.Table{Schema: catalogSchema, Table: "auth"}, create: createTableAuth},
+	{table: dbx.Table{Schema: catalogSchema, Table: "change_log"}, create: createTableChangeLog},
 	{table: dbx.Table{Schema: catalogSchema, Table: "config"}, create: createTableConfig},
+	{table: dbx.Table{Schema: catalogSchema, Table: "dead_letter"}, create: createTableDeadLetter},
+	{table: dbx.Table{Schema: catalogSchema, Table: "history_retention"}, create: createTableHistoryRetention},
 	{table: dbx.Table{Schema: catalogSchema, Table: "init"}, create: createTableInit},
 	{table: dbx.Table{Schema: catalogSchema, Table: "log"}, create: createTableLog},
 	{table: dbx.Table{Schema: catalogSchema, Table: "maintenance"}, create: createTableMaintenance},
 	{table: dbx.Table{Schema: catalogSchema, Table: "origin"}, create: createTableOrigin},
+	{table: dbx.Table{Schema: catalogSchema, Table: "primary_key_override"}, create: createTablePrimaryKeyOverride},
 	{table: dbx.Table{Schema: catalogSchema, Table: "source"}, create: createTableSource},
 	{table: dbx.Table{Schema: catalogSchema, Table: "table_update"}, create: createTableUpdate},
 	{table: dbx.Table{Schema: catalogSchema, Table: "base_table"}, create: createTableBaseTable},
@@ -254,17 +290,101 @@ func createTableConfig(tx pgx.Tx) error {
 		return fmt.Errorf("creating table "+catalogSchema+".config: %w", err)
 	}
 	q = "INSERT INTO " + catalogSchema + ".config (parameter, value) VALUES " +
+		"('allow_unmasked_events', 'false'), " +
+		"('apply_concurrency', '1'), " +
 		"('checkpoint_segment_size', '3000'), " +
+		"('client_auth_method', 'scram-sha-256'), " +
+		"('client_database_names', 'metadb'), " +
 		"('external_sql_folio', ''), " +
 		"('external_sql_reshare', ''), " +
 		"('kafka_sync_concurrency', '1'), " +
-		"('max_poll_interval', '1800000')"
+		"('max_poll_interval', '1800000'), " +
+		"('retry_initial_interval', '10'), " +
+		"('retry_max_interval', '86400')"
 	if _, err := tx.Exec(context.TODO(), q); err != nil {
 		return fmt.Errorf("writing to table "+catalogSchema+".config: %w", err)
 	}
 	return nil
 }
 
+func createTableDeadLetter(tx pgx.Tx) error {
+	q := "CREATE TABLE " + catalogSchema + ".dead_letter (" +
+		"id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY, " +
+		"source_name text NOT NULL, " +
+		"topic text NOT NULL, " +
+		"position text NOT NULL, " +
+		"key bytea, " +
+		"value bytea, " +
+		"stage text NOT NULL CHECK (stage IN ('parse', 'apply')), " +
+		"error text NOT NULL, " +
+		"attempts integer NOT NULL DEFAULT 1, " +
+		"retry boolean NOT NULL DEFAULT FALSE, " +
+		"created timestamptz NOT NULL DEFAULT now(), " +
+		"updated timestamptz NOT NULL DEFAULT now())"
+	if _, err := tx.Exec(context.TODO(), q); err != nil {
+		return fmt.Errorf("creating table "+catalogSchema+".dead_letter: %w", err)
+	}
+	return nil
+}
+
+func createTablePrimaryKeyOverride(tx pgx.Tx) error {
+	q := "CREATE TABLE " + catalogSchema + ".primary_key_override (" +
+		"schema_name varchar(63) NOT NULL, " +
+		"table_name varchar(63) NOT NULL, " +
+		"column_names text[], " +
+		"row_hash boolean NOT NULL DEFAULT FALSE, " +
+		"PRIMARY KEY (schema_name, table_name))"
+	if _, err := tx.Exec(context.TODO(), q); err != nil {
+		return fmt.Errorf("creating table "+catalogSchema+".primary_key_override: %w", err)
+	}
+	return nil
+}
+
+func createTableArchive(tx pgx.Tx) error {
+	q := "CREATE TABLE " + catalogSchema + ".archive (" +
+		"schema_name varchar(63) NOT NULL, " +
+		"table_name varchar(63) NOT NULL, " +
+		"partition_name text NOT NULL, " +
+		"path text NOT NULL, " +
+		"row_count bigint NOT NULL, " +
+		"archived timestamptz NOT NULL, " +
+		"dropped boolean NOT NULL, " +
+		"PRIMARY KEY (schema_name, table_name, partition_name))"
+	if _, err := tx.Exec(context.TODO(), q); err != nil {
+		return fmt.Errorf("creating table "+catalogSchema+".archive: %w", err)
+	}
+	return nil
+}
+
+func createTableChangeLog(tx pgx.Tx) error {
+	q := "CREATE TABLE " + catalogSchema + ".change_log (" +
+		"id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY, " +
+		"source_name text NOT NULL, " +
+		"operation text NOT NULL CHECK (operation IN ('merge', 'delete', 'truncate')), " +
+		"schema_name varchar(63) NOT NULL, " +
+		"table_name varchar(63) NOT NULL, " +
+		"primary_key jsonb, " +
+		"__id bigint, " +
+		"source_timestamp timestamptz NOT NULL, " +
+		"commit_time timestamptz NOT NULL DEFAULT now())"
+	if _, err := tx.Exec(context.TODO(), q); err != nil {
+		return fmt.Errorf("creating table "+catalogSchema+".change_log: %w", err)
+	}
+	return nil
+}
+
+func createTableHistoryRetention(tx pgx.Tx) error {
+	q := "CREATE TABLE " + catalogSchema + ".history_retention (" +
+		"schema_name varchar(63) NOT NULL, " +
+		"table_name varchar(63) NOT NULL, " +
+		"retention text NOT NULL, " +
+		"PRIMARY KEY (schema_name, table_name))"
+	if _, err := tx.Exec(context.TODO(), q); err != nil {
+		return fmt.Errorf("creating table "+catalogSchema+".history_retention: %w", err)
+	}
+	return nil
+}
+
 func createTableInit(tx pgx.Tx) error {
 	q := "CREATE TABLE " + catalogSchema + ".init (" +
 		"dbversion integer NOT NULL)"
@@ -318,18 +438,36 @@ func createTableOrigin(tx pgx.Tx) error {
 func createTableSource(tx pgx.Tx) error {
 	q := "CREATE TABLE " + catalogSchema + ".source (" +
 		"name text PRIMARY KEY, " +
+		"type text NOT NULL DEFAULT 'kafka', " +
 		"enable boolean NOT NULL, " +
 		"brokers text, " +
 		"security text, " +
 		"topics text, " +
 		"consumer_group text, " +
+		"schema_registry text, " +
+		"flattened text, " +
+		"schemaless text, " +
+		"dead_letter text, " +
+		"dead_letter_topic text, " +
 		"schema_pass_filter text, " +
 		"schema_stop_filter text, " +
 		"table_stop_filter text, " +
+		"column_stop_filter text, " +
+		"column_mask text, " +
+		"column_mask_salt text, " +
+		"schema_rename text, " +
+		"table_rename text, " +
 		"trim_schema_prefix text, " +
 		"add_schema_prefix text, " +
 		"map_public_schema text, " +
 		"module text, " +
+		"path text, " +
+		"connection text, " +
+		"publication text, " +
+		"slot text, " +
+		"history_retention text, " +
+		"change_log text, " +
+		"position text, " +
 		"sync smallint NOT NULL DEFAULT 1)"
 	if _, err := tx.Exec(context.TODO(), q); err != nil {
 		return fmt.Errorf("creating table "+catalogSchema+".source: %w", err)
@@ -358,7 +496,8 @@ func createTableBaseTable(tx pgx.Tx) error {
 		"source_name varchar(63) NOT NULL, " +
 		"transformed boolean NOT NULL, " +
 		"parent_schema_name varchar(63) NOT NULL, " +
-		"parent_table_name varchar(63) NOT NULL)"
+		"parent_table_name varchar(63) NOT NULL, " +
+		"partition_granularity text NOT NULL DEFAULT 'year')"
 	if _, err := tx.Exec(context.TODO(), q); err != nil {
 		return fmt.Errorf("creating table "+catalogSchema+".base_table: %w", err)
 	}
@@ -39,28 +39,39 @@ func (c *Catalog) JSONPathLookup(path types.JSONPath) string {
 	return c.jsonTransform[path]
 }
 
-func (c *Catalog) DefineJSONMapping(schema, table, column, path, mapping string) error {
+// DefineJSONMapping writes a JSON mapping using the database connection dc.
+// If dc is in a transaction block, the mapping takes effect when
+// ReloadDefinitions is called after the transaction is committed.
+func (c *Catalog) DefineJSONMapping(dc *pgx.Conn, schema, table, column, path, mapping string) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	if err := writeJSONMapping(c, schema, table, column, path, mapping); err != nil {
+	if err := writeJSONMapping(dc, schema, table, column, path, mapping); err != nil {
 		return err
 	}
+	if inTransaction(dc) {
+		return nil
+	}
 	c.jsonTransform[types.NewJSONPath(schema, table, column, path)] = mapping
 	return nil
 }
 
-func (c *Catalog) RemoveJSONMapping(schema, table, column, path string) error {
+// RemoveJSONMapping deletes a JSON mapping using the database connection dc,
+// with the same handling of transaction blocks as DefineJSONMapping.
+func (c *Catalog) RemoveJSONMapping(dc *pgx.Conn, schema, table, column, path string) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	if err := deleteJSONMapping(c, schema, table, column, path); err != nil {
+	if err := deleteJSONMapping(dc, schema, table, column, path); err != nil {
 		return err
 	}
+	if inTransaction(dc) {
+		return nil
+	}
 	delete(c.jsonTransform, types.NewJSONPath(schema, table, column, path))
 	return nil
 }
 
-func writeJSONMapping(c *Catalog, schema, table, column, path, mapping string) error {
-	if _, err := c.dp.Exec(context.TODO(),
+func writeJSONMapping(dc *pgx.Conn, schema, table, column, path, mapping string) error {
+	if _, err := dc.Exec(context.TODO(),
 		"INSERT INTO metadb.transform_json (schema_name, table_name, column_name, path, map) VALUES ($1, $2, $3, $4, $5)",
 		schema, table, column, path, mapping); err != nil {
 		if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
@@ -72,10 +83,10 @@ func writeJSONMapping(c *Catalog, schema, table, column, path, mapping string) e
 	return nil
 }
 
-func deleteJSONMapping(c *Catalog, schema, table, column, path string) error {
+func deleteJSONMapping(dc *pgx.Conn, schema, table, column, path string) error {
 	// confirm the mapping exists
 	var i int64
-	err := c.dp.QueryRow(context.TODO(), "SELECT 1 FROM metadb.transform_json WHERE schema_name=$1 AND table_name=$2 AND column_name=$3 AND path=$4",
+	err := dc.QueryRow(context.TODO(), "SELECT 1 FROM metadb.transform_json WHERE schema_name=$1 AND table_name=$2 AND column_name=$3 AND path=$4",
 		schema, table, column, path).Scan(&i)
 	switch {
 	case err == pgx.ErrNoRows:
@@ -87,7 +98,7 @@ func deleteJSONMapping(c *Catalog, schema, table, column, path string) error {
 		// NOP - the mapping was found
 	}
 	// delete the mapping
-	if _, err := c.dp.Exec(context.TODO(),
+	if _, err := dc.Exec(context.TODO(),
 		"DELETE FROM metadb.transform_json WHERE schema_name=$1 AND table_name=$2 AND column_name=$3 AND path=$4",
 		schema, table, column, path); err != nil {
 		return util.PGErr(err)
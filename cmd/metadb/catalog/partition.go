@@ -0,0 +1,312 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+)
+
+// Granularities of history partitions.  Non-current records of a table are
+// stored in partitions divided by __start, each covering a calendar year,
+// quarter, or month.
+const (
+	GranularityYear    = "year"
+	GranularityQuarter = "quarter"
+	GranularityMonth   = "month"
+)
+
+// CheckGranularity returns an error if g is not a valid granularity.
+func CheckGranularity(g string) error {
+	switch g {
+	case GranularityYear, GranularityQuarter, GranularityMonth:
+		return nil
+	default:
+		return fmt.Errorf("invalid partition granularity %q", g)
+	}
+}
+
+// Partition is a history partition of a table, which stores non-current
+// records whose __start is within [Start, End).  Name is the suffix of the
+// partition table name, which has the form YYYY for a year, YYYYqN for a
+// quarter, or YYYYmMM for a month.
+type Partition struct {
+	Name  string
+	Start time.Time
+	End   time.Time
+}
+
+// PartitionPeriod returns the partition of a granularity that contains a
+// time.
+func PartitionPeriod(granularity string, t time.Time) Partition {
+	t = t.UTC()
+	year := t.Year()
+	switch granularity {
+	case GranularityQuarter:
+		q := (int(t.Month()) - 1) / 3
+		start := time.Date(year, time.Month(q*3+1), 1, 0, 0, 0, 0, time.UTC)
+		return Partition{Name: fmt.Sprintf("%dq%d", year, q+1), Start: start, End: start.AddDate(0, 3, 0)}
+	case GranularityMonth:
+		start := time.Date(year, t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return Partition{Name: fmt.Sprintf("%dm%02d", year, int(t.Month())), Start: start, End: start.AddDate(0, 1, 0)}
+	default:
+		start := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+		return Partition{Name: strconv.Itoa(year), Start: start, End: start.AddDate(1, 0, 0)}
+	}
+}
+
+// ParsePartitionName returns the partition having a name.
+func ParsePartitionName(name string) (Partition, error) {
+	if len(name) < 4 {
+		return Partition{}, fmt.Errorf("invalid partition name %q", name)
+	}
+	year, err := strconv.Atoi(name[:4])
+	if err != nil {
+		return Partition{}, fmt.Errorf("invalid partition name %q", name)
+	}
+	var p Partition
+	switch {
+	case len(name) == 4:
+		p = PartitionPeriod(GranularityYear, time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC))
+	case len(name) == 6 && name[4] == 'q' && name[5] >= '1' && name[5] <= '4':
+		month := time.Month(int(name[5]-'1')*3 + 1)
+		p = PartitionPeriod(GranularityQuarter, time.Date(year, month, 1, 0, 0, 0, 0, time.UTC))
+	case len(name) == 7 && name[4] == 'm':
+		month, err := strconv.Atoi(name[5:])
+		if err != nil || month < 1 || month > 12 {
+			return Partition{}, fmt.Errorf("invalid partition name %q", name)
+		}
+		p = PartitionPeriod(GranularityMonth, time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC))
+	default:
+		return Partition{}, fmt.Errorf("invalid partition name %q", name)
+	}
+	if p.Name != name {
+		return Partition{}, fmt.Errorf("invalid partition name %q", name)
+	}
+	return p, nil
+}
+
+// PartitionTable returns the name of a history partition of a table.
+func PartitionTable(table dbx.Table, name string) dbx.Table {
+	return dbx.Table{Schema: table.Schema, Table: "zzz___" + table.Table + "___" + name}
+}
+
+// HistoryTable returns the name of the partitioned table that contains the
+// history partitions of a table.
+func HistoryTable(table dbx.Table) dbx.Table {
+	return dbx.Table{Schema: table.Schema, Table: "zzz___" + table.Table + "___"}
+}
+
+func (c *Catalog) initPartitions() error {
+	q := "SELECT t.schema_name, t.table_name, ic.relname " +
+		"FROM " + catalogSchema + ".base_table t " +
+		"JOIN pg_class c ON 'zzz___'||t.table_name||'___'=c.relname " +
+		"JOIN pg_namespace n ON c.relnamespace=n.oid AND t.schema_name=n.nspname " +
+		"JOIN pg_partitioned_table p ON c.oid=p.partrelid " +
+		"JOIN pg_inherits i ON p.partrelid=i.inhparent " +
+		"JOIN pg_class ic ON i.inhrelid=ic.oid"
+	rows, err := c.dp.Query(context.TODO(), q)
+	if err != nil {
+		return fmt.Errorf("selecting partitions: %w", err)
+	}
+	defer rows.Close()
+	parts := make(map[dbx.Table]map[string]Partition)
+	for rows.Next() {
+		var table dbx.Table
+		var relname string
+		if err := rows.Scan(&table.Schema, &table.Table, &relname); err != nil {
+			return fmt.Errorf("reading partitions: %w", err)
+		}
+		p, err := ParsePartitionName(strings.TrimPrefix(relname, "zzz___"+table.Table+"___"))
+		if err != nil {
+			return fmt.Errorf("invalid partition: %s.%s", table.Schema, relname)
+		}
+		m, ok := parts[table]
+		if !ok {
+			m = make(map[string]Partition)
+			parts[table] = m
+		}
+		m[p.Name] = p
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("reading partitions: %w", err)
+	}
+	rows.Close()
+
+	q = "SELECT schema_name, table_name, partition_granularity FROM " + catalogSchema + ".base_table " +
+		"WHERE partition_granularity<>'" + GranularityYear + "'"
+	rows, err = c.dp.Query(context.TODO(), q)
+	if err != nil {
+		return fmt.Errorf("selecting partition granularity: %w", err)
+	}
+	defer rows.Close()
+	granularity := make(map[dbx.Table]string)
+	for rows.Next() {
+		var table dbx.Table
+		var g string
+		if err := rows.Scan(&table.Schema, &table.Table, &g); err != nil {
+			return fmt.Errorf("reading partition granularity: %w", err)
+		}
+		granularity[table] = g
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("reading partition granularity: %w", err)
+	}
+	c.partitions = parts
+	c.granularity = granularity
+	return nil
+}
+
+// PartitionGranularity returns the granularity of the history partitions of
+// a table.
+func (c *Catalog) PartitionGranularity(table dbx.Table) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.partitionGranularity(table)
+}
+
+func (c *Catalog) partitionGranularity(table dbx.Table) string {
+	if g, ok := c.granularity[table]; ok {
+		return g
+	}
+	return GranularityYear
+}
+
+// AddPartition creates the history partition of a table that contains a
+// time, according to the granularity of the table.
+func (c *Catalog) AddPartition(table dbx.Table, t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p := PartitionPeriod(c.partitionGranularity(table), t)
+	// Add partition in database.
+	if err := createPartition(c.dp, table, p); err != nil {
+		return err
+	}
+	// Update the cache.
+	m := c.partitions[table]
+	if m == nil {
+		m = make(map[string]Partition)
+		c.partitions[table] = m
+	}
+	m[p.Name] = p
+	return nil
+}
+
+func createPartition(dq dbx.Queryable, table dbx.Table, p Partition) error {
+	q := "CREATE TABLE " + PartitionTable(table, p.Name).SQL() +
+		" PARTITION OF " + HistoryTable(table).SQL() +
+		" FOR VALUES FROM ('" + p.Start.Format(time.DateOnly) + "') TO ('" + p.End.Format(time.DateOnly) + "')"
+	if _, err := dq.Exec(context.TODO(), q); err != nil {
+		return fmt.Errorf("creating partition: %w", err)
+	}
+	return nil
+}
+
+// PartitionExists returns true if a table has a history partition that
+// contains a time.
+func (c *Catalog) PartitionExists(table dbx.Table, t time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, p := range c.partitions[table] {
+		if !t.Before(p.Start) && t.Before(p.End) {
+			return true
+		}
+	}
+	return false
+}
+
+// Partitions returns the history partitions of a table, in order of time.
+func (c *Catalog) Partitions(table dbx.Table) []Partition {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var parts []Partition
+	for _, p := range c.partitions[table] {
+		parts = append(parts, p)
+	}
+	slices.SortFunc(parts, func(a, b Partition) int { return a.Start.Compare(b.Start) })
+	return parts
+}
+
+// Repartition changes the granularity of the history partitions of a table.
+// Each existing partition is detached and replaced by partitions of the new
+// granularity that cover the same period, and its records are copied into
+// them, all within a single transaction.  Since the server caches the list of
+// partitions, this should not be run while the server is running.
+func (c *Catalog) Repartition(table dbx.Table, granularity string) error {
+	if err := CheckGranularity(granularity); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.partitionGranularity(table) == granularity {
+		return nil
+	}
+	columns := []string{"__id", "__start", "__end", "__current", "__origin"}
+	for k := range c.columns {
+		if k.Schema == table.Schema && k.Table == table.Table {
+			columns = append(columns, "\""+k.Column+"\"")
+		}
+	}
+	collist := strings.Join(columns, ", ")
+	history := HistoryTable(table).SQL()
+	tx, err := c.dp.Begin(context.TODO())
+	if err != nil {
+		return fmt.Errorf("repartitioning table \"%s__\": %w", table.String(), err)
+	}
+	defer dbx.Rollback(tx)
+	// Partition names of different granularities never coincide, so the new
+	// partitions can be created before the old ones are dropped.
+	var oldParts []Partition
+	for _, p := range c.partitions[table] {
+		oldParts = append(oldParts, p)
+	}
+	slices.SortFunc(oldParts, func(a, b Partition) int { return a.Start.Compare(b.Start) })
+	for _, p := range oldParts {
+		q := "ALTER TABLE " + history + " DETACH PARTITION " + PartitionTable(table, p.Name).SQL()
+		if _, err = tx.Exec(context.TODO(), q); err != nil {
+			return fmt.Errorf("detaching partition %s: %w", PartitionTable(table, p.Name).SQL(), err)
+		}
+	}
+	parts := make(map[string]Partition)
+	for _, p := range oldParts {
+		for t := p.Start; t.Before(p.End); {
+			np := PartitionPeriod(granularity, t)
+			if _, ok := parts[np.Name]; !ok {
+				if err = createPartition(tx, table, np); err != nil {
+					return err
+				}
+				parts[np.Name] = np
+			}
+			t = np.End
+		}
+	}
+	for _, p := range oldParts {
+		part := PartitionTable(table, p.Name).SQL()
+		q := "INSERT INTO " + history + " (" + collist + ") SELECT " + collist + " FROM " + part
+		if _, err = tx.Exec(context.TODO(), q); err != nil {
+			return fmt.Errorf("copying partition %s: %w", part, err)
+		}
+		if _, err = tx.Exec(context.TODO(), "DROP TABLE "+part); err != nil {
+			return fmt.Errorf("dropping partition %s: %w", part, err)
+		}
+	}
+	q := "UPDATE " + catalogSchema + ".base_table SET partition_granularity=$1 WHERE schema_name=$2 AND table_name=$3"
+	if _, err = tx.Exec(context.TODO(), q, granularity, table.Schema, table.Table); err != nil {
+		return fmt.Errorf("writing partition granularity for table \"%s__\": %w", table.String(), err)
+	}
+	if err = tx.Commit(context.TODO()); err != nil {
+		return fmt.Errorf("repartitioning table \"%s__\": %w", table.String(), err)
+	}
+	// Update the cache.
+	c.partitions[table] = parts
+	if granularity == GranularityYear {
+		delete(c.granularity, table)
+	} else {
+		c.granularity[table] = granularity
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package catalog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPartitionPeriod(t *testing.T) {
+	tm := time.Date(2024, time.May, 17, 8, 30, 0, 0, time.UTC)
+	tests := []struct {
+		granularity string
+		name        string
+		start, end  string
+	}{
+		{GranularityYear, "2024", "2024-01-01", "2025-01-01"},
+		{GranularityQuarter, "2024q2", "2024-04-01", "2024-07-01"},
+		{GranularityMonth, "2024m05", "2024-05-01", "2024-06-01"},
+	}
+	for _, tt := range tests {
+		p := PartitionPeriod(tt.granularity, tm)
+		if p.Name != tt.name || p.Start.Format(time.DateOnly) != tt.start || p.End.Format(time.DateOnly) != tt.end {
+			t.Errorf("%s: got %s [%s, %s)", tt.granularity, p.Name, p.Start.Format(time.DateOnly),
+				p.End.Format(time.DateOnly))
+		}
+		q, err := ParsePartitionName(tt.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if q != p {
+			t.Errorf("%s: parsed %v, want %v", tt.name, q, p)
+		}
+	}
+	if p := PartitionPeriod(GranularityQuarter, time.Date(2024, time.December, 31, 23, 0, 0, 0, time.UTC)); p.Name != "2024q4" ||
+		p.End.Format(time.DateOnly) != "2025-01-01" {
+		t.Errorf("last quarter: got %s ending %s", p.Name, p.End.Format(time.DateOnly))
+	}
+	for _, name := range []string{"", "24", "2024q0", "2024q5", "2024m00", "2024m13", "2024m5", "2024x01", "sync"} {
+		if _, err := ParsePartitionName(name); err == nil {
+			t.Errorf("%q: expected error", name)
+		}
+	}
+}
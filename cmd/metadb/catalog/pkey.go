@@ -0,0 +1,91 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+)
+
+// PrimaryKeyOverride defines the primary key of a table, for change events
+// that do not have a key.  If RowHash is true, the key is a hash of all
+// columns; otherwise it consists of Columns.
+type PrimaryKeyOverride struct {
+	Columns []string
+	RowHash bool
+}
+
+func (c *Catalog) initPrimaryKeyOverrides() error {
+	q := "SELECT schema_name, table_name, column_names, row_hash FROM metadb.primary_key_override"
+	rows, err := c.dp.Query(context.TODO(), q)
+	if err != nil {
+		return fmt.Errorf("selecting primary key overrides: %w", err)
+	}
+	defer rows.Close()
+	pkeys := make(map[dbx.Table]*PrimaryKeyOverride)
+	for rows.Next() {
+		var t dbx.Table
+		var pk PrimaryKeyOverride
+		if err := rows.Scan(&t.Schema, &t.Table, &pk.Columns, &pk.RowHash); err != nil {
+			return fmt.Errorf("reading primary key overrides: %w", err)
+		}
+		pkeys[t] = &pk
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("reading primary key overrides: %w", err)
+	}
+	c.primaryKeys = pkeys
+	return nil
+}
+
+// PrimaryKeyOverride returns the primary key override for a table, or nil
+// if none is defined.
+func (c *Catalog) PrimaryKeyOverride(table dbx.Table) *PrimaryKeyOverride {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.primaryKeys[table]
+}
+
+// SetPrimaryKeyOverride defines or replaces the primary key override for a
+// table, using the database connection dc.  If dc is in a transaction block,
+// the override takes effect when ReloadDefinitions is called after the
+// transaction is committed.
+func (c *Catalog) SetPrimaryKeyOverride(dc *pgx.Conn, table dbx.Table, pk *PrimaryKeyOverride) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	q := "INSERT INTO metadb.primary_key_override (schema_name, table_name, column_names, row_hash) " +
+		"VALUES ($1, $2, $3, $4) ON CONFLICT (schema_name, table_name) " +
+		"DO UPDATE SET column_names=EXCLUDED.column_names, row_hash=EXCLUDED.row_hash"
+	if _, err := dc.Exec(context.TODO(), q, table.Schema, table.Table, pk.Columns, pk.RowHash); err != nil {
+		return fmt.Errorf("writing primary key override for table \"%s__\": %w", table.String(), err)
+	}
+	if inTransaction(dc) {
+		return nil
+	}
+	if c.primaryKeys == nil {
+		c.primaryKeys = make(map[dbx.Table]*PrimaryKeyOverride)
+	}
+	c.primaryKeys[table] = pk
+	return nil
+}
+
+// DropPrimaryKeyOverride removes the primary key override for a table, with
+// the same handling of transaction blocks as SetPrimaryKeyOverride.
+func (c *Catalog) DropPrimaryKeyOverride(dc *pgx.Conn, table dbx.Table) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	q := "DELETE FROM metadb.primary_key_override WHERE schema_name=$1 AND table_name=$2"
+	tag, err := dc.Exec(context.TODO(), q, table.Schema, table.Table)
+	if err != nil {
+		return fmt.Errorf("removing primary key override for table \"%s__\": %w", table.String(), err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("primary key override for table \"%s__\" does not exist", table.String())
+	}
+	if inTransaction(dc) {
+		return nil
+	}
+	delete(c.primaryKeys, table)
+	return nil
+}
@@ -0,0 +1,194 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+)
+
+// HistoryRetention is a policy that limits how long non-current records are
+// retained.  Either Years is the number of calendar years of history to
+// keep, including the current year, or Before is a date such that records
+// that started before it may be removed.  Since history partitions are
+// divided by __start, a policy applies to whole partitions.
+type HistoryRetention struct {
+	Years  int
+	Before time.Time
+}
+
+// ParseHistoryRetention parses a retention policy, which is either a
+// positive number of years or a date in the form YYYY-MM-DD.
+func ParseHistoryRetention(s string) (HistoryRetention, error) {
+	if years, err := strconv.Atoi(s); err == nil {
+		if years < 1 {
+			return HistoryRetention{}, fmt.Errorf("history retention must be at least 1 year: %q", s)
+		}
+		return HistoryRetention{Years: years}, nil
+	}
+	before, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return HistoryRetention{}, fmt.Errorf("invalid history retention %q", s)
+	}
+	return HistoryRetention{Before: before}, nil
+}
+
+// Expired reports whether a history partition that ends at the specified
+// end time may be removed under the policy, at the time now.  A partition is
+// expired only if it ends on or before the first day of the oldest year to
+// keep, or on or before the date.
+func (r HistoryRetention) Expired(end, now time.Time) bool {
+	if r.Years > 0 {
+		keep := time.Date(now.UTC().Year()-r.Years+1, time.January, 1, 0, 0, 0, 0, time.UTC)
+		return !end.After(keep)
+	}
+	return !end.After(r.Before)
+}
+
+// TableRetention is the retention policy in effect for a table, which is
+// the table's own policy if defined, or otherwise the policy of its data
+// source.
+type TableRetention struct {
+	Table     dbx.Table
+	Retention string
+}
+
+// HistoryRetentionPolicies returns the retention policies that are in effect
+// for tables.  Tables without a policy are not included.
+func HistoryRetentionPolicies(dq dbx.Queryable) ([]TableRetention, error) {
+	q := "SELECT b.schema_name, b.table_name, coalesce(r.retention, s.history_retention) " +
+		"FROM " + catalogSchema + ".base_table b " +
+		"LEFT JOIN " + catalogSchema + ".history_retention r " +
+		"ON b.schema_name=r.schema_name AND b.table_name=r.table_name " +
+		"LEFT JOIN " + catalogSchema + ".source s ON b.source_name=s.name " +
+		"WHERE coalesce(r.retention, s.history_retention) IS NOT NULL " +
+		"ORDER BY b.schema_name, b.table_name"
+	rows, err := dq.Query(context.TODO(), q)
+	if err != nil {
+		return nil, fmt.Errorf("selecting history retention policies: %w", err)
+	}
+	defer rows.Close()
+	var policies []TableRetention
+	for rows.Next() {
+		var t TableRetention
+		if err := rows.Scan(&t.Table.Schema, &t.Table.Table, &t.Retention); err != nil {
+			return nil, fmt.Errorf("reading history retention policies: %w", err)
+		}
+		policies = append(policies, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading history retention policies: %w", err)
+	}
+	return policies, nil
+}
+
+// SetHistoryRetention defines or replaces the retention policy for a table,
+// which overrides the policy of its data source.  It is written using the
+// database connection dc, which may be in a transaction block.
+func (c *Catalog) SetHistoryRetention(dc *pgx.Conn, table dbx.Table, retention string) error {
+	q := "INSERT INTO " + catalogSchema + ".history_retention (schema_name, table_name, retention) " +
+		"VALUES ($1, $2, $3) ON CONFLICT (schema_name, table_name) " +
+		"DO UPDATE SET retention=EXCLUDED.retention"
+	if _, err := dc.Exec(context.TODO(), q, table.Schema, table.Table, retention); err != nil {
+		return fmt.Errorf("writing history retention for table \"%s__\": %w", table.String(), err)
+	}
+	return nil
+}
+
+// DropHistoryRetention removes the retention policy for a table.
+func (c *Catalog) DropHistoryRetention(dc *pgx.Conn, table dbx.Table) error {
+	q := "DELETE FROM " + catalogSchema + ".history_retention WHERE schema_name=$1 AND table_name=$2"
+	tag, err := dc.Exec(context.TODO(), q, table.Schema, table.Table)
+	if err != nil {
+		return fmt.Errorf("removing history retention for table \"%s__\": %w", table.String(), err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("history retention for table \"%s__\" does not exist", table.String())
+	}
+	return nil
+}
+
+// DropPartition detaches and drops a history partition of a table.  A
+// current record moves to the partition containing its __start when it
+// becomes non-current; so if the current table has records that started
+// within the partition, an empty partition is created in place of the
+// dropped one, and true is returned.  Otherwise the partition is removed
+// from the cache, and if records are later written to it, it is created
+// again by AddPartition.
+func (c *Catalog) DropPartition(table dbx.Table, p Partition) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	part := PartitionTable(table, p.Name).SQL()
+	tx, err := c.dp.Begin(context.TODO())
+	if err != nil {
+		return false, fmt.Errorf("dropping partition %s: %w", part, err)
+	}
+	defer dbx.Rollback(tx)
+	q := "ALTER TABLE " + HistoryTable(table).SQL() + " DETACH PARTITION " + part
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return false, fmt.Errorf("detaching partition %s: %w", part, err)
+	}
+	q = "DROP TABLE " + part
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return false, fmt.Errorf("dropping partition %s: %w", part, err)
+	}
+	var current bool
+	q = "SELECT EXISTS (SELECT 1 FROM " + table.SQL() + " WHERE __start >= $1 AND __start < $2)"
+	if err = tx.QueryRow(context.TODO(), q, p.Start, p.End).Scan(&current); err != nil {
+		return false, fmt.Errorf("checking current records for partition %s: %w", part, err)
+	}
+	if current {
+		if err = createPartition(tx, table, p); err != nil {
+			return false, err
+		}
+	}
+	if err = tx.Commit(context.TODO()); err != nil {
+		return false, fmt.Errorf("dropping partition %s: %w", part, err)
+	}
+	if !current {
+		delete(c.partitions[table], p.Name)
+	}
+	return current, nil
+}
+
+// HistoryPartition is a history partition of a table that has a retention
+// policy.
+type HistoryPartition struct {
+	Table dbx.Table
+	Partition
+	Retention string
+	Expired   bool
+}
+
+// SQL returns the SQL name of the partition.
+func (p HistoryPartition) SQL() string {
+	return PartitionTable(p.Table, p.Name).SQL()
+}
+
+// HistoryPartitions returns the history partitions of tables that have a
+// retention policy, and whether each one has expired at the specified time.
+func (c *Catalog) HistoryPartitions(dq dbx.Queryable, now time.Time) ([]HistoryPartition, error) {
+	policies, err := HistoryRetentionPolicies(dq)
+	if err != nil {
+		return nil, err
+	}
+	var parts []HistoryPartition
+	for _, p := range policies {
+		r, err := ParseHistoryRetention(p.Retention)
+		if err != nil {
+			return nil, fmt.Errorf("table \"%s__\": %w", p.Table.String(), err)
+		}
+		for _, part := range c.Partitions(p.Table) {
+			parts = append(parts, HistoryPartition{
+				Table:     p.Table,
+				Partition: part,
+				Retention: p.Retention,
+				Expired:   r.Expired(part.End, now),
+			})
+		}
+	}
+	return parts, nil
+}
@@ -0,0 +1,128 @@
+package catalog
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+)
+
+func TestHistoryRetention(t *testing.T) {
+	now := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		retention string
+		partition string
+		expired   bool
+	}{
+		{"1", "2026", false},
+		{"1", "2025", true},
+		{"1", "2025m12", true},
+		{"1", "2026m01", false},
+		{"3", "2024", false},
+		{"3", "2023", true},
+		{"3", "2023q4", true},
+		{"2024-01-01", "2023", true},
+		{"2024-01-01", "2024", false},
+		{"2024-06-30", "2023", true},
+		{"2024-06-30", "2024", false},
+		{"2024-06-30", "2024m05", true},
+		{"2024-06-30", "2024q2", false},
+		{"2024-07-01", "2024q2", true},
+	}
+	for _, tt := range tests {
+		r, err := ParseHistoryRetention(tt.retention)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.retention, err)
+		}
+		p, err := ParsePartitionName(tt.partition)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.Expired(p.End, now); got != tt.expired {
+			t.Errorf("%s: partition %s: expired = %v, want %v", tt.retention, tt.partition, got, tt.expired)
+		}
+	}
+	for _, s := range []string{"", "0", "-2", "2024-13-01", "ten"} {
+		if _, err := ParseHistoryRetention(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
+
+func TestDropPartition(t *testing.T) {
+	dp := testPool(t)
+	ctx := context.Background()
+	drop := func() {
+		_, _ = dp.Exec(ctx, "DROP SCHEMA IF EXISTS metadb_test CASCADE")
+	}
+	drop()
+	t.Cleanup(drop)
+	for _, q := range []string{
+		"CREATE SCHEMA metadb_test",
+		"CREATE TABLE metadb_test.t__ (__id bigint GENERATED BY DEFAULT AS IDENTITY, " +
+			"__start timestamptz NOT NULL, __end timestamptz NOT NULL, __current boolean NOT NULL, " +
+			"__origin varchar(63) NOT NULL DEFAULT '', v text) PARTITION BY LIST (__current)",
+		"CREATE TABLE metadb_test.t PARTITION OF metadb_test.t__ FOR VALUES IN (TRUE)",
+		"CREATE TABLE metadb_test.zzz___t___ PARTITION OF metadb_test.t__ FOR VALUES IN (FALSE) " +
+			"PARTITION BY RANGE (__start)",
+	} {
+		if _, err := dp.Exec(ctx, q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	table := dbx.Table{Schema: "metadb_test", Table: "t"}
+	c := &Catalog{dp: dp, partitions: make(map[dbx.Table]map[string]Partition)}
+	for _, year := range []int{2020, 2021} {
+		if err := c.AddPartition(table, time.Date(year, time.June, 1, 0, 0, 0, 0, time.UTC)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	q := "INSERT INTO metadb_test.t__ (__start, __end, __current, v) VALUES " +
+		"('2020-06-01Z', '2021-06-01Z', FALSE, 'a'), " +
+		"('2021-06-01Z', '9999-12-31Z', TRUE, 'b')"
+	if _, err := dp.Exec(ctx, q); err != nil {
+		t.Fatal(err)
+	}
+	// A partition is dropped and removed from the cache if no current
+	// records started within it.
+	recreated, err := c.DropPartition(table, PartitionPeriod(GranularityYear, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recreated || c.PartitionExists(table, time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("partition 2020: recreated = %v; want false and removed from cache", recreated)
+	}
+	// Otherwise an empty partition is created in its place.
+	recreated, err = c.DropPartition(table, PartitionPeriod(GranularityYear, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !recreated || !c.PartitionExists(table, time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("partition 2021: recreated = %v; want true and kept in cache", recreated)
+	}
+	var n int
+	if err = dp.QueryRow(ctx, "SELECT count(*) FROM "+PartitionTable(table, "2021").SQL()).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("recreated partition has %d rows; want 0", n)
+	}
+}
+
+func testPool(t *testing.T) *pgxpool.Pool {
+	db, err := dbx.TestDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db == nil {
+		t.Skipf("%s not set", dbx.TestDatabaseEnv)
+	}
+	dp, err := dbx.NewPool(context.Background(), db.ConnString(db.User, db.Password))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(dp.Close)
+	return dp
+}
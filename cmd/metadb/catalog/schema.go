@@ -41,8 +41,11 @@ func (c *Catalog) initSchema() error {
 
 func getColumnSchemas(dp *pgxpool.Pool) ([]*sqlx.ColumnSchema, error) {
 	cs := make([]*sqlx.ColumnSchema, 0)
+	// The type of an array column is written as the element type followed
+	// by "[]", as in types.DataTypeToSQL.
 	rows, err := dp.Query(context.TODO(), ""+
-		"SELECT table_schema, left(table_name, -2) table_name, column_name, data_type, character_maximum_length "+
+		"SELECT table_schema, left(table_name, -2) table_name, column_name, "+
+		"CASE WHEN data_type='ARRAY' THEN substr(udt_name, 2)||'[]' ELSE data_type END, character_maximum_length "+
 		"FROM information_schema.columns "+
 		"WHERE lower(table_schema) NOT IN ('information_schema', 'pg_catalog')"+
 		" AND right(table_name, 2) = '__'"+
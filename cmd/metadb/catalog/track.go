@@ -127,6 +127,21 @@ func (c *Catalog) AllTables(source string) []dbx.Table {
 	return all
 }
 
+// RootTable returns the table from which a table is transformed, following
+// parent tables to the root.  A table that is not transformed is its own
+// root.
+func (c *Catalog) RootTable(table dbx.Table) dbx.Table {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		e, ok := c.tableDir[table]
+		if !ok || !e.transformed {
+			return table
+		}
+		table = e.parentTable
+	}
+}
+
 func (c *Catalog) TraverseDescendantTables(table dbx.Table, process func(level int, table dbx.Table)) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -173,6 +188,9 @@ func (c *Catalog) CreateNewTable(table *dbx.Table, transformed bool, parentTable
 	if err := createMainTableIfNotExists(c, table); err != nil {
 		return fmt.Errorf("creating new table %q: %v", table, err)
 	}
+	if err := CreateAsOfFunction(c.dp, table); err != nil {
+		return fmt.Errorf("creating new table %q: %v", table, err)
+	}
 	if err := addTableEntry(c, table, transformed, parentTable, source); err != nil {
 		return fmt.Errorf("creating new table %q: %v", table, err)
 	}
@@ -186,6 +204,9 @@ func (c *Catalog) DropTable(dq dbx.Queryable, table *dbx.Table) error {
 	if err := removeTableEntry(c, dq, table); err != nil {
 		return err
 	}
+	if err := dropAsOfFunction(dq, table); err != nil {
+		return err
+	}
 	q := "DROP TABLE \"" + table.Schema + "\".\"" + table.Table + "__\""
 	if _, err := dq.Exec(context.TODO(), q); err != nil {
 		return util.PGErr(err)
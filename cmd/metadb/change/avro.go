@@ -0,0 +1,430 @@
+package change
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+// SchemaRegistry decodes Avro messages in the Confluent Schema Registry wire
+// format, fetching and caching their schemas from a registry.
+type SchemaRegistry struct {
+	url     string
+	client  *http.Client
+	mu      sync.Mutex
+	schemas map[uint32]*avroSchema
+}
+
+type avroSchema struct {
+	codec *goavro.Codec
+	// schema is the parsed schema, in which each "logicalType"
+	// attribute has been renamed to logicalTypeAttr, so that the codec
+	// decodes the underlying types.
+	schema any
+}
+
+// logicalTypeAttr is the name to which "logicalType" attributes are renamed.
+const logicalTypeAttr = "metadb.logicalType"
+
+// NewSchemaRegistry returns a schema registry client for the registry at the
+// specified URL.  The URL may include a user name and password for basic
+// authentication.
+func NewSchemaRegistry(url string) *SchemaRegistry {
+	return &SchemaRegistry{
+		url:     strings.TrimSuffix(url, "/"),
+		client:  &http.Client{Timeout: 30 * time.Second},
+		schemas: make(map[uint32]*avroSchema),
+	}
+}
+
+// Decode converts a message key or value from the wire format to JSON with
+// an embedded schema, in the form written by the Kafka Connect JSON
+// converter, so that it can be read by NewEvent.  Data not in the wire format
+// are returned unchanged.
+func (r *SchemaRegistry) Decode(data []byte) ([]byte, error) {
+	if len(data) == 0 || data[0] != 0 {
+		return data, nil
+	}
+	if len(data) < 5 {
+		return nil, fmt.Errorf("decoding avro: message too short")
+	}
+	id := binary.BigEndian.Uint32(data[1:5])
+	s, err := r.schema(id)
+	if err != nil {
+		return nil, err
+	}
+	native, _, err := s.codec.NativeFromBinary(data[5:])
+	if err != nil {
+		return nil, fmt.Errorf("decoding avro with schema %d: %w", id, err)
+	}
+	c := &avroConverter{names: make(map[string]avroNamed)}
+	schema, err := c.connectSchema(s.schema, "")
+	if err != nil {
+		return nil, fmt.Errorf("converting avro schema %d: %w", id, err)
+	}
+	payload, err := c.payload(s.schema, "", native)
+	if err != nil {
+		return nil, fmt.Errorf("converting avro data with schema %d: %w", id, err)
+	}
+	return json.Marshal(map[string]any{"schema": schema, "payload": payload})
+}
+
+// schema returns the schema with the specified ID, fetching it from the
+// registry if it is not cached.  Schemas are never changed once registered.
+func (r *SchemaRegistry) schema(id uint32) (*avroSchema, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if s, ok := r.schemas[id]; ok {
+		return s, nil
+	}
+	url := r.url + "/schemas/ids/" + strconv.FormatUint(uint64(id), 10)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("fetching schema %d: %w", id, err)
+	}
+	req.Header.Set("Accept", "application/vnd.schemaregistry.v1+json")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching schema %d: %w", id, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("fetching schema %d: %w", id, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching schema %d: %s: %s", id, resp.Status, strings.TrimSpace(string(body)))
+	}
+	var reply struct {
+		Schema     string `json:"schema"`
+		SchemaType string `json:"schemaType"`
+	}
+	if err = json.Unmarshal(body, &reply); err != nil {
+		return nil, fmt.Errorf("fetching schema %d: %w", id, err)
+	}
+	if reply.SchemaType != "" && reply.SchemaType != "AVRO" {
+		return nil, fmt.Errorf("fetching schema %d: unsupported schema type %q", id, reply.SchemaType)
+	}
+	var schema any
+	if err = json.Unmarshal([]byte(reply.Schema), &schema); err != nil {
+		return nil, fmt.Errorf("parsing schema %d: %w", id, err)
+	}
+	renameLogicalTypes(schema)
+	spec, err := json.Marshal(schema)
+	if err != nil {
+		return nil, fmt.Errorf("parsing schema %d: %w", id, err)
+	}
+	codec, err := goavro.NewCodec(string(spec))
+	if err != nil {
+		return nil, fmt.Errorf("parsing schema %d: %w", id, err)
+	}
+	s := &avroSchema{codec: codec, schema: schema}
+	r.schemas[id] = s
+	return s, nil
+}
+
+func renameLogicalTypes(schema any) {
+	switch s := schema.(type) {
+	case map[string]any:
+		if lt, ok := s["logicalType"]; ok {
+			s[logicalTypeAttr] = lt
+			delete(s, "logicalType")
+		}
+		for _, v := range s {
+			renameLogicalTypes(v)
+		}
+	case []any:
+		for _, v := range s {
+			renameLogicalTypes(v)
+		}
+	}
+}
+
+// avroConverter converts Avro schemas and data to Kafka Connect schemas and
+// payloads.
+type avroConverter struct {
+	// names maps the full names of named types to their definitions.
+	names map[string]avroNamed
+}
+
+type avroNamed struct {
+	schema    map[string]any
+	namespace string
+}
+
+// avroPrimitives maps Avro primitive types to Kafka Connect types.
+var avroPrimitives = map[string]string{
+	"boolean": "boolean",
+	"int":     "int32",
+	"long":    "int64",
+	"float":   "float",
+	"double":  "double",
+	"bytes":   "bytes",
+	"string":  "string",
+}
+
+// avroLogicalTypes maps Avro logical types to the semantic types used by
+// Debezium for the same data.
+var avroLogicalTypes = map[string]string{
+	"date":                   "io.debezium.time.Date",
+	"time-millis":            "io.debezium.time.Time",
+	"time-micros":            "io.debezium.time.MicroTime",
+	"timestamp-millis":       "io.debezium.time.Timestamp",
+	"timestamp-micros":       "io.debezium.time.MicroTimestamp",
+	"local-timestamp-millis": "io.debezium.time.Timestamp",
+	"local-timestamp-micros": "io.debezium.time.MicroTimestamp",
+	"decimal":                "org.apache.kafka.connect.data.Decimal",
+	"uuid":                   "io.debezium.data.Uuid",
+}
+
+// fullName returns the full name of a named type defined in a namespace, and
+// the namespace of the name.
+func fullName(def map[string]any, namespace string) (string, string) {
+	name, _ := def["name"].(string)
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		return name, name[:i]
+	}
+	if ns, ok := def["namespace"].(string); ok {
+		namespace = ns
+	}
+	if namespace == "" {
+		return name, ""
+	}
+	return namespace + "." + name, namespace
+}
+
+// lookup returns the definition of a named type.
+func (c *avroConverter) lookup(name, namespace string) (avroNamed, bool) {
+	if def, ok := c.names[name]; ok {
+		return def, true
+	}
+	def, ok := c.names[namespace+"."+name]
+	return def, ok
+}
+
+// connectSchema converts an Avro schema to a Kafka Connect schema.
+func (c *avroConverter) connectSchema(schema any, namespace string) (map[string]any, error) {
+	switch s := schema.(type) {
+	case string:
+		if t, ok := avroPrimitives[s]; ok {
+			return map[string]any{"type": t, "optional": false}, nil
+		}
+		def, ok := c.lookup(s, namespace)
+		if !ok {
+			return nil, fmt.Errorf("unknown type %q", s)
+		}
+		return c.connectSchema(def.schema, def.namespace)
+	case []any:
+		branch, err := unionBranch(s)
+		if err != nil {
+			return nil, err
+		}
+		cs, err := c.connectSchema(branch, namespace)
+		if err != nil {
+			return nil, err
+		}
+		cs["optional"] = true
+		return cs, nil
+	case map[string]any:
+		return c.connectComplexSchema(s, namespace)
+	default:
+		return nil, fmt.Errorf("invalid schema: %v", schema)
+	}
+}
+
+func (c *avroConverter) connectComplexSchema(s map[string]any, namespace string) (map[string]any, error) {
+	var cs map[string]any
+	switch t := s["type"].(type) {
+	case string:
+		switch t {
+		case "record", "error":
+			name, ns := fullName(s, namespace)
+			c.names[name] = avroNamed{schema: s, namespace: ns}
+			fields, _ := s["fields"].([]any)
+			var cfields []any
+			for _, f := range fields {
+				fm, ok := f.(map[string]any)
+				if !ok {
+					return nil, fmt.Errorf("invalid record field: %v", f)
+				}
+				cf, err := c.connectSchema(fm["type"], ns)
+				if err != nil {
+					return nil, err
+				}
+				cf["field"] = fm["name"]
+				cfields = append(cfields, cf)
+			}
+			cs = map[string]any{"type": "struct", "fields": cfields, "optional": false, "name": name}
+		case "enum":
+			name, ns := fullName(s, namespace)
+			c.names[name] = avroNamed{schema: s, namespace: ns}
+			cs = map[string]any{"type": "string", "optional": false}
+		case "fixed":
+			name, ns := fullName(s, namespace)
+			c.names[name] = avroNamed{schema: s, namespace: ns}
+			cs = map[string]any{"type": "bytes", "optional": false}
+		case "array":
+			items, err := c.connectSchema(s["items"], namespace)
+			if err != nil {
+				return nil, err
+			}
+			cs = map[string]any{"type": "array", "items": items, "optional": false}
+		case "map":
+			values, err := c.connectSchema(s["values"], namespace)
+			if err != nil {
+				return nil, err
+			}
+			cs = map[string]any{"type": "map", "keys": map[string]any{"type": "string", "optional": false},
+				"values": values, "optional": false}
+		default:
+			var err error
+			if cs, err = c.connectSchema(t, namespace); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		var err error
+		if cs, err = c.connectSchema(t, namespace); err != nil {
+			return nil, err
+		}
+	}
+	// Semantic types written by the Avro converter take precedence over
+	// Avro logical types.
+	if ct, ok := s["connect.type"].(string); ok {
+		cs["type"] = ct
+	}
+	if name, ok := s["connect.name"].(string); ok {
+		cs["name"] = name
+		if params, ok := s["connect.parameters"]; ok {
+			cs["parameters"] = params
+		}
+		return cs, nil
+	}
+	if lt, ok := s[logicalTypeAttr].(string); ok {
+		if name, ok := avroLogicalTypes[lt]; ok {
+			cs["name"] = name
+			if lt == "decimal" {
+				var scale int64
+				if v, ok := s["scale"].(float64); ok {
+					scale = int64(v)
+				}
+				cs["parameters"] = map[string]any{"scale": strconv.FormatInt(scale, 10)}
+			}
+		}
+	}
+	return cs, nil
+}
+
+// unionBranch returns the non-null branch of a union, which is expected to
+// represent an optional value.
+func unionBranch(union []any) (any, error) {
+	var branch any
+	for _, b := range union {
+		if b == "null" {
+			continue
+		}
+		if branch != nil {
+			return nil, fmt.Errorf("unsupported union: %v", union)
+		}
+		branch = b
+	}
+	if branch == nil {
+		return nil, fmt.Errorf("unsupported union: %v", union)
+	}
+	return branch, nil
+}
+
+// payload converts data decoded by goavro to the form of a Kafka Connect
+// payload.  Schemas must already have been converted by connectSchema, so
+// that named types are defined.
+func (c *avroConverter) payload(schema any, namespace string, value any) (any, error) {
+	if value == nil {
+		return nil, nil
+	}
+	switch s := schema.(type) {
+	case string:
+		if _, ok := avroPrimitives[s]; ok {
+			return value, nil
+		}
+		def, ok := c.lookup(s, namespace)
+		if !ok {
+			return nil, fmt.Errorf("unknown type %q", s)
+		}
+		return c.payload(def.schema, def.namespace, value)
+	case []any:
+		// goavro returns a non-null union value as a map from the
+		// name of the branch type to the value.
+		m, ok := value.(map[string]any)
+		if !ok || len(m) != 1 {
+			return nil, fmt.Errorf("unexpected union value: %v", value)
+		}
+		branch, err := unionBranch(s)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range m {
+			return c.payload(branch, namespace, v)
+		}
+	case map[string]any:
+		t, _ := s["type"].(string)
+		switch t {
+		case "record", "error":
+			_, ns := fullName(s, namespace)
+			m, ok := value.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("unexpected record value: %v", value)
+			}
+			fields, _ := s["fields"].([]any)
+			p := make(map[string]any, len(fields))
+			for _, f := range fields {
+				fm := f.(map[string]any)
+				name, _ := fm["name"].(string)
+				v, err := c.payload(fm["type"], ns, m[name])
+				if err != nil {
+					return nil, err
+				}
+				p[name] = v
+			}
+			return p, nil
+		case "array":
+			a, ok := value.([]any)
+			if !ok {
+				return nil, fmt.Errorf("unexpected array value: %v", value)
+			}
+			p := make([]any, len(a))
+			for i := range a {
+				var err error
+				if p[i], err = c.payload(s["items"], namespace, a[i]); err != nil {
+					return nil, err
+				}
+			}
+			return p, nil
+		case "map":
+			m, ok := value.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("unexpected map value: %v", value)
+			}
+			p := make(map[string]any, len(m))
+			for k, v := range m {
+				var err error
+				if p[k], err = c.payload(s["values"], namespace, v); err != nil {
+					return nil, err
+				}
+			}
+			return p, nil
+		case "enum", "fixed":
+			return value, nil
+		default:
+			return c.payload(s["type"], namespace, value)
+		}
+	}
+	return nil, fmt.Errorf("invalid schema: %v", schema)
+}
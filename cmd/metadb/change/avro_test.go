@@ -0,0 +1,137 @@
+package change
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+const testValueSchema = `{
+  "type": "record",
+  "name": "Envelope",
+  "namespace": "folio.diku_mod_users.users",
+  "fields": [
+    {"name": "before", "type": ["null", {
+      "type": "record",
+      "name": "Value",
+      "fields": [
+        {"name": "id", "type": {"type": "string", "connect.version": 1, "connect.name": "io.debezium.data.Uuid"}},
+        {"name": "active", "type": ["null", "boolean"], "default": null},
+        {"name": "created", "type": {"type": "long", "logicalType": "timestamp-micros"}},
+        {"name": "balance", "type": {"type": "bytes", "logicalType": "decimal", "precision": 10, "scale": 2}},
+        {"name": "level", "type": {"type": "int", "connect.type": "int16"}}
+      ]
+    }], "default": null},
+    {"name": "after", "type": ["null", "Value"], "default": null},
+    {"name": "source", "type": {
+      "type": "record",
+      "name": "Source",
+      "namespace": "io.debezium.connector.postgresql",
+      "fields": [
+        {"name": "ts_ms", "type": "long"},
+        {"name": "snapshot", "type": ["string", "null"]},
+        {"name": "schema", "type": "string"},
+        {"name": "table", "type": "string"}
+      ]
+    }},
+    {"name": "op", "type": "string"}
+  ]
+}`
+
+func TestSchemaRegistry(t *testing.T) {
+	requests := 0
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/schemas/ids/7" {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"schema": testValueSchema})
+	}))
+	defer registry.Close()
+
+	codec, err := goavro.NewCodec(testValueSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	avro, err := codec.BinaryFromNative([]byte{0, 0, 0, 0, 7}, map[string]any{
+		"before": nil,
+		"after": goavro.Union("folio.diku_mod_users.users.Value", map[string]any{
+			"id":      "6d3c8fd9-5d85-4a49-9f2b-54a2b8c3a0f1",
+			"active":  goavro.Union("boolean", true),
+			"created": created,
+			"balance": big.NewRat(1250, 100),
+			"level":   3,
+		}),
+		"source": map[string]any{
+			"ts_ms":    int64(1709294400000),
+			"snapshot": goavro.Union("string", "false"),
+			"schema":   "diku_mod_users",
+			"table":    "users",
+		},
+		"op": "c",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewSchemaRegistry(registry.URL + "/")
+	for i := 0; i < 2; i++ {
+		value, err := r.Decode(avro)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ce, err := NewEvent(&Message{Value: value})
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := ce.Value.Payload
+		if *p.Op != "c" || *p.Source.Table != "users" || *p.Source.TsMs != 1709294400000 {
+			t.Fatalf("payload = %v", p)
+		}
+		if p.After["active"] != true || p.After["created"] != float64(created.UnixMicro()) ||
+			p.After["level"] != float64(3) || p.After["balance"] != "BOI=" {
+			t.Errorf("payload after = %v", p.After)
+		}
+		var after map[string]any
+		for _, f := range ce.Value.Schema.Fields {
+			if f["field"] == "after" {
+				after = f
+			}
+		}
+		if after == nil || after["optional"] != true || after["name"] != "folio.diku_mod_users.users.Value" {
+			t.Fatalf("schema after = %v", after)
+		}
+		want := []struct{ typ, name string }{
+			{"string", "io.debezium.data.Uuid"},
+			{"boolean", ""},
+			{"int64", "io.debezium.time.MicroTimestamp"},
+			{"bytes", "org.apache.kafka.connect.data.Decimal"},
+			{"int16", ""},
+		}
+		for i, f := range after["fields"].([]any) {
+			m := f.(map[string]any)
+			name, _ := m["name"].(string)
+			if m["type"] != want[i].typ || name != want[i].name {
+				t.Errorf("schema field %v: type=%v name=%v; want %v", m["field"], m["type"], name, want[i])
+			}
+		}
+	}
+	if requests != 1 {
+		t.Errorf("registry requests = %d; want 1", requests)
+	}
+
+	// JSON is passed through unchanged.
+	if b, err := r.Decode([]byte(`{"a":1}`)); err != nil || string(b) != `{"a":1}` {
+		t.Errorf("Decode(json) = %s, %v", b, err)
+	}
+	if _, err = r.Decode([]byte{0, 0, 0, 0, 8, 0}); err == nil {
+		t.Error("Decode with unknown schema ID: expected error")
+	}
+}
@@ -3,9 +3,7 @@ package change
 import (
 	"encoding/json"
 	"fmt"
-
-	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
-	"github.com/metadb-project/metadb/cmd/metadb/util"
+	"strings"
 )
 
 type Event struct {
@@ -14,23 +12,45 @@ type Event struct {
 	Topic *string
 }
 
-func NewEvent(msg *kafka.Message) (*Event, error) {
+// Message is a change event message read from a source.
+type Message struct {
+	Key   []byte
+	Value []byte
+	Topic string
+	// Position identifies the location of the message within the
+	// source, such as a Kafka partition and offset.
+	Position string
+}
+
+func (m *Message) String() string {
+	var b strings.Builder
+	_, _ = fmt.Fprintf(&b, "topic = %s\n", m.Topic)
+	_, _ = fmt.Fprintf(&b, "position = %s\n", m.Position)
+	_, _ = fmt.Fprintf(&b, "key = %s\n", m.Key)
+	_, _ = fmt.Fprintf(&b, "value = %s\n", m.Value)
+	return b.String()
+}
+
+func NewEvent(msg *Message) (*Event, error) {
 	if msg == nil {
 		return nil, fmt.Errorf("creating change event: message is nil")
 	}
 	var ce = new(Event)
 	var err error
-	if msg.Key != nil && len(msg.Key) > 0 {
+	if len(msg.Key) > 0 {
 		if err = json.Unmarshal(msg.Key, &(ce.Key)); err != nil {
-			return nil, fmt.Errorf("change event key: %s\n%s", err, util.KafkaMessageString(msg))
+			return nil, fmt.Errorf("change event key: %s\n%s", err, msg)
 		}
 	}
-	if msg.Value != nil && len(msg.Value) > 0 {
+	if len(msg.Value) > 0 {
 		if err = json.Unmarshal(msg.Value, &(ce.Value)); err != nil {
-			return nil, fmt.Errorf("change event value: %s\n%s", err, util.KafkaMessageString(msg))
+			return nil, fmt.Errorf("change event value: %s\n%s", err, msg)
 		}
 	}
-	ce.Topic = msg.TopicPartition.Topic
+	if msg.Topic != "" {
+		topic := msg.Topic
+		ce.Topic = &topic
+	}
 	return ce, nil
 }
 
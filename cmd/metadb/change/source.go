@@ -0,0 +1,223 @@
+package change
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Source is a stream of change event messages.
+type Source interface {
+	// Read returns the next message, or nil if no message is available
+	// before the timeout expires.  It returns io.EOF if the source has no
+	// more messages.
+	Read(timeout time.Duration) (*Message, error)
+	// Commit records that the messages read so far have been processed,
+	// so that they will not be read again if the source is reopened.
+	Commit() error
+	// Close releases resources used by the source.
+	Close() error
+}
+
+// FileSource replays change events from a file, or from all files in a
+// directory in order of their names.  The files are in the format written by
+// the server option --logsource, where each message is written as a line
+// containing "#", followed by a line containing the key and a line
+// containing the value.
+type FileSource struct {
+	files  []string
+	index  int
+	file   *os.File
+	reader *bufio.Reader
+	// offset is the position in the current file following the last
+	// message read.
+	offset int64
+	// commit is called to store the position of the last message read.
+	commit func(position string) error
+}
+
+// NewFileSource opens a file or directory for reading change events,
+// resuming after the specified position if it is not "".  The commit function
+// is called to store the position of processed messages; it may be nil.
+func NewFileSource(path, position string, commit func(position string) error) (*FileSource, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening file source: %w", err)
+	}
+	var files []string
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, fmt.Errorf("opening file source: %w", err)
+		}
+		for _, e := range entries {
+			if e.Type().IsRegular() && !strings.HasPrefix(e.Name(), ".") {
+				files = append(files, filepath.Join(path, e.Name()))
+			}
+		}
+		slices.Sort(files)
+	} else {
+		files = []string{path}
+	}
+	s := &FileSource{files: files, commit: commit}
+	if position != "" {
+		if err = s.seek(position); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// seek moves to a position returned by Position.
+func (s *FileSource) seek(position string) error {
+	i := strings.LastIndexByte(position, ':')
+	if i < 0 {
+		return fmt.Errorf("invalid file source position %q", position)
+	}
+	name := position[:i]
+	offset, err := strconv.ParseInt(position[i+1:], 10, 64)
+	if err != nil || offset < 0 {
+		return fmt.Errorf("invalid file source position %q", position)
+	}
+	// Files are read in sorted order, so any file that sorts before the
+	// committed one has been fully read.
+	s.index, _ = slices.BinarySearchFunc(s.files, name, func(f, name string) int {
+		return strings.Compare(filepath.Base(f), name)
+	})
+	if s.index < len(s.files) && filepath.Base(s.files[s.index]) == name {
+		if err = s.open(); err != nil {
+			return err
+		}
+		if _, err = s.file.Seek(offset, io.SeekStart); err != nil {
+			return fmt.Errorf("reading file source: %w", err)
+		}
+		s.offset = offset
+	}
+	return nil
+}
+
+func (s *FileSource) open() error {
+	f, err := os.Open(s.files[s.index])
+	if err != nil {
+		return fmt.Errorf("reading file source: %w", err)
+	}
+	s.file = f
+	s.reader = bufio.NewReader(f)
+	s.offset = 0
+	return nil
+}
+
+// Read returns the next message.  The timeout is not used because reading a
+// file does not block.
+func (s *FileSource) Read(timeout time.Duration) (*Message, error) {
+	for s.index < len(s.files) {
+		if s.file == nil {
+			if err := s.open(); err != nil {
+				return nil, err
+			}
+		}
+		msg, err := s.readMessage()
+		if err == nil {
+			return msg, nil
+		}
+		if !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		_ = s.file.Close()
+		s.file = nil
+		s.index++
+		s.offset = 0
+	}
+	return nil, io.EOF
+}
+
+// readMessage reads the next message in the current file, skipping anything
+// that precedes the "#" line.
+func (s *FileSource) readMessage() (*Message, error) {
+	var position string
+	for {
+		position = s.Position()
+		line, err := s.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if line == "#" {
+			break
+		}
+	}
+	key, err := s.readLine()
+	if err != nil {
+		return nil, truncated(err)
+	}
+	value, err := s.readLine()
+	if err != nil {
+		return nil, truncated(err)
+	}
+	return &Message{Key: []byte(key), Value: []byte(value), Position: position}, nil
+}
+
+// readLine reads a line, without the line terminator.  It returns io.EOF if
+// the end of the file is reached before a complete line.
+func (s *FileSource) readLine() (string, error) {
+	line, err := s.reader.ReadString('\n')
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return "", io.EOF
+		}
+		return "", fmt.Errorf("reading file source: %w", err)
+	}
+	s.offset += int64(len(line))
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
+
+func truncated(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Position returns the current position as the file name and the offset
+// following the last message read.
+func (s *FileSource) Position() string {
+	if s.index >= len(s.files) {
+		if len(s.files) == 0 {
+			return ""
+		}
+		return filepath.Base(s.files[len(s.files)-1]) + ":" + strconv.FormatInt(s.endOffset(), 10)
+	}
+	return filepath.Base(s.files[s.index]) + ":" + strconv.FormatInt(s.offset, 10)
+}
+
+// endOffset returns the size of the last file.
+func (s *FileSource) endOffset() int64 {
+	info, err := os.Stat(s.files[len(s.files)-1])
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// Commit stores the current position.
+func (s *FileSource) Commit() error {
+	if s.commit == nil {
+		return nil
+	}
+	return s.commit(s.Position())
+}
+
+func (s *FileSource) Close() error {
+	if s.file != nil {
+		err := s.file.Close()
+		s.file = nil
+		return err
+	}
+	return nil
+}
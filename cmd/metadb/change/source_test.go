@@ -0,0 +1,66 @@
+package change
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileSource(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.log"), []byte("#\nk1\nv1\n#\nk2\nv2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "b.log"), []byte("#\n\nv3\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var committed string
+	commit := func(position string) error {
+		committed = position
+		return nil
+	}
+
+	s, err := NewFileSource(dir, "", commit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := s.Read(0)
+	if err != nil || string(msg.Key) != "k1" || string(msg.Value) != "v1" {
+		t.Fatalf("Read() = %v, %v; want k1, v1", msg, err)
+	}
+	if err = s.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if committed != "a.log:8" {
+		t.Errorf("committed position %q; want %q", committed, "a.log:8")
+	}
+	_ = s.Close()
+
+	// Resume after the committed position.
+	if s, err = NewFileSource(dir, committed, commit); err != nil {
+		t.Fatal(err)
+	}
+	var values []string
+	for {
+		msg, err = s.Read(0)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		values = append(values, string(msg.Key)+"="+string(msg.Value))
+	}
+	if len(values) != 2 || values[0] != "k2=v2" || values[1] != "=v3" {
+		t.Errorf("read %q; want [k2=v2 =v3]", values)
+	}
+	if err = s.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if committed != "b.log:6" {
+		t.Errorf("committed position %q; want %q", committed, "b.log:6")
+	}
+	_ = s.Close()
+}
@@ -3,6 +3,7 @@ package command
 import (
 	"container/list"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"math"
 	"math/big"
@@ -65,6 +66,12 @@ type Command struct {
 	Column          []CommandColumn
 	SourceTimestamp string
 	Subcommands     *list.List
+	// Previous is a command that must be executed before this one, such as
+	// deleting the old row of an update that changes a primary key override.
+	Previous *Command
+	// Message is the change event from which the command was parsed,
+	// if it is retained for dead letter handling.
+	Message *change.Message
 }
 
 func (c *Command) AddChild(child *Command) {
@@ -106,6 +113,9 @@ type CommandColumn struct {
 */
 
 func convertTypeSize(coltype string, datatype types.DataType) (int64, error) {
+	if datatype.IsArray() {
+		return convertTypeSize(coltype, datatype.Elem())
+	}
 	switch datatype {
 	case types.IntegerType:
 		switch coltype {
@@ -149,6 +159,10 @@ func convertTypeSize(coltype string, datatype types.DataType) (int64, error) {
 		return 0, nil
 	case types.JSONType:
 		return 0, nil
+	case types.ByteaType:
+		return 0, nil
+	case types.IntervalType:
+		return 0, nil
 	default:
 		return 0, fmt.Errorf("convert type size: unknown data type: %s", datatype)
 	}
@@ -184,7 +198,10 @@ func extractPrimaryKey(dedup *log.MessageSet, ce *change.Event) (map[string]int,
 	return primaryKey, nil
 }
 
-func extractColumns(dedup *log.MessageSet, ce *change.Event) ([]CommandColumn, error) {
+// extractColumns returns the columns of the row after a change.  If
+// override is true, the primary key is not read from the event key and is
+// left to be set from a primary key override.
+func extractColumns(dedup *log.MessageSet, ce *change.Event, override bool) ([]CommandColumn, error) {
 	var err error
 	var ok bool
 	// Extract field data from payload
@@ -224,6 +241,9 @@ func extractColumns(dedup *log.MessageSet, ce *change.Event) ([]CommandColumn, e
 	if afi, ok = af.([]interface{}); !ok {
 		return nil, fmt.Errorf("value: $.schema.fields: \"fields\" not expected type")
 	}
+	if override {
+		return fieldsColumns(afi, fieldData, map[string]int{}, false)
+	}
 	var primaryKey map[string]int
 	if primaryKey, err = extractPrimaryKey(dedup, ce); err != nil {
 		return nil, err
@@ -231,6 +251,14 @@ func extractColumns(dedup *log.MessageSet, ce *change.Event) ([]CommandColumn, e
 	if primaryKey == nil {
 		return nil, nil
 	}
+	return fieldsColumns(afi, fieldData, primaryKey, false)
+}
+
+// fieldsColumns returns columns for the fields described by a list of schema
+// fields, with data from a payload.  If flattened is true, fields that
+// contain metadata added to flattened events are skipped.
+func fieldsColumns(afi []any, fieldData map[string]any, primaryKey map[string]int, flattened bool) ([]CommandColumn, error) {
+	var ok bool
 	var column []CommandColumn
 	var i interface{}
 	for _, i = range afi {
@@ -265,36 +293,148 @@ func extractColumns(dedup *log.MessageSet, ce *change.Event) ([]CommandColumn, e
 			}
 		}
 
-		var col CommandColumn
-		col.Name = field
-		if col.DType, err = convertDataType(ftype, semtype); err != nil {
-			return nil, fmt.Errorf("value: $.schema.fields: \"type\": %s", err)
+		if flattened && strings.HasPrefix(field, "__") {
+			continue
 		}
-		col.Data = fieldData[field]
-		if (col.DType == types.TextType || col.DType == types.JSONType) && col.Data != nil {
-			// Large values (typically above 8 kB) in PostgreSQL that have been stored using
-			// the "TOAST" method are not included in an UPDATE change event where those
-			// values were not modified.
-			if col.Data.(string) == "__debezium_unavailable_value" {
-				col.Data = nil
-				col.Unavailable = true
-			}
+		col, err := fieldColumn(m, field, ftype, semtype, fieldData[field])
+		if err != nil {
+			return nil, err
 		}
-		if col.DType == types.NumericType && col.Data != nil {
-			if col.Data, err = decodeNumericBytes(m, col.Data, semtype); err != nil {
-				return nil, fmt.Errorf("decoding numeric bytes: %w", err)
+		col.PrimaryKey = primaryKey[field]
+		column = append(column, col)
+	}
+	return column, nil
+}
+
+// fieldColumn returns a column for a field described by a schema field map,
+// literal type, and semantic type.
+func fieldColumn(m map[string]any, field, ftype, semtype string, data any) (CommandColumn, error) {
+	var err error
+	var col CommandColumn
+	col.Name = field
+	if ftype == "array" {
+		return arrayColumn(m, field, data)
+	}
+	if col.DType, err = convertDataType(ftype, semtype); err != nil {
+		return CommandColumn{}, fmt.Errorf("value: $.schema.fields: \"type\": %s", err)
+	}
+	col.Data = data
+	if (col.DType == types.TextType || col.DType == types.JSONType) && col.Data != nil {
+		// Large values (typically above 8 kB) in PostgreSQL that have been stored using
+		// the "TOAST" method are not included in an UPDATE change event where those
+		// values were not modified.
+		if col.Data.(string) == "__debezium_unavailable_value" {
+			col.Data = nil
+			col.Unavailable = true
+		}
+	}
+	if col.DType == types.NumericType && col.Data != nil {
+		if col.Data, err = decodeNumericBytes(m, col.Data, semtype); err != nil {
+			return CommandColumn{}, fmt.Errorf("decoding numeric bytes: %w", err)
+		}
+	}
+	if strings.HasSuffix(semtype, ".data.Bits") && col.Data != nil {
+		if col.Data, err = decodeBits(m, col.Data); err != nil {
+			return CommandColumn{}, fmt.Errorf("decoding bits: %w", err)
+		}
+	}
+	if strings.HasPrefix(semtype, "io.debezium.data.geometry.") && col.Data != nil {
+		g, ok := col.Data.(map[string]any)
+		if !ok {
+			return CommandColumn{}, fmt.Errorf("geometry data \"%v\" has type %T", col.Data, col.Data)
+		}
+		col.Data = g["wkb"]
+	}
+	if col.SQLData, err = DataToSQLData(col.Data, col.DType, semtype); err != nil {
+		return CommandColumn{}, fmt.Errorf("value: $.payload.after: \"%s\": unknown type: %v", field, err)
+	}
+	if col.DTypeSize, err = convertTypeSize(ftype, col.DType); err != nil {
+		return CommandColumn{}, fmt.Errorf("value: $.payload.after: \"%s\": unknown type size: %v", field, err)
+	}
+	return col, nil
+}
+
+// arrayColumn returns a column for an array field.  The elements are
+// described by the "items" schema and must have a scalar type.
+func arrayColumn(m map[string]any, field string, data any) (CommandColumn, error) {
+	items, ok := m["items"].(map[string]any)
+	if !ok {
+		return CommandColumn{}, fmt.Errorf("value: $.schema.fields: \"items\" not found in array %q", field)
+	}
+	itype, ok := items["type"].(string)
+	if !ok {
+		return CommandColumn{}, fmt.Errorf("value: $.schema.fields: \"type\" not found in array %q", field)
+	}
+	isemtype, _ := items["name"].(string)
+	if itype == "array" || itype == "struct" || itype == "map" {
+		return CommandColumn{}, fmt.Errorf("value: $.schema.fields: unhandled array element type %q in %q",
+			itype, field)
+	}
+	dtype, err := convertDataType(itype, isemtype)
+	if err != nil {
+		return CommandColumn{}, fmt.Errorf("value: $.schema.fields: \"type\": %s", err)
+	}
+	col := CommandColumn{Name: field, DType: types.ArrayOf(dtype), Data: data}
+	if col.DTypeSize, err = convertTypeSize(itype, dtype); err != nil {
+		return CommandColumn{}, fmt.Errorf("value: $.payload.after: \"%s\": unknown type size: %v", field, err)
+	}
+	if data != nil {
+		elems, ok := data.([]any)
+		if !ok {
+			return CommandColumn{}, fmt.Errorf("value: $.payload.after: \"%s\": array data has type %T", field, data)
+		}
+		// Decode elements that are encoded as bytes.
+		decoded := make([]any, len(elems))
+		for i, e := range elems {
+			decoded[i] = e
+			if e == nil {
+				continue
+			}
+			switch {
+			case dtype == types.NumericType:
+				decoded[i], err = decodeNumericBytes(items, e, isemtype)
+			case strings.HasSuffix(isemtype, ".data.Bits"):
+				decoded[i], err = decodeBits(items, e)
+			}
+			if err != nil {
+				return CommandColumn{}, fmt.Errorf("value: $.payload.after: \"%s\": %w", field, err)
 			}
 		}
-		if col.SQLData, err = DataToSQLData(col.Data, col.DType, semtype); err != nil {
-			return nil, fmt.Errorf("value: $.payload.after: \"%s\": unknown type: %v", field, err)
+		col.Data = decoded
+	}
+	if col.SQLData, err = DataToSQLData(col.Data, col.DType, isemtype); err != nil {
+		return CommandColumn{}, fmt.Errorf("value: $.payload.after: \"%s\": unknown type: %v", field, err)
+	}
+	return col, nil
+}
+
+// decodeBits decodes a Bits value, which is encoded as bytes in
+// little-endian order, to a bit string.
+func decodeBits(fieldMap map[string]any, data any) (string, error) {
+	s, ok := data.(string)
+	if !ok {
+		return "", fmt.Errorf("bits data \"%v\" has type %T", data, data)
+	}
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", fmt.Errorf("bits data \"%v\": %w", data, err)
+	}
+	length := len(b) * 8
+	if p, ok := fieldMap["parameters"].(map[string]any); ok {
+		if l, ok := p["length"].(string); ok {
+			if length, err = strconv.Atoi(l); err != nil {
+				return "", fmt.Errorf("bits length %q: %w", l, err)
+			}
 		}
-		if col.DTypeSize, err = convertTypeSize(ftype, col.DType); err != nil {
-			return nil, fmt.Errorf("value: $.payload.after: \"%s\": unknown type size: %v", field, err)
+	}
+	bits := make([]byte, length)
+	for i := 0; i < length; i++ {
+		bits[length-1-i] = '0'
+		if i/8 < len(b) && b[i/8]&(1<<(i%8)) != 0 {
+			bits[length-1-i] = '1'
 		}
-		col.PrimaryKey = primaryKey[field]
-		column = append(column, col)
 	}
-	return column, nil
+	return string(bits), nil
 }
 
 func decodeNumericBytes(fieldMap map[string]any, data any, semtype string) (string, error) {
@@ -430,7 +570,8 @@ func structScale(data any) (int32, string, error) {
 }
 
 func NewCommand(cat *catalog.Catalog, dedup *log.MessageSet, ce *change.Event, schemaPassFilter, schemaStopFilter,
-	tableStopFilter []*regexp.Regexp, trimSchemaPrefix, addSchemaPrefix, mapPublicSchema string) (*Command, bool, error) {
+	tableStopFilter []*regexp.Regexp, trimSchemaPrefix, addSchemaPrefix, mapPublicSchema string,
+	renames *RenameRules) (*Command, bool, error) {
 	snapshot := false
 	// Note: this function returns nil, nil in some cases.
 	if ce == nil {
@@ -471,44 +612,17 @@ func NewCommand(cat *catalog.Catalog, dedup *log.MessageSet, ce *change.Event, s
 	if ce.Value.Payload.Source.TsMs == nil {
 		return nil, false, fmt.Errorf("missing value payload source timestamp: %v", ce.Value.Payload.Source)
 	}
-	// convert ts_ms to string
-	i, f := math.Modf(*ce.Value.Payload.Source.TsMs / 1000)
-	c.SourceTimestamp = time.Unix(int64(i), int64(f*1000000000)).UTC().Format("2006-01-02 15:04:05.000000000") + "Z"
+	c.SourceTimestamp = formatTimestampMs(*ce.Value.Payload.Source.TsMs)
 	if ce.Value.Payload.Source.Schema != nil {
-		schema := *ce.Value.Payload.Source.Schema
-		if len(schemaPassFilter) > 0 && !util.MatchRegexps(schemaPassFilter, schema) {
-			log.Trace("filter: reject: %s", schema)
-			return nil, false, nil
-		}
-		if len(schemaStopFilter) > 0 && util.MatchRegexps(schemaStopFilter, schema) {
-			log.Trace("filter: reject: %s", schema)
+		if !c.setSchema(cat, *ce.Value.Payload.Source.Schema, schemaPassFilter, schemaStopFilter,
+			trimSchemaPrefix, addSchemaPrefix, mapPublicSchema, renames) {
 			return nil, false, nil
 		}
-		// Rewrite schema name
-		if schema == "public" && mapPublicSchema != "" {
-			c.SchemaName = mapPublicSchema
-		} else {
-			if trimSchemaPrefix != "" {
-				schema = strings.TrimPrefix(schema, trimSchemaPrefix)
-			}
-			schema = strings.TrimPrefix(schema, "mod_")
-			schema = strings.TrimSuffix(schema, "_storage")
-			schema = strings.Replace(schema, "_mod_", "_", 1)
-			var origin string
-			origin, schema = cat.ExtractOrigin(schema)
-			c.Origin = origin
-			schema = addSchemaPrefix + schema
-			c.SchemaName = schema
-		}
 	}
 	if ce.Value.Payload.Source.Table != nil {
-		table := *ce.Value.Payload.Source.Table
-		schemaTable := *ce.Value.Payload.Source.Schema + "." + table
-		if len(tableStopFilter) > 0 && util.MatchRegexps(tableStopFilter, schemaTable) {
-			log.Trace("filter: reject: %s", table)
+		if !c.setTable(*ce.Value.Payload.Source.Schema, *ce.Value.Payload.Source.Table, tableStopFilter, renames) {
 			return nil, false, nil
 		}
-		c.TableName = table
 	}
 	if *ce.Value.Payload.Source.Snapshot == "true" {
 		snapshot = true
@@ -516,6 +630,20 @@ func NewCommand(cat *catalog.Catalog, dedup *log.MessageSet, ce *change.Event, s
 	if c.Op == TruncateOp {
 		return c, snapshot, nil
 	}
+	pk := primaryKeyOverride(cat, c)
+	if c.Op == DeleteOp && pk != nil {
+		if c.Column, err = beforeColumns(ce); err != nil {
+			return nil, false, fmt.Errorf("delete: %w", err)
+		}
+		if c.Column == nil {
+			return nil, false, fmt.Errorf("delete: primary key override requires the old row in change event: %s.%s",
+				c.SchemaName, c.TableName)
+		}
+		if err = applyPrimaryKeyOverride(c, pk); err != nil {
+			return nil, false, fmt.Errorf("delete: %w", err)
+		}
+		return c, snapshot, nil
+	}
 	if c.Op == DeleteOp {
 		switch {
 		case ce.Key == nil:
@@ -528,60 +656,132 @@ func NewCommand(cat *catalog.Catalog, dedup *log.MessageSet, ce *change.Event, s
 		case ce.Key.Payload == nil:
 			return nil, false, fmt.Errorf("delete: missing event key payload: %v", ce.Key)
 		}
-		fields := ce.Key.Schema.Fields
-		payload := ce.Key.Payload
-		for i, m := range fields {
-			attr, ok := m["field"].(string)
-			if !ok {
-				return nil, false, fmt.Errorf("delete: unexpected type: key schema field: %v", m["field"])
-			}
-			var semtype string
-			if m["name"] != nil {
-				semtype, ok = m["name"].(string)
-				if !ok {
-					return nil, false, fmt.Errorf("delete: unexpected type: key schema name: %v", m["name"])
-				}
-			}
-			dt, ok := m["type"].(string)
-			if !ok {
-				return nil, false, fmt.Errorf("delete: unexpected type: key schema type: %v", m["type"])
-			}
-			var dtype types.DataType
-			dtype, err = convertDataType(dt, semtype)
-			if err != nil {
-				return nil, false, fmt.Errorf("delete: unknown key schema type: %v", m["type"])
-			}
-			data := payload[attr]
-			var edata *string
-			edata, err = DataToSQLData(data, dtype, semtype)
-			if err != nil {
-				return nil, false, fmt.Errorf("delete: unknown type: %w", err)
-			}
-			var typesize int64
-			typesize, err = convertTypeSize(dt, dtype)
-			if err != nil {
-				return nil, false, fmt.Errorf("delete: unknown type size: %v", data)
-			}
-			c.Column = append(c.Column, CommandColumn{
-				Name:       attr,
-				DType:      dtype,
-				DTypeSize:  typesize,
-				Data:       data,
-				SQLData:    edata,
-				PrimaryKey: i + 1,
-			})
+		if c.Column, err = keyColumns(ce.Key.Schema.Fields, ce.Key.Payload); err != nil {
+			return nil, false, err
 		}
 		return c, snapshot, nil
 	}
-	if c.Column, err = extractColumns(dedup, ce); err != nil {
+	if c.Column, err = extractColumns(dedup, ce, pk != nil); err != nil {
 		return nil, false, err
 	}
 	if c.Column == nil {
 		return nil, false, nil
 	}
+	if pk != nil {
+		if err = applyPrimaryKeyOverride(c, pk); err != nil {
+			return nil, false, err
+		}
+		if *ce.Value.Payload.Op == "u" {
+			if c.Previous, err = previousCommand(c, ce, pk); err != nil {
+				return nil, false, err
+			}
+		}
+	}
 	return c, snapshot, nil
 }
 
+// keyColumns returns the primary key columns described by the schema fields
+// and payload of a change event key.
+func keyColumns(fields []map[string]any, payload map[string]any) ([]CommandColumn, error) {
+	var err error
+	var columns []CommandColumn
+	for i, m := range fields {
+		attr, ok := m["field"].(string)
+		if !ok {
+			return nil, fmt.Errorf("delete: unexpected type: key schema field: %v", m["field"])
+		}
+		var semtype string
+		if m["name"] != nil {
+			semtype, ok = m["name"].(string)
+			if !ok {
+				return nil, fmt.Errorf("delete: unexpected type: key schema name: %v", m["name"])
+			}
+		}
+		dt, ok := m["type"].(string)
+		if !ok {
+			return nil, fmt.Errorf("delete: unexpected type: key schema type: %v", m["type"])
+		}
+		var dtype types.DataType
+		dtype, err = convertDataType(dt, semtype)
+		if err != nil {
+			return nil, fmt.Errorf("delete: unknown key schema type: %v", m["type"])
+		}
+		data := payload[attr]
+		var edata *string
+		edata, err = DataToSQLData(data, dtype, semtype)
+		if err != nil {
+			return nil, fmt.Errorf("delete: unknown type: %w", err)
+		}
+		var typesize int64
+		typesize, err = convertTypeSize(dt, dtype)
+		if err != nil {
+			return nil, fmt.Errorf("delete: unknown type size: %v", data)
+		}
+		columns = append(columns, CommandColumn{
+			Name:       attr,
+			DType:      dtype,
+			DTypeSize:  typesize,
+			Data:       data,
+			SQLData:    edata,
+			PrimaryKey: i + 1,
+		})
+	}
+	return columns, nil
+}
+
+// SetTable sets the schema and table names of a command from the schema and
+// table names in the data source, after applying the schema and table
+// filters and rewriting the schema and table names.  It returns false if the
+// table is rejected by a filter.
+func (c *Command) SetTable(cat *catalog.Catalog, schema, table string, schemaPassFilter, schemaStopFilter,
+	tableStopFilter []*regexp.Regexp, trimSchemaPrefix, addSchemaPrefix, mapPublicSchema string,
+	renames *RenameRules) bool {
+	return c.setSchema(cat, schema, schemaPassFilter, schemaStopFilter, trimSchemaPrefix, addSchemaPrefix,
+		mapPublicSchema, renames) && c.setTable(schema, table, tableStopFilter, renames)
+}
+
+func (c *Command) setSchema(cat *catalog.Catalog, schema string, schemaPassFilter, schemaStopFilter []*regexp.Regexp,
+	trimSchemaPrefix, addSchemaPrefix, mapPublicSchema string, renames *RenameRules) bool {
+	if len(schemaPassFilter) > 0 && !util.MatchRegexps(schemaPassFilter, schema) {
+		log.Trace("filter: reject: %s", schema)
+		return false
+	}
+	if len(schemaStopFilter) > 0 && util.MatchRegexps(schemaStopFilter, schema) {
+		log.Trace("filter: reject: %s", schema)
+		return false
+	}
+	// Rewrite schema name
+	if schema == "public" && mapPublicSchema != "" {
+		c.SchemaName = mapPublicSchema
+		return true
+	}
+	if trimSchemaPrefix != "" {
+		schema = strings.TrimPrefix(schema, trimSchemaPrefix)
+	}
+	schema = renames.renameSchema(schema)
+	var origin string
+	origin, schema = cat.ExtractOrigin(schema)
+	c.Origin = origin
+	c.SchemaName = addSchemaPrefix + schema
+	return true
+}
+
+func (c *Command) setTable(schema, table string, tableStopFilter []*regexp.Regexp, renames *RenameRules) bool {
+	if len(tableStopFilter) > 0 && util.MatchRegexps(tableStopFilter, schema+"."+table) {
+		log.Trace("filter: reject: %s", table)
+		return false
+	}
+	c.TableName = renames.renameTable(table)
+	return true
+}
+
+// formatTimestampMs converts a timestamp in milliseconds since the epoch to
+// a string.
+func formatTimestampMs(ms float64) string {
+	i, f := math.Modf(ms / 1000)
+	return time.Unix(int64(i), int64(f*1000000000)).UTC().Format("2006-01-02 15:04:05.000000000") + "Z"
+}
+
 func primaryKeyNotDefined(dedup *log.MessageSet, topicPtr *string) {
 	topic := ""
 	if topicPtr != nil {
@@ -610,12 +810,16 @@ func convertDataType(coltype, semtype string) (types.DataType, error) {
 		}
 		return types.IntegerType, nil
 	case "int64":
-		if strings.HasSuffix(semtype, ".time.MicroTime") {
+		if strings.HasSuffix(semtype, ".time.MicroTime") || strings.HasSuffix(semtype, ".time.NanoTime") {
 			return types.TimeType, nil
 		}
-		if strings.HasSuffix(semtype, ".time.Timestamp") || strings.HasSuffix(semtype, ".time.MicroTimestamp") {
+		if strings.HasSuffix(semtype, ".time.Timestamp") || strings.HasSuffix(semtype, ".time.MicroTimestamp") ||
+			strings.HasSuffix(semtype, ".time.NanoTimestamp") {
 			return types.TimestampType, nil
 		}
+		if strings.HasSuffix(semtype, ".time.MicroDuration") {
+			return types.IntervalType, nil
+		}
 		return types.IntegerType, nil
 	case "float", "double", "float32", "float64":
 		return types.FloatType, nil
@@ -632,19 +836,29 @@ func convertDataType(coltype, semtype string) (types.DataType, error) {
 		if strings.HasSuffix(semtype, ".time.ZonedTimestamp") {
 			return types.TimestamptzType, nil
 		}
+		if strings.HasSuffix(semtype, ".time.Interval") {
+			return types.IntervalType, nil
+		}
+		// Other semantic types such as Enum, EnumSet, and Xml are
+		// read as text.
 		return types.TextType, nil
 	case "bytes":
-		// if strings.HasSuffix(semtype, ".data.Bits") {
-		// 	return , nil
-		// }
 		if semtype == "org.apache.kafka.connect.data.Decimal" {
 			return types.NumericType, nil
 		}
-		return 0, fmt.Errorf("convert data type: unhandled type: type=%s, semtype=%s", coltype, semtype)
+		if strings.HasSuffix(semtype, ".data.Bits") {
+			// Bits are written as a bit string.
+			return types.TextType, nil
+		}
+		return types.ByteaType, nil
 	case "struct":
 		if semtype == "io.debezium.data.VariableScaleDecimal" {
 			return types.NumericType, nil
 		}
+		if strings.HasPrefix(semtype, "io.debezium.data.geometry.") {
+			// Geometries are written in well-known binary format.
+			return types.ByteaType, nil
+		}
 		return 0, fmt.Errorf("convert data type: unhandled type: type=%s, semtype=%s", coltype, semtype)
 	default:
 		return 0, fmt.Errorf("convert data type: unknown data type: %s", coltype)
@@ -656,6 +870,9 @@ func DataToSQLData(data any, datatype types.DataType, semtype string) (*string,
 	if data == nil {
 		return nil, nil
 	}
+	if datatype.IsArray() {
+		return arrayToSQLData(data, datatype.Elem(), semtype)
+	}
 	switch datatype {
 	case types.BooleanType:
 		v, ok := data.(bool)
@@ -706,6 +923,11 @@ func DataToSQLData(data any, datatype types.DataType, semtype string) (*string,
 			var t string = time.Unix(int64(i), int64(f*1000000000)).UTC().Format("15:04:05.000000")
 			s := fixupSQLTime(t)
 			return &s, nil
+		case strings.HasSuffix(semtype, ".time.NanoTime"):
+			var i, f float64 = math.Modf(v / 1000000000)
+			var t string = time.Unix(int64(i), int64(f*1000000000)).UTC().Format("15:04:05.000000")
+			s := fixupSQLTime(t)
+			return &s, nil
 		}
 	case types.TimestampType:
 		v, ok := data.(float64)
@@ -726,6 +948,31 @@ func DataToSQLData(data any, datatype types.DataType, semtype string) (*string,
 				s = "0001-01-01T00:00:00Z"
 			}
 			return &s, nil
+		case strings.HasSuffix(semtype, ".time.NanoTimestamp"):
+			var i, f float64 = math.Modf(v / 1000000000)
+			var t string = time.Unix(int64(i), int64(f*1000000000)).UTC().Format("2006-01-02 15:04:05.000000")
+			s := fixupSQLTime(t)
+			return &s, nil
+		}
+	case types.ByteaType:
+		v, ok := data.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s data \"%v\" has type %T", datatype, data, data)
+		}
+		b, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s data \"%v\": %w", datatype, data, err)
+		}
+		s := "\\x" + hex.EncodeToString(b)
+		return &s, nil
+	case types.IntervalType:
+		switch v := data.(type) {
+		case float64:
+			// A MicroDuration is a number of microseconds.
+			s := strconv.FormatFloat(v, 'f', -1, 64) + " microseconds"
+			return &s, nil
+		case string:
+			return &v, nil
 		}
 	case types.TextType, types.NumericType, types.UUIDType, types.JSONType, types.TimetzType, types.TimestamptzType:
 		s, ok := data.(string)
@@ -737,6 +984,40 @@ func DataToSQLData(data any, datatype types.DataType, semtype string) (*string,
 	return nil, fmt.Errorf("%s data \"%v\" has type %T", datatype, data, data)
 }
 
+// arrayToSQLData converts array data to a PostgreSQL array literal.
+func arrayToSQLData(data any, elemtype types.DataType, semtype string) (*string, error) {
+	elems, ok := data.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s data \"%v\" has type %T", types.ArrayOf(elemtype), data, data)
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, e := range elems {
+		if i != 0 {
+			b.WriteByte(',')
+		}
+		s, err := DataToSQLData(e, elemtype, semtype)
+		if err != nil {
+			return nil, err
+		}
+		if s == nil {
+			b.WriteString("NULL")
+			continue
+		}
+		b.WriteByte('"')
+		for _, c := range *s {
+			if c == '"' || c == '\\' {
+				b.WriteByte('\\')
+			}
+			b.WriteRune(c)
+		}
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	s := b.String()
+	return &s, nil
+}
+
 // fixupSQLTime prepares a time or timestamp for subsequent SQL encoding.  Any
 // fractional trailing zeros are removed.  "T" is added between the date and
 // time of a timestamp.  "Z" is appended to specify UTC.  This function does
@@ -2,6 +2,8 @@ package command
 
 import (
 	"testing"
+
+	"github.com/metadb-project/metadb/cmd/metadb/types"
 )
 
 func TestTrimFractionalZerosInFraction(t *testing.T) {
@@ -58,6 +60,64 @@ func TestTrimFractionalZerosEmpty(t *testing.T) {
 	}
 }
 
+func TestFieldColumnSemanticTypes(t *testing.T) {
+	tests := []struct {
+		schema map[string]any
+		data   any
+		dtype  types.DataType
+		size   int64
+		want   string
+	}{
+		{map[string]any{"type": "bytes"}, "3q2+7w==", types.ByteaType, 0, `\xdeadbeef`},
+		{map[string]any{"type": "bytes", "name": "io.debezium.data.Bits",
+			"parameters": map[string]any{"length": "10"}}, "BQI=", types.TextType, 0, "1000000101"},
+		{map[string]any{"type": "string", "name": "io.debezium.data.Enum"}, "red", types.TextType, 0, "red"},
+		{map[string]any{"type": "int32", "name": "io.debezium.time.Year"}, float64(2024), types.IntegerType, 4,
+			"2024"},
+		{map[string]any{"type": "string", "name": "io.debezium.time.Interval"}, "P1Y2M3DT4H5M6.5S",
+			types.IntervalType, 0, "P1Y2M3DT4H5M6.5S"},
+		{map[string]any{"type": "int64", "name": "io.debezium.time.MicroDuration"}, float64(1500000),
+			types.IntervalType, 0, "1500000 microseconds"},
+		{map[string]any{"type": "int64", "name": "io.debezium.time.NanoTimestamp"}, float64(1709294400500000000),
+			types.TimestampType, 0, "2024-03-01T12:00:00.5Z"},
+		{map[string]any{"type": "int64", "name": "io.debezium.time.NanoTime"}, float64(3723000000000),
+			types.TimeType, 0, "01:02:03Z"},
+		{map[string]any{"type": "struct", "name": "io.debezium.data.geometry.Point"},
+			map[string]any{"wkb": "AQE=", "srid": nil}, types.ByteaType, 0, `\x0101`},
+		{map[string]any{"type": "array", "items": map[string]any{"type": "int32"}}, []any{float64(1), nil},
+			types.ArrayOf(types.IntegerType), 4, `{"1",NULL}`},
+		{map[string]any{"type": "array", "items": map[string]any{"type": "string"}}, []any{`a "b"`, `c\`},
+			types.ArrayOf(types.TextType), 0, `{"a \"b\"","c\\"}`},
+	}
+	for _, tt := range tests {
+		ftype := tt.schema["type"].(string)
+		semtype, _ := tt.schema["name"].(string)
+		col, err := fieldColumn(tt.schema, "f", ftype, semtype, tt.data)
+		if err != nil {
+			t.Errorf("%v: %v", tt.schema, err)
+			continue
+		}
+		if col.DType != tt.dtype || col.DTypeSize != tt.size || col.SQLData == nil || *col.SQLData != tt.want {
+			var got string
+			if col.SQLData != nil {
+				got = *col.SQLData
+			}
+			t.Errorf("%v: got %v, %d, %q; want %v, %d, %q", tt.schema, col.DType, col.DTypeSize, got, tt.dtype,
+				tt.size, tt.want)
+		}
+	}
+}
+
+func TestMakeDataTypeArray(t *testing.T) {
+	dtype, size := types.MakeDataType("int8[]")
+	if dtype != types.ArrayOf(types.IntegerType) || size != 8 {
+		t.Errorf("got %v, %d", dtype, size)
+	}
+	if sql := types.DataTypeToSQL(dtype, size); sql != "bigint[]" {
+		t.Errorf("got %q; want %q", sql, "bigint[]")
+	}
+}
+
 /*
 func TestExtractOriginMatch(t *testing.T) {
 	var prefixes = []string{"reshare_east", "reshare_north", "reshare_outer", "reshare_south", "reshare_west"}
@@ -0,0 +1,469 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/metadb-project/metadb/cmd/metadb/catalog"
+	"github.com/metadb-project/metadb/cmd/metadb/change"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+	"github.com/metadb-project/metadb/cmd/metadb/log"
+	"github.com/metadb-project/metadb/cmd/metadb/types"
+)
+
+// EventFormat describes how change events from a data source are encoded.
+// The zero value is the Debezium change event envelope with embedded
+// schemas.
+type EventFormat struct {
+	// Flattened is true if each event value contains only the state of a
+	// row after the change, as written by the Debezium
+	// ExtractNewRecordState transformation.  Metadata fields added by the
+	// transformation have names beginning with "__".
+	Flattened bool
+	// Schemaless is true if keys and values do not include schemas, as
+	// written by the JSON converter with schemas.enable=false.  Data
+	// types are then inferred from existing columns or from the values.
+	Schemaless bool
+}
+
+// NewCommandFromMessage parses a change event message in the specified
+// format and returns the resulting command, or nil if the event does not
+// result in a command.  It also returns true if the event is part of a
+// snapshot.
+func NewCommandFromMessage(cat *catalog.Catalog, dedup *log.MessageSet, msg *change.Message, format EventFormat,
+	schemaPassFilter, schemaStopFilter, tableStopFilter []*regexp.Regexp, trimSchemaPrefix, addSchemaPrefix,
+	mapPublicSchema string, renames *RenameRules) (*Command, bool, error) {
+	if format == (EventFormat{}) {
+		ce, err := change.NewEvent(msg)
+		if err != nil {
+			log.Error("%s", err)
+			ce = nil
+		}
+		c, snapshot, err := NewCommand(cat, dedup, ce, schemaPassFilter, schemaStopFilter, tableStopFilter,
+			trimSchemaPrefix, addSchemaPrefix, mapPublicSchema, renames)
+		if err != nil && ce != nil {
+			log.Debug("%v", *ce)
+		}
+		return c, snapshot, err
+	}
+
+	topic := msg.Topic
+	var key *eventKey
+	if len(msg.Key) > 0 {
+		var err error
+		if key, err = decodeEventKey(msg.Key, format.Schemaless); err != nil {
+			return nil, false, fmt.Errorf("key: %w", err)
+		}
+	}
+
+	var ev *event
+	var err error
+	if ev, err = decodeEvent(msg, format); err != nil {
+		return nil, false, fmt.Errorf("value: %w", err)
+	}
+	if ev == nil {
+		log.Trace("tombstone event: %s", topic)
+		return nil, false, nil
+	}
+
+	c := &Command{Op: ev.op, SourceTimestamp: ev.timestamp}
+	if !c.SetTable(cat, ev.schema, ev.table, schemaPassFilter, schemaStopFilter, tableStopFilter,
+		trimSchemaPrefix, addSchemaPrefix, mapPublicSchema, renames) {
+		return nil, false, nil
+	}
+	if c.Op == TruncateOp {
+		return c, ev.snapshot, nil
+	}
+	if pk := primaryKeyOverride(cat, c); pk != nil {
+		if pk.RowHash {
+			return nil, false, fmt.Errorf("row hash primary key not supported for event format: %s.%s",
+				c.SchemaName, c.TableName)
+		}
+		if ev.row == nil {
+			return nil, false, fmt.Errorf("primary key override requires the row in change event: %s.%s",
+				c.SchemaName, c.TableName)
+		}
+		if ev.fields != nil {
+			c.Column, err = fieldsColumns(ev.fields, ev.row, nil, format.Flattened)
+		} else {
+			c.Column, err = inferColumns(cat, c, ev.names, ev.row, nil, format.Flattened)
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		if err = applyPrimaryKeyOverride(c, pk); err != nil {
+			return nil, false, err
+		}
+		return c, ev.snapshot, nil
+	}
+	if key == nil || len(key.names) == 0 {
+		primaryKeyNotDefined(dedup, &topic)
+		return nil, false, nil
+	}
+	if c.Op == DeleteOp {
+		if key.fields != nil {
+			c.Column, err = keyColumns(key.fields, key.payload)
+		} else {
+			c.Column, err = inferColumns(cat, c, key.names, key.payload, key.names, false)
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("delete: %w", err)
+		}
+		return c, ev.snapshot, nil
+	}
+	if ev.fields != nil {
+		primaryKey := make(map[string]int)
+		for i, name := range key.names {
+			primaryKey[name] = i + 1
+		}
+		c.Column, err = fieldsColumns(ev.fields, ev.row, primaryKey, format.Flattened)
+	} else {
+		c.Column, err = inferColumns(cat, c, ev.names, ev.row, key.names, format.Flattened)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return c, ev.snapshot, nil
+}
+
+// eventKey is a decoded change event key.
+type eventKey struct {
+	// fields is the list of schema fields, or nil if there is no schema.
+	fields []map[string]any
+	// names lists the key columns in order.
+	names   []string
+	payload map[string]any
+}
+
+func decodeEventKey(data []byte, schemaless bool) (*eventKey, error) {
+	if schemaless {
+		names, err := objectKeys(data)
+		if err != nil {
+			return nil, err
+		}
+		key := &eventKey{names: names}
+		if err = json.Unmarshal(data, &key.payload); err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+	var k change.EventKey
+	if err := json.Unmarshal(data, &k); err != nil {
+		return nil, err
+	}
+	if k.Schema == nil || k.Schema.Fields == nil {
+		return nil, fmt.Errorf("$.schema.fields not found")
+	}
+	key := &eventKey{fields: k.Schema.Fields, payload: k.Payload}
+	for _, f := range k.Schema.Fields {
+		name, ok := f["field"].(string)
+		if !ok {
+			return nil, fmt.Errorf("$.schema.fields: unexpected field name: %v", f["field"])
+		}
+		key.names = append(key.names, name)
+	}
+	return key, nil
+}
+
+// event is a decoded change event value.
+type event struct {
+	op        Operation
+	schema    string
+	table     string
+	timestamp string
+	snapshot  bool
+	// fields is the list of schema fields describing the row, or nil if
+	// there is no schema.
+	fields []any
+	// names lists the row's fields in order, if there is no schema.
+	names []string
+	row   map[string]any
+}
+
+// decodeEvent decodes a change event value.  It returns nil for a tombstone
+// event that does not represent a deletion.
+func decodeEvent(msg *change.Message, format EventFormat) (*event, error) {
+	payload := json.RawMessage(msg.Value)
+	var schema struct {
+		Fields []any `json:"fields"`
+	}
+	if !format.Schemaless && len(msg.Value) > 0 {
+		var v struct {
+			Schema  json.RawMessage `json:"schema"`
+			Payload json.RawMessage `json:"payload"`
+		}
+		if err := json.Unmarshal(msg.Value, &v); err != nil {
+			return nil, err
+		}
+		if len(v.Schema) > 0 && string(v.Schema) != "null" {
+			if err := json.Unmarshal(v.Schema, &schema); err != nil {
+				return nil, fmt.Errorf("$.schema: %w", err)
+			}
+		}
+		payload = v.Payload
+	}
+	if len(payload) == 0 || string(payload) == "null" {
+		if !format.Flattened {
+			return nil, nil
+		}
+		// Flattened events have no delete event unless deletes are
+		// rewritten, and so a tombstone is treated as a delete.
+		ev := &event{op: DeleteOp, timestamp: time.Now().UTC().Format("2006-01-02 15:04:05.000000000") + "Z"}
+		ev.schema, ev.table = topicTable(msg.Topic)
+		return ev, nil
+	}
+	if format.Flattened {
+		return decodeFlattened(msg.Topic, payload, schema.Fields, format.Schemaless)
+	}
+	return decodeEnvelope(payload)
+}
+
+// decodeEnvelope decodes a change event envelope without a schema.
+func decodeEnvelope(payload json.RawMessage) (*event, error) {
+	var p struct {
+		After  json.RawMessage            `json:"after"`
+		Source *change.EventPayloadSource `json:"source"`
+		Op     *string                    `json:"op"`
+	}
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, err
+	}
+	if p.Op == nil {
+		return nil, fmt.Errorf("missing payload op")
+	}
+	if p.Source == nil || p.Source.TsMs == nil || p.Source.Schema == nil || p.Source.Table == nil {
+		return nil, fmt.Errorf("missing payload source")
+	}
+	ev := &event{
+		schema:    *p.Source.Schema,
+		table:     *p.Source.Table,
+		timestamp: formatTimestampMs(*p.Source.TsMs),
+		snapshot:  p.Source.Snapshot != nil && *p.Source.Snapshot == "true",
+	}
+	var err error
+	if ev.op, err = parseOp(*p.Op); err != nil {
+		return nil, err
+	}
+	if ev.op != MergeOp {
+		return ev, nil
+	}
+	if ev.names, err = objectKeys(p.After); err != nil {
+		return nil, fmt.Errorf("$.payload.after: %w", err)
+	}
+	if err = json.Unmarshal(p.After, &ev.row); err != nil {
+		return nil, fmt.Errorf("$.payload.after: %w", err)
+	}
+	return ev, nil
+}
+
+// decodeFlattened decodes a flattened event.  The schema and table names
+// are read from the fields "__schema" and "__table" if present, or
+// otherwise from the topic name.
+func decodeFlattened(topic string, payload json.RawMessage, fields []any, schemaless bool) (*event, error) {
+	ev := &event{op: MergeOp, fields: fields}
+	if fields == nil && !schemaless {
+		return nil, fmt.Errorf("$.schema.fields not found")
+	}
+	if err := json.Unmarshal(payload, &ev.row); err != nil {
+		return nil, err
+	}
+	if schemaless {
+		var err error
+		if ev.names, err = objectKeys(payload); err != nil {
+			return nil, err
+		}
+	}
+	ev.schema, ev.table = topicTable(topic)
+	if s, ok := ev.row["__schema"].(string); ok {
+		ev.schema = s
+	}
+	if s, ok := ev.row["__table"].(string); ok {
+		ev.table = s
+	}
+	if ev.schema == "" || ev.table == "" {
+		return nil, fmt.Errorf("schema and table names not found in topic %q", topic)
+	}
+	if op, ok := ev.row["__op"].(string); ok {
+		var err error
+		if ev.op, err = parseOp(op); err != nil {
+			return nil, err
+		}
+		ev.snapshot = op == "r"
+	}
+	if deleted, ok := ev.row["__deleted"].(string); ok && deleted == "true" {
+		ev.op = DeleteOp
+	}
+	if s, ok := ev.row["__source_snapshot"].(string); ok && s == "true" {
+		ev.snapshot = true
+	}
+	ts, ok := ev.row["__source_ts_ms"].(float64)
+	if !ok {
+		ts, ok = ev.row["__ts_ms"].(float64)
+	}
+	if ok {
+		ev.timestamp = formatTimestampMs(ts)
+	} else {
+		ev.timestamp = time.Now().UTC().Format("2006-01-02 15:04:05.000000000") + "Z"
+	}
+	return ev, nil
+}
+
+func parseOp(op string) (Operation, error) {
+	switch op {
+	case "c", "r", "u":
+		return MergeOp, nil
+	case "d":
+		return DeleteOp, nil
+	case "t":
+		return TruncateOp, nil
+	default:
+		return 0, fmt.Errorf("unknown op value in change event: %q", op)
+	}
+}
+
+// topicTable returns the schema and table names from a topic name of the
+// form "prefix.schema.table".
+func topicTable(topic string) (string, string) {
+	s := strings.Split(topic, ".")
+	if len(s) < 3 {
+		return "", ""
+	}
+	return s[len(s)-2], s[len(s)-1]
+}
+
+// objectKeys returns the keys of a JSON object in order.
+func objectKeys(data []byte) ([]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	t, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if t != json.Delim('{') {
+		return nil, fmt.Errorf("expected JSON object")
+	}
+	var keys []string
+	for dec.More() {
+		if t, err = dec.Token(); err != nil {
+			return nil, err
+		}
+		keys = append(keys, t.(string))
+		var v json.RawMessage
+		if err = dec.Decode(&v); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// inferColumns returns columns for the named fields of a row that has no
+// schema.  If flattened is true, fields that contain metadata added to
+// flattened events are skipped.
+func inferColumns(cat *catalog.Catalog, c *Command, names []string, row map[string]any, key []string,
+	flattened bool) ([]CommandColumn, error) {
+	var columns []CommandColumn
+	for _, name := range names {
+		if flattened && strings.HasPrefix(name, "__") {
+			continue
+		}
+		col, err := inferColumn(cat, c, name, row[name])
+		if err != nil {
+			return nil, err
+		}
+		for i := range key {
+			if key[i] == name {
+				col.PrimaryKey = i + 1
+			}
+		}
+		columns = append(columns, col)
+	}
+	return columns, nil
+}
+
+// inferColumn returns a column for a value that has no schema.  The data
+// type of an existing column is used if it is compatible with the value;
+// otherwise the type is inferred from the value as in JSON transformation.
+func inferColumn(cat *catalog.Catalog, c *Command, name string, data any) (CommandColumn, error) {
+	var ctype types.DataType
+	var csize int64
+	if t := cat.ColumnType(&dbx.Column{Schema: c.SchemaName, Table: c.TableName, Column: name}); t != nil {
+		ctype, csize = types.MakeDataType(*t)
+	}
+	col := CommandColumn{Name: name, Data: data}
+	var semtype string
+	switch v := data.(type) {
+	case nil:
+		col.DType, col.DTypeSize = ctype, csize
+		if ctype == types.UnknownType {
+			col.DType = types.TextType
+		}
+		return col, nil
+	case bool:
+		col.DType = types.BooleanType
+	case float64:
+		switch ctype {
+		case types.IntegerType, types.FloatType:
+			if ctype == types.IntegerType && v != math.Trunc(v) {
+				col.DType = types.NumericType
+				break
+			}
+			col.DType, col.DTypeSize = ctype, csize
+		case types.DateType:
+			col.DType, semtype = ctype, "io.debezium.time.Date"
+		case types.IntervalType:
+			col.DType, semtype = ctype, "io.debezium.time.MicroDuration"
+		case types.TimeType:
+			col.DType, semtype = ctype, "io.debezium.time.MicroTime"
+		case types.TimestampType:
+			col.DType, semtype = ctype, "io.debezium.time.MicroTimestamp"
+		default:
+			col.DType = types.NumericType
+		}
+		if col.DType == types.NumericType {
+			col.Data = strconv.FormatFloat(v, 'f', -1, 64)
+		}
+	case string:
+		switch ctype {
+		case types.TextType, types.JSONType, types.UUIDType, types.NumericType, types.DateType, types.TimeType,
+			types.TimetzType, types.TimestampType, types.TimestamptzType, types.IntervalType:
+			col.DType = ctype
+		default:
+			col.DType = InferTypeFromString(v)
+		}
+		if v == "__debezium_unavailable_value" {
+			col.Data = nil
+			col.Unavailable = true
+			return col, nil
+		}
+		if col.DType != types.TextType && col.DType != types.JSONType {
+			// The string is used as a literal of the column type.
+			col.SQLData = &v
+			return col, nil
+		}
+	default:
+		if _, ok := v.([]any); ok && ctype.IsArray() {
+			// An array is written to an existing array column if
+			// its elements have the column's element type.
+			if sqldata, err := DataToSQLData(v, ctype, ""); err == nil {
+				col.DType, col.DTypeSize, col.SQLData = ctype, csize, sqldata
+				return col, nil
+			}
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return CommandColumn{}, fmt.Errorf("%q: %w", name, err)
+		}
+		col.DType = types.JSONType
+		col.Data = string(b)
+	}
+	var err error
+	if col.SQLData, err = DataToSQLData(col.Data, col.DType, semtype); err != nil {
+		return CommandColumn{}, fmt.Errorf("%q: %w", name, err)
+	}
+	return col, nil
+}
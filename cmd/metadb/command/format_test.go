@@ -0,0 +1,74 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/metadb-project/metadb/cmd/metadb/catalog"
+	"github.com/metadb-project/metadb/cmd/metadb/change"
+	"github.com/metadb-project/metadb/cmd/metadb/log"
+	"github.com/metadb-project/metadb/cmd/metadb/types"
+)
+
+func TestNewCommandFromMessageFlattenedSchemaless(t *testing.T) {
+	cat := &catalog.Catalog{}
+	format := EventFormat{Flattened: true, Schemaless: true}
+	msg := &change.Message{
+		Topic: "folio.library.loan",
+		Key:   []byte(`{"id":7}`),
+		Value: []byte(`{"id":7,"due":"2024-03-01T12:00:00Z","renewals":2.5,"active":true,"note":null,"meta":{"a":1},` +
+			`"__op":"r","__source_ts_ms":1709294400000,"__deleted":"false"}`),
+	}
+	c, snapshot, err := NewCommandFromMessage(cat, log.NewMessageSet(), msg, format, nil, nil, nil, "", "", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c == nil || c.Op != MergeOp || c.SchemaName != "library" || c.TableName != "loan" || !snapshot {
+		t.Fatalf("got %+v, %v", c, snapshot)
+	}
+	if c.SourceTimestamp != "2024-03-01 12:00:00.000000000Z" {
+		t.Errorf("source timestamp = %q", c.SourceTimestamp)
+	}
+	want := []struct {
+		name       string
+		dtype      types.DataType
+		primaryKey int
+		sqlData    string
+	}{
+		{"id", types.NumericType, 1, "7"},
+		{"due", types.TimestamptzType, 0, "2024-03-01T12:00:00Z"},
+		{"renewals", types.NumericType, 0, "2.5"},
+		{"active", types.BooleanType, 0, "true"},
+		{"note", types.TextType, 0, ""},
+		{"meta", types.JSONType, 0, `{"a":1}`},
+	}
+	if len(c.Column) != len(want) {
+		t.Fatalf("got %d columns; want %d", len(c.Column), len(want))
+	}
+	for i, w := range want {
+		col := c.Column[i]
+		var sqlData string
+		if col.SQLData != nil {
+			sqlData = *col.SQLData
+		}
+		if col.Name != w.name || col.DType != w.dtype || col.PrimaryKey != w.primaryKey || sqlData != w.sqlData {
+			t.Errorf("column %d = %+v; want %+v", i, col, w)
+		}
+	}
+
+	msg.Value = []byte(`{"id":7,"__deleted":"true"}`)
+	if c, _, err = NewCommandFromMessage(cat, log.NewMessageSet(), msg, format, nil, nil, nil, "", "", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if c == nil || c.Op != DeleteOp || len(c.Column) != 1 || c.Column[0].PrimaryKey != 1 {
+		t.Errorf("delete: got %+v", c)
+	}
+
+	// A tombstone is a deletion.
+	msg.Value = nil
+	if c, _, err = NewCommandFromMessage(cat, log.NewMessageSet(), msg, format, nil, nil, nil, "", "", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if c == nil || c.Op != DeleteOp || c.TableName != "loan" {
+		t.Errorf("tombstone: got %+v", c)
+	}
+}
@@ -0,0 +1,226 @@
+package command
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/metadb-project/metadb/cmd/metadb/types"
+	"github.com/metadb-project/metadb/cmd/metadb/util"
+)
+
+// Masking methods.
+const (
+	MaskDrop = "drop" // Remove the column or JSON field.
+	MaskHash = "hash" // Replace the value with a salted SHA-256 hash.
+	MaskNull = "null" // Replace the value with null.
+)
+
+// ColumnRule is a masking rule that applies a method to columns whose
+// qualified names match a regular expression.
+type ColumnRule struct {
+	Pattern *regexp.Regexp
+	Method  string
+}
+
+// ColumnRules defines which columns of change events are filtered out or
+// masked before they are written to the database.  Rules are matched against
+// qualified column names of the form schema.table.column, using the schema
+// and table names after any rewriting.  Fields within JSON columns are
+// matched by appending their path, such as schema.table.column.key.subkey;
+// elements of arrays are matched by the path of the array.
+type ColumnRules struct {
+	StopFilter []*regexp.Regexp
+	Masks      []ColumnRule
+	Salt       string
+}
+
+// NewColumnRules compiles a column stop filter and masking rules.  Each
+// masking rule has the form regexp:method.  It returns nil if there are no
+// filters or rules.
+func NewColumnRules(stopFilter, masks []string, salt string) (*ColumnRules, error) {
+	if len(stopFilter) == 0 && len(masks) == 0 {
+		return nil, nil
+	}
+	var err error
+	r := &ColumnRules{Salt: salt}
+	if r.StopFilter, err = util.CompileRegexps(stopFilter); err != nil {
+		return nil, err
+	}
+	for _, m := range masks {
+		rule, err := ParseColumnRule(m)
+		if err != nil {
+			return nil, err
+		}
+		r.Masks = append(r.Masks, rule)
+	}
+	return r, nil
+}
+
+// ParseColumnRule parses a masking rule of the form regexp:method.
+func ParseColumnRule(s string) (ColumnRule, error) {
+	i := strings.LastIndexByte(s, ':')
+	if i < 1 {
+		return ColumnRule{}, fmt.Errorf("invalid masking rule %q", s)
+	}
+	method := s[i+1:]
+	switch method {
+	case MaskDrop, MaskHash, MaskNull:
+	default:
+		return ColumnRule{}, fmt.Errorf("invalid masking method %q in rule %q", method, s)
+	}
+	re, err := regexp.Compile(s[:i])
+	if err != nil {
+		return ColumnRule{}, fmt.Errorf("compiling regular expression %s: %v", s[:i], err)
+	}
+	return ColumnRule{Pattern: re, Method: method}, nil
+}
+
+// method returns the masking method that applies to a qualified name, or ""
+// if none.  The stop filter is checked first, then the masking rules in
+// order.
+func (r *ColumnRules) method(name string) string {
+	if util.MatchRegexps(r.StopFilter, name) {
+		return MaskDrop
+	}
+	for _, m := range r.Masks {
+		if m.Pattern.MatchString(name) {
+			return m.Method
+		}
+	}
+	return ""
+}
+
+// Apply filters and masks the columns of a command.  Primary key columns
+// can only be hashed, so that they continue to identify rows.  The rules are
+// also applied to any previous command.
+func (r *ColumnRules) Apply(c *Command) error {
+	if r == nil {
+		return nil
+	}
+	if c.Previous != nil {
+		if err := r.Apply(c.Previous); err != nil {
+			return err
+		}
+	}
+	if len(c.Column) == 0 {
+		return nil
+	}
+	prefix := c.TableName + "."
+	if c.SchemaName != "" {
+		prefix = c.SchemaName + "." + prefix
+	}
+	columns := c.Column[:0]
+	for _, col := range c.Column {
+		name := prefix + col.Name
+		method := r.method(name)
+		if method != "" && method != MaskHash && col.PrimaryKey != 0 {
+			return fmt.Errorf("masking method %q cannot be applied to primary key column %q", method, name)
+		}
+		switch method {
+		case MaskDrop:
+			continue
+		case MaskNull:
+			col.Data = nil
+			col.SQLData = nil
+		case MaskHash:
+			col.DType = types.TextType
+			col.DTypeSize = 64
+			if col.SQLData != nil {
+				h := r.hash(*col.SQLData)
+				col.Data = h
+				col.SQLData = &h
+			}
+		default:
+			if col.DType == types.JSONType && col.SQLData != nil && len(r.StopFilter)+len(r.Masks) != 0 {
+				if err := r.maskJSON(&col, name); err != nil {
+					return fmt.Errorf("masking column %q: %w", name, err)
+				}
+			}
+		}
+		columns = append(columns, col)
+	}
+	c.Column = columns
+	return nil
+}
+
+// maskJSON applies the rules to fields within a JSON column.
+func (r *ColumnRules) maskJSON(col *CommandColumn, name string) error {
+	d := json.NewDecoder(strings.NewReader(*col.SQLData))
+	d.UseNumber()
+	var j any
+	if err := d.Decode(&j); err != nil {
+		return err
+	}
+	j, changed := r.maskJSONValue(j, name)
+	if !changed {
+		return nil
+	}
+	var b bytes.Buffer
+	e := json.NewEncoder(&b)
+	e.SetEscapeHTML(false)
+	if err := e.Encode(j); err != nil {
+		return err
+	}
+	s := strings.TrimSuffix(b.String(), "\n")
+	col.Data = s
+	col.SQLData = &s
+	return nil
+}
+
+// maskJSONValue applies the rules to the fields of a JSON value, and reports
+// whether any were changed.
+func (r *ColumnRules) maskJSONValue(j any, path string) (any, bool) {
+	var changed bool
+	switch v := j.(type) {
+	case map[string]any:
+		for key, value := range v {
+			p := path + "." + key
+			switch r.method(p) {
+			case MaskDrop:
+				delete(v, key)
+				changed = true
+			case MaskNull:
+				v[key] = nil
+				changed = true
+			case MaskHash:
+				if value != nil {
+					v[key] = r.hashJSON(value)
+				}
+				changed = true
+			default:
+				var c bool
+				if v[key], c = r.maskJSONValue(value, p); c {
+					changed = true
+				}
+			}
+		}
+	case []any:
+		for i := range v {
+			var c bool
+			if v[i], c = r.maskJSONValue(v[i], path); c {
+				changed = true
+			}
+		}
+	}
+	return j, changed
+}
+
+// hashJSON returns the hash of a JSON value.  Strings are hashed without
+// quotes, so that the result is the same as for a text column.
+func (r *ColumnRules) hashJSON(value any) string {
+	if s, ok := value.(string); ok {
+		return r.hash(s)
+	}
+	b, _ := json.Marshal(value)
+	return r.hash(string(b))
+}
+
+func (r *ColumnRules) hash(s string) string {
+	h := sha256.Sum256([]byte(r.Salt + s))
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,56 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/metadb-project/metadb/cmd/metadb/types"
+)
+
+func TestColumnRules(t *testing.T) {
+	rules, err := NewColumnRules([]string{`^library\.patron\.barcode$`},
+		[]string{`^library\.patron\.id$:hash`, `\.personal\.email$:drop`, `\.personal\.phone$:null`,
+			`\.personal\.name$:hash`, `^library\.patron\.note$:null`}, "salt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	str := func(s string) *string { return &s }
+	c := &Command{
+		Op:         MergeOp,
+		SchemaName: "library",
+		TableName:  "patron",
+		Column: []CommandColumn{
+			{Name: "id", DType: types.IntegerType, Data: "7", SQLData: str("7"), PrimaryKey: 1},
+			{Name: "barcode", DType: types.TextType, Data: "1234", SQLData: str("1234")},
+			{Name: "note", DType: types.TextType, Data: "x", SQLData: str("x")},
+			{Name: "jsonb", DType: types.JSONType, SQLData: str(
+				`{"personal":{"email":"a@b","name":"Ann","phone":"5"},"items":[{"personal":{"email":"c@d"}}]}`)},
+		},
+	}
+	if err = rules.Apply(c); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Column) != 3 {
+		t.Fatalf("got %d columns; want 3", len(c.Column))
+	}
+	id := c.Column[0]
+	if id.DType != types.TextType || id.SQLData == nil || *id.SQLData != rules.hash("7") || id.PrimaryKey != 1 {
+		t.Errorf("id = %+v", id)
+	}
+	if c.Column[1].Name != "note" || c.Column[1].SQLData != nil {
+		t.Errorf("note = %+v", c.Column[1])
+	}
+	want := `{"items":[{"personal":{}}],"personal":{"name":"` + rules.hash("Ann") + `","phone":null}}`
+	if got := *c.Column[2].SQLData; got != want {
+		t.Errorf("jsonb = %s; want %s", got, want)
+	}
+
+	c = &Command{Op: DeleteOp, SchemaName: "library", TableName: "patron",
+		Column: []CommandColumn{{Name: "barcode", SQLData: str("1234"), PrimaryKey: 1}}}
+	if err = rules.Apply(c); err == nil {
+		t.Error("dropping primary key column: expected error")
+	}
+
+	if _, err = ParseColumnRule(`^a\.b:mask`); err == nil {
+		t.Error("invalid method: expected error")
+	}
+}
@@ -0,0 +1,160 @@
+package command
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/metadb-project/metadb/cmd/metadb/catalog"
+	"github.com/metadb-project/metadb/cmd/metadb/change"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+	"github.com/metadb-project/metadb/cmd/metadb/types"
+)
+
+// RowHashColumn is the primary key column that is added to tables whose
+// primary key is a hash of all columns.
+const RowHashColumn = "__row_hash"
+
+// primaryKeyOverride returns the primary key override for the table of a
+// command, or nil if none is defined.
+func primaryKeyOverride(cat *catalog.Catalog, c *Command) *catalog.PrimaryKeyOverride {
+	return cat.PrimaryKeyOverride(dbx.Table{Schema: c.SchemaName, Table: c.TableName})
+}
+
+// applyPrimaryKeyOverride sets the primary key of the columns of a command,
+// which must contain the entire row, as defined by an override.  For a
+// delete, only the primary key columns are retained.
+func applyPrimaryKeyOverride(c *Command, pk *catalog.PrimaryKeyOverride) error {
+	if pk.RowHash {
+		h := rowHashColumn(c.Column)
+		if c.Op == DeleteOp {
+			c.Column = []CommandColumn{h}
+			return nil
+		}
+		for i := range c.Column {
+			c.Column[i].PrimaryKey = 0
+		}
+		c.Column = append(c.Column, h)
+		return nil
+	}
+	var key []CommandColumn
+	for i := range c.Column {
+		c.Column[i].PrimaryKey = slices.Index(pk.Columns, c.Column[i].Name) + 1
+		if c.Column[i].PrimaryKey == 0 {
+			continue
+		}
+		if c.Column[i].SQLData == nil {
+			return fmt.Errorf("primary key column %q is null", c.Column[i].Name)
+		}
+		key = append(key, c.Column[i])
+	}
+	for _, name := range pk.Columns {
+		if !slices.ContainsFunc(key, func(col CommandColumn) bool { return col.Name == name }) {
+			return fmt.Errorf("primary key column %q not found in change event", name)
+		}
+	}
+	if c.Op == DeleteOp {
+		c.Column = PrimaryKeyColumns(c.Column)
+	}
+	return nil
+}
+
+// rowHashColumn returns a primary key column containing a SHA-256 hash of
+// the names and values of all columns.  Columns are hashed in order of their
+// names, and null values are distinguished from empty strings.
+func rowHashColumn(columns []CommandColumn) CommandColumn {
+	sorted := slices.Clone(columns)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	h := sha256.New()
+	for _, col := range sorted {
+		h.Write([]byte(col.Name))
+		if col.SQLData == nil {
+			h.Write([]byte{0, 'N', 0})
+		} else {
+			h.Write([]byte{0, 'V'})
+			h.Write([]byte(*col.SQLData))
+			h.Write([]byte{0})
+		}
+	}
+	s := hex.EncodeToString(h.Sum(nil))
+	return CommandColumn{
+		Name:       RowHashColumn,
+		DType:      types.TextType,
+		DTypeSize:  64,
+		Data:       s,
+		SQLData:    &s,
+		PrimaryKey: 1,
+	}
+}
+
+// beforeColumns returns the columns of the row before it was changed, or nil
+// if the change event does not include it.
+func beforeColumns(ce *change.Event) ([]CommandColumn, error) {
+	if ce.Value.Payload.Before == nil {
+		return nil, nil
+	}
+	var row map[string]any
+	if err := json.Unmarshal(*ce.Value.Payload.Before, &row); err != nil {
+		return nil, fmt.Errorf("value: $.payload.before: %w", err)
+	}
+	if row == nil {
+		return nil, nil
+	}
+	if ce.Value.Schema == nil {
+		return nil, fmt.Errorf("value: $.schema.fields not found")
+	}
+	for _, f := range ce.Value.Schema.Fields {
+		if f["field"] != "before" {
+			continue
+		}
+		fields, ok := f["fields"].([]any)
+		if !ok {
+			return nil, fmt.Errorf("value: $.schema.fields: \"fields\" not expected type")
+		}
+		return fieldsColumns(fields, row, nil, false)
+	}
+	return nil, fmt.Errorf("value: $.schema.fields: \"before\" not found")
+}
+
+// previousCommand returns a command that deletes the old row of an update,
+// if the update changes the primary key defined by an override.  Otherwise
+// the update would leave the old row in place.  The row hash changes with
+// every update, and so in that mode the change event must include the old
+// row.
+func previousCommand(c *Command, ce *change.Event, pk *catalog.PrimaryKeyOverride) (*Command, error) {
+	before, err := beforeColumns(ce)
+	if err != nil {
+		return nil, err
+	}
+	if before == nil {
+		if pk.RowHash {
+			return nil, fmt.Errorf("update: row hash primary key requires the old row in change event: %s.%s",
+				c.SchemaName, c.TableName)
+		}
+		return nil, nil
+	}
+	p := &Command{
+		Op:              DeleteOp,
+		SchemaName:      c.SchemaName,
+		TableName:       c.TableName,
+		Transformed:     c.Transformed,
+		ParentTable:     c.ParentTable,
+		Origin:          c.Origin,
+		Column:          before,
+		SourceTimestamp: c.SourceTimestamp,
+	}
+	if err = applyPrimaryKeyOverride(p, pk); err != nil {
+		return nil, fmt.Errorf("update: old row: %w", err)
+	}
+	if slices.EqualFunc(p.Column, PrimaryKeyColumns(c.Column), func(a, b CommandColumn) bool {
+		return a.Name == b.Name && *a.SQLData == *b.SQLData
+	}) {
+		return nil, nil
+	}
+	return p, nil
+}
@@ -0,0 +1,65 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/metadb-project/metadb/cmd/metadb/catalog"
+	"github.com/metadb-project/metadb/cmd/metadb/types"
+)
+
+func TestApplyPrimaryKeyOverride(t *testing.T) {
+	str := func(s string) *string { return &s }
+	row := func(op Operation, note *string) *Command {
+		return &Command{Op: op, SchemaName: "library", TableName: "loan", Column: []CommandColumn{
+			{Name: "item_id", DType: types.IntegerType, SQLData: str("7")},
+			{Name: "loan_date", DType: types.DateType, SQLData: str("2026-01-02")},
+			{Name: "note", DType: types.TextType, SQLData: note},
+		}}
+	}
+
+	pk := &catalog.PrimaryKeyOverride{Columns: []string{"loan_date", "item_id"}}
+	c := row(MergeOp, str("x"))
+	if err := applyPrimaryKeyOverride(c, pk); err != nil {
+		t.Fatal(err)
+	}
+	if c.Column[0].PrimaryKey != 2 || c.Column[1].PrimaryKey != 1 || c.Column[2].PrimaryKey != 0 {
+		t.Errorf("columns = %+v", c.Column)
+	}
+	c = row(DeleteOp, str("x"))
+	if err := applyPrimaryKeyOverride(c, pk); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Column) != 2 || c.Column[0].Name != "loan_date" || c.Column[1].Name != "item_id" {
+		t.Errorf("delete columns = %+v", c.Column)
+	}
+	if err := applyPrimaryKeyOverride(row(MergeOp, nil), &catalog.PrimaryKeyOverride{Columns: []string{"note"}}); err == nil {
+		t.Error("null key column: expected error")
+	}
+	if err := applyPrimaryKeyOverride(row(MergeOp, nil), &catalog.PrimaryKeyOverride{Columns: []string{"id"}}); err == nil {
+		t.Error("missing key column: expected error")
+	}
+
+	pk = &catalog.PrimaryKeyOverride{RowHash: true}
+	m := row(MergeOp, str(""))
+	if err := applyPrimaryKeyOverride(m, pk); err != nil {
+		t.Fatal(err)
+	}
+	h := m.Column[len(m.Column)-1]
+	if h.Name != RowHashColumn || h.PrimaryKey != 1 || len(*h.SQLData) != 64 || len(PrimaryKeyColumns(m.Column)) != 1 {
+		t.Errorf("merge columns = %+v", m.Column)
+	}
+	d := row(DeleteOp, str(""))
+	if err := applyPrimaryKeyOverride(d, pk); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Column) != 1 || *d.Column[0].SQLData != *h.SQLData {
+		t.Errorf("delete columns = %+v; want hash %s", d.Column, *h.SQLData)
+	}
+	n := row(DeleteOp, nil)
+	if err := applyPrimaryKeyOverride(n, pk); err != nil {
+		t.Fatal(err)
+	}
+	if *n.Column[0].SQLData == *h.SQLData {
+		t.Error("null and empty string have the same hash")
+	}
+}
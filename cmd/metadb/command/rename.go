@@ -0,0 +1,92 @@
+package command
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// RenameRule rewrites names that match a regular expression.  The
+// replacement may refer to submatches as in regexp.Regexp.ReplaceAllString.
+type RenameRule struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// RenameRules are ordered lists of rules for rewriting the schema and table
+// names of a data source.  Each rule is applied to the result of the
+// previous rules.
+type RenameRules struct {
+	Schema []RenameRule
+	Table  []RenameRule
+}
+
+// defaultSchemaRenames are the schema rename rules used for modules that do
+// not define their own.  They remove the prefix "mod_" and the suffix
+// "_storage" that are used in FOLIO schema names, and the first "mod" in
+// tenant-qualified ReShare schema names such as "east_mod_rs".
+var defaultSchemaRenames = map[string][]string{
+	"folio":   {"^mod_:", "_storage$:", "^(.*?)_mod_:${1}_"},
+	"reshare": {"^mod_:", "_storage$:", "^(.*?)_mod_:${1}_"},
+}
+
+// NewRenameRules compiles schema and table rename rules.  Each rule has the
+// form regexp:replacement.  If no schema rules are defined, the default
+// rules for the module are used.
+func NewRenameRules(module string, schemaRules, tableRules []string) (*RenameRules, error) {
+	if len(schemaRules) == 0 {
+		schemaRules = defaultSchemaRenames[module]
+	}
+	r := &RenameRules{}
+	for _, s := range schemaRules {
+		rule, err := ParseRenameRule(s)
+		if err != nil {
+			return nil, err
+		}
+		r.Schema = append(r.Schema, rule)
+	}
+	for _, s := range tableRules {
+		rule, err := ParseRenameRule(s)
+		if err != nil {
+			return nil, err
+		}
+		r.Table = append(r.Table, rule)
+	}
+	return r, nil
+}
+
+// ParseRenameRule parses a rename rule of the form regexp:replacement.  The
+// regular expression extends to the last colon, and the replacement may be
+// empty.
+func ParseRenameRule(s string) (RenameRule, error) {
+	i := strings.LastIndexByte(s, ':')
+	if i < 1 {
+		return RenameRule{}, fmt.Errorf("invalid rename rule %q", s)
+	}
+	re, err := regexp.Compile(s[:i])
+	if err != nil {
+		return RenameRule{}, fmt.Errorf("compiling regular expression %s: %v", s[:i], err)
+	}
+	return RenameRule{Pattern: re, Replacement: s[i+1:]}, nil
+}
+
+func (r *RenameRules) renameSchema(schema string) string {
+	if r == nil {
+		return schema
+	}
+	return rename(r.Schema, schema)
+}
+
+func (r *RenameRules) renameTable(table string) string {
+	if r == nil {
+		return table
+	}
+	return rename(r.Table, table)
+}
+
+func rename(rules []RenameRule, name string) string {
+	for _, rule := range rules {
+		name = rule.Pattern.ReplaceAllString(name, rule.Replacement)
+	}
+	return name
+}
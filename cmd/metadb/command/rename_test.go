@@ -0,0 +1,38 @@
+package command
+
+import "testing"
+
+func TestRenameRules(t *testing.T) {
+	tests := []struct {
+		module      string
+		schemaRules []string
+		tableRules  []string
+		schema      string
+		table       string
+		wantSchema  string
+		wantTable   string
+	}{
+		{"folio", nil, nil, "mod_inventory_storage", "item", "inventory", "item"},
+		{"reshare", nil, nil, "east_mod_rs", "patron_request", "east_rs", "patron_request"},
+		{"reshare", nil, nil, "east_mod_rs_mod_x", "t", "east_rs_mod_x", "t"},
+		{"folio", nil, nil, "mod_a_mod_b_mod_c_storage", "t", "a_b_mod_c", "t"},
+		{"", nil, nil, "mod_x", "t", "mod_x", "t"},
+		{"folio", []string{`^(\w+)_v\d+$:${1}`}, []string{`^tbl_:`, `_old$:_archive`}, "sales_v2", "tbl_orders_old",
+			"sales", "orders_archive"},
+	}
+	for _, tt := range tests {
+		r, err := NewRenameRules(tt.module, tt.schemaRules, tt.tableRules)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.renameSchema(tt.schema); got != tt.wantSchema {
+			t.Errorf("renameSchema(%q) = %q; want %q", tt.schema, got, tt.wantSchema)
+		}
+		if got := r.renameTable(tt.table); got != tt.wantTable {
+			t.Errorf("renameTable(%q) = %q; want %q", tt.table, got, tt.wantTable)
+		}
+	}
+	if _, err := ParseRenameRule("no_colon"); err == nil {
+		t.Error("ParseRenameRule: expected error")
+	}
+}
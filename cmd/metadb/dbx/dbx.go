@@ -217,3 +217,27 @@ func EncodeString(b *strings.Builder, s string) {
 	}
 	b.WriteRune('\'')
 }
+
+// EncodeCopyText writes a value in the text format of the COPY command,
+// in which NULL is written as \N and backslashes and control characters
+// that delimit rows and columns are escaped.
+func EncodeCopyText(b *strings.Builder, s *string) {
+	if s == nil {
+		b.WriteString("\\N")
+		return
+	}
+	for _, c := range *s {
+		switch c {
+		case '\\':
+			b.WriteString("\\\\")
+		case '\n':
+			b.WriteString("\\n")
+		case '\r':
+			b.WriteString("\\r")
+		case '\t':
+			b.WriteString("\\t")
+		default:
+			b.WriteRune(c)
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"strconv"
+	"strings"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgproto3"
@@ -24,10 +26,6 @@ func alterDataSource(conn net.Conn, node *ast.AlterDataSourceStmt, dc *pgx.Conn)
 		return err
 	}
 
-	_ = writeEncoded(conn, []pgproto3.Message{
-		&pgproto3.NoticeResponse{Severity: "INFO", Message: "restart server for data source changes to take effect"},
-	})
-
 	return writeEncoded(conn, []pgproto3.Message{
 		&pgproto3.CommandComplete{CommandTag: []byte("ALTER DATA SOURCE")},
 		&pgproto3.ReadyForQuery{TxStatus: 'I'},
@@ -40,19 +38,72 @@ func alterSourceOptions(dc *pgx.Conn, node *ast.AlterDataSourceStmt) error {
 		switch opt.Name {
 		case "consumergroup":
 			name = "consumer_group"
+		case "schemaregistry":
+			name = "schema_registry"
+		case "deadletter":
+			name = "dead_letter"
+		case "deadlettertopic":
+			name = "dead_letter_topic"
 		case "schemapassfilter":
 			name = "schema_pass_filter"
 		case "schemastopfilter":
 			name = "schema_stop_filter"
 		case "tablestopfilter":
 			name = "table_stop_filter"
+		case "columnstopfilter":
+			name = "column_stop_filter"
+		case "columnmask":
+			name = "column_mask"
+		case "columnmasksalt":
+			name = "column_mask_salt"
+		case "schemarename":
+			name = "schema_rename"
+		case "tablerename":
+			name = "table_rename"
 		case "trimschemaprefix":
 			name = "trim_schema_prefix"
 		case "addschemaprefix":
 			name = "add_schema_prefix"
+		case "historyretention":
+			name = "history_retention"
+		case "changelog":
+			name = "change_log"
 		default:
 			name = opt.Name
 		}
+		if name == "enable" {
+			if err := alterSourceEnable(dc, node.DataSourceName, opt); err != nil {
+				return err
+			}
+			continue
+		}
+		if (name == "flattened" || name == "schemaless" || name == "change_log") && opt.Action != "DROP" {
+			val, err := sourceBoolOption(name, opt.Val)
+			if err != nil {
+				return err
+			}
+			opt.Val = strconv.FormatBool(val)
+		}
+		if name == "dead_letter" && opt.Action != "DROP" {
+			if err := checkDeadLetterOption(opt.Val); err != nil {
+				return err
+			}
+		}
+		if name == "column_mask" && opt.Action != "DROP" {
+			if err := checkColumnMaskOption(opt.Val); err != nil {
+				return err
+			}
+		}
+		if (name == "schema_rename" || name == "table_rename") && opt.Action != "DROP" {
+			if err := checkRenameOption(opt.Val); err != nil {
+				return err
+			}
+		}
+		if name == "history_retention" && opt.Action != "DROP" {
+			if err := checkHistoryRetentionOption(opt.Val); err != nil {
+				return err
+			}
+		}
 		switch name {
 		case "brokers":
 			fallthrough
@@ -62,12 +113,32 @@ func alterSourceOptions(dc *pgx.Conn, node *ast.AlterDataSourceStmt) error {
 			fallthrough
 		case "consumer_group":
 			fallthrough
+		case "schema_registry":
+			fallthrough
+		case "flattened":
+			fallthrough
+		case "schemaless":
+			fallthrough
+		case "dead_letter":
+			fallthrough
+		case "dead_letter_topic":
+			fallthrough
 		case "schema_pass_filter":
 			fallthrough
 		case "schema_stop_filter":
 			fallthrough
 		case "table_stop_filter":
 			fallthrough
+		case "column_stop_filter":
+			fallthrough
+		case "column_mask":
+			fallthrough
+		case "column_mask_salt":
+			fallthrough
+		case "schema_rename":
+			fallthrough
+		case "table_rename":
+			fallthrough
 		case "trim_schema_prefix":
 			fallthrough
 		case "add_schema_prefix":
@@ -75,12 +146,24 @@ func alterSourceOptions(dc *pgx.Conn, node *ast.AlterDataSourceStmt) error {
 		case "map_public_schema":
 			fallthrough
 		case "module":
+			fallthrough
+		case "path":
+			fallthrough
+		case "connection":
+			fallthrough
+		case "publication":
+			fallthrough
+		case "slot":
+			fallthrough
+		case "history_retention":
+			fallthrough
+		case "change_log":
 			// NOP
 		default:
 			return &dberr.Error{
 				Err: fmt.Errorf("invalid option %q", opt.Name),
 				Hint: "Valid options in this context are: " +
-					"brokers, security, topics, consumer_group, schema_pass_filter, schema_stop_filter, table_stop_filter, trim_schema_prefix, add_schema_prefix, map_public_schema, module",
+					"brokers, security, topics, consumer_group, schema_registry, flattened, schemaless, dead_letter, dead_letter_topic, schema_pass_filter, schema_stop_filter, table_stop_filter, column_stop_filter, column_mask, column_mask_salt, schema_rename, table_rename, trim_schema_prefix, add_schema_prefix, map_public_schema, module, path, connection, publication, slot, history_retention, change_log, enable",
 			}
 		}
 		isnull, err := isSourceOptionNull(dc, node.DataSourceName, name)
@@ -114,11 +197,39 @@ func alterSourceOptions(dc *pgx.Conn, node *ast.AlterDataSourceStmt) error {
 				return fmt.Errorf("unable to add option %q", name)
 			}
 		}
+		if name == "path" || name == "slot" {
+			// The stored position refers to the previous path or
+			// replication slot.
+			if err := updateSource(dc, node.DataSourceName, "position", "NULL"); err != nil {
+				return fmt.Errorf("unable to reset source position")
+			}
+		}
 	}
 
 	return nil
 }
 
+// alterSourceEnable enables or disables a data source.  The enable option
+// always has a value, and so it can be set but not dropped.
+func alterSourceEnable(dc *pgx.Conn, sourceName string, opt ast.Option) error {
+	if opt.Action == "DROP" {
+		return fmt.Errorf("option %q cannot be dropped", opt.Name)
+	}
+	var val string
+	switch strings.ToLower(opt.Val) {
+	case "true":
+		val = "TRUE"
+	case "false":
+		val = "FALSE"
+	default:
+		return fmt.Errorf("invalid value %q for option %q", opt.Val, opt.Name)
+	}
+	if err := updateSource(dc, sourceName, "enable", val); err != nil {
+		return fmt.Errorf("unable to set option %q", opt.Name)
+	}
+	return nil
+}
+
 func isSourceOptionNull(dc *pgx.Conn, sourceName, optionName string) (bool, error) {
 	var val *string
 	q := "SELECT " + optionName + " FROM metadb.source WHERE name='" + sourceName + "'"
@@ -3,6 +3,7 @@ package libpq
 import (
 	"fmt"
 	"net"
+	"strconv"
 
 	"github.com/jackc/pgx/v5/pgproto3"
 	"github.com/metadb-project/metadb/cmd/metadb/ast"
@@ -14,12 +15,29 @@ func alterSystem(conn net.Conn, node *ast.AlterSystemStmt, cat *catalog.Catalog)
 		return fmt.Errorf("unrecognized configuration parameter %q", node.ConfigParameter)
 	}
 
+	switch node.ConfigParameter {
+	case "client_auth_method":
+		switch node.Value {
+		case authTrust, authMD5, authSCRAMSHA256:
+		default:
+			return fmt.Errorf("invalid value %q for %q", node.Value, node.ConfigParameter)
+		}
+	case "allow_unmasked_events":
+		if node.Value != "true" && node.Value != "false" {
+			return fmt.Errorf("invalid value %q for %q", node.Value, node.ConfigParameter)
+		}
+	case "apply_concurrency", "retry_initial_interval", "retry_max_interval":
+		if n, err := strconv.Atoi(node.Value); err != nil || n < 1 {
+			return fmt.Errorf("invalid value %q for %q", node.Value, node.ConfigParameter)
+		}
+	}
+
 	if err := cat.SetConfig(node.ConfigParameter, node.Value); err != nil {
 		return err
 	}
 
 	switch node.ConfigParameter {
-	case "kafka_sync_concurrency":
+	case "apply_concurrency", "kafka_sync_concurrency":
 		_ = writeEncoded(conn, []pgproto3.Message{
 			&pgproto3.NoticeResponse{
 				Severity: "INFO",
@@ -3,6 +3,7 @@ package libpq
 import (
 	"fmt"
 	"net"
+	"slices"
 	"strings"
 
 	"github.com/jackc/pgx/v5"
@@ -89,6 +90,93 @@ func alterTableAlterColumn(conn net.Conn, node *ast.AlterTableAlterColumnStmt, d
 	})
 }
 
+// alterTableSetPrimaryKey defines a primary key override for a table, which
+// is used to identify rows in change events that have no key.  The table
+// need not exist yet.
+func alterTableSetPrimaryKey(conn net.Conn, node *ast.AlterTableSetPrimaryKeyStmt, dc *pgx.Conn, cat *catalog.Catalog) error {
+	table, err := parseMainTableName(node.TableName)
+	if err != nil {
+		return err
+	}
+	for i, c := range node.Columns {
+		if slices.Contains(node.Columns[:i], c) {
+			return fmt.Errorf("column %q specified more than once", c)
+		}
+	}
+
+	_ = writeEncoded(conn, []pgproto3.Message{&pgproto3.NoticeResponse{Severity: "INFO",
+		Message: "waiting for stream processor lock"},
+	})
+
+	catalog.ExecMutex.Lock()
+	defer catalog.ExecMutex.Unlock()
+
+	pk := &catalog.PrimaryKeyOverride{Columns: node.Columns, RowHash: node.RowHash}
+	if err = cat.SetPrimaryKeyOverride(dc, table, pk); err != nil {
+		return err
+	}
+	return writeEncoded(conn, []pgproto3.Message{
+		&pgproto3.CommandComplete{CommandTag: []byte("ALTER TABLE")},
+		&pgproto3.ReadyForQuery{TxStatus: 'I'},
+	})
+}
+
+func alterTableDropPrimaryKey(conn net.Conn, node *ast.AlterTableDropPrimaryKeyStmt, dc *pgx.Conn, cat *catalog.Catalog) error {
+	table, err := parseMainTableName(node.TableName)
+	if err != nil {
+		return err
+	}
+
+	_ = writeEncoded(conn, []pgproto3.Message{&pgproto3.NoticeResponse{Severity: "INFO",
+		Message: "waiting for stream processor lock"},
+	})
+
+	catalog.ExecMutex.Lock()
+	defer catalog.ExecMutex.Unlock()
+
+	if err = cat.DropPrimaryKeyOverride(dc, table); err != nil {
+		return err
+	}
+	return writeEncoded(conn, []pgproto3.Message{
+		&pgproto3.CommandComplete{CommandTag: []byte("ALTER TABLE")},
+		&pgproto3.ReadyForQuery{TxStatus: 'I'},
+	})
+}
+
+// alterTableSetHistoryRetention defines a history retention policy for a
+// table, which overrides the policy of its data source.  The policy is
+// enforced during daily maintenance.
+func alterTableSetHistoryRetention(conn net.Conn, node *ast.AlterTableSetHistoryRetentionStmt, dc *pgx.Conn, cat *catalog.Catalog) error {
+	table, err := parseMainTableName(node.TableName)
+	if err != nil {
+		return err
+	}
+	if err = checkHistoryRetentionOption(node.Retention); err != nil {
+		return err
+	}
+	if err = cat.SetHistoryRetention(dc, table, node.Retention); err != nil {
+		return err
+	}
+	return writeEncoded(conn, []pgproto3.Message{
+		&pgproto3.CommandComplete{CommandTag: []byte("ALTER TABLE")},
+		&pgproto3.ReadyForQuery{TxStatus: 'I'},
+	})
+}
+
+func alterTableDropHistoryRetention(conn net.Conn, node *ast.AlterTableDropHistoryRetentionStmt, dc *pgx.Conn, cat *catalog.Catalog) error {
+	table, err := parseMainTableName(node.TableName)
+	if err != nil {
+		return err
+	}
+	if err = cat.DropHistoryRetention(dc, table); err != nil {
+		return err
+	}
+	return writeEncoded(conn, []pgproto3.Message{
+		&pgproto3.CommandComplete{CommandTag: []byte("ALTER TABLE")},
+		&pgproto3.ReadyForQuery{TxStatus: 'I'},
+	})
+}
+
 func validateColumnType(columnType string) error {
 	switch columnType {
 	case "text":
@@ -0,0 +1,345 @@
+package libpq
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/metadb-project/metadb/cmd/metadb/catalog"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+	"github.com/metadb-project/metadb/cmd/metadb/util"
+)
+
+// Client authentication methods, set by the configuration parameter
+// client_auth_method.
+const (
+	authTrust       = "trust"
+	authMD5         = "md5"
+	authSCRAMSHA256 = "scram-sha-256"
+)
+
+// authenticate performs password authentication of a client.  Password
+// verifiers are read from the password file in the data directory, or
+// otherwise from the database for the Metadb administrative user.  Other
+// users are not allowed to log in, because client sessions run as the
+// administrative user.  Verifiers use the same formats as PostgreSQL:
+// "SCRAM-SHA-256$<iterations>:<salt>$<StoredKey>:<ServerKey>" or "md5"
+// followed by the MD5 hash of the password concatenated with the user name.
+func authenticate(cat *catalog.Catalog, backend *pgproto3.Backend, db *dbx.DB, datadir, user string) error {
+	method, err := cat.GetConfig("client_auth_method")
+	if err != nil {
+		return err
+	}
+	if method == authTrust {
+		return nil
+	}
+	if method != authMD5 && method != authSCRAMSHA256 {
+		return fmt.Errorf("invalid value %q for client_auth_method", method)
+	}
+	verifier, err := readPasswordVerifier(db, datadir, user)
+	if err != nil {
+		return err
+	}
+	var ok bool
+	// As in PostgreSQL, SCRAM is used if the verifier does not support MD5.
+	if method == authMD5 && strings.HasPrefix(verifier, "md5") {
+		ok, err = authenticateMD5(backend, user, verifier)
+	} else {
+		ok, err = authenticateSCRAM(backend, verifier)
+	}
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("password authentication failed for user %q", user)
+	}
+	return nil
+}
+
+// readPasswordVerifier returns the password verifier for a user, or "" if
+// none is found or the user is not allowed to log in.
+func readPasswordVerifier(db *dbx.DB, datadir, user string) (string, error) {
+	verifier, found, err := readPasswordFile(util.PasswordFileName(datadir), user)
+	if err != nil {
+		return "", err
+	}
+	if found {
+		return verifier, nil
+	}
+	if user != db.User {
+		return "", nil
+	}
+	dcsuper, err := db.ConnectSuper()
+	if err != nil {
+		return "", fmt.Errorf("connecting to database: %w", err)
+	}
+	defer dbx.Close(dcsuper)
+	var rolpassword *string
+	q := "SELECT rolpassword FROM pg_catalog.pg_authid WHERE rolname=$1"
+	err = dcsuper.QueryRow(context.TODO(), q, user).Scan(&rolpassword)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return "", nil
+	case err != nil:
+		return "", fmt.Errorf("reading password: %w", util.PGErr(err))
+	case rolpassword == nil:
+		return "", nil
+	default:
+		return *rolpassword, nil
+	}
+}
+
+// readPasswordFile looks up a user in the password file, which contains
+// lines of the form "user:verifier".  Empty lines and lines beginning with
+// "#" are ignored.  A missing file is treated as empty.
+func readPasswordFile(filename, user string) (string, bool, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("reading password file: %w", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		u, verifier, ok := strings.Cut(line, ":")
+		if ok && u == user {
+			return verifier, true, nil
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return "", false, fmt.Errorf("reading password file: %w", err)
+	}
+	return "", false, nil
+}
+
+func authenticateMD5(backend *pgproto3.Backend, user, verifier string) (bool, error) {
+	var salt [4]byte
+	if _, err := rand.Read(salt[:]); err != nil {
+		return false, err
+	}
+	backend.Send(&pgproto3.AuthenticationMD5Password{Salt: salt})
+	if err := backend.Flush(); err != nil {
+		return false, err
+	}
+	if err := backend.SetAuthType(pgproto3.AuthTypeMD5Password); err != nil {
+		return false, err
+	}
+	msg, err := backend.Receive()
+	if err != nil {
+		return false, err
+	}
+	pw, ok := msg.(*pgproto3.PasswordMessage)
+	if !ok {
+		return false, fmt.Errorf("expected password message, received %T", msg)
+	}
+	sum := md5.Sum(append([]byte(strings.TrimPrefix(verifier, "md5")), salt[:]...))
+	expected := "md5" + hex.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(pw.Password), []byte(expected)) == 1, nil
+}
+
+// scramVerifier is a parsed SCRAM-SHA-256 password verifier.
+type scramVerifier struct {
+	iterations int
+	salt       []byte
+	storedKey  []byte
+	serverKey  []byte
+}
+
+func parseSCRAMVerifier(verifier string) (*scramVerifier, bool) {
+	mech, rest, ok := strings.Cut(verifier, "$")
+	if !ok || mech != "SCRAM-SHA-256" {
+		return nil, false
+	}
+	iterSalt, keys, ok := strings.Cut(rest, "$")
+	if !ok {
+		return nil, false
+	}
+	iter, salt, ok := strings.Cut(iterSalt, ":")
+	if !ok {
+		return nil, false
+	}
+	stored, server, ok := strings.Cut(keys, ":")
+	if !ok {
+		return nil, false
+	}
+	var v scramVerifier
+	var err error
+	if v.iterations, err = strconv.Atoi(iter); err != nil {
+		return nil, false
+	}
+	if v.salt, err = base64.StdEncoding.DecodeString(salt); err != nil {
+		return nil, false
+	}
+	if v.storedKey, err = base64.StdEncoding.DecodeString(stored); err != nil {
+		return nil, false
+	}
+	if v.serverKey, err = base64.StdEncoding.DecodeString(server); err != nil {
+		return nil, false
+	}
+	return &v, true
+}
+
+// authenticateSCRAM performs SCRAM-SHA-256 authentication (RFC 7677) without
+// channel binding.  If the verifier is missing or invalid, the exchange is
+// completed with a random salt and then fails, so that the client cannot
+// distinguish an unknown user from an incorrect password.
+func authenticateSCRAM(backend *pgproto3.Backend, verifier string) (bool, error) {
+	v, valid := parseSCRAMVerifier(verifier)
+	if !valid {
+		v = &scramVerifier{iterations: 4096, salt: make([]byte, 16)}
+		if _, err := rand.Read(v.salt); err != nil {
+			return false, err
+		}
+	}
+
+	backend.Send(&pgproto3.AuthenticationSASL{AuthMechanisms: []string{"SCRAM-SHA-256"}})
+	if err := backend.Flush(); err != nil {
+		return false, err
+	}
+	if err := backend.SetAuthType(pgproto3.AuthTypeSASL); err != nil {
+		return false, err
+	}
+	msg, err := backend.Receive()
+	if err != nil {
+		return false, err
+	}
+	initial, ok := msg.(*pgproto3.SASLInitialResponse)
+	if !ok {
+		return false, fmt.Errorf("expected SASL initial response, received %T", msg)
+	}
+	if initial.AuthMechanism != "SCRAM-SHA-256" {
+		return false, fmt.Errorf("unsupported SASL mechanism %q", initial.AuthMechanism)
+	}
+	// client-first-message = gs2-header client-first-message-bare
+	clientFirst := string(initial.Data)
+	if !strings.HasPrefix(clientFirst, "n,") && !strings.HasPrefix(clientFirst, "y,") {
+		return false, fmt.Errorf("unsupported SCRAM channel binding")
+	}
+	gs2Header, clientFirstBare, err := splitGS2Header(clientFirst)
+	if err != nil {
+		return false, err
+	}
+	clientNonce := scramAttribute(clientFirstBare, 'r')
+	if clientNonce == "" {
+		return false, fmt.Errorf("invalid SCRAM client-first-message")
+	}
+
+	serverNonce, err := scramServerNonce()
+	if err != nil {
+		return false, err
+	}
+	combinedNonce := clientNonce + serverNonce
+	serverFirst := "r=" + combinedNonce + ",s=" + base64.StdEncoding.EncodeToString(v.salt) +
+		",i=" + strconv.Itoa(v.iterations)
+	backend.Send(&pgproto3.AuthenticationSASLContinue{Data: []byte(serverFirst)})
+	if err = backend.Flush(); err != nil {
+		return false, err
+	}
+	if err = backend.SetAuthType(pgproto3.AuthTypeSASLContinue); err != nil {
+		return false, err
+	}
+	msg, err = backend.Receive()
+	if err != nil {
+		return false, err
+	}
+	resp, ok := msg.(*pgproto3.SASLResponse)
+	if !ok {
+		return false, fmt.Errorf("expected SASL response, received %T", msg)
+	}
+	clientFinal := string(resp.Data)
+	i := strings.LastIndex(clientFinal, ",p=")
+	if i < 0 {
+		return false, fmt.Errorf("invalid SCRAM client-final-message")
+	}
+	clientFinalWithoutProof := clientFinal[:i]
+	proof, err := base64.StdEncoding.DecodeString(clientFinal[i+3:])
+	if err != nil {
+		return false, fmt.Errorf("invalid SCRAM client proof")
+	}
+	if scramAttribute(clientFinalWithoutProof, 'r') != combinedNonce ||
+		scramAttribute(clientFinalWithoutProof, 'c') != base64.StdEncoding.EncodeToString([]byte(gs2Header)) {
+		return false, nil
+	}
+	if !valid || len(proof) != sha256.Size {
+		return false, nil
+	}
+
+	authMessage := []byte(clientFirstBare + "," + serverFirst + "," + clientFinalWithoutProof)
+	clientSignature := hmacSHA256(v.storedKey, authMessage)
+	clientKey := make([]byte, len(proof))
+	for j := range proof {
+		clientKey[j] = proof[j] ^ clientSignature[j]
+	}
+	storedKey := sha256.Sum256(clientKey)
+	if subtle.ConstantTimeCompare(storedKey[:], v.storedKey) != 1 {
+		return false, nil
+	}
+	serverSignature := hmacSHA256(v.serverKey, authMessage)
+	backend.Send(&pgproto3.AuthenticationSASLFinal{
+		Data: []byte("v=" + base64.StdEncoding.EncodeToString(serverSignature)),
+	})
+	if err = backend.Flush(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// scramServerNonce returns a random nonce to be appended to the client nonce.
+// It is a variable so that tests can use a fixed nonce.
+var scramServerNonce = func() (string, error) {
+	nonce := make([]byte, 18)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(nonce), nil
+}
+
+// splitGS2Header splits a SCRAM client-first-message into the GS2 header,
+// including its trailing comma, and the client-first-message-bare.
+func splitGS2Header(msg string) (string, string, error) {
+	i := strings.Index(msg, ",")
+	if i < 0 {
+		return "", "", fmt.Errorf("invalid SCRAM client-first-message")
+	}
+	j := strings.Index(msg[i+1:], ",")
+	if j < 0 {
+		return "", "", fmt.Errorf("invalid SCRAM client-first-message")
+	}
+	n := i + 1 + j + 1
+	return msg[:n], msg[n:], nil
+}
+
+// scramAttribute returns the value of an attribute in a SCRAM message.
+func scramAttribute(msg string, name byte) string {
+	for _, a := range strings.Split(msg, ",") {
+		if len(a) >= 2 && a[0] == name && a[1] == '=' {
+			return a[2:]
+		}
+	}
+	return ""
+}
+
+func hmacSHA256(key, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
@@ -0,0 +1,209 @@
+package libpq
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+	"github.com/metadb-project/metadb/cmd/metadb/util"
+)
+
+// authResult is the result of an authentication function run by the
+// backend.
+type authResult struct {
+	ok  bool
+	err error
+}
+
+// startAuth runs an authentication function on the backend end of a pipe
+// and returns a frontend connected to the other end.
+func startAuth(t *testing.T, auth func(backend *pgproto3.Backend) (bool, error)) (*pgproto3.Frontend, chan authResult) {
+	server, client := net.Pipe()
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = server.Close()
+	})
+	result := make(chan authResult, 1)
+	go func() {
+		ok, err := auth(pgproto3.NewBackend(server, server))
+		result <- authResult{ok, err}
+	}()
+	return pgproto3.NewFrontend(client, client), result
+}
+
+func send(t *testing.T, fe *pgproto3.Frontend, msg pgproto3.FrontendMessage) {
+	t.Helper()
+	fe.Send(msg)
+	if err := fe.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func receive[T pgproto3.BackendMessage](t *testing.T, fe *pgproto3.Frontend) T {
+	t.Helper()
+	msg, err := fe.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, ok := msg.(T)
+	if !ok {
+		t.Fatalf("received %T", msg)
+	}
+	return m
+}
+
+// The example SCRAM-SHA-256 exchange from RFC 7677, for the user "user" with
+// password "pencil".
+const (
+	rfc7677Verifier = "SCRAM-SHA-256$4096:W22ZaJ0SNY7soEsUEjb6gQ==$" +
+		"WG5d8oPm3OtcPnkdi4Uo7BkeZkBFzpcXkuLmtbsT4qY=:wfPLwcE6nTWhTAmQ7tl2KeoiWGPlZqQxSrmfPwDl2dU="
+	rfc7677ServerNonce = "%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0"
+	rfc7677ClientFirst = "n,,n=user,r=rOprNGfwEbeRWgbNEkqO"
+	rfc7677ServerFirst = "r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0," +
+		"s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"
+	rfc7677ClientFinalWithoutProof = "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0"
+	rfc7677Proof                   = "dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ="
+	rfc7677ServerFinal             = "v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="
+)
+
+func TestAuthenticateSCRAM(t *testing.T) {
+	saved := scramServerNonce
+	scramServerNonce = func() (string, error) { return rfc7677ServerNonce, nil }
+	t.Cleanup(func() { scramServerNonce = saved })
+
+	badProof := base64.StdEncoding.EncodeToString(make([]byte, 32))
+	tests := []struct {
+		name     string
+		verifier string
+		proof    string
+		ok       bool
+	}{
+		{"valid", rfc7677Verifier, rfc7677Proof, true},
+		{"bad password", rfc7677Verifier, badProof, false},
+		{"unknown user", "", rfc7677Proof, false},
+		{"md5 verifier", "md5" + hex.EncodeToString(make([]byte, 16)), rfc7677Proof, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fe, result := startAuth(t, func(backend *pgproto3.Backend) (bool, error) {
+				return authenticateSCRAM(backend, tt.verifier)
+			})
+			sasl := receive[*pgproto3.AuthenticationSASL](t, fe)
+			if len(sasl.AuthMechanisms) != 1 || sasl.AuthMechanisms[0] != "SCRAM-SHA-256" {
+				t.Fatalf("mechanisms = %v", sasl.AuthMechanisms)
+			}
+			send(t, fe, &pgproto3.SASLInitialResponse{AuthMechanism: "SCRAM-SHA-256", Data: []byte(rfc7677ClientFirst)})
+			cont := receive[*pgproto3.AuthenticationSASLContinue](t, fe)
+			if tt.verifier == rfc7677Verifier && string(cont.Data) != rfc7677ServerFirst {
+				t.Errorf("server-first-message = %q; want %q", cont.Data, rfc7677ServerFirst)
+			}
+			send(t, fe, &pgproto3.SASLResponse{Data: []byte(rfc7677ClientFinalWithoutProof + ",p=" + tt.proof)})
+			if tt.ok {
+				final := receive[*pgproto3.AuthenticationSASLFinal](t, fe)
+				if string(final.Data) != rfc7677ServerFinal {
+					t.Errorf("server-final-message = %q; want %q", final.Data, rfc7677ServerFinal)
+				}
+			}
+			r := <-result
+			if r.err != nil {
+				t.Fatal(r.err)
+			}
+			if r.ok != tt.ok {
+				t.Errorf("ok = %v; want %v", r.ok, tt.ok)
+			}
+		})
+	}
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestAuthenticateMD5(t *testing.T) {
+	verifier := "md5" + md5Hex("pencil"+"user")
+	for _, password := range []string{"pencil", "paper", ""} {
+		t.Run(password, func(t *testing.T) {
+			fe, result := startAuth(t, func(backend *pgproto3.Backend) (bool, error) {
+				return authenticateMD5(backend, "user", verifier)
+			})
+			m := receive[*pgproto3.AuthenticationMD5Password](t, fe)
+			response := "md5" + md5Hex(md5Hex(password+"user")+string(m.Salt[:]))
+			send(t, fe, &pgproto3.PasswordMessage{Password: response})
+			r := <-result
+			if r.err != nil {
+				t.Fatal(r.err)
+			}
+			if want := password == "pencil"; r.ok != want {
+				t.Errorf("ok = %v; want %v", r.ok, want)
+			}
+		})
+	}
+}
+
+func TestReadPasswordFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "metadb.passwd")
+	data := "# comment\n\nuser:" + rfc7677Verifier + "\n  other:md5abc  \n"
+	if err := os.WriteFile(filename, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		user     string
+		verifier string
+		found    bool
+	}{
+		{"user", rfc7677Verifier, true},
+		{"other", "md5abc", true},
+		{"nobody", "", false},
+		{"# comment", "", false},
+	}
+	for _, tt := range tests {
+		verifier, found, err := readPasswordFile(filename, tt.user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if verifier != tt.verifier || found != tt.found {
+			t.Errorf("readPasswordFile(%q) = %q, %v; want %q, %v", tt.user, verifier, found, tt.verifier, tt.found)
+		}
+	}
+	if _, found, err := readPasswordFile(filepath.Join(t.TempDir(), "missing"), "user"); found || err != nil {
+		t.Errorf("missing file: found = %v, err = %v", found, err)
+	}
+}
+
+func TestReadPasswordVerifier(t *testing.T) {
+	datadir := t.TempDir()
+	data := "analyst:" + rfc7677Verifier + "\n"
+	if err := os.WriteFile(util.PasswordFileName(datadir), []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// Users other than the administrative user are refused unless they
+	// are listed in the password file: without a verifier, authentication
+	// fails as for an unknown user in TestAuthenticateSCRAM.  The database
+	// is not read for these users, and so no connection parameters are
+	// needed.
+	db := &dbx.DB{User: "metadb"}
+	tests := []struct {
+		user     string
+		verifier string
+	}{
+		{"analyst", rfc7677Verifier},
+		{"registered", ""},
+		{"postgres", ""},
+	}
+	for _, tt := range tests {
+		verifier, err := readPasswordVerifier(db, datadir, tt.user)
+		if err != nil {
+			t.Fatalf("readPasswordVerifier(%q): %v", tt.user, err)
+		}
+		if verifier != tt.verifier {
+			t.Errorf("readPasswordVerifier(%q) = %q; want %q", tt.user, verifier, tt.verifier)
+		}
+	}
+}
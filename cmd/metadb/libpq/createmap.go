@@ -6,6 +6,7 @@ import (
 	"regexp"
 	"strings"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgproto3"
 	"github.com/metadb-project/metadb/cmd/metadb/ast"
 	"github.com/metadb-project/metadb/cmd/metadb/catalog"
@@ -16,7 +17,7 @@ var schemaTableRegexp = regexp.MustCompile(`^[_a-z][0-9_a-z]*[.][_a-z][0-9_a-z]*
 var columnRegexp = regexp.MustCompile(`^[_a-z][0-9_a-z]*$`)
 var identifierRegexp = regexp.MustCompile(`^[a-z][0-9a-z]*$`)
 
-func createDataMapping(conn net.Conn, node *ast.CreateDataMappingStmt, cat *catalog.Catalog) error {
+func createDataMapping(conn net.Conn, node *ast.CreateDataMappingStmt, dc *pgx.Conn, cat *catalog.Catalog) error {
 	// The only mapping type currently supported is json.
 	if node.TypeName != "json" {
 		return fmt.Errorf("mapping type %q not supported", node.TypeName)
@@ -64,7 +65,7 @@ func createDataMapping(conn net.Conn, node *ast.CreateDataMappingStmt, cat *cata
 		return fmt.Errorf("target identifier %q is too long (maximum length %d characters)", node.TargetIdentifier, maxTargetIdentifierLen)
 	}
 
-	if err := cat.DefineJSONMapping(table.Schema, table.Table, node.ColumnName, node.Path, node.TargetIdentifier); err != nil {
+	if err := cat.DefineJSONMapping(dc, table.Schema, table.Table, node.ColumnName, node.Path, node.TargetIdentifier); err != nil {
 		return err
 	}
 
@@ -4,11 +4,14 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"strconv"
 	"strings"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgproto3"
 	"github.com/metadb-project/metadb/cmd/metadb/ast"
+	"github.com/metadb-project/metadb/cmd/metadb/catalog"
+	"github.com/metadb-project/metadb/cmd/metadb/command"
 	"github.com/metadb-project/metadb/cmd/metadb/dberr"
 	"github.com/metadb-project/metadb/cmd/metadb/sysdb"
 )
@@ -22,18 +25,10 @@ func createDataSource(conn net.Conn, node *ast.CreateDataSourceStmt, dc *pgx.Con
 		return fmt.Errorf("data source %q already exists", node.DataSourceName)
 	}
 
-	var count int64
-	q := "SELECT count(*) FROM metadb.source"
-	err = dc.QueryRow(context.TODO(), q).Scan(&count)
-	if err != nil {
-		return fmt.Errorf("checking number of configured sources: %w", err)
-	}
-	if count > 0 {
-		return fmt.Errorf("multiple sources not currently supported")
-	}
-
 	name := node.DataSourceName
-	if node.TypeName != "kafka" {
+	switch node.TypeName {
+	case "kafka", "file", "postgresql":
+	default:
 		return fmt.Errorf("invalid data source type %q", node.TypeName)
 	}
 	if node.Options == nil {
@@ -43,15 +38,43 @@ func createDataSource(conn net.Conn, node *ast.CreateDataSourceStmt, dc *pgx.Con
 	if err != nil {
 		return err
 	}
+	if node.TypeName == "file" && src.Path == "" {
+		return fmt.Errorf("option \"path\" is required for data source type %q", node.TypeName)
+	}
+	if node.TypeName == "postgresql" {
+		for _, o := range []struct{ name, val string }{
+			{"connection", src.Connection}, {"publication", src.Publication}, {"slot", src.Slot},
+		} {
+			if o.val == "" {
+				return fmt.Errorf("option %q is required for data source type %q", o.name, node.TypeName)
+			}
+		}
+	}
 
-	q = "INSERT INTO metadb.source" +
-		"(name,brokers,security,topics,consumer_group,schema_pass_filter,schema_stop_filter,table_stop_filter,trim_schema_prefix,add_schema_prefix,map_public_schema,module,enable)" +
-		"VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13)"
+	if src.DeadLetter != "" && node.TypeName == "postgresql" {
+		return fmt.Errorf("option \"dead_letter\" is not supported for data source type %q", node.TypeName)
+	}
+	if src.DeadLetter == "kafka" {
+		if node.TypeName != "kafka" {
+			return fmt.Errorf("option \"dead_letter\" value \"kafka\" requires data source type \"kafka\"")
+		}
+		if src.DeadLetterTopic == "" {
+			return fmt.Errorf("option \"dead_letter_topic\" is required for dead letter mode \"kafka\"")
+		}
+	}
+
+	q := "INSERT INTO metadb.source" +
+		"(name,type,brokers,security,topics,consumer_group,schema_registry,flattened,schemaless,dead_letter,dead_letter_topic,schema_pass_filter,schema_stop_filter,table_stop_filter,column_stop_filter,column_mask,column_mask_salt,schema_rename,table_rename,trim_schema_prefix,add_schema_prefix,map_public_schema,module,path,connection,publication,slot,history_retention,change_log,enable)" +
+		"VALUES($1,$2,$3,$4,$5,$6,NULLIF($7,''),NULLIF($8,'false'),NULLIF($9,'false'),NULLIF($10,''),NULLIF($11,''),$12,$13,$14,NULLIF($15,''),NULLIF($16,''),NULLIF($17,''),NULLIF($18,''),NULLIF($19,''),$20,$21,$22,$23,NULLIF($24,''),NULLIF($25,''),NULLIF($26,''),NULLIF($27,''),NULLIF($28,''),NULLIF($29,'false'),$30)"
 	_, err = dc.Exec(context.TODO(), q,
-		name, src.Brokers, src.Security, strings.Join(src.Topics, ","), src.Group,
+		name, node.TypeName, src.Brokers, src.Security, strings.Join(src.Topics, ","), src.Group, src.SchemaRegistry,
+		strconv.FormatBool(src.Flattened), strconv.FormatBool(src.Schemaless), src.DeadLetter, src.DeadLetterTopic,
 		strings.Join(src.SchemaPassFilter, ","), strings.Join(src.SchemaStopFilter, ","),
-		strings.Join(src.TableStopFilter, ","), src.TrimSchemaPrefix, src.AddSchemaPrefix,
-		src.MapPublicSchema, src.Module, src.Enable)
+		strings.Join(src.TableStopFilter, ","), strings.Join(src.ColumnStopFilter, ","),
+		strings.Join(src.ColumnMask, ","), src.ColumnMaskSalt, strings.Join(src.SchemaRename, ","),
+		strings.Join(src.TableRename, ","), src.TrimSchemaPrefix, src.AddSchemaPrefix,
+		src.MapPublicSchema, src.Module, src.Path, src.Connection, src.Publication, src.Slot, src.HistoryRetention,
+		strconv.FormatBool(src.ChangeLog), src.Enable)
 	if err != nil {
 		return fmt.Errorf("writing source configuration: %w", err)
 	}
@@ -74,22 +97,46 @@ func createSourceOptions(options []ast.Option) (*sysdb.SourceConnector, error) {
 		SchemaPassFilter: []string{},
 		SchemaStopFilter: []string{},
 		TableStopFilter:  []string{},
+		ColumnStopFilter: []string{},
+		ColumnMask:       []string{},
+		SchemaRename:     []string{},
+		TableRename:      []string{},
 	}
 	for _, opt := range options {
 		var name string
 		switch opt.Name {
 		case "consumergroup":
 			name = "consumer_group"
+		case "schemaregistry":
+			name = "schema_registry"
+		case "deadletter":
+			name = "dead_letter"
+		case "deadlettertopic":
+			name = "dead_letter_topic"
 		case "schemapassfilter":
 			name = "schema_pass_filter"
 		case "schemastopfilter":
 			name = "schema_stop_filter"
 		case "tablestopfilter":
 			name = "table_stop_filter"
+		case "columnstopfilter":
+			name = "column_stop_filter"
+		case "columnmask":
+			name = "column_mask"
+		case "columnmasksalt":
+			name = "column_mask_salt"
+		case "schemarename":
+			name = "schema_rename"
+		case "tablerename":
+			name = "table_rename"
 		case "trimschemaprefix":
 			name = "trim_schema_prefix"
 		case "addschemaprefix":
 			name = "add_schema_prefix"
+		case "historyretention":
+			name = "history_retention"
+		case "changelog":
+			name = "change_log"
 		default:
 			name = opt.Name
 		}
@@ -102,12 +149,52 @@ func createSourceOptions(options []ast.Option) (*sysdb.SourceConnector, error) {
 			s.Topics = strings.Split(opt.Val, ",")
 		case "consumer_group":
 			s.Group = opt.Val
+		case "schema_registry":
+			s.SchemaRegistry = opt.Val
+		case "flattened", "schemaless", "change_log":
+			val, err := sourceBoolOption(name, opt.Val)
+			if err != nil {
+				return nil, err
+			}
+			switch name {
+			case "flattened":
+				s.Flattened = val
+			case "schemaless":
+				s.Schemaless = val
+			default:
+				s.ChangeLog = val
+			}
+		case "dead_letter":
+			if err := checkDeadLetterOption(opt.Val); err != nil {
+				return nil, err
+			}
+			s.DeadLetter = opt.Val
+		case "dead_letter_topic":
+			s.DeadLetterTopic = opt.Val
 		case "schema_pass_filter":
 			s.SchemaPassFilter = strings.Split(opt.Val, ",")
 		case "schema_stop_filter":
 			s.SchemaStopFilter = strings.Split(opt.Val, ",")
 		case "table_stop_filter":
 			s.TableStopFilter = strings.Split(opt.Val, ",")
+		case "column_stop_filter":
+			s.ColumnStopFilter = strings.Split(opt.Val, ",")
+		case "column_mask":
+			if err := checkColumnMaskOption(opt.Val); err != nil {
+				return nil, err
+			}
+			s.ColumnMask = strings.Split(opt.Val, ",")
+		case "column_mask_salt":
+			s.ColumnMaskSalt = opt.Val
+		case "schema_rename", "table_rename":
+			if err := checkRenameOption(opt.Val); err != nil {
+				return nil, err
+			}
+			if name == "schema_rename" {
+				s.SchemaRename = strings.Split(opt.Val, ",")
+			} else {
+				s.TableRename = strings.Split(opt.Val, ",")
+			}
 		case "trim_schema_prefix":
 			s.TrimSchemaPrefix = opt.Val
 		case "add_schema_prefix":
@@ -118,13 +205,91 @@ func createSourceOptions(options []ast.Option) (*sysdb.SourceConnector, error) {
 		//	s.Enable = (strings.ToLower(opt.Val) == "true")
 		case "module":
 			s.Module = opt.Val
+		case "path":
+			s.Path = opt.Val
+		case "connection":
+			s.Connection = opt.Val
+		case "publication":
+			s.Publication = opt.Val
+		case "slot":
+			s.Slot = opt.Val
+		case "history_retention":
+			if err := checkHistoryRetentionOption(opt.Val); err != nil {
+				return nil, err
+			}
+			s.HistoryRetention = opt.Val
 		default:
 			return nil, &dberr.Error{
 				Err: fmt.Errorf("invalid option %q", opt.Name),
 				Hint: "Valid options in this context are: " +
-					"brokers, security, topics, consumer_group, schema_pass_filter, schema_stop_filter, table_stop_filter, trim_schema_prefix, add_schema_prefix, map_public_schema, module",
+					"brokers, security, topics, consumer_group, schema_registry, flattened, schemaless, dead_letter, dead_letter_topic, schema_pass_filter, schema_stop_filter, table_stop_filter, column_stop_filter, column_mask, column_mask_salt, schema_rename, table_rename, trim_schema_prefix, add_schema_prefix, map_public_schema, module, path, connection, publication, slot, history_retention, change_log",
 			}
 		}
 	}
 	return s, nil
 }
+
+// sourceBoolOption parses the value of a boolean data source option.
+func sourceBoolOption(name, val string) (bool, error) {
+	switch strings.ToLower(val) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	default:
+		return false, fmt.Errorf("invalid value %q for option %q", val, name)
+	}
+}
+
+// checkDeadLetterOption validates the value of the dead_letter option.
+func checkDeadLetterOption(val string) error {
+	switch val {
+	case "table", "kafka":
+		return nil
+	default:
+		return &dberr.Error{
+			Err:  fmt.Errorf("invalid value %q for option \"dead_letter\"", val),
+			Hint: "Valid values are: table, kafka",
+		}
+	}
+}
+
+// checkColumnMaskOption validates the masking rules in the value of the
+// column_mask option.
+func checkColumnMaskOption(val string) error {
+	for _, m := range strings.Split(val, ",") {
+		if _, err := command.ParseColumnRule(m); err != nil {
+			return &dberr.Error{
+				Err:  err,
+				Hint: "Masking rules have the form regexp:method, where method is drop, hash, or null",
+			}
+		}
+	}
+	return nil
+}
+
+// checkRenameOption validates the rename rules in the value of the
+// schema_rename or table_rename option.
+func checkRenameOption(val string) error {
+	for _, r := range strings.Split(val, ",") {
+		if _, err := command.ParseRenameRule(r); err != nil {
+			return &dberr.Error{
+				Err:  err,
+				Hint: "Rename rules have the form regexp:replacement",
+			}
+		}
+	}
+	return nil
+}
+
+// checkHistoryRetentionOption validates the value of the history_retention
+// option.
+func checkHistoryRetentionOption(val string) error {
+	if _, err := catalog.ParseHistoryRetention(val); err != nil {
+		return &dberr.Error{
+			Err:  err,
+			Hint: "History retention is a number of years or a date in the form YYYY-MM-DD",
+		}
+	}
+	return nil
+}
@@ -50,17 +50,17 @@ func createUser(conn net.Conn /*query string,*/, node *ast.CreateUserStmt, db *d
 		return util.PGErr(err)
 	}
 
-	if err = createUserSchema(dc, node.UserName); err != nil {
+	if err = savepoint(dc, func() error { return createUserSchema(dc, node.UserName) }); err != nil {
 		_ = writeEncoded(conn, []pgproto3.Message{&pgproto3.NoticeResponse{Severity: "NOTICE",
 			Message: util.PGErr(err).Error()},
 		})
 	}
-	if err = grantCreateOnUserSchema(dc, node.UserName); err != nil {
+	if err = savepoint(dc, func() error { return grantCreateOnUserSchema(dc, node.UserName) }); err != nil {
 		_ = writeEncoded(conn, []pgproto3.Message{&pgproto3.NoticeResponse{Severity: "NOTICE",
 			Message: util.PGErr(err).Error()},
 		})
 	}
-	if err = grantUsageOnUserSchema(dc, node.UserName); err != nil {
+	if err = savepoint(dc, func() error { return grantUsageOnUserSchema(dc, node.UserName) }); err != nil {
 		_ = writeEncoded(conn, []pgproto3.Message{&pgproto3.NoticeResponse{Severity: "NOTICE",
 			Message: util.PGErr(err).Error()},
 		})
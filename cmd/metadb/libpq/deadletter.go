@@ -0,0 +1,52 @@
+package libpq
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/metadb-project/metadb/cmd/metadb/ast"
+)
+
+func deadLetter(conn net.Conn, node *ast.DeadLetterStmt, dc *pgx.Conn) error {
+	var q string
+	if node.Action == "retry" {
+		q = "UPDATE metadb.dead_letter SET retry=TRUE"
+	} else {
+		q = "DELETE FROM metadb.dead_letter"
+	}
+	var args []any
+	switch {
+	case node.ID != 0:
+		q = q + " WHERE id=$1"
+		args = append(args, node.ID)
+	case node.DataSourceName != "":
+		exists, err := sourceExists(dc, node.DataSourceName)
+		if err != nil {
+			return fmt.Errorf("selecting data source: %w", err)
+		}
+		if !exists {
+			return fmt.Errorf("data source %q does not exist", node.DataSourceName)
+		}
+		q = q + " WHERE source_name=$1"
+		args = append(args, node.DataSourceName)
+	}
+	tag, err := dc.Exec(context.TODO(), q, args...)
+	if err != nil {
+		return fmt.Errorf("updating dead letters: %w", err)
+	}
+	if node.ID != 0 && tag.RowsAffected() == 0 {
+		return fmt.Errorf("dead letter %d does not exist", node.ID)
+	}
+	cmd := strings.ToUpper(node.Action) + " DEAD LETTER"
+	if node.ID == 0 {
+		cmd = cmd + "S"
+	}
+	return writeEncoded(conn, []pgproto3.Message{
+		&pgproto3.CommandComplete{CommandTag: []byte(cmd)},
+		&pgproto3.ReadyForQuery{TxStatus: 'I'},
+	})
+}
@@ -0,0 +1,580 @@
+package libpq
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/metadb-project/metadb/cmd/metadb/ast"
+	"github.com/metadb-project/metadb/cmd/metadb/catalog"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+	"github.com/metadb-project/metadb/cmd/metadb/log"
+	"github.com/metadb-project/metadb/cmd/metadb/parser"
+	"github.com/metadb-project/metadb/cmd/metadb/sysdb"
+)
+
+// session stores the state of a client connection, including prepared
+// statements and portals of the extended query protocol and the current
+// transaction block.
+type session struct {
+	cat     *catalog.Catalog
+	conn    net.Conn
+	db      *dbx.DB
+	sources *sysdb.SourceList
+	// dc is the database connection on which proxied statements are
+	// prepared.  It is opened when first needed.
+	dc      *pgx.Conn
+	stmts   map[string]*preparedStmt
+	portals map[string]*portal
+	// skipToSync is set after an error in the extended query protocol,
+	// which causes messages to be discarded until the next Sync.
+	skipToSync bool
+	// txStatus is the transaction status reported in ReadyForQuery:  'I'
+	// if idle, 'T' in a transaction block, or 'E' in a failed transaction
+	// block.
+	txStatus byte
+	// reload is set if the current transaction block changes definitions
+	// that are reloaded into the catalog when it is committed.
+	reload bool
+	// active is the portal, if any, whose result is being read from dc.
+	active *portal
+}
+
+// preparedStmt is a statement created by a Parse message.  A proxied
+// statement is prepared in the database under the same name; otherwise the
+// statement is a Metadb command.
+type preparedStmt struct {
+	name    string
+	query   string
+	node    ast.Node
+	proxied bool
+	desc    *pgconn.StatementDescription
+}
+
+// portal is a statement with bound parameters, created by a Bind message.
+type portal struct {
+	stmt          *preparedStmt
+	params        [][]byte
+	paramFormats  []int16
+	resultFormats []int16
+	executed      bool
+	// For proxied statements, result rows are read from the database as
+	// they are requested by Execute messages.  If the database connection
+	// is needed for another statement while the portal is suspended, the
+	// remaining rows are read into rows.
+	// The statement is run in a read-only transaction, which end
+	// completes.
+	rr   *pgconn.ResultReader
+	end  func() error
+	rows [][][]byte
+	tag  string
+	err  error
+	// For Metadb commands, the response is captured as encoded backend
+	// messages.
+	response [][]byte
+}
+
+func newSession(cat *catalog.Catalog, conn net.Conn, db *dbx.DB, sources *sysdb.SourceList) *session {
+	return &session{
+		cat:      cat,
+		conn:     conn,
+		db:       db,
+		sources:  sources,
+		stmts:    make(map[string]*preparedStmt),
+		portals:  make(map[string]*portal),
+		txStatus: 'I',
+	}
+}
+
+func (s *session) close() {
+	s.discard()
+	if s.dc != nil {
+		dbx.Close(s.dc)
+		s.dc = nil
+	}
+}
+
+// connect returns the database connection, opening it if necessary.  The
+// result of a suspended portal is first read from the connection, so that
+// it can be used for another statement.
+func (s *session) connect() (*pgx.Conn, error) {
+	s.release()
+	if s.dc == nil {
+		dc, err := s.db.Connect()
+		if err != nil {
+			return nil, fmt.Errorf("connecting to database: %w", err)
+		}
+		s.dc = dc
+	}
+	return s.dc, nil
+}
+
+// release reads the remaining rows of the active portal.
+func (s *session) release() {
+	p := s.active
+	if p == nil {
+		return
+	}
+	s.active = nil
+	for p.rr.NextRow() {
+		p.rows = append(p.rows, cloneRow(p.rr.Values()))
+	}
+	p.finish()
+}
+
+// discard closes the result of the active portal, if any, without reading
+// the remaining rows.
+func (s *session) discard() {
+	if s.active != nil {
+		s.active.finish()
+		s.active = nil
+	}
+}
+
+// finish closes the result reader of a portal, ends its read-only
+// transaction, and saves the command tag or error.
+func (p *portal) finish() {
+	tag, err := p.rr.Close()
+	p.rr = nil
+	if errEnd := p.end(); err == nil {
+		err = errEnd
+	}
+	p.end = nil
+	p.tag, p.err = tag.String(), err
+}
+
+// cloneRow copies the values of a row, which are overwritten when the next
+// row is read.
+func cloneRow(values [][]byte) [][]byte {
+	row := make([][]byte, len(values))
+	for i, v := range values {
+		if v != nil {
+			row[i] = bytes.Clone(v)
+		}
+	}
+	return row
+}
+
+// serve reads and processes messages from the client until the connection
+// is closed or the client terminates the session.
+func (s *session) serve(backend *pgproto3.Backend) error {
+	for {
+		msg, err := backend.Receive()
+		if err != nil {
+			// TODO handle error
+			return nil
+		}
+		switch m := msg.(type) {
+		case *pgproto3.Parse, *pgproto3.Bind, *pgproto3.Describe, *pgproto3.Execute, *pgproto3.Close,
+			*pgproto3.Sync, *pgproto3.Flush:
+			// Extended query
+			if err = s.processExtended(m); err != nil {
+				return err
+			}
+		case *pgproto3.Query:
+			if err = s.processSimpleQuery(m.String); err != nil {
+				return err
+			}
+		case *pgproto3.Terminate:
+			return nil
+		default:
+			return fmt.Errorf("unknown message: %#v", msg)
+		}
+	}
+}
+
+// processExtended handles a message of the extended query protocol.  Errors
+// that are reported to the client are not returned; a returned error means
+// that the connection should be closed.
+func (s *session) processExtended(msg pgproto3.FrontendMessage) error {
+	if _, ok := msg.(*pgproto3.Sync); ok {
+		return s.processSync()
+	}
+	if s.skipToSync {
+		return nil
+	}
+	var err error
+	switch m := msg.(type) {
+	case *pgproto3.Parse:
+		err = s.processParse(m)
+	case *pgproto3.Bind:
+		err = s.processBind(m)
+	case *pgproto3.Describe:
+		err = s.processDescribe(m)
+	case *pgproto3.Execute:
+		err = s.processExecute(m)
+	case *pgproto3.Close:
+		err = s.processClose(m)
+	case *pgproto3.Flush:
+		// Responses are written immediately.
+		return nil
+	default:
+		return fmt.Errorf("unexpected message in extended query: %#v", msg)
+	}
+	if err != nil {
+		var conerr *net.OpError
+		if errors.As(err, &conerr) {
+			return err
+		}
+		s.failTransaction()
+		return s.sendError(err)
+	}
+	return nil
+}
+
+// sendError reports an error to the client and begins discarding messages
+// until the next Sync.
+func (s *session) sendError(err error) error {
+	s.skipToSync = true
+	return writeEncoded(s.conn, []pgproto3.Message{errorResponse(err)})
+}
+
+func (s *session) processSync() error {
+	s.skipToSync = false
+	// Portals do not outlive the implicit transaction.
+	s.discard()
+	clear(s.portals)
+	return writeEncoded(s.conn, []pgproto3.Message{
+		&pgproto3.ReadyForQuery{TxStatus: s.txStatus},
+	})
+}
+
+func (s *session) processParse(m *pgproto3.Parse) error {
+	log.Trace("prepared statement: %s", m.Query)
+	if m.Name != "" {
+		if _, ok := s.stmts[m.Name]; ok {
+			return fmt.Errorf("prepared statement %q already exists", m.Name)
+		}
+	}
+	stmt := &preparedStmt{name: m.Name, query: m.Query}
+	if isPassthrough(m.Query) {
+		dc, err := s.connect()
+		if err != nil {
+			return err
+		}
+		stmt.proxied = true
+		stmt.desc, err = dc.PgConn().Prepare(context.TODO(), m.Name, m.Query, m.ParameterOIDs)
+		if err != nil {
+			return err
+		}
+	} else {
+		// Metadb commands end with a semicolon, which clients may omit
+		// in a Parse message.
+		query := strings.TrimSpace(m.Query)
+		if !strings.HasSuffix(query, ";") {
+			query += ";"
+		}
+		node, err, pass := parser.Parse(query)
+		if err != nil {
+			return err
+		}
+		if pass {
+			return fmt.Errorf("syntax error")
+		}
+		stmt.query, stmt.node = query, node
+	}
+	s.stmts[m.Name] = stmt
+	return writeEncoded(s.conn, []pgproto3.Message{&pgproto3.ParseComplete{}})
+}
+
+func (s *session) processBind(m *pgproto3.Bind) error {
+	stmt, ok := s.stmts[m.PreparedStatement]
+	if !ok {
+		return fmt.Errorf("prepared statement %q does not exist", m.PreparedStatement)
+	}
+	if m.DestinationPortal != "" {
+		if _, ok := s.portals[m.DestinationPortal]; ok {
+			return fmt.Errorf("portal %q already exists", m.DestinationPortal)
+		}
+	}
+	if stmt.proxied && len(m.Parameters) != len(stmt.desc.ParamOIDs) {
+		return fmt.Errorf("bind message supplies %d parameters, but prepared statement %q requires %d",
+			len(m.Parameters), m.PreparedStatement, len(stmt.desc.ParamOIDs))
+	}
+	// The message buffers are reused by the backend, so the parameters
+	// are copied.
+	params := make([][]byte, len(m.Parameters))
+	for i, p := range m.Parameters {
+		if p != nil {
+			params[i] = bytes.Clone(p)
+		}
+	}
+	s.portals[m.DestinationPortal] = &portal{
+		stmt:          stmt,
+		params:        params,
+		paramFormats:  append([]int16(nil), m.ParameterFormatCodes...),
+		resultFormats: append([]int16(nil), m.ResultFormatCodes...),
+	}
+	return writeEncoded(s.conn, []pgproto3.Message{&pgproto3.BindComplete{}})
+}
+
+func (s *session) processDescribe(m *pgproto3.Describe) error {
+	switch m.ObjectType {
+	case 'S':
+		stmt, ok := s.stmts[m.Name]
+		if !ok {
+			return fmt.Errorf("prepared statement %q does not exist", m.Name)
+		}
+		if stmt.proxied {
+			return writeEncoded(s.conn, []pgproto3.Message{
+				&pgproto3.ParameterDescription{ParameterOIDs: stmt.desc.ParamOIDs},
+				rowDescription(stmt.desc.Fields, nil),
+			})
+		}
+		// Metadb commands take no parameters.
+		rd, err := s.describeCommand(stmt)
+		if err != nil {
+			return err
+		}
+		return writeEncoded(s.conn, []pgproto3.Message{&pgproto3.ParameterDescription{}, rd})
+	case 'P':
+		p, ok := s.portals[m.Name]
+		if !ok {
+			return fmt.Errorf("portal %q does not exist", m.Name)
+		}
+		if p.stmt.proxied {
+			return writeEncoded(s.conn, []pgproto3.Message{rowDescription(p.stmt.desc.Fields, p.resultFormats)})
+		}
+		rd, err := s.describeCommand(p.stmt)
+		if err != nil {
+			return err
+		}
+		return writeEncoded(s.conn, []pgproto3.Message{rd})
+	default:
+		return fmt.Errorf("invalid describe object type %q", m.ObjectType)
+	}
+}
+
+// describeCommand returns the RowDescription of the result of a Metadb
+// command, or NoData if it returns no rows.  The command is not run.
+func (s *session) describeCommand(stmt *preparedStmt) (pgproto3.Message, error) {
+	node, ok := stmt.node.(*ast.ListStmt)
+	if !ok {
+		return &pgproto3.NoData{}, nil
+	}
+	if strings.ToLower(node.Name) == "status" {
+		return statusRowDescription(), nil
+	}
+	dc, err := s.connect()
+	if err != nil {
+		return nil, err
+	}
+	return listDescription(node, dc)
+}
+
+func (s *session) processExecute(m *pgproto3.Execute) error {
+	p, ok := s.portals[m.Portal]
+	if !ok {
+		return fmt.Errorf("portal %q does not exist", m.Portal)
+	}
+	if !p.stmt.proxied {
+		if err := s.executeCommand(p); err != nil {
+			return err
+		}
+		var b []byte
+		for _, msg := range p.response {
+			switch msg[0] {
+			case 'T', 'Z': // RowDescription, ReadyForQuery
+				continue
+			case 'E': // ErrorResponse
+				s.skipToSync = true
+			}
+			b = append(b, msg...)
+		}
+		p.response = nil
+		return write(s.conn, b)
+	}
+
+	if !p.executed {
+		dc, err := s.connect()
+		if err != nil {
+			return err
+		}
+		if p.end, err = beginReadOnly(dc.PgConn()); err != nil {
+			return err
+		}
+		p.executed = true
+		p.rr = dc.PgConn().ExecPrepared(context.TODO(), p.stmt.name, p.params, p.paramFormats, p.resultFormats)
+		s.active = p
+	}
+	// Rows are written as they are read, in batches of about
+	// executeBufferSize bytes.
+	var b []byte
+	var err error
+	var n int
+	for m.MaxRows == 0 || n < int(m.MaxRows) {
+		var row [][]byte
+		switch {
+		case len(p.rows) > 0:
+			row = p.rows[0]
+			p.rows = p.rows[1:]
+		case p.rr != nil && p.rr.NextRow():
+			row = p.rr.Values()
+		default:
+			return s.completeExecute(p, b)
+		}
+		if b, err = (&pgproto3.DataRow{Values: row}).Encode(b); err != nil {
+			return err
+		}
+		n++
+		if len(b) >= executeBufferSize {
+			if err = write(s.conn, b); err != nil {
+				return err
+			}
+			b = b[:0]
+		}
+	}
+	if b, err = (&pgproto3.PortalSuspended{}).Encode(b); err != nil {
+		return err
+	}
+	return write(s.conn, b)
+}
+
+const executeBufferSize = 64 * 1024
+
+// completeExecute writes the rows in b followed by CommandComplete, after all
+// rows of the portal have been read.
+func (s *session) completeExecute(p *portal, b []byte) error {
+	if p.rr != nil {
+		p.finish()
+		s.active = nil
+	}
+	if p.err != nil {
+		// The rows already read are sent before the error.
+		if err := write(s.conn, b); err != nil {
+			return err
+		}
+		return p.err
+	}
+	b, err := (&pgproto3.CommandComplete{CommandTag: []byte(p.tag)}).Encode(b)
+	if err != nil {
+		return err
+	}
+	return write(s.conn, b)
+}
+
+func (s *session) processClose(m *pgproto3.Close) error {
+	switch m.ObjectType {
+	case 'S':
+		if stmt, ok := s.stmts[m.Name]; ok {
+			if stmt.proxied && m.Name != "" {
+				dc, err := s.connect()
+				if err != nil {
+					return err
+				}
+				if err = dc.PgConn().Deallocate(context.TODO(), m.Name); err != nil {
+					return err
+				}
+			}
+			delete(s.stmts, m.Name)
+		}
+	case 'P':
+		if p, ok := s.portals[m.Name]; ok && p == s.active {
+			s.discard()
+		}
+		delete(s.portals, m.Name)
+	default:
+		return fmt.Errorf("invalid close object type %q", m.ObjectType)
+	}
+	return writeEncoded(s.conn, []pgproto3.Message{&pgproto3.CloseComplete{}})
+}
+
+// executeCommand runs a Metadb command, if it has not already been run for
+// the portal, and stores the response.
+func (s *session) executeCommand(p *portal) error {
+	if p.executed {
+		return nil
+	}
+	p.executed = true
+	var err error
+	p.response, err = s.runCommand(p.stmt.query)
+	return err
+}
+
+// runCommand runs a Metadb command and returns the encoded response messages.
+func (s *session) runCommand(query string) ([][]byte, error) {
+	return s.runStatement(query)
+}
+
+// captureConn is a connection that buffers written data instead of sending
+// it to the client.
+type captureConn struct {
+	net.Conn
+	buf bytes.Buffer
+}
+
+func (c *captureConn) Write(b []byte) (int, error) {
+	return c.buf.Write(b)
+}
+
+// splitMessages splits a buffer of encoded backend messages into individual
+// messages.
+func splitMessages(buf []byte) ([][]byte, error) {
+	var msgs [][]byte
+	for len(buf) > 0 {
+		if len(buf) < 5 {
+			return nil, fmt.Errorf("splitting messages: incomplete message header")
+		}
+		n := int(binary.BigEndian.Uint32(buf[1:5])) + 1
+		if n < 5 || n > len(buf) {
+			return nil, fmt.Errorf("splitting messages: invalid message length")
+		}
+		msgs = append(msgs, buf[:n])
+		buf = buf[n:]
+	}
+	return msgs, nil
+}
+
+// rowDescription converts field descriptions returned by the database to a
+// RowDescription message, or NoData if there are no fields.  The result
+// format codes follow the rules of the Bind message:  none means all text, one
+// applies to all columns, and otherwise there is one per column.
+func rowDescription(fields []pgconn.FieldDescription, resultFormats []int16) pgproto3.Message {
+	if len(fields) == 0 {
+		return &pgproto3.NoData{}
+	}
+	rd := &pgproto3.RowDescription{Fields: make([]pgproto3.FieldDescription, len(fields))}
+	for i, f := range fields {
+		var format int16
+		switch {
+		case len(resultFormats) == 1:
+			format = resultFormats[0]
+		case i < len(resultFormats):
+			format = resultFormats[i]
+		}
+		rd.Fields[i] = pgproto3.FieldDescription{
+			Name:                 []byte(f.Name),
+			TableOID:             f.TableOID,
+			TableAttributeNumber: f.TableAttributeNumber,
+			DataTypeOID:          f.DataTypeOID,
+			DataTypeSize:         f.DataTypeSize,
+			TypeModifier:         f.TypeModifier,
+			Format:               format,
+		}
+	}
+	return rd
+}
+
+// errorResponse converts an error to an ErrorResponse message, retaining the
+// fields of a database error.
+func errorResponse(err error) *pgproto3.ErrorResponse {
+	var e *pgconn.PgError
+	if errors.As(err, &e) {
+		return &pgproto3.ErrorResponse{
+			Severity: e.Severity,
+			Code:     e.Code,
+			Message:  e.Message,
+			Detail:   e.Detail,
+			Hint:     e.Hint,
+			Position: e.Position,
+		}
+	}
+	return &pgproto3.ErrorResponse{Severity: "ERROR", Message: err.Error()}
+}
@@ -0,0 +1,357 @@
+package libpq
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+)
+
+// startSession serves a session on one end of a pipe and returns a frontend
+// connected to the other end.
+func startSession(t *testing.T, db *dbx.DB) *pgproto3.Frontend {
+	server, client := net.Pipe()
+	sess := newSession(nil, server, db, nil)
+	go func() {
+		defer server.Close()
+		defer sess.close()
+		_ = sess.serve(pgproto3.NewBackend(server, server))
+	}()
+	t.Cleanup(func() { _ = client.Close() })
+	return pgproto3.NewFrontend(client, client)
+}
+
+// exchange sends messages to the session and returns a summary of each
+// response message, up to and including the ReadyForQuery that answers the
+// last Sync or Query message.
+func exchange(t *testing.T, fe *pgproto3.Frontend, msgs ...pgproto3.FrontendMessage) []string {
+	t.Helper()
+	var ready int
+	for _, m := range msgs {
+		switch m.(type) {
+		case *pgproto3.Sync, *pgproto3.Query:
+			ready++
+		}
+		fe.Send(m)
+	}
+	// Responses are written while the messages are being read, so the
+	// messages are sent concurrently.
+	errc := make(chan error, 1)
+	go func() { errc <- fe.Flush() }()
+	var got []string
+	for ready > 0 {
+		msg, err := fe.Receive()
+		if err != nil {
+			t.Fatalf("receiving: %v", err)
+		}
+		got = append(got, summarize(msg))
+		if _, ok := msg.(*pgproto3.ReadyForQuery); ok {
+			ready--
+		}
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("sending: %v", err)
+	}
+	return got
+}
+
+func summarize(msg pgproto3.BackendMessage) string {
+	switch m := msg.(type) {
+	case *pgproto3.ParseComplete:
+		return "ParseComplete"
+	case *pgproto3.BindComplete:
+		return "BindComplete"
+	case *pgproto3.CloseComplete:
+		return "CloseComplete"
+	case *pgproto3.NoData:
+		return "NoData"
+	case *pgproto3.PortalSuspended:
+		return "PortalSuspended"
+	case *pgproto3.ParameterDescription:
+		return fmt.Sprintf("ParameterDescription %v", m.ParameterOIDs)
+	case *pgproto3.RowDescription:
+		var names []string
+		for _, f := range m.Fields {
+			names = append(names, string(f.Name))
+		}
+		return "RowDescription " + strings.Join(names, ",")
+	case *pgproto3.DataRow:
+		var values []string
+		for _, v := range m.Values {
+			values = append(values, string(v))
+		}
+		return "DataRow " + strings.Join(values, ",")
+	case *pgproto3.CommandComplete:
+		return "CommandComplete " + string(m.CommandTag)
+	case *pgproto3.ErrorResponse:
+		return "ErrorResponse " + m.Message
+	case *pgproto3.ReadyForQuery:
+		return "ReadyForQuery " + string(m.TxStatus)
+	default:
+		return fmt.Sprintf("%T", msg)
+	}
+}
+
+func checkExchange(t *testing.T, fe *pgproto3.Frontend, msgs []pgproto3.FrontendMessage, want []string) {
+	t.Helper()
+	if got := exchange(t, fe, msgs...); !slices.Equal(got, want) {
+		t.Errorf("got:\n\t%s\nwant:\n\t%s", strings.Join(got, "\n\t"), strings.Join(want, "\n\t"))
+	}
+}
+
+func TestExtendedCommand(t *testing.T) {
+	fe := startSession(t, nil)
+	// A Metadb command may omit the semicolon, and describing it does
+	// not run it.
+	checkExchange(t, fe, []pgproto3.FrontendMessage{
+		&pgproto3.Parse{Name: "s1", Query: "create data origin o1"},
+		&pgproto3.Describe{ObjectType: 'S', Name: "s1"},
+		&pgproto3.Bind{DestinationPortal: "p1", PreparedStatement: "s1"},
+		&pgproto3.Describe{ObjectType: 'P', Name: "p1"},
+		&pgproto3.Close{ObjectType: 'P', Name: "p1"},
+		&pgproto3.Sync{},
+	}, []string{
+		"ParseComplete",
+		"ParameterDescription []",
+		"NoData",
+		"BindComplete",
+		"NoData",
+		"CloseComplete",
+		"ReadyForQuery I",
+	})
+	// LIST status is described without reading the status of sources.
+	checkExchange(t, fe, []pgproto3.FrontendMessage{
+		&pgproto3.Parse{Query: "list status;"},
+		&pgproto3.Describe{ObjectType: 'S'},
+		&pgproto3.Sync{},
+	}, []string{
+		"ParseComplete",
+		"ParameterDescription []",
+		"RowDescription type,name,source_stream,source_sync,retry_attempts,retry_class,next_retry,last_error",
+		"ReadyForQuery I",
+	})
+	// Prepared statements remain after Sync, but portals do not.
+	checkExchange(t, fe, []pgproto3.FrontendMessage{
+		&pgproto3.Bind{DestinationPortal: "p1", PreparedStatement: "s1"},
+		&pgproto3.Sync{},
+		&pgproto3.Describe{ObjectType: 'P', Name: "p1"},
+		&pgproto3.Sync{},
+	}, []string{
+		"BindComplete",
+		"ReadyForQuery I",
+		`ErrorResponse portal "p1" does not exist`,
+		"ReadyForQuery I",
+	})
+}
+
+func TestExtendedError(t *testing.T) {
+	fe := startSession(t, nil)
+	// SQL statements other than queries and session statements are not
+	// passed through.  After an error, messages are discarded until Sync.
+	checkExchange(t, fe, []pgproto3.FrontendMessage{
+		&pgproto3.Parse{Name: "s1", Query: "VACUUM"},
+		&pgproto3.Bind{PreparedStatement: "s1"},
+		&pgproto3.Execute{},
+		&pgproto3.Sync{},
+	}, []string{
+		"ErrorResponse syntax error",
+		"ReadyForQuery I",
+	})
+	checkExchange(t, fe, []pgproto3.FrontendMessage{
+		&pgproto3.Parse{Name: "s2", Query: "create data origin o1;"},
+		&pgproto3.Parse{Name: "s2", Query: "create data origin o2;"},
+		&pgproto3.Describe{ObjectType: 'S', Name: "s2"},
+		&pgproto3.Sync{},
+		&pgproto3.Execute{Portal: "p1"},
+		&pgproto3.Sync{},
+		&pgproto3.Bind{PreparedStatement: "s1"},
+		&pgproto3.Sync{},
+	}, []string{
+		"ParseComplete",
+		`ErrorResponse prepared statement "s2" already exists`,
+		"ReadyForQuery I",
+		`ErrorResponse portal "p1" does not exist`,
+		"ReadyForQuery I",
+		`ErrorResponse prepared statement "s1" does not exist`,
+		"ReadyForQuery I",
+	})
+}
+
+func testDB(t *testing.T) *dbx.DB {
+	db, err := dbx.TestDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db == nil {
+		t.Skipf("%s not set", dbx.TestDatabaseEnv)
+	}
+	return db
+}
+
+func TestExtendedStream(t *testing.T) {
+	fe := startSession(t, testDB(t))
+	// Rows are returned as requested by each Execute, and a suspended
+	// portal is not affected by other statements.
+	checkExchange(t, fe, []pgproto3.FrontendMessage{
+		&pgproto3.Parse{Name: "s1", Query: "SELECT g FROM generate_series(1, 5) g"},
+		&pgproto3.Bind{DestinationPortal: "p1", PreparedStatement: "s1"},
+		&pgproto3.Describe{ObjectType: 'P', Name: "p1"},
+		&pgproto3.Execute{Portal: "p1", MaxRows: 2},
+		&pgproto3.Parse{Name: "s2", Query: "VALUES ('a'), ('b')"},
+		&pgproto3.Bind{DestinationPortal: "p2", PreparedStatement: "s2"},
+		&pgproto3.Execute{Portal: "p2"},
+		&pgproto3.Execute{Portal: "p1", MaxRows: 2},
+		&pgproto3.Execute{Portal: "p1", MaxRows: 2},
+		&pgproto3.Sync{},
+	}, []string{
+		"ParseComplete",
+		"BindComplete",
+		"RowDescription g",
+		"DataRow 1",
+		"DataRow 2",
+		"PortalSuspended",
+		"ParseComplete",
+		"BindComplete",
+		"DataRow a",
+		"DataRow b",
+		"CommandComplete SELECT 2",
+		"DataRow 3",
+		"DataRow 4",
+		"PortalSuspended",
+		"DataRow 5",
+		"CommandComplete SELECT 5",
+		"ReadyForQuery I",
+	})
+	// An error in the query is reported after the rows that were read.
+	checkExchange(t, fe, []pgproto3.FrontendMessage{
+		&pgproto3.Parse{Query: "SELECT 1 / (2 - g) FROM generate_series(1, 3) g"},
+		&pgproto3.Bind{},
+		&pgproto3.Execute{},
+		&pgproto3.Execute{},
+		&pgproto3.Sync{},
+	}, []string{
+		"ParseComplete",
+		"BindComplete",
+		"DataRow 1",
+		"ErrorResponse division by zero",
+		"ReadyForQuery I",
+	})
+}
+
+func TestExtendedSessionStatements(t *testing.T) {
+	fe := startSession(t, testDB(t))
+	checkExchange(t, fe, []pgproto3.FrontendMessage{
+		&pgproto3.Parse{Query: "SET application_name = 'metadb_test'"},
+		&pgproto3.Bind{},
+		&pgproto3.Describe{ObjectType: 'P'},
+		&pgproto3.Execute{},
+		&pgproto3.Parse{Query: "SHOW application_name"},
+		&pgproto3.Bind{},
+		&pgproto3.Execute{},
+		&pgproto3.Sync{},
+	}, []string{
+		"ParseComplete",
+		"BindComplete",
+		"NoData",
+		"CommandComplete SET",
+		"ParseComplete",
+		"BindComplete",
+		"DataRow metadb_test",
+		"CommandComplete SHOW",
+		"ReadyForQuery I",
+	})
+	checkExchange(t, fe, []pgproto3.FrontendMessage{
+		&pgproto3.Query{String: "SET application_name = 'metadb_simple'; SHOW application_name;"},
+	}, []string{
+		"CommandComplete SET",
+		"RowDescription application_name",
+		"DataRow metadb_simple",
+		"CommandComplete SHOW",
+		"ReadyForQuery I",
+	})
+}
+
+func TestReadOnly(t *testing.T) {
+	db := testDB(t)
+	dc, err := db.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbx.Close(dc)
+	drop := func() {
+		_, _ = dc.Exec(context.Background(), "DROP SCHEMA IF EXISTS metadb_test CASCADE")
+	}
+	drop()
+	t.Cleanup(drop)
+	for _, q := range []string{
+		"CREATE SCHEMA metadb_test",
+		"CREATE TABLE metadb_test.t (id integer)",
+		"INSERT INTO metadb_test.t VALUES (1)",
+	} {
+		if _, err = dc.Exec(context.Background(), q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Queries that are passed through cannot modify data, although they
+	// may begin with a keyword that is passed through.
+	fe := startSession(t, db)
+	for _, q := range []string{
+		"WITH d AS (DELETE FROM metadb_test.t RETURNING id) SELECT count(*) FROM d",
+		"EXPLAIN ANALYZE DELETE FROM metadb_test.t",
+	} {
+		got := exchange(t, fe, &pgproto3.Query{String: q})
+		if len(got) != 2 || !strings.Contains(got[0], "read-only transaction") {
+			t.Errorf("simple query %q: got %v; want read-only error", q, got)
+		}
+		checkExchange(t, fe, []pgproto3.FrontendMessage{
+			&pgproto3.Parse{Query: q},
+			&pgproto3.Bind{},
+			&pgproto3.Execute{},
+			&pgproto3.Sync{},
+		}, []string{
+			"ParseComplete",
+			"BindComplete",
+			"ErrorResponse cannot execute DELETE in a read-only transaction",
+			"ReadyForQuery I",
+		})
+	}
+	var n int
+	if err = dc.QueryRow(context.Background(), "SELECT count(*) FROM metadb_test.t").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("%d rows after read-only queries; want 1", n)
+	}
+}
+
+func TestIsPassthrough(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"SELECT 1", true},
+		{"  with t AS (SELECT 1) SELECT * FROM t", true},
+		{"(select 1) union (select 2)", true},
+		{"-- comment\nSHOW server_version", true},
+		{"/* comment */ set extra_float_digits = 3", true},
+		{"values (1)", true},
+		{"reset all", true},
+		{"explain select 1", true},
+		{"list status;", false},
+		{"begin", false},
+		{"selection", false},
+		{"delete from t", false},
+		{"-- select", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := isPassthrough(tt.query); got != tt.want {
+			t.Errorf("isPassthrough(%q) = %v; want %v", tt.query, got, tt.want)
+		}
+	}
+}
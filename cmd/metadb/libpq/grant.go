@@ -85,14 +85,16 @@ func grantAccessOnAll(conn net.Conn, node *ast.GrantAccessOnAllStmt, dc *pgx.Con
 
 	for i := range extraManagedTables {
 		t := strings.Split(extraManagedTables[i], ".")
-		_ = acl.Grant(dc, []acl.ACLItem{
-			{
-				SchemaName: t[0],
-				ObjectName: t[1],
-				ObjectType: acl.Table,
-				Privilege:  acl.Access,
-				UserName:   node.UserName,
-			},
+		_ = savepoint(dc, func() error {
+			return acl.Grant(dc, []acl.ACLItem{
+				{
+					SchemaName: t[0],
+					ObjectName: t[1],
+					ObjectType: acl.Table,
+					Privilege:  acl.Access,
+					UserName:   node.UserName,
+				},
+			})
 		})
 	}
 
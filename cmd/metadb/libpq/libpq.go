@@ -2,7 +2,9 @@ package libpq
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"math/rand/v2"
 	"net"
 	"strings"
 	"syscall"
@@ -16,6 +18,7 @@ import (
 	"github.com/metadb-project/metadb/cmd/metadb/dberr"
 	"github.com/metadb-project/metadb/cmd/metadb/dbx"
 	"github.com/metadb-project/metadb/cmd/metadb/log"
+	"github.com/metadb-project/metadb/cmd/metadb/option"
 	"github.com/metadb-project/metadb/cmd/metadb/parser"
 	"github.com/metadb-project/metadb/cmd/metadb/sysdb"
 	"github.com/metadb-project/metadb/cmd/metadb/tools"
@@ -24,13 +27,18 @@ import (
 var extraManagedSchemas = []string{"folio_derived", "reshare_derived"}
 var extraManagedTables = []string{"folio_source_record.marc__t"}
 
-func Listen(cat *catalog.Catalog, host string, port string, db *dbx.DB, sources *[]*sysdb.SourceConnector) {
-	// var h string
-	// if host == "" {
-	// 	h = "127.0.0.1"
-	// } else {
-	// 	h = host
-	// }
+func Listen(cat *catalog.Catalog, opt *option.Server, db *dbx.DB, sources *sysdb.SourceList) {
+	host := opt.Listen
+	port := opt.Port
+	var tlsConfig *tls.Config
+	if opt.TLSCert != "" && !opt.NoTLS {
+		cert, err := tls.LoadX509KeyPair(opt.TLSCert, opt.TLSKey)
+		if err != nil {
+			log.Fatal("loading server certificate: %v", err)
+			return
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	}
 	var ln net.Listener
 	var err error
 	if host == "" {
@@ -46,6 +54,9 @@ func Listen(cat *catalog.Catalog, host string, port string, db *dbx.DB, sources
 		// TODO handle error
 		_ = err
 	}
+	if method, _ := cat.GetConfig("client_auth_method"); method == authTrust && host != "" && host != "127.0.0.1" {
+		log.Warning("client authentication is disabled (client_auth_method = 'trust')")
+	}
 	log.Debug("server is ready to accept connections")
 	for {
 		var conn net.Conn
@@ -53,19 +64,19 @@ func Listen(cat *catalog.Catalog, host string, port string, db *dbx.DB, sources
 			// TODO handle error
 			_ = err
 		}
-		backend := pgproto3.NewBackend(conn, conn)
 		//log.Trace("connection received: %s", conn.RemoteAddr().String())
 		log.Trace("connection received") // domain socket
-		go serve(cat, conn, backend, db, sources)
+		go serve(cat, conn, db, sources, tlsConfig, opt.Datadir)
 	}
 }
 
-func serve(cat *catalog.Catalog, conn net.Conn, backend *pgproto3.Backend, db *dbx.DB, sources *[]*sysdb.SourceConnector) {
+func serve(cat *catalog.Catalog, conn net.Conn, db *dbx.DB, sources *sysdb.SourceList, tlsConfig *tls.Config, datadir string) {
 	//log.Trace("connected to database")
-	// TODO Close
+	defer conn.Close()
 
 	var err error
-	if err = startup(conn, backend); err != nil {
+	var backend *pgproto3.Backend
+	if conn, backend, err = startup(cat, conn, pgproto3.NewBackend(conn, conn), db, tlsConfig, datadir); err != nil {
 		// errw := write(conn, encode(nil, []pgproto3.Message{
 		// 	&pgproto3.ErrorResponse{Message: err.Error()},
 		// 	&pgproto3.ReadyForQuery{TxStatus: 'I'},
@@ -84,176 +95,71 @@ func serve(cat *catalog.Catalog, conn net.Conn, backend *pgproto3.Backend, db *d
 		}
 		return
 	}
-	for {
-		var msg pgproto3.FrontendMessage
-		if msg, err = backend.Receive(); err != nil {
-			// TODO handle error
-			_ = err
-			return
-		}
-
-		switch m := msg.(type) {
-		case *pgproto3.Parse:
-			// Extended query
-			if err = processParse(cat, conn, backend, m, db, sources); err != nil {
-				log.Info("%v", err)
-				return
-			}
-			//log.Info("*pgproto3.Parse: not yet implemented")
-		case *pgproto3.Query:
-			if err = processQuery(cat, conn, m.String, nil, db, sources); err != nil {
-				log.Info("%v", err)
-				return
-			}
-		case *pgproto3.Sync:
-			continue
-		case *pgproto3.Terminate:
-			return
-		default:
-			log.Info("unknown message: %#v", msg)
-			// TODO handle error
-			_ = err
-			return
-		}
+	sess := newSession(cat, conn, db, sources)
+	defer sess.close()
+	if err = sess.serve(backend); err != nil {
+		log.Info("%v", err)
 	}
 }
 
-func startup(conn net.Conn, backend *pgproto3.Backend) error {
+// startup handles the startup phase of a connection, which may include a TLS
+// handshake.  It returns the connection and backend to be used for the rest
+// of the session.
+func startup(cat *catalog.Catalog, conn net.Conn, backend *pgproto3.Backend, db *dbx.DB, tlsConfig *tls.Config, datadir string) (net.Conn, *pgproto3.Backend, error) {
 	var msg pgproto3.FrontendMessage
 	var err error
 	if msg, err = backend.ReceiveStartupMessage(); err != nil {
 		// TODO handle error
-		return err
+		return conn, backend, err
 	}
 	switch m := msg.(type) {
 	case *pgproto3.SSLRequest:
-		if _, err = conn.Write([]byte("N")); err != nil {
-			return err
+		if tlsConfig == nil {
+			if _, err = conn.Write([]byte("N")); err != nil {
+				return conn, backend, err
+			}
+			return startup(cat, conn, backend, db, nil, datadir)
 		}
-		if err = startup(conn, backend); err != nil {
-			return err
+		if _, err = conn.Write([]byte("S")); err != nil {
+			return conn, backend, err
 		}
-		return nil
-	case *pgproto3.StartupMessage:
-		if err = handleStartup(conn, m); err != nil {
-			return err
+		tlsConn := tls.Server(conn, tlsConfig)
+		if err = tlsConn.Handshake(); err != nil {
+			return conn, backend, fmt.Errorf("startup: TLS handshake: %w", err)
 		}
-		return nil
-	default:
-		return fmt.Errorf("unknown message: %v", msg)
-	}
-}
-
-func processParse(cat *catalog.Catalog, conn net.Conn, backend *pgproto3.Backend, parse *pgproto3.Parse, db *dbx.DB, sources *[]*sysdb.SourceConnector) error {
-	query := parse.Query
-	log.Trace("prepared statement: %s", query)
-
-	dc, err := db.Connect()
-	if err != nil {
-		return fmt.Errorf("connecting to database: %w", err)
-	}
-	defer dbx.Close(dc)
-
-	// Prepare the query.
-	stmt, err := dc.Prepare(context.TODO(), parse.Name, query)
-	if err != nil {
-		return fmt.Errorf("preparing extended query: %w", err)
-	}
-
-	//var rows pgx.Rows
-	//var cols []pgconn.FieldDescription
-	//var binds []interface{}
-	//exec := func() (err error) {
-	//	if rows != nil {
-	//		return nil
-	//	}
-	//	if rows, err = dc.Query(context.TODO(), binds...); err != nil {
-	//		return fmt.Errorf("query: %w", err)
-	//	}
-	//	cols = rows.FieldDescriptions()
-	//	return nil
-	//}
-
-	args := make([]any, 0)
-	_ = args
-	for {
-		msg, err := backend.Receive()
-		if err != nil {
-			return fmt.Errorf("unexpected message in extended query: %w", err)
+		return startup(cat, tlsConn, pgproto3.NewBackend(tlsConn, tlsConn), db, nil, datadir)
+	case *pgproto3.GSSEncRequest:
+		if _, err = conn.Write([]byte("N")); err != nil {
+			return conn, backend, err
 		}
-
-		_ = stmt
-		switch m := msg.(type) {
-		case *pgproto3.Bind:
-			args = make([]any, 0)
-			for _, p := range m.Parameters {
-				args = append(args, string(p))
-			}
-
-		case *pgproto3.Describe:
-			return fmt.Errorf("pgproto3.Describe not yet implemented")
-			//if err := exec(); err != nil {
-			//	return fmt.Errorf("exec: %w", err)
-			//}
-			//if _, err := c.Write(toRowDescription(cols).Encode(nil)); err != nil {
-			//	return err
-			//}
-
-		case *pgproto3.Execute:
-			//func processQuery(conn net.Conn, query string, db *dbx.DB, dc *pgx.Conn, sources *[]*sysdb.SourceConnector) error {
-			err := processQuery(cat, conn, query, args, db, sources)
-			//err := proxySelect(conn, query, args, dc)
-			if err != nil {
-				return fmt.Errorf("executing prepared statement: %w", err)
-			}
-
-			//// TODO: Send pgproto3.ParseComplete?
-			//if err := exec(); err != nil {
-			//	return fmt.Errorf("exec: %w", err)
-			//}
-			//
-			//var buf []byte
-			//for rows.Next() {
-			//	row, err := scanRow(rows, cols)
-			//	if err != nil {
-			//		return fmt.Errorf("scan: %w", err)
-			//	}
-			//	buf = row.Encode(buf)
-			//}
-			//if err := rows.Err(); err != nil {
-			//	return fmt.Errorf("rows: %w", err)
-			//}
-			//
-			//// Mark command complete and ready for next query.
-			//buf = (&pgproto3.CommandComplete{CommandTag: []byte("SELECT 1")}).Encode(buf)
-			//buf = (&pgproto3.ReadyForQuery{TxStatus: 'I'}).Encode(buf)
-			//_, err := c.Write(buf)
-			//return err
-
-		case *pgproto3.Sync:
-			// NOP
-
-		default:
-			return fmt.Errorf("unexpected message during parse: %#v", msg)
+		return startup(cat, conn, backend, db, tlsConfig, datadir)
+	case *pgproto3.StartupMessage:
+		if tlsConfig != nil {
+			// TLS is configured but the client did not request it.
+			return conn, backend, fmt.Errorf("startup: TLS required")
+		}
+		if err = handleStartup(cat, conn, backend, m, db, datadir); err != nil {
+			return conn, backend, err
 		}
+		return conn, backend, nil
+	case *pgproto3.CancelRequest:
+		return conn, backend, fmt.Errorf("startup: cancel request not supported")
+	default:
+		return conn, backend, fmt.Errorf("unknown message: %v", msg)
 	}
 }
 
-func processQuery(cat *catalog.Catalog, conn net.Conn, query string, args []any, db *dbx.DB, sources *[]*sysdb.SourceConnector) error {
-	dc, err := db.Connect()
-	if err != nil {
-		return fmt.Errorf("connecting to database: %w", err)
-	}
-	defer dbx.Close(dc)
-
+// processQuery runs a single statement on the database connection dc and
+// writes the response, ending with ReadyForQuery.
+func processQuery(cat *catalog.Catalog, conn net.Conn, query string, args []any, db *dbx.DB, dc *pgx.Conn, sources *sysdb.SourceList) error {
 	var e string
 	node, err, pass := parser.Parse(query)
 	if err != nil {
 		e = err.Error()
 	}
 	log.Trace("query received: query=%q node=%#v err=%q pass=%v\n", query, node, e, pass)
-	if pass {
-		err = proxyQuery(conn, query, args, node, dc)
+	if isPassthrough(query) {
+		err = proxyQuery(conn, query, args, dc)
 		if err != nil {
 			buffer, erre := encode(nil, []pgproto3.Message{
 				&pgproto3.ErrorResponse{Message: "ERROR:  " + err.Error()},
@@ -282,17 +188,25 @@ func processQuery(cat *catalog.Catalog, conn net.Conn, query string, args []any,
 	case *ast.DeregisterUserStmt:
 		err = deregisterUser(conn, n, db, dc)
 	case *ast.DropDataMappingStmt:
-		err = dropDataMapping(conn, n, cat)
+		err = dropDataMapping(conn, n, dc, cat)
 	case *ast.RegisterUserStmt:
 		err = registerUser(conn, n, db, dc)
 	case *ast.CreateDataSourceStmt:
 		err = createDataSource(conn, n, dc)
 	case *ast.CreateDataMappingStmt:
-		err = createDataMapping(conn, n, cat)
+		err = createDataMapping(conn, n, dc, cat)
 	case *ast.AlterTableAddColumnStmt:
 		err = alterTableAddColumn(conn, n, dc, cat)
 	case *ast.AlterTableAlterColumnStmt:
 		err = alterTableAlterColumn(conn, n, dc, cat)
+	case *ast.AlterTableSetPrimaryKeyStmt:
+		err = alterTableSetPrimaryKey(conn, n, dc, cat)
+	case *ast.AlterTableDropPrimaryKeyStmt:
+		err = alterTableDropPrimaryKey(conn, n, dc, cat)
+	case *ast.AlterTableSetHistoryRetentionStmt:
+		err = alterTableSetHistoryRetention(conn, n, dc, cat)
+	case *ast.AlterTableDropHistoryRetentionStmt:
+		err = alterTableDropHistoryRetention(conn, n, dc, cat)
 	case *ast.AlterDataSourceStmt:
 		err = alterDataSource(conn, n, dc)
 	case *ast.CreateUserStmt:
@@ -322,13 +236,17 @@ func processQuery(cat *catalog.Catalog, conn net.Conn, query string, args []any,
 	case *ast.CreateDataOriginStmt:
 		err = createDataOrigin(conn, n, dc, cat)
 	case *ast.ListStmt:
-		err = list(conn, n, dc, sources)
+		err = list(conn, n, dc, cat, sources)
 	case *ast.RefreshInferredColumnTypesStmt:
 		err = refreshInferredColumnTypesStmt(conn, dc)
 	case *ast.VerifyConsistencyStmt:
 		err = verifyConsistencyStmt(conn, dc)
 	case *ast.CreateSchemaForUserStmt:
 		err = createSchemaForUser(conn, n, dc)
+	case *ast.DeadLetterStmt:
+		err = deadLetter(conn, n, dc)
+	case *ast.PreviewTableStmt:
+		err = previewTable(conn, n, db, cat)
 	//case *ast.SelectStmt:
 	//	if n.Fn == "version" {
 	//		return version(conn, query)
@@ -366,71 +284,113 @@ func processQuery(cat *catalog.Catalog, conn net.Conn, query string, args []any,
 	return nil
 }
 
-func handleStartup(conn net.Conn, msg *pgproto3.StartupMessage) error {
+func handleStartup(cat *catalog.Catalog, conn net.Conn, backend *pgproto3.Backend, msg *pgproto3.StartupMessage, db *dbx.DB, datadir string) error {
 	if msg.ProtocolVersion != 0x30000 {
 		return fmt.Errorf("startup: unknown protocol version \"%#x\"", msg.ProtocolVersion)
 	}
-	if msg.Parameters["application_name"] != "psql" {
-		return fmt.Errorf("startup: unsupported application %q", msg.Parameters["application_name"])
+	dbname := msg.Parameters["database"]
+	if dbname == "" {
+		dbname = msg.Parameters["user"]
 	}
-	if msg.Parameters["database"] != "metadb" {
-		return fmt.Errorf("startup: unsupported database name %q (use \"-d metadb\")", msg.Parameters["database"])
+	ok, err := isClientDatabaseName(cat, dbname)
+	if err != nil {
+		return fmt.Errorf("startup: %v", err)
 	}
-	buffer, erre := encode(nil, []pgproto3.Message{
-		&pgproto3.AuthenticationOk{},
-		&pgproto3.ParameterStatus{Name: "server_version", Value: "15.3.0"},
-		&pgproto3.ReadyForQuery{TxStatus: 'I'},
-	})
+	if !ok {
+		return fmt.Errorf("startup: unsupported database name %q", dbname)
+	}
+	if err = authenticate(cat, backend, db, datadir, msg.Parameters["user"]); err != nil {
+		return fmt.Errorf("startup: %v", err)
+	}
+	m := []pgproto3.Message{&pgproto3.AuthenticationOk{}}
+	for _, p := range startupParameters(db, msg.Parameters["application_name"]) {
+		m = append(m, p)
+	}
+	m = append(m, &pgproto3.BackendKeyData{ProcessID: rand.Uint32(), SecretKey: rand.Uint32()})
+	m = append(m, &pgproto3.ReadyForQuery{TxStatus: 'I'})
+	buffer, erre := encode(nil, m)
 	if erre != nil {
 		return fmt.Errorf("startup: %v", erre)
 	}
 	return write(conn, buffer)
 }
 
+// isClientDatabaseName returns true if name is one of the database names
+// that clients may connect to, as defined by the configuration parameter
+// client_database_names.
+func isClientDatabaseName(cat *catalog.Catalog, name string) (bool, error) {
+	names, err := cat.GetConfig("client_database_names")
+	if err != nil {
+		return false, err
+	}
+	for _, n := range strings.Split(names, ",") {
+		if strings.TrimSpace(n) == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// startupParameters returns the run-time parameters reported to a client
+// after startup.  Values are taken from the database where possible, so that
+// they describe the format of proxied query results.  Metadb always uses
+// UTF8 for client communication.
+func startupParameters(db *dbx.DB, applicationName string) []*pgproto3.ParameterStatus {
+	params := []*pgproto3.ParameterStatus{
+		{Name: "server_version", Value: "15.3.0"},
+		{Name: "server_encoding", Value: "UTF8"},
+		{Name: "client_encoding", Value: "UTF8"},
+		{Name: "DateStyle", Value: "ISO, MDY"},
+		{Name: "IntervalStyle", Value: "postgres"},
+		{Name: "TimeZone", Value: "UTC"},
+		{Name: "integer_datetimes", Value: "on"},
+		{Name: "standard_conforming_strings", Value: "on"},
+		{Name: "is_superuser", Value: "off"},
+		{Name: "application_name", Value: applicationName},
+	}
+	dc, err := db.Connect()
+	if err != nil {
+		log.Info("startup: reading parameters: %v", err)
+		return params
+	}
+	defer dbx.Close(dc)
+	for _, p := range params {
+		switch p.Name {
+		case "application_name", "client_encoding", "is_superuser":
+			continue
+		}
+		if v := dc.PgConn().ParameterStatus(p.Name); v != "" {
+			p.Value = v
+		}
+	}
+	return params
+}
+
+// encodeFieldDesc encodes a RowDescription that carries the upstream field
+// descriptions, with all columns in text format.
 func encodeFieldDesc(buffer []byte, cols []pgconn.FieldDescription) ([]byte, error) {
 	var desc pgproto3.RowDescription
 	var col pgconn.FieldDescription
 	for _, col = range cols {
 		var f = pgproto3.FieldDescription{
 			Name:                 []byte(col.Name),
-			TableOID:             0,
-			TableAttributeNumber: 0,
-			DataTypeOID:          pgtype.TextOID,
-			DataTypeSize:         -1,
-			TypeModifier:         -1,
-			Format:               0,
+			TableOID:             col.TableOID,
+			TableAttributeNumber: col.TableAttributeNumber,
+			DataTypeOID:          col.DataTypeOID,
+			DataTypeSize:         col.DataTypeSize,
+			TypeModifier:         col.TypeModifier,
+			Format:               pgtype.TextFormatCode,
 		}
 		desc.Fields = append(desc.Fields, f)
 	}
 	return desc.Encode(buffer)
 }
 
-func encodeRow(buffer []byte, rows pgx.Rows, cols []pgconn.FieldDescription) ([]byte, error) {
-	var err error
-	var numCols = len(cols)
-	var dest = make([]any, numCols)
-	var vals = make([]any, numCols)
-	var i int
-	for i = range dest {
-		dest[i] = &(vals[i])
-	}
-	if err = rows.Scan(dest...); err != nil {
-		return nil, err
-	}
-	var row = pgproto3.DataRow{Values: make([][]byte, numCols)}
-	var a any
-	for i, a = range vals {
-		if a == nil {
-			row.Values[i] = []byte("")
-			continue
-		}
-		switch v := a.(type) {
-		case []byte:
-			row.Values[i] = v
-		default:
-			row.Values[i] = []byte(fmt.Sprintf("%v", v))
-		}
-	}
+// encodeRow encodes the current row as a DataRow.  The row must have been
+// read in text format, so that the values are passed through in the
+// PostgreSQL text representation; a nil value is encoded as NULL.
+func encodeRow(buffer []byte, rows pgx.Rows) ([]byte, error) {
+	var row = pgproto3.DataRow{Values: rows.RawValues()}
 	return row.Encode(buffer)
 }
 
@@ -448,9 +408,6 @@ func dropDataSource(conn net.Conn, node *ast.DropDataSourceStmt, dc *pgx.Conn) e
 	if err != nil {
 		return fmt.Errorf("deleting data source %q", node.DataSourceName)
 	}
-	_ = writeEncoded(conn, []pgproto3.Message{
-		&pgproto3.NoticeResponse{Severity: "INFO", Message: "restart server for data source changes to take effect"},
-	})
 	return writeEncoded(conn, []pgproto3.Message{
 		&pgproto3.CommandComplete{CommandTag: []byte("DROP DATA SOURCE")},
 		&pgproto3.ReadyForQuery{TxStatus: 'I'},
@@ -1,118 +1,268 @@
 package libpq
 
 import (
+	"context"
 	"fmt"
 	"net"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgproto3"
 	"github.com/metadb-project/metadb/cmd/metadb/ast"
+	"github.com/metadb-project/metadb/cmd/metadb/catalog"
 	"github.com/metadb-project/metadb/cmd/metadb/sysdb"
 )
 
-func list(conn net.Conn, node *ast.ListStmt, dc *pgx.Conn, sources *[]*sysdb.SourceConnector) error {
+func list(conn net.Conn, node *ast.ListStmt, dc *pgx.Conn, cat *catalog.Catalog, sources *sysdb.SourceList) error {
 	switch strings.ToLower(node.Name) {
+	case "history_retention":
+		return listHistoryRetention(conn, dc, cat)
+	case "status":
+		return listStatus(conn, sources)
+	}
+	q, err := listQuery(node.Name)
+	if err != nil {
+		return err
+	}
+	return proxySelect(conn, q, nil, dc)
+}
+
+// listDescription returns the RowDescription of the result of a LIST
+// statement that reads from the database, without running it.
+func listDescription(node *ast.ListStmt, dc *pgx.Conn) (pgproto3.Message, error) {
+	q, err := listQuery(node.Name)
+	if err != nil {
+		return nil, err
+	}
+	sd, err := dc.PgConn().Prepare(context.TODO(), "metadb_list", q, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err = dc.PgConn().Deallocate(context.TODO(), "metadb_list"); err != nil {
+		return nil, err
+	}
+	return rowDescription(sd.Fields, nil), nil
+}
+
+// listQuery returns the query that reads the data for a LIST statement.
+func listQuery(name string) (string, error) {
+	switch strings.ToLower(name) {
 	case "authorizations":
-		return proxySelect(conn, ""+
-			"SELECT username,"+
-			"       CASE WHEN (NOT dbupdated) THEN 'pending restart'"+
-			"            WHEN (tables='.*' AND dbupdated) THEN 'authorized'"+
-			"            ELSE 'not authorized'"+
-			"       END note"+
-			"    FROM metadb.auth"+
-			"    ORDER BY username", nil, dc)
+		return "" +
+			"SELECT username," +
+			"       CASE WHEN (NOT dbupdated) THEN 'pending restart'" +
+			"            WHEN (tables='.*' AND dbupdated) THEN 'authorized'" +
+			"            ELSE 'not authorized'" +
+			"       END note" +
+			"    FROM metadb.auth" +
+			"    ORDER BY username", nil
 	case "config":
-		return proxySelect(conn, ""+
-			"SELECT parameter, value FROM metadb.config ORDER BY parameter", nil, dc)
+		return "" +
+			"SELECT parameter, value FROM metadb.config ORDER BY parameter", nil
 	case "data_mappings":
-		return proxySelect(conn, ""+
-			"SELECT 'json' mapping_type,"+
-			"       schema_name||'.'||table_name||'__' table_name,"+
-			"       column_name,"+
-			"       path object_path,"+
-			"       map target_identifier"+
-			"    FROM metadb.transform_json"+
-			"    ORDER BY mapping_type, table_name, column_name, path", nil, dc)
+		return "" +
+			"SELECT 'json' mapping_type," +
+			"       schema_name||'.'||table_name||'__' table_name," +
+			"       column_name," +
+			"       path object_path," +
+			"       map target_identifier" +
+			"    FROM metadb.transform_json" +
+			"    ORDER BY mapping_type, table_name, column_name, path", nil
 	case "data_origins":
-		return proxySelect(conn, ""+
-			"SELECT name"+
-			"    FROM metadb.origin"+
-			"    ORDER BY name", nil, dc)
+		return "" +
+			"SELECT name" +
+			"    FROM metadb.origin" +
+			"    ORDER BY name", nil
 	case "data_sources":
-		return proxySelect(conn, ""+
-			"SELECT name,"+
-			"       brokers,"+
-			"       security,"+
-			"       topics,"+
-			"       consumer_group,"+
-			"       schema_pass_filter,"+
-			"       schema_stop_filter,"+
-			"       table_stop_filter,"+
-			"       trim_schema_prefix,"+
-			"       add_schema_prefix,"+
-			"       map_public_schema,"+
-			"       module"+
-			"    FROM metadb.source"+
-			"    ORDER BY name", nil, dc)
-	case "status":
-		return listStatus(conn, sources)
+		return "" +
+			"SELECT name," +
+			"       type," +
+			"       brokers," +
+			"       security," +
+			"       topics," +
+			"       consumer_group," +
+			"       schema_registry," +
+			"       flattened," +
+			"       schemaless," +
+			"       dead_letter," +
+			"       dead_letter_topic," +
+			"       schema_pass_filter," +
+			"       schema_stop_filter," +
+			"       table_stop_filter," +
+			"       column_stop_filter," +
+			"       column_mask," +
+			"       schema_rename," +
+			"       table_rename," +
+			"       trim_schema_prefix," +
+			"       add_schema_prefix," +
+			"       map_public_schema," +
+			"       module," +
+			"       path," +
+			"       publication," +
+			"       slot," +
+			"       history_retention," +
+			"       change_log" +
+			"    FROM metadb.source" +
+			"    ORDER BY name", nil
+	case "dead_letters":
+		return "" +
+			"SELECT id," +
+			"       source_name," +
+			"       topic," +
+			"       position," +
+			"       stage," +
+			"       error," +
+			"       attempts," +
+			"       retry," +
+			"       created," +
+			"       updated" +
+			"    FROM metadb.dead_letter" +
+			"    ORDER BY id", nil
+	case "history_retention":
+		return "" +
+			"SELECT table_name," +
+			"       partition_name," +
+			"       retention," +
+			"       pg_size_pretty(pg_total_relation_size(to_regclass(partition_name))) size," +
+			"       expired" +
+			"    FROM unnest($1::text[], $2::text[], $3::text[], $4::boolean[])" +
+			"        AS t(table_name, partition_name, retention, expired)" +
+			"    ORDER BY table_name, partition_name", nil
 	default:
-		return fmt.Errorf("unrecognized parameter %q", node.Name)
+		return "", fmt.Errorf("unrecognized parameter %q", name)
 	}
 }
 
-func listStatus(conn net.Conn, sources *[]*sysdb.SourceConnector) error {
-	m := []pgproto3.Message{
-		&pgproto3.RowDescription{Fields: []pgproto3.FieldDescription{
-			{
-				Name:                 []byte("type"),
-				TableOID:             0,
-				TableAttributeNumber: 0,
-				DataTypeOID:          25,
-				DataTypeSize:         -1,
-				TypeModifier:         -1,
-				Format:               0,
-			},
-			{
-				Name:                 []byte("name"),
-				TableOID:             0,
-				TableAttributeNumber: 0,
-				DataTypeOID:          25,
-				DataTypeSize:         -1,
-				TypeModifier:         -1,
-				Format:               0,
-			},
-			{
-				Name:                 []byte("source_stream"),
-				TableOID:             0,
-				TableAttributeNumber: 0,
-				DataTypeOID:          25,
-				DataTypeSize:         -1,
-				TypeModifier:         -1,
-				Format:               0,
-			},
-			{
-				Name:                 []byte("source_sync"),
-				TableOID:             0,
-				TableAttributeNumber: 0,
-				DataTypeOID:          25,
-				DataTypeSize:         -1,
-				TypeModifier:         -1,
-				Format:               0,
-			},
-		}},
+// listHistoryRetention reports the history partitions of tables that have a
+// retention policy, with their sizes and whether they will be dropped at the
+// next maintenance.  Nothing is changed, so it can be used to estimate the
+// space that a policy would reclaim.
+func listHistoryRetention(conn net.Conn, dc *pgx.Conn, cat *catalog.Catalog) error {
+	parts, err := cat.HistoryPartitions(dc, time.Now())
+	if err != nil {
+		return err
+	}
+	var tables, partitions, retentions []string
+	var expired []bool
+	for _, p := range parts {
+		tables = append(tables, p.Table.String()+"__")
+		partitions = append(partitions, p.SQL())
+		retentions = append(retentions, p.Retention)
+		expired = append(expired, p.Expired)
 	}
-	for _, s := range *sources {
+	q, _ := listQuery("history_retention")
+	return proxySelect(conn, q, []any{tables, partitions, retentions, expired}, dc)
+}
+
+func listStatus(conn net.Conn, sources *sysdb.SourceList) error {
+	m := []pgproto3.Message{statusRowDescription()}
+	srcs := sources.All()
+	for _, s := range srcs {
+		// Retry columns are NULL unless the stream has had an error
+		// since the last checkpoint.
+		var attempts, class, next, lastError []byte
+		if r := s.Status.Retry.Get(); r.Attempts != 0 {
+			attempts = []byte(strconv.Itoa(r.Attempts))
+			class = []byte(r.Class)
+			if !r.Next.IsZero() {
+				next = []byte(r.Next.Format("2006-01-02 15:04:05.000000Z07:00"))
+			}
+			lastError = []byte(r.Error)
+		}
 		m = append(m, &pgproto3.DataRow{Values: [][]byte{
 			[]byte("data_source"),
 			[]byte(s.Name),
 			[]byte(s.Status.Stream.GetString()),
 			[]byte(s.Status.Sync.GetString()),
+			attempts,
+			class,
+			next,
+			lastError,
 		}})
 	}
-	ctag := fmt.Sprintf("SELECT %d", len(*sources))
+	ctag := fmt.Sprintf("SELECT %d", len(srcs))
 	m = append(m, &pgproto3.CommandComplete{CommandTag: []byte(ctag)})
 	m = append(m, &pgproto3.ReadyForQuery{TxStatus: 'I'})
 	return writeEncoded(conn, m)
 }
+
+// statusRowDescription returns the RowDescription of the result of LIST
+// status.
+func statusRowDescription() *pgproto3.RowDescription {
+	return &pgproto3.RowDescription{Fields: []pgproto3.FieldDescription{
+		{
+			Name:                 []byte("type"),
+			TableOID:             0,
+			TableAttributeNumber: 0,
+			DataTypeOID:          25,
+			DataTypeSize:         -1,
+			TypeModifier:         -1,
+			Format:               0,
+		},
+		{
+			Name:                 []byte("name"),
+			TableOID:             0,
+			TableAttributeNumber: 0,
+			DataTypeOID:          25,
+			DataTypeSize:         -1,
+			TypeModifier:         -1,
+			Format:               0,
+		},
+		{
+			Name:                 []byte("source_stream"),
+			TableOID:             0,
+			TableAttributeNumber: 0,
+			DataTypeOID:          25,
+			DataTypeSize:         -1,
+			TypeModifier:         -1,
+			Format:               0,
+		},
+		{
+			Name:                 []byte("source_sync"),
+			TableOID:             0,
+			TableAttributeNumber: 0,
+			DataTypeOID:          25,
+			DataTypeSize:         -1,
+			TypeModifier:         -1,
+			Format:               0,
+		},
+		{
+			Name:                 []byte("retry_attempts"),
+			TableOID:             0,
+			TableAttributeNumber: 0,
+			DataTypeOID:          23,
+			DataTypeSize:         4,
+			TypeModifier:         -1,
+			Format:               0,
+		},
+		{
+			Name:                 []byte("retry_class"),
+			TableOID:             0,
+			TableAttributeNumber: 0,
+			DataTypeOID:          25,
+			DataTypeSize:         -1,
+			TypeModifier:         -1,
+			Format:               0,
+		},
+		{
+			Name:                 []byte("next_retry"),
+			TableOID:             0,
+			TableAttributeNumber: 0,
+			DataTypeOID:          1184,
+			DataTypeSize:         8,
+			TypeModifier:         -1,
+			Format:               0,
+		},
+		{
+			Name:                 []byte("last_error"),
+			TableOID:             0,
+			TableAttributeNumber: 0,
+			DataTypeOID:          25,
+			DataTypeSize:         -1,
+			TypeModifier:         -1,
+			Format:               0,
+		},
+	}}
+}
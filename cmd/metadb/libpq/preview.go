@@ -0,0 +1,82 @@
+package libpq
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/metadb-project/metadb/cmd/metadb/ast"
+	"github.com/metadb-project/metadb/cmd/metadb/catalog"
+	"github.com/metadb-project/metadb/cmd/metadb/command"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+	"github.com/metadb-project/metadb/cmd/metadb/sysdb"
+	"github.com/metadb-project/metadb/cmd/metadb/util"
+)
+
+// previewTable shows the table in Metadb that a table in a data source is
+// mapped to by the filters and rename rules of the data source.  The table
+// name is NULL if the table is rejected by a filter.
+func previewTable(conn net.Conn, node *ast.PreviewTableStmt, db *dbx.DB, cat *catalog.Catalog) error {
+	schema, table, ok := strings.Cut(node.TableName, ".")
+	if !ok || schema == "" || table == "" {
+		return fmt.Errorf("%q is not a valid table name", node.TableName)
+	}
+	sources, err := sysdb.ReadSourceConnectors(db)
+	if err != nil {
+		return fmt.Errorf("reading data sources: %w", err)
+	}
+	var src *sysdb.SourceConnector
+	for _, s := range sources {
+		if s.Name == node.DataSourceName {
+			src = s
+		}
+	}
+	if src == nil {
+		return fmt.Errorf("data source %q does not exist", node.DataSourceName)
+	}
+	schemaPassFilter, err := util.CompileRegexps(src.SchemaPassFilter)
+	if err != nil {
+		return err
+	}
+	schemaStopFilter, err := util.CompileRegexps(src.SchemaStopFilter)
+	if err != nil {
+		return err
+	}
+	tableStopFilter, err := util.CompileRegexps(src.TableStopFilter)
+	if err != nil {
+		return err
+	}
+	renames, err := command.NewRenameRules(src.Module, src.SchemaRename, src.TableRename)
+	if err != nil {
+		return err
+	}
+
+	var tableName, origin []byte
+	c := &command.Command{}
+	if c.SetTable(cat, schema, table, schemaPassFilter, schemaStopFilter, tableStopFilter, src.TrimSchemaPrefix,
+		src.AddSchemaPrefix, src.MapPublicSchema, renames) {
+		tableName = []byte(c.SchemaName + "." + c.TableName)
+		if c.Origin != "" {
+			origin = []byte(c.Origin)
+		}
+	}
+	var fields []pgproto3.FieldDescription
+	for _, name := range []string{"source_table", "table_name", "origin"} {
+		fields = append(fields, pgproto3.FieldDescription{
+			Name:                 []byte(name),
+			TableOID:             0,
+			TableAttributeNumber: 0,
+			DataTypeOID:          25,
+			DataTypeSize:         -1,
+			TypeModifier:         -1,
+			Format:               0,
+		})
+	}
+	return writeEncoded(conn, []pgproto3.Message{
+		&pgproto3.RowDescription{Fields: fields},
+		&pgproto3.DataRow{Values: [][]byte{[]byte(node.TableName), tableName, origin}},
+		&pgproto3.CommandComplete{CommandTag: []byte("SELECT 1")},
+		&pgproto3.ReadyForQuery{TxStatus: 'I'},
+	})
+}
@@ -4,69 +4,145 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"strings"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgproto3"
-	"github.com/metadb-project/metadb/cmd/metadb/ast"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/metadb-project/metadb/cmd/metadb/parser"
 )
 
-func proxyQuery(conn net.Conn, query string, args []any, node ast.Node, dc *pgx.Conn) error {
-	switch node.(type) {
-	case *ast.SelectStmt:
-		return proxySelect(conn, query, args, dc)
-		//case *ast.CreateUserStmt:
-		//	return createUser(conn, query, n, db)
+// passthroughKeywords are the leading keywords of statements that are passed
+// through to the database.  They are limited to queries and to statements
+// that read or change session settings, which clients such as JDBC drivers
+// send when connecting.  Other SQL statements are not passed through,
+// because the database connection belongs to the Metadb administrator; and
+// since a query can still modify data, for example in a WITH clause or with
+// EXPLAIN ANALYZE, every statement that is passed through is run in a
+// read-only transaction (see beginReadOnly).
+var passthroughKeywords = map[string]bool{
+	"SELECT":  true,
+	"WITH":    true,
+	"VALUES":  true,
+	"TABLE":   true,
+	"EXPLAIN": true,
+	"SET":     true,
+	"SHOW":    true,
+	"RESET":   true,
+}
+
+// isPassthrough returns true if a statement should be passed through to the
+// database rather than run as a Metadb command.
+func isPassthrough(query string) bool {
+	return passthroughKeywords[strings.ToUpper(leadingKeyword(query))]
+}
+
+// leadingKeyword returns the first word of a statement, skipping white space,
+// comments, and opening parentheses.
+func leadingKeyword(query string) string {
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '(':
+		case strings.HasPrefix(query[i:], "--"):
+			j := strings.IndexByte(query[i:], '\n')
+			if j < 0 {
+				return ""
+			}
+			i += j
+		case strings.HasPrefix(query[i:], "/*"):
+			j := strings.Index(query[i:], "*/")
+			if j < 0 {
+				return ""
+			}
+			i += j + 1
+		default:
+			j := i
+			for j < len(query) && (query[j] >= 'A' && query[j] <= 'Z' || query[j] >= 'a' && query[j] <= 'z') {
+				j++
+			}
+			return query[i:j]
+		}
 	}
+	return ""
+}
 
-	return writeEncoded(conn, []pgproto3.Message{
-		&pgproto3.ErrorResponse{Severity: "ERROR", Message: "syntax error"},
-		&pgproto3.ReadyForQuery{TxStatus: 'I'},
-	})
+func proxyQuery(conn net.Conn, query string, args []any, dc *pgx.Conn) error {
+	return proxySelect(conn, query, args, dc)
+}
 
-	//ctag, err := dc.Exec(context.TODO(), query)
-	//if err != nil {
-	//	return errors.New(strings.TrimLeft(strings.TrimPrefix(err.Error(), "ERROR:"), " "))
-	//}
-	//b := encode(nil, []pgproto3.Message{
-	//	&pgproto3.CommandComplete{CommandTag: []byte(ctag.String())},
-	//	&pgproto3.ReadyForQuery{TxStatus: 'I'},
-	//})
-	//return write(conn, b)
+// beginReadOnly starts a read-only transaction on a database connection, in
+// which a statement that is passed through is run.  If a transaction block
+// is in progress, a savepoint is used instead, within which the transaction
+// is made read-only.  The returned function ends the transaction; it
+// commits a transaction so that session settings changed by the statement
+// are kept, and rolls back to a savepoint so that the transaction block
+// can continue to make changes.
+func beginReadOnly(pc *pgconn.PgConn) (func() error, error) {
+	if pc.TxStatus() != 'I' {
+		q := "SAVEPOINT metadb_read_only; SET TRANSACTION READ ONLY"
+		if err := pc.Exec(context.TODO(), q).Close(); err != nil {
+			return nil, err
+		}
+		return func() error {
+			q := "ROLLBACK TO SAVEPOINT metadb_read_only; RELEASE SAVEPOINT metadb_read_only"
+			return pc.Exec(context.TODO(), q).Close()
+		}, nil
+	}
+	if err := pc.Exec(context.TODO(), "BEGIN READ ONLY").Close(); err != nil {
+		return nil, err
+	}
+	return func() error {
+		// A failed transaction is rolled back by COMMIT.
+		return pc.Exec(context.TODO(), "COMMIT").Close()
+	}, nil
 }
 
 func proxySelect(conn net.Conn, query string, args []any, dbconn *pgx.Conn) error {
 	var err error
 	var rows pgx.Rows
-	if rows, err = dbconn.Query(context.TODO(), query, args...); err != nil {
-		var ok bool
-		var e *pgconn.PgError
-		if e, ok = err.(*pgconn.PgError); !ok {
-			panic("passthroughQuery(): casting error to *pgconn.PgError")
+	end, err := beginReadOnly(dbconn.PgConn())
+	if err != nil {
+		return proxyError(conn, query, err)
+	}
+	defer func() {
+		if end != nil {
+			_ = end()
 		}
-		var s = e.Severity + ":  " + e.Message + "\n" + parser.WriteErrorContext(query, int(e.Position-1))
-		return writeEncoded(conn, []pgproto3.Message{
-			&pgproto3.ErrorResponse{Message: s},
-			&pgproto3.ReadyForQuery{TxStatus: 'I'},
-		})
+	}()
+	// Request all results in text format so that values can be passed
+	// through unchanged.
+	var qargs = append([]any{pgx.QueryResultFormats{pgtype.TextFormatCode}}, args...)
+	if rows, err = dbconn.Query(context.TODO(), query, qargs...); err != nil {
+		return proxyError(conn, query, err)
 	}
 	defer rows.Close()
-	var cols = rows.FieldDescriptions()
-	b, erre := encodeFieldDesc(nil, cols)
-	if erre != nil {
-		return fmt.Errorf("proxy select: field desc: %v", erre)
+	var b []byte
+	var erre error
+	// Statements such as SET do not return rows and have no row
+	// description.
+	if cols := rows.FieldDescriptions(); len(cols) > 0 {
+		if b, erre = encodeFieldDesc(nil, cols); erre != nil {
+			return fmt.Errorf("proxy select: field desc: %v", erre)
+		}
 	}
 	for rows.Next() {
-		if b, err = encodeRow(b, rows, cols); err != nil {
+		if b, err = encodeRow(b, rows); err != nil {
 			return err
 		}
 	}
+	rows.Close()
 	if err = rows.Err(); err != nil {
-		return err
+		return proxyError(conn, query, err)
+	}
+	endReadOnly := end
+	end = nil
+	if err = endReadOnly(); err != nil {
+		return proxyError(conn, query, err)
 	}
 	b, erre = encode(b, []pgproto3.Message{
-		&pgproto3.CommandComplete{CommandTag: []byte("SELECT 1")},
+		&pgproto3.CommandComplete{CommandTag: []byte(rows.CommandTag().String())},
 		&pgproto3.ReadyForQuery{TxStatus: 'I'},
 	})
 	if erre != nil {
@@ -74,3 +150,18 @@ func proxySelect(conn net.Conn, query string, args []any, dbconn *pgx.Conn) erro
 	}
 	return write(conn, b)
 }
+
+// proxyError writes an error returned by the database for a proxied
+// statement, with the position of the error shown in context.
+func proxyError(conn net.Conn, query string, err error) error {
+	var e *pgconn.PgError
+	var ok bool
+	if e, ok = err.(*pgconn.PgError); !ok {
+		return err
+	}
+	var s = e.Severity + ":  " + e.Message + "\n" + parser.WriteErrorContext(query, int(e.Position-1))
+	return writeEncoded(conn, []pgproto3.Message{
+		&pgproto3.ErrorResponse{Message: s},
+		&pgproto3.ReadyForQuery{TxStatus: 'I'},
+	})
+}
@@ -27,12 +27,12 @@ func registerUser(conn net.Conn, node *ast.RegisterUserStmt, db *dbx.DB, dc *pgx
 	}
 
 	// Duplicated from CREATE USER, but necessary in case a DROP USER failed in midstream.
-	if err = grantCreateOnUserSchema(dc, node.UserName); err != nil {
+	if err = savepoint(dc, func() error { return grantCreateOnUserSchema(dc, node.UserName) }); err != nil {
 		_ = writeEncoded(conn, []pgproto3.Message{&pgproto3.NoticeResponse{Severity: "NOTICE",
 			Message: util.PGErr(err).Error()},
 		})
 	}
-	if err = grantUsageOnUserSchema(dc, node.UserName); err != nil {
+	if err = savepoint(dc, func() error { return grantUsageOnUserSchema(dc, node.UserName) }); err != nil {
 		_ = writeEncoded(conn, []pgproto3.Message{&pgproto3.NoticeResponse{Severity: "NOTICE",
 			Message: util.PGErr(err).Error()},
 		})
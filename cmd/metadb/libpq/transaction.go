@@ -0,0 +1,235 @@
+package libpq
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/metadb-project/metadb/cmd/metadb/ast"
+	"github.com/metadb-project/metadb/cmd/metadb/catalog"
+	"github.com/metadb-project/metadb/cmd/metadb/parser"
+	"github.com/metadb-project/metadb/cmd/metadb/util"
+)
+
+// processSimpleQuery runs the statements in a simple query message.  Each
+// statement is run separately, unless the statements are enclosed in a
+// transaction block, and the first error ends processing of the query.
+func (s *session) processSimpleQuery(query string) error {
+	stmts := parser.SplitStatements(query)
+	if len(stmts) == 0 {
+		return writeEncoded(s.conn, []pgproto3.Message{
+			&pgproto3.EmptyQueryResponse{},
+			&pgproto3.ReadyForQuery{TxStatus: s.txStatus},
+		})
+	}
+	for _, stmt := range stmts {
+		response, err := s.runStatement(stmt)
+		if err != nil {
+			return err
+		}
+		var b []byte
+		var failed bool
+		for _, msg := range response {
+			if msg[0] == 'E' { // ErrorResponse
+				failed = true
+			}
+			b = append(b, msg...)
+		}
+		if err = write(s.conn, b); err != nil {
+			return err
+		}
+		if failed {
+			break
+		}
+	}
+	return writeEncoded(s.conn, []pgproto3.Message{&pgproto3.ReadyForQuery{TxStatus: s.txStatus}})
+}
+
+// runStatement runs a single statement and returns the encoded response
+// messages, excluding ReadyForQuery.  If the statement fails within a
+// transaction block, the transaction block is marked as failed.
+func (s *session) runStatement(query string) ([][]byte, error) {
+	dc, err := s.connect()
+	if err != nil {
+		return nil, err
+	}
+	node, perr, pass := parser.Parse(query)
+	c := &captureConn{Conn: s.conn}
+	switch {
+	case !pass && isTransactionStmt(node):
+		err = s.transactionStmt(c, node, dc)
+	case s.txStatus == 'E':
+		err = writeEncoded(c, []pgproto3.Message{errorResponse(fmt.Errorf(
+			"current transaction is aborted, commands ignored until end of transaction block"))})
+	case s.txStatus == 'T' && !pass && perr == nil && !isTransactional(node):
+		err = writeEncoded(c, []pgproto3.Message{errorResponse(fmt.Errorf(
+			"%s cannot run inside a transaction block", commandName(query)))})
+	default:
+		if s.txStatus == 'T' && changesDefinitions(node) {
+			s.reload = true
+		}
+		err = processQuery(s.cat, c, query, nil, s.db, dc, s.sources)
+	}
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := splitMessages(c.buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	response := msgs[:0]
+	for _, msg := range msgs {
+		switch msg[0] {
+		case 'Z': // ReadyForQuery
+			continue
+		case 'E': // ErrorResponse
+			s.failTransaction()
+		}
+		response = append(response, msg)
+	}
+	return response, nil
+}
+
+// transactionStmt runs BEGIN, COMMIT, or ROLLBACK.  As in PostgreSQL, a
+// warning is returned for a redundant statement, and COMMIT of a failed
+// transaction block rolls it back.
+func (s *session) transactionStmt(conn *captureConn, node ast.Node, dc *pgx.Conn) error {
+	var q, tag, warning string
+	switch node.(type) {
+	case *ast.BeginStmt:
+		q, tag = "BEGIN", "BEGIN"
+		if s.txStatus != 'I' {
+			warning = "there is already a transaction in progress"
+		}
+	case *ast.CommitStmt:
+		q, tag = "COMMIT", "COMMIT"
+		if s.txStatus == 'E' {
+			q, tag = "ROLLBACK", "ROLLBACK"
+		}
+		if s.txStatus == 'I' {
+			warning = "there is no transaction in progress"
+		}
+	case *ast.RollbackStmt:
+		q, tag = "ROLLBACK", "ROLLBACK"
+		if s.txStatus == 'I' {
+			warning = "there is no transaction in progress"
+		}
+	}
+	var msgs []pgproto3.Message
+	if warning != "" {
+		msgs = append(msgs, &pgproto3.NoticeResponse{Severity: "WARNING", Message: warning})
+	} else {
+		if _, err := dc.Exec(context.TODO(), q); err != nil {
+			return writeEncoded(conn, []pgproto3.Message{errorResponse(util.PGErr(err))})
+		}
+		if q == "BEGIN" {
+			s.txStatus = 'T'
+		} else {
+			s.txStatus = 'I'
+			reload := s.reload && q == "COMMIT"
+			s.reload = false
+			if reload {
+				if err := s.reloadDefinitions(); err != nil {
+					return writeEncoded(conn, []pgproto3.Message{errorResponse(err)})
+				}
+			}
+		}
+	}
+	msgs = append(msgs, &pgproto3.CommandComplete{CommandTag: []byte(tag)})
+	return writeEncoded(conn, msgs)
+}
+
+// reloadDefinitions applies committed changes to JSON mappings and primary
+// key overrides to the in-memory catalog.  The stream processor lock is held
+// so that a change does not take effect in the middle of a batch.
+func (s *session) reloadDefinitions() error {
+	catalog.ExecMutex.Lock()
+	defer catalog.ExecMutex.Unlock()
+	if err := s.cat.ReloadDefinitions(); err != nil {
+		return fmt.Errorf("committed changes will take effect after restart: %w", err)
+	}
+	return nil
+}
+
+// failTransaction marks the current transaction block, if any, as failed.
+func (s *session) failTransaction() {
+	if s.txStatus == 'T' {
+		s.txStatus = 'E'
+	}
+}
+
+func isTransactionStmt(node ast.Node) bool {
+	switch node.(type) {
+	case *ast.BeginStmt, *ast.CommitStmt, *ast.RollbackStmt:
+		return true
+	default:
+		return false
+	}
+}
+
+// isTransactional returns true if a Metadb command makes changes only
+// within the database, so that it can be run inside a transaction block.
+// Commands that also change the in-memory catalog or use a separate
+// database connection cannot be rolled back and are not allowed.  In
+// particular, ALTER TABLE ADD COLUMN and ALTER COLUMN TYPE change data tables
+// while holding the stream processor lock, which would otherwise be held
+// until the end of the transaction block, stopping all data sources.
+func isTransactional(node ast.Node) bool {
+	switch node.(type) {
+	case *ast.CreateDataSourceStmt, *ast.AlterDataSourceStmt, *ast.DropDataSourceStmt,
+		*ast.CreateUserStmt, *ast.RegisterUserStmt, *ast.CreateSchemaForUserStmt,
+		*ast.GrantAccessOnAllStmt, *ast.GrantAccessOnFunctionStmt, *ast.GrantAccessOnTableStmt,
+		*ast.RevokeAccessOnAllStmt, *ast.RevokeAccessOnFunctionStmt, *ast.RevokeAccessOnTableStmt,
+		*ast.DeadLetterStmt, *ast.ListStmt,
+		*ast.AlterTableSetHistoryRetentionStmt, *ast.AlterTableDropHistoryRetentionStmt:
+		return true
+	default:
+		return changesDefinitions(node)
+	}
+}
+
+// changesDefinitions returns true if a Metadb command changes JSON mappings
+// or primary key overrides.  Inside a transaction block, these changes are
+// applied to the in-memory catalog when the transaction is committed.
+func changesDefinitions(node ast.Node) bool {
+	switch node.(type) {
+	case *ast.CreateDataMappingStmt, *ast.DropDataMappingStmt,
+		*ast.AlterTableSetPrimaryKeyStmt, *ast.AlterTableDropPrimaryKeyStmt:
+		return true
+	default:
+		return false
+	}
+}
+
+// commandName returns the leading keywords of a statement, for use in error
+// messages.
+func commandName(query string) string {
+	words := strings.Fields(strings.ToUpper(strings.TrimSuffix(query, ";")))
+	n := min(len(words), 2)
+	if n == 2 && (words[1] == "DATA" || words[1] == "INFERRED" || words[1] == "DEAD") {
+		n = min(len(words), 3)
+	}
+	return strings.Join(words[:n], " ")
+}
+
+// savepoint runs f and, if the connection is in a transaction block, does so
+// within a savepoint, so that an error returned by f does not abort the
+// transaction.  It is used for database changes whose errors are reported
+// only as notices.
+func savepoint(dc *pgx.Conn, f func() error) error {
+	if dc.PgConn().TxStatus() == 'I' {
+		return f()
+	}
+	if _, err := dc.Exec(context.TODO(), "SAVEPOINT metadb_notice"); err != nil {
+		return err
+	}
+	if err := f(); err != nil {
+		_, _ = dc.Exec(context.TODO(), "ROLLBACK TO SAVEPOINT metadb_notice")
+		_, _ = dc.Exec(context.TODO(), "RELEASE SAVEPOINT metadb_notice")
+		return err
+	}
+	_, err := dc.Exec(context.TODO(), "RELEASE SAVEPOINT metadb_notice")
+	return err
+}
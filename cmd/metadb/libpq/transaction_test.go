@@ -0,0 +1,38 @@
+package libpq
+
+import (
+	"testing"
+
+	"github.com/metadb-project/metadb/cmd/metadb/parser"
+)
+
+func TestIsTransactional(t *testing.T) {
+	tests := []struct {
+		query  string
+		want   bool
+		reload bool
+	}{
+		{"create data mapping for json from table library.inventory__ column content path '$.item' to 'item';", true, true},
+		{"drop data mapping for json from table library.inventory__ column content path '$.item';", true, true},
+		{"alter table library.loan__ set primary key (id);", true, true},
+		{"alter table library.loan__ drop primary key;", true, true},
+		{"alter table library.loan__ set history retention '3';", true, false},
+		{"alter table library.loan__ drop history retention;", true, false},
+		{"grant access on all to u;", true, false},
+		{"alter table library.loan__ add column note text;", false, false},
+		{"alter table library.loan__ alter column note type uuid;", false, false},
+		{"alter system set checkpoint_segment_size = '3000';", false, false},
+	}
+	for _, tt := range tests {
+		node, err, _ := parser.Parse(tt.query)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.query, err)
+		}
+		if got := isTransactional(node); got != tt.want {
+			t.Errorf("isTransactional(%q) = %v; want %v", tt.query, got, tt.want)
+		}
+		if got := changesDefinitions(node); got != tt.reload {
+			t.Errorf("changesDefinitions(%q) = %v; want %v", tt.query, got, tt.reload)
+		}
+	}
+}
@@ -0,0 +1,361 @@
+// Package logrepl reads changes from a PostgreSQL publication using the
+// logical replication protocol and the pgoutput plugin.
+package logrepl
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/metadb-project/metadb/cmd/metadb/command"
+	"github.com/metadb-project/metadb/cmd/metadb/log"
+)
+
+// statusInterval is the maximum time between standby status updates sent to
+// the server, which must be less than the server's wal_sender_timeout.
+const statusInterval = 10 * time.Second
+
+// slotNameRegexp matches the replication slot names allowed by PostgreSQL.
+var slotNameRegexp = regexp.MustCompile(`^[a-z0-9_]{1,63}$`)
+
+// LSN is a PostgreSQL write-ahead log location.
+type LSN uint64
+
+func (l LSN) String() string {
+	return fmt.Sprintf("%X/%X", uint32(l>>32), uint32(l))
+}
+
+// ParseLSN parses an LSN in the form returned by String.
+func ParseLSN(s string) (LSN, error) {
+	var hi, lo uint32
+	if _, err := fmt.Sscanf(s, "%X/%X", &hi, &lo); err != nil {
+		return 0, fmt.Errorf("invalid LSN %q", s)
+	}
+	return LSN(uint64(hi)<<32 | uint64(lo)), nil
+}
+
+// Source reads changes from a publication and decodes them into commands.
+// On first use, a replication slot is created and the existing rows of the
+// published tables are read from a snapshot, before streaming begins.
+type Source struct {
+	conn        *pgconn.PgConn
+	slot        string
+	publication string
+	decoder     *decoder
+	// snapshot is the initial copy of the published tables, or nil if the
+	// copy is not in progress.
+	snapshot *snapshot
+	// queue holds commands decoded but not yet returned.
+	queue []*command.Command
+	// readLSN is the end of the last transaction for which all commands
+	// have been returned.
+	readLSN LSN
+	// confirmedLSN is the location reported to the server as flushed.
+	confirmedLSN LSN
+	// inTransaction is true if a transaction has begun but its commit
+	// has not been read.
+	inTransaction bool
+	// pending is true if commands have been returned since the last
+	// commit.
+	pending    bool
+	statusTime time.Time
+	// commit is called to store the confirmed LSN.
+	commit func(position string) error
+}
+
+// Open connects to a PostgreSQL database for logical replication.  If
+// position is "", the replication slot is created, replacing any existing
+// slot of the same name, and the source begins with a snapshot of the
+// published tables.  Otherwise streaming resumes from the LSN in position.
+// The commit function is called to store the confirmed LSN.
+func Open(ctx context.Context, connString, slot, publication, position string,
+	commit func(position string) error) (*Source, error) {
+	if !slotNameRegexp.MatchString(slot) {
+		return nil, fmt.Errorf("invalid replication slot name %q", slot)
+	}
+	config, err := pgconn.ParseConfig(connString)
+	if err != nil {
+		return nil, fmt.Errorf("parsing connection string: %w", err)
+	}
+	setSessionParams(config.RuntimeParams)
+	config.RuntimeParams["replication"] = "database"
+	conn, err := pgconn.ConnectConfig(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("connecting for replication: %w", err)
+	}
+	s := &Source{
+		conn:        conn,
+		slot:        slot,
+		publication: publication,
+		decoder:     newDecoder(),
+		commit:      commit,
+	}
+	if position != "" {
+		if s.readLSN, err = ParseLSN(position); err != nil {
+			_ = conn.Close(ctx)
+			return nil, err
+		}
+		s.confirmedLSN = s.readLSN
+		if err = s.startReplication(ctx); err != nil {
+			_ = conn.Close(ctx)
+			return nil, err
+		}
+		return s, nil
+	}
+	snapshotName, err := s.createSlot(ctx)
+	if err != nil {
+		_ = conn.Close(ctx)
+		return nil, err
+	}
+	if s.snapshot, err = openSnapshot(ctx, connString, snapshotName, publication); err != nil {
+		_ = conn.Close(ctx)
+		return nil, err
+	}
+	return s, nil
+}
+
+// setSessionParams sets run-time parameters so that values are sent in the
+// formats expected by Metadb.
+func setSessionParams(params map[string]string) {
+	params["DateStyle"] = "ISO"
+	params["IntervalStyle"] = "postgres"
+	params["TimeZone"] = "UTC"
+	params["extra_float_digits"] = "3"
+}
+
+// createSlot creates the replication slot, dropping it first if it exists,
+// and returns the name of the exported snapshot.  The slot's consistent
+// point becomes the starting LSN.
+func (s *Source) createSlot(ctx context.Context) (string, error) {
+	q := "SELECT 1 FROM pg_catalog.pg_replication_slots WHERE slot_name='" + s.slot + "'"
+	results, err := s.conn.Exec(ctx, q).ReadAll()
+	if err != nil {
+		return "", fmt.Errorf("reading replication slots: %w", err)
+	}
+	if len(results) > 0 && len(results[0].Rows) > 0 {
+		log.Info("dropping replication slot %q for new snapshot", s.slot)
+		if _, err = s.conn.Exec(ctx, "DROP_REPLICATION_SLOT "+quoteIdent(s.slot)).ReadAll(); err != nil {
+			return "", fmt.Errorf("dropping replication slot %q: %w", s.slot, err)
+		}
+	}
+	q = "CREATE_REPLICATION_SLOT " + quoteIdent(s.slot) + " LOGICAL pgoutput EXPORT_SNAPSHOT"
+	results, err = s.conn.Exec(ctx, q).ReadAll()
+	if err != nil {
+		return "", fmt.Errorf("creating replication slot %q: %w", s.slot, err)
+	}
+	if len(results) == 0 || len(results[0].Rows) == 0 || len(results[0].Rows[0]) < 3 {
+		return "", fmt.Errorf("creating replication slot %q: unexpected result", s.slot)
+	}
+	row := results[0].Rows[0]
+	if s.readLSN, err = ParseLSN(string(row[1])); err != nil {
+		return "", err
+	}
+	log.Info("created replication slot %q at %s", s.slot, s.readLSN)
+	return string(row[2]), nil
+}
+
+// startReplication starts streaming from readLSN.
+func (s *Source) startReplication(ctx context.Context) error {
+	q := "START_REPLICATION SLOT " + quoteIdent(s.slot) + " LOGICAL " + s.readLSN.String() +
+		" (proto_version '1', publication_names '" + quoteIdent(s.publication) + "')"
+	s.conn.Frontend().SendQuery(&pgproto3.Query{String: q})
+	if err := s.conn.Frontend().Flush(); err != nil {
+		return fmt.Errorf("starting replication: %w", err)
+	}
+	for {
+		msg, err := s.conn.ReceiveMessage(ctx)
+		if err != nil {
+			return fmt.Errorf("starting replication: %w", err)
+		}
+		switch m := msg.(type) {
+		case *pgproto3.CopyBothResponse:
+			log.Debug("streaming from replication slot %q at %s", s.slot, s.readLSN)
+			s.statusTime = time.Now()
+			return nil
+		case *pgproto3.ErrorResponse:
+			return fmt.Errorf("starting replication: %w", pgconn.ErrorResponseToPgError(m))
+		}
+	}
+}
+
+// ReadCommand returns the next command, or nil if no command is available
+// before the timeout expires.  The returned command has the schema and
+// table names of the source database.  The boolean result is true if the
+// command was read from the initial snapshot.
+func (s *Source) ReadCommand(timeout time.Duration) (*command.Command, bool, error) {
+	if len(s.queue) > 0 {
+		return s.dequeue(), false, nil
+	}
+	if s.snapshot != nil {
+		ctx := context.TODO()
+		c, err := s.snapshot.read(ctx)
+		if err != nil {
+			return nil, false, err
+		}
+		if c != nil {
+			s.pending = true
+			return c, true, nil
+		}
+		// The snapshot is complete.
+		if err = s.snapshot.close(ctx); err != nil {
+			return nil, false, err
+		}
+		s.snapshot = nil
+		if err = s.startReplication(ctx); err != nil {
+			return nil, false, err
+		}
+		return nil, false, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for {
+		if time.Since(s.statusTime) >= statusInterval {
+			if err := s.sendStatus(); err != nil {
+				return nil, false, err
+			}
+		}
+		msg, err := s.conn.ReceiveMessage(ctx)
+		if err != nil {
+			if pgconn.Timeout(err) {
+				return nil, false, nil
+			}
+			return nil, false, fmt.Errorf("receiving replication message: %w", err)
+		}
+		switch m := msg.(type) {
+		case *pgproto3.CopyData:
+			if err = s.receive(m.Data); err != nil {
+				return nil, false, err
+			}
+			if len(s.queue) > 0 {
+				return s.dequeue(), false, nil
+			}
+		case *pgproto3.ErrorResponse:
+			return nil, false, fmt.Errorf("replication: %w", pgconn.ErrorResponseToPgError(m))
+		case *pgproto3.CopyDone:
+			return nil, false, io.ErrUnexpectedEOF
+		}
+	}
+}
+
+func (s *Source) dequeue() *command.Command {
+	c := s.queue[0]
+	s.queue = s.queue[1:]
+	s.pending = true
+	return c
+}
+
+// receive processes a message in the replication stream.
+func (s *Source) receive(data []byte) error {
+	if len(data) == 0 {
+		return errors.New("empty replication message")
+	}
+	r := &reader{buf: data[1:]}
+	switch data[0] {
+	case 'k': // Primary keepalive
+		walEnd := LSN(r.uint64())
+		_ = r.uint64() // Server time
+		replyRequested := r.byte() == 1
+		if r.err != nil {
+			return r.err
+		}
+		// If no commands are awaiting commit, nothing more needs to be
+		// read up to the end of the server's log.
+		if !s.pending && !s.inTransaction && walEnd > s.readLSN {
+			s.readLSN = walEnd
+			s.confirmedLSN = walEnd
+		}
+		if replyRequested {
+			return s.sendStatus()
+		}
+		return nil
+	case 'w': // XLogData
+		_ = r.uint64() // Start of data
+		_ = r.uint64() // Current end of the server's log
+		_ = r.uint64() // Server time
+		if r.err != nil {
+			return r.err
+		}
+		msg := r.buf
+		if len(msg) > 0 {
+			switch msg[0] {
+			case 'B':
+				s.inTransaction = true
+			case 'C':
+				cr := &reader{buf: msg[1:]}
+				_ = cr.byte()   // Flags
+				_ = cr.uint64() // Commit LSN
+				end := LSN(cr.uint64())
+				if cr.err != nil {
+					return cr.err
+				}
+				s.inTransaction = false
+				s.readLSN = end
+				if !s.pending {
+					s.confirmedLSN = end
+				}
+			}
+		}
+		cmds, err := s.decoder.decode(msg)
+		if err != nil {
+			return err
+		}
+		s.queue = append(s.queue, cmds...)
+		return nil
+	default:
+		return nil
+	}
+}
+
+// sendStatus sends a standby status update reporting confirmedLSN.
+func (s *Source) sendStatus() error {
+	buf := make([]byte, 34)
+	buf[0] = 'r'
+	binary.BigEndian.PutUint64(buf[1:], uint64(s.confirmedLSN))  // Written
+	binary.BigEndian.PutUint64(buf[9:], uint64(s.confirmedLSN))  // Flushed
+	binary.BigEndian.PutUint64(buf[17:], uint64(s.confirmedLSN)) // Applied
+	binary.BigEndian.PutUint64(buf[25:], uint64(time.Since(pgEpoch).Microseconds()))
+	if err := s.conn.Frontend().SendUnbufferedEncodedCopyData(buf); err != nil {
+		return fmt.Errorf("sending standby status update: %w", err)
+	}
+	s.statusTime = time.Now()
+	return nil
+}
+
+// Commit confirms the end of the last transaction for which all commands
+// have been returned, storing it and reporting it to the server so that
+// earlier changes are not sent again.  Commands returned from a transaction
+// that is still in progress will be read again after the source is reopened.
+func (s *Source) Commit() error {
+	if s.snapshot != nil {
+		// Rows from an incomplete snapshot cannot be confirmed.
+		return nil
+	}
+	s.confirmedLSN = s.readLSN
+	if s.commit != nil {
+		if err := s.commit(s.confirmedLSN.String()); err != nil {
+			return err
+		}
+	}
+	s.pending = s.inTransaction
+	return s.sendStatus()
+}
+
+func (s *Source) Close() error {
+	ctx := context.TODO()
+	if s.snapshot != nil {
+		_ = s.snapshot.close(ctx)
+		s.snapshot = nil
+	}
+	return s.conn.Close(ctx)
+}
+
+func quoteIdent(s string) string {
+	return pgx.Identifier{s}.Sanitize()
+}
@@ -0,0 +1,449 @@
+package logrepl
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/metadb-project/metadb/cmd/metadb/command"
+	"github.com/metadb-project/metadb/cmd/metadb/log"
+	"github.com/metadb-project/metadb/cmd/metadb/types"
+)
+
+// relation describes a table as sent in a pgoutput relation message.
+type relation struct {
+	id      uint32
+	schema  string
+	table   string
+	columns []column
+}
+
+type column struct {
+	name string
+	// key is true if the column is part of the replica identity.
+	key     bool
+	typeOID uint32
+}
+
+// hasKey returns true if the relation has at least one key column.
+func (r *relation) hasKey() bool {
+	for _, col := range r.columns {
+		if col.key {
+			return true
+		}
+	}
+	return false
+}
+
+// tupleValue is a column value in a pgoutput tuple.  A nil data value is
+// NULL, unless unchanged is true, which indicates a TOASTed value that was
+// not modified and has not been sent.
+type tupleValue struct {
+	data      *string
+	unchanged bool
+}
+
+// decoder decodes pgoutput (protocol version 1) messages into commands.
+type decoder struct {
+	relations map[uint32]*relation
+	// timestamp is the commit timestamp of the current transaction.
+	timestamp string
+	// warned records relations for which a missing key has been reported.
+	warned map[uint32]bool
+}
+
+func newDecoder() *decoder {
+	return &decoder{relations: make(map[uint32]*relation), warned: make(map[uint32]bool)}
+}
+
+// decode decodes a pgoutput message and returns the resulting commands,
+// which may be none.
+func (d *decoder) decode(data []byte) ([]*command.Command, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty pgoutput message")
+	}
+	r := &reader{buf: data[1:]}
+	switch data[0] {
+	case 'B': // Begin
+		_ = r.uint64() // Final LSN
+		d.timestamp = pgTime(int64(r.uint64())).Format("2006-01-02 15:04:05.000000000") + "Z"
+		_ = r.uint32() // Transaction ID
+		return nil, r.err
+	case 'R': // Relation
+		return nil, d.decodeRelation(r)
+	case 'I': // Insert
+		rel, err := d.relation(r.uint32())
+		if err != nil {
+			return nil, err
+		}
+		if r.byte() != 'N' {
+			return nil, d.malformed(data[0])
+		}
+		tuple := r.tuple(len(rel.columns))
+		if r.err != nil {
+			return nil, r.err
+		}
+		return d.mergeCommand(rel, tuple), nil
+	case 'U': // Update
+		rel, err := d.relation(r.uint32())
+		if err != nil {
+			return nil, err
+		}
+		var old []tupleValue
+		kind := r.byte()
+		if kind == 'K' || kind == 'O' {
+			old = r.tuple(len(rel.columns))
+			kind = r.byte()
+		}
+		if kind != 'N' {
+			return nil, d.malformed(data[0])
+		}
+		tuple := r.tuple(len(rel.columns))
+		if r.err != nil {
+			return nil, r.err
+		}
+		var cmds []*command.Command
+		if old != nil && keyChanged(rel, old, tuple) {
+			// The old row is deleted, as its key no longer exists.
+			cmds = d.deleteCommand(rel, old)
+		}
+		return append(cmds, d.mergeCommand(rel, tuple)...), nil
+	case 'D': // Delete
+		rel, err := d.relation(r.uint32())
+		if err != nil {
+			return nil, err
+		}
+		if kind := r.byte(); kind != 'K' && kind != 'O' {
+			return nil, d.malformed(data[0])
+		}
+		tuple := r.tuple(len(rel.columns))
+		if r.err != nil {
+			return nil, r.err
+		}
+		return d.deleteCommand(rel, tuple), nil
+	case 'T': // Truncate
+		n := int(r.uint32())
+		_ = r.byte() // Options
+		var cmds []*command.Command
+		for i := 0; i < n; i++ {
+			rel, err := d.relation(r.uint32())
+			if err != nil {
+				return nil, err
+			}
+			cmds = append(cmds, &command.Command{
+				Op:              command.TruncateOp,
+				SchemaName:      rel.schema,
+				TableName:       rel.table,
+				SourceTimestamp: d.timestamp,
+			})
+		}
+		return cmds, r.err
+	default:
+		// Commit, origin, type, and logical decoding messages do not
+		// result in commands.
+		return nil, nil
+	}
+}
+
+func (d *decoder) decodeRelation(r *reader) error {
+	id := r.uint32()
+	rel := &relation{id: id, schema: r.string(), table: r.string()}
+	if rel.schema == "" {
+		rel.schema = "pg_catalog"
+	}
+	_ = r.byte() // Replica identity setting
+	n := int(r.uint16())
+	for i := 0; i < n && r.err == nil; i++ {
+		flags := r.byte()
+		col := column{key: flags&1 != 0, name: r.string(), typeOID: r.uint32()}
+		_ = r.uint32() // Type modifier
+		rel.columns = append(rel.columns, col)
+	}
+	if r.err != nil {
+		return r.err
+	}
+	d.relations[id] = rel
+	return nil
+}
+
+func (d *decoder) relation(id uint32) (*relation, error) {
+	rel, ok := d.relations[id]
+	if !ok {
+		return nil, fmt.Errorf("pgoutput: unknown relation %d", id)
+	}
+	return rel, nil
+}
+
+func (d *decoder) malformed(msgType byte) error {
+	return fmt.Errorf("pgoutput: malformed %q message", msgType)
+}
+
+// mergeCommand returns a merge command for a new row, or nil if the table
+// has no key.
+func (d *decoder) mergeCommand(rel *relation, tuple []tupleValue) []*command.Command {
+	if !rel.hasKey() {
+		d.warnNoKey(rel)
+		return nil
+	}
+	c := &command.Command{
+		Op:              command.MergeOp,
+		SchemaName:      rel.schema,
+		TableName:       rel.table,
+		SourceTimestamp: d.timestamp,
+	}
+	var key int
+	for i, col := range rel.columns {
+		cc := newCommandColumn(col, tuple[i].data)
+		if col.key {
+			key++
+			cc.PrimaryKey = key
+		}
+		cc.Unavailable = tuple[i].unchanged
+		c.Column = append(c.Column, cc)
+	}
+	return []*command.Command{c}
+}
+
+// deleteCommand returns a delete command containing the key columns of an
+// old row, or nil if the table has no key.
+func (d *decoder) deleteCommand(rel *relation, tuple []tupleValue) []*command.Command {
+	if !rel.hasKey() {
+		d.warnNoKey(rel)
+		return nil
+	}
+	c := &command.Command{
+		Op:              command.DeleteOp,
+		SchemaName:      rel.schema,
+		TableName:       rel.table,
+		SourceTimestamp: d.timestamp,
+	}
+	var key int
+	for i, col := range rel.columns {
+		if !col.key {
+			continue
+		}
+		key++
+		cc := newCommandColumn(col, tuple[i].data)
+		cc.PrimaryKey = key
+		c.Column = append(c.Column, cc)
+	}
+	return []*command.Command{c}
+}
+
+// keyChanged returns true if the key columns of two tuples have different
+// values.
+func keyChanged(rel *relation, old, tuple []tupleValue) bool {
+	for i, col := range rel.columns {
+		if !col.key {
+			continue
+		}
+		o, n := old[i].data, tuple[i].data
+		if (o == nil) != (n == nil) || (o != nil && *o != *n) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *decoder) warnNoKey(rel *relation) {
+	if !d.warned[rel.id] {
+		d.warned[rel.id] = true
+		log.Warning("primary key not defined: %s.%s", rel.schema, rel.table)
+	}
+}
+
+// newCommandColumn returns a command column for a value in PostgreSQL text
+// format.
+func newCommandColumn(col column, data *string) command.CommandColumn {
+	dtype, size := convertType(col.typeOID)
+	cc := command.CommandColumn{Name: col.name, DType: dtype, DTypeSize: size}
+	if data == nil {
+		return cc
+	}
+	cc.Data = *data
+	s := *data
+	switch dtype {
+	case types.BooleanType:
+		if s == "t" {
+			s = "true"
+		} else {
+			s = "false"
+		}
+	case types.FloatType, types.NumericType:
+		// Special values such as NaN and Infinity are not numeric
+		// literals and must be quoted.
+		if s == "NaN" || strings.HasSuffix(s, "Infinity") {
+			s = "'" + s + "'"
+		}
+	}
+	cc.SQLData = &s
+	return cc
+}
+
+// convertType returns the data type and type size corresponding to a
+// PostgreSQL type.  Types that are not otherwise supported are treated as
+// text.
+func convertType(oid uint32) (types.DataType, int64) {
+	switch oid {
+	case pgtype.BoolOID:
+		return types.BooleanType, 0
+	case pgtype.Int2OID:
+		return types.IntegerType, 2
+	case pgtype.Int4OID:
+		return types.IntegerType, 4
+	case pgtype.Int8OID:
+		return types.IntegerType, 8
+	case pgtype.Float4OID:
+		return types.FloatType, 4
+	case pgtype.Float8OID:
+		return types.FloatType, 8
+	case pgtype.NumericOID:
+		return types.NumericType, 0
+	case pgtype.DateOID:
+		return types.DateType, 0
+	case pgtype.TimeOID:
+		return types.TimeType, 0
+	case pgtype.TimetzOID:
+		return types.TimetzType, 0
+	case pgtype.TimestampOID:
+		return types.TimestampType, 0
+	case pgtype.TimestamptzOID:
+		return types.TimestamptzType, 0
+	case pgtype.UUIDOID:
+		return types.UUIDType, 0
+	case pgtype.JSONOID, pgtype.JSONBOID:
+		return types.JSONType, 0
+	case pgtype.ByteaOID:
+		return types.ByteaType, 0
+	case pgtype.IntervalOID:
+		return types.IntervalType, 0
+	case pgtype.BoolArrayOID:
+		return types.ArrayOf(types.BooleanType), 0
+	case pgtype.Int2ArrayOID:
+		return types.ArrayOf(types.IntegerType), 2
+	case pgtype.Int4ArrayOID:
+		return types.ArrayOf(types.IntegerType), 4
+	case pgtype.Int8ArrayOID:
+		return types.ArrayOf(types.IntegerType), 8
+	case pgtype.Float4ArrayOID:
+		return types.ArrayOf(types.FloatType), 4
+	case pgtype.Float8ArrayOID:
+		return types.ArrayOf(types.FloatType), 8
+	case pgtype.NumericArrayOID:
+		return types.ArrayOf(types.NumericType), 0
+	case pgtype.TextArrayOID, pgtype.VarcharArrayOID, pgtype.BPCharArrayOID:
+		return types.ArrayOf(types.TextType), 0
+	case pgtype.DateArrayOID:
+		return types.ArrayOf(types.DateType), 0
+	case pgtype.TimestampArrayOID:
+		return types.ArrayOf(types.TimestampType), 0
+	case pgtype.TimestamptzArrayOID:
+		return types.ArrayOf(types.TimestamptzType), 0
+	case pgtype.UUIDArrayOID:
+		return types.ArrayOf(types.UUIDType), 0
+	default:
+		return types.TextType, 0
+	}
+}
+
+// pgEpoch is the epoch used for timestamps in the replication protocol.
+var pgEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// pgTime converts microseconds since pgEpoch to a time.
+func pgTime(usec int64) time.Time {
+	return pgEpoch.Add(time.Duration(usec) * time.Microsecond)
+}
+
+// reader reads fields from a protocol message.  After an error, reads
+// return zero values and err is set.
+type reader struct {
+	buf []byte
+	err error
+}
+
+func (r *reader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.buf) < n {
+		r.err = fmt.Errorf("pgoutput: unexpected end of message")
+		r.buf = nil
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *reader) byte() byte {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *reader) uint16() uint16 {
+	if b := r.next(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *reader) uint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *reader) uint64() uint64 {
+	if b := r.next(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+// string reads a null-terminated string.
+func (r *reader) string() string {
+	if r.err != nil {
+		return ""
+	}
+	for i, c := range r.buf {
+		if c == 0 {
+			s := string(r.buf[:i])
+			r.buf = r.buf[i+1:]
+			return s
+		}
+	}
+	r.err = fmt.Errorf("pgoutput: unterminated string")
+	r.buf = nil
+	return ""
+}
+
+// tuple reads tuple data having the specified number of columns.
+func (r *reader) tuple(columns int) []tupleValue {
+	n := int(r.uint16())
+	if r.err == nil && n != columns {
+		r.err = fmt.Errorf("pgoutput: tuple has %d columns, expected %d", n, columns)
+		return nil
+	}
+	tuple := make([]tupleValue, 0, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		switch kind := r.byte(); kind {
+		case 'n': // NULL
+			tuple = append(tuple, tupleValue{})
+		case 'u': // Unchanged TOASTed value
+			tuple = append(tuple, tupleValue{unchanged: true})
+		case 't': // Text
+			s := string(r.next(int(r.uint32())))
+			tuple = append(tuple, tupleValue{data: &s})
+		default:
+			if r.err == nil {
+				r.err = fmt.Errorf("pgoutput: unknown tuple data type %q", kind)
+			}
+		}
+	}
+	return tuple
+}
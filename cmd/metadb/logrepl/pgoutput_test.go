@@ -0,0 +1,117 @@
+package logrepl
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/metadb-project/metadb/cmd/metadb/command"
+	"github.com/metadb-project/metadb/cmd/metadb/types"
+)
+
+// message builds a pgoutput message.
+type message []byte
+
+func (m message) byte(b byte) message { return append(m, b) }
+
+func (m message) uint16(v uint16) message { return binary.BigEndian.AppendUint16(m, v) }
+
+func (m message) uint32(v uint32) message { return binary.BigEndian.AppendUint32(m, v) }
+
+func (m message) uint64(v uint64) message { return binary.BigEndian.AppendUint64(m, v) }
+
+func (m message) string(s string) message { return append(append(m, s...), 0) }
+
+// tuple appends tuple data in which "" is NULL.
+func (m message) tuple(values ...string) message {
+	m = m.uint16(uint16(len(values)))
+	for _, v := range values {
+		if v == "" {
+			m = m.byte('n')
+			continue
+		}
+		m = m.byte('t').uint32(uint32(len(v)))
+		m = append(m, v...)
+	}
+	return m
+}
+
+func TestDecode(t *testing.T) {
+	d := newDecoder()
+	relation := message{'R'}.uint32(16385).string("public").string("loan").byte('d').uint16(3).
+		byte(1).string("id").uint32(pgtype.Int4OID).uint32(0xffffffff).
+		byte(0).string("due").uint32(pgtype.DateOID).uint32(0xffffffff).
+		byte(0).string("renewed").uint32(pgtype.BoolOID).uint32(0xffffffff)
+	begin := message{'B'}.uint64(0).uint64(86400 * 1000000).uint32(1)
+	for _, m := range []message{relation, begin} {
+		if cmds, err := d.decode(m); err != nil || cmds != nil {
+			t.Fatalf("decode(%q) = %v, %v; want nil, nil", m[0], cmds, err)
+		}
+	}
+
+	cmds, err := d.decode(message{'I'}.uint32(16385).byte('N').tuple("1", "2024-03-01", "t"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cmds) != 1 {
+		t.Fatalf("insert: got %d commands; want 1", len(cmds))
+	}
+	c := cmds[0]
+	if c.Op != command.MergeOp || c.SchemaName != "public" || c.TableName != "loan" ||
+		c.SourceTimestamp != "2000-01-02 00:00:00.000000000Z" || len(c.Column) != 3 {
+		t.Fatalf("insert: got %v", c)
+	}
+	if col := c.Column[0]; col.DType != types.IntegerType || col.DTypeSize != 4 || col.PrimaryKey != 1 ||
+		*col.SQLData != "1" {
+		t.Errorf("insert: column id = %+v", col)
+	}
+	if col := c.Column[2]; col.DType != types.BooleanType || col.PrimaryKey != 0 || *col.SQLData != "true" {
+		t.Errorf("insert: column renewed = %+v", col)
+	}
+
+	// An update that changes the key deletes the old row.
+	cmds, err = d.decode(message{'U'}.uint32(16385).byte('K').tuple("1", "", "").byte('N').tuple("2", "", "f"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cmds) != 2 || cmds[0].Op != command.DeleteOp || len(cmds[0].Column) != 1 ||
+		*cmds[0].Column[0].SQLData != "1" || cmds[1].Op != command.MergeOp || cmds[1].Column[1].SQLData != nil {
+		t.Fatalf("update: got %v", cmds)
+	}
+
+	cmds, err = d.decode(message{'D'}.uint32(16385).byte('K').tuple("2", "", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cmds) != 1 || cmds[0].Op != command.DeleteOp || *cmds[0].Column[0].SQLData != "2" {
+		t.Fatalf("delete: got %v", cmds)
+	}
+
+	cmds, err = d.decode(message{'T'}.uint32(1).byte(0).uint32(16385))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cmds) != 1 || cmds[0].Op != command.TruncateOp || cmds[0].TableName != "loan" {
+		t.Fatalf("truncate: got %v", cmds)
+	}
+
+	if _, err = d.decode(message{'I'}.uint32(16385).byte('N').tuple("3")); err == nil {
+		t.Error("insert with wrong number of columns: expected error")
+	}
+	if _, err = d.decode(message{'I'}.uint32(99).byte('N').tuple("3")); err == nil {
+		t.Error("insert into unknown relation: expected error")
+	}
+}
+
+func TestLSN(t *testing.T) {
+	lsn, err := ParseLSN("16/B374D848")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lsn != 0x16B374D848 || lsn.String() != "16/B374D848" {
+		t.Errorf("ParseLSN() = %X", uint64(lsn))
+	}
+	if _, err = ParseLSN("B374D848"); err == nil {
+		t.Error("ParseLSN(\"B374D848\"): expected error")
+	}
+}
@@ -0,0 +1,179 @@
+package logrepl
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/metadb-project/metadb/cmd/metadb/command"
+	"github.com/metadb-project/metadb/cmd/metadb/log"
+)
+
+// snapshot reads the existing rows of the published tables, as of the
+// consistent point of a new replication slot.
+type snapshot struct {
+	conn      *pgx.Conn
+	tables    []relation
+	index     int
+	rows      pgx.Rows
+	rel       *relation
+	timestamp string
+}
+
+// openSnapshot begins a transaction using an exported snapshot and reads the
+// list of published tables.
+func openSnapshot(ctx context.Context, connString, snapshotName, publication string) (*snapshot, error) {
+	config, err := pgx.ParseConfig(connString)
+	if err != nil {
+		return nil, fmt.Errorf("parsing connection string: %w", err)
+	}
+	setSessionParams(config.RuntimeParams)
+	conn, err := pgx.ConnectConfig(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("connecting for snapshot: %w", err)
+	}
+	s := &snapshot{
+		conn:      conn,
+		timestamp: time.Now().UTC().Format("2006-01-02 15:04:05.000000000") + "Z",
+	}
+	if _, err = conn.Exec(ctx, "BEGIN ISOLATION LEVEL REPEATABLE READ READ ONLY"); err != nil {
+		_ = conn.Close(ctx)
+		return nil, fmt.Errorf("starting snapshot: %w", err)
+	}
+	if _, err = conn.Exec(ctx, "SET TRANSACTION SNAPSHOT '"+snapshotName+"'"); err != nil {
+		_ = conn.Close(ctx)
+		return nil, fmt.Errorf("starting snapshot: %w", err)
+	}
+	q := "SELECT c.oid, t.schemaname, t.tablename " +
+		"FROM pg_catalog.pg_publication_tables t " +
+		"JOIN pg_catalog.pg_namespace n ON n.nspname=t.schemaname " +
+		"JOIN pg_catalog.pg_class c ON c.relnamespace=n.oid AND c.relname=t.tablename " +
+		"WHERE t.pubname=$1 ORDER BY t.schemaname, t.tablename"
+	rows, err := conn.Query(ctx, q, publication)
+	if err != nil {
+		_ = conn.Close(ctx)
+		return nil, fmt.Errorf("reading publication %q: %w", publication, err)
+	}
+	for rows.Next() {
+		var rel relation
+		if err = rows.Scan(&rel.id, &rel.schema, &rel.table); err != nil {
+			rows.Close()
+			_ = conn.Close(ctx)
+			return nil, fmt.Errorf("reading publication %q: %w", publication, err)
+		}
+		s.tables = append(s.tables, rel)
+	}
+	if err = rows.Err(); err != nil {
+		_ = conn.Close(ctx)
+		return nil, fmt.Errorf("reading publication %q: %w", publication, err)
+	}
+	log.Info("reading snapshot of %d tables in publication %q", len(s.tables), publication)
+	return s, nil
+}
+
+// read returns the next row as a merge command, or nil if all rows have
+// been read.
+func (s *snapshot) read(ctx context.Context) (*command.Command, error) {
+	for {
+		if s.rows == nil {
+			if s.index >= len(s.tables) {
+				return nil, nil
+			}
+			if err := s.openTable(ctx, &s.tables[s.index]); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if s.rows.Next() {
+			values := s.rows.RawValues()
+			c := &command.Command{
+				Op:              command.MergeOp,
+				SchemaName:      s.rel.schema,
+				TableName:       s.rel.table,
+				SourceTimestamp: s.timestamp,
+			}
+			var key int
+			for i, col := range s.rel.columns {
+				var data *string
+				if values[i] != nil {
+					v := string(values[i])
+					data = &v
+				}
+				cc := newCommandColumn(col, data)
+				if col.key {
+					key++
+					cc.PrimaryKey = key
+				}
+				c.Column = append(c.Column, cc)
+			}
+			return c, nil
+		}
+		s.rows.Close()
+		if err := s.rows.Err(); err != nil {
+			return nil, fmt.Errorf("reading snapshot of table %s.%s: %w", s.rel.schema, s.rel.table, err)
+		}
+		s.rows = nil
+		s.index++
+	}
+}
+
+// openTable begins reading the rows of a table, or skips the table if it
+// has no replica identity key.
+func (s *snapshot) openTable(ctx context.Context, rel *relation) error {
+	// The key columns are those that pgoutput marks as part of the
+	// replica identity.
+	q := "SELECT a.attname FROM pg_catalog.pg_class c " +
+		"JOIN pg_catalog.pg_attribute a ON a.attrelid=c.oid " +
+		"WHERE c.oid=$1 AND a.attnum>0 AND NOT a.attisdropped AND (c.relreplident='f' OR " +
+		"a.attnum=ANY((SELECT i.indkey::int2[] FROM pg_catalog.pg_index i WHERE i.indrelid=c.oid AND " +
+		"CASE c.relreplident WHEN 'd' THEN i.indisprimary WHEN 'i' THEN i.indisreplident ELSE FALSE END)))"
+	rows, err := s.conn.Query(ctx, q, rel.id)
+	if err != nil {
+		return fmt.Errorf("reading key of table %s.%s: %w", rel.schema, rel.table, err)
+	}
+	keys, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return fmt.Errorf("reading key of table %s.%s: %w", rel.schema, rel.table, err)
+	}
+	key := make(map[string]bool)
+	for _, k := range keys {
+		key[k] = true
+	}
+	q = "SELECT * FROM ONLY " + pgx.Identifier{rel.schema, rel.table}.Sanitize()
+	s.rows, err = s.conn.Query(ctx, q, pgx.QueryResultFormats{pgtype.TextFormatCode})
+	if err != nil {
+		return fmt.Errorf("reading snapshot of table %s.%s: %w", rel.schema, rel.table, err)
+	}
+	rel.columns = nil
+	for _, fd := range s.rows.FieldDescriptions() {
+		rel.columns = append(rel.columns, column{name: fd.Name, key: key[fd.Name], typeOID: fd.DataTypeOID})
+	}
+	s.rel = rel
+	if !rel.hasKey() {
+		log.Warning("primary key not defined: %s.%s", rel.schema, rel.table)
+		s.rows.Close()
+		s.rows = nil
+		s.index++
+		return nil
+	}
+	log.Debug("snapshot: reading table %s.%s", rel.schema, rel.table)
+	return nil
+}
+
+// close ends the snapshot transaction.
+func (s *snapshot) close(ctx context.Context) error {
+	if s.rows != nil {
+		s.rows.Close()
+		s.rows = nil
+	}
+	_, err := s.conn.Exec(ctx, "COMMIT")
+	if cerr := s.conn.Close(ctx); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("ending snapshot: %w", err)
+	}
+	return nil
+}
@@ -4,12 +4,14 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/metadb-project/metadb/cmd/metadb/archive"
 	"github.com/metadb-project/metadb/cmd/metadb/color"
 	"github.com/metadb-project/metadb/cmd/metadb/dsync"
 	"github.com/metadb-project/metadb/cmd/metadb/eout"
 	"github.com/metadb-project/metadb/cmd/metadb/initsys"
 	"github.com/metadb-project/metadb/cmd/metadb/log"
 	"github.com/metadb-project/metadb/cmd/metadb/option"
+	"github.com/metadb-project/metadb/cmd/metadb/repartition"
 	"github.com/metadb-project/metadb/cmd/metadb/server"
 	"github.com/metadb-project/metadb/cmd/metadb/stop"
 	"github.com/metadb-project/metadb/cmd/metadb/upgrade"
@@ -55,6 +57,9 @@ func run() error {
 	var syncOpt = option.Sync{}
 	var endSyncOpt = option.EndSync{}
 	var migrateOpt = option.Migrate{}
+	var archiveOpt = option.Archive{}
+	var repartitionOpt = option.Repartition{}
+	var replayOpt = option.Replay{}
 	var logfile, csvlogfile string
 
 	var cmdInit = &cobra.Command{
@@ -125,7 +130,9 @@ func run() error {
 			//if serverOpt.Port == "" {
 			//        serverOpt.Port = metadbAdminPort
 			//}
-			serverOpt.Listen = "127.0.0.1"
+			if serverOpt.Listen == "" {
+				serverOpt.Listen = "127.0.0.1"
+			}
 			if err = server.Start(&serverOpt); err != nil {
 				return fatal(err, logf, csvlogf)
 			}
@@ -136,16 +143,16 @@ func run() error {
 	_ = dirFlag(cmdStart, &serverOpt.Datadir)
 	_ = logFlag(cmdStart, &logfile)
 	//_ = csvlogFlag(cmdStart, &csvlogfile)
-	//_ = listenFlag(cmdStart, &serverOpt.Listen)
+	_ = listenFlag(cmdStart, &serverOpt.Listen)
 	_ = portFlag(cmdStart, &serverOpt.Port)
-	//_ = certFlag(cmdStart, &serverOpt.TLSCert)
-	//_ = keyFlag(cmdStart, &serverOpt.TLSKey)
+	_ = certFlag(cmdStart, &serverOpt.TLSCert)
+	_ = keyFlag(cmdStart, &serverOpt.TLSKey)
 	_ = uuoptFlag(cmdStart, &serverOpt.UUOpt)
 	_ = debugFlag(cmdStart, &serverOpt.Debug)
 	_ = traceLogFlag(cmdStart, &serverOpt.Trace)
 	_ = noKafkaCommitFlag(cmdStart, &serverOpt.NoKafkaCommit)
 	_ = logSourceFlag(cmdStart, &serverOpt.LogSource)
-	//_ = noTLSFlag(cmdStart, &serverOpt.NoTLS)
+	_ = noTLSFlag(cmdStart, &serverOpt.NoTLS)
 	_ = memoryLimitFlag(cmdStart, &serverOpt.MemoryLimit)
 
 	var cmdStop = &cobra.Command{
@@ -235,6 +242,80 @@ func run() error {
 	_ = dirFlag(cmdMigrate, &migrateOpt.Datadir)
 	_ = traceFlag(cmdMigrate, &eout.EnableTrace)
 
+	var cmdArchive = &cobra.Command{
+		Use: "archive",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			if err = initColor(); err != nil {
+				return err
+			}
+			archiveOpt.Global = globalOpt
+			if err = archive.Archive(&archiveOpt); err != nil {
+				return err
+			}
+			return nil
+		},
+	}
+	cmdArchive.SetHelpFunc(help)
+	cmdArchive.Flags().StringVar(&archiveOpt.Table, "table", "", "")
+	_ = cmdArchive.MarkFlagRequired("table")
+	cmdArchive.Flags().IntVar(&archiveOpt.Year, "year", 0, "")
+	_ = cmdArchive.MarkFlagRequired("year")
+	cmdArchive.Flags().StringVar(&archiveOpt.Dir, "output", "", "")
+	_ = cmdArchive.MarkFlagRequired("output")
+	cmdArchive.Flags().BoolVar(&archiveOpt.Drop, "drop", false, "")
+	_ = dirFlag(cmdArchive, &archiveOpt.Datadir)
+	_ = verboseFlag(cmdArchive, &eout.EnableVerbose)
+	_ = traceFlag(cmdArchive, &eout.EnableTrace)
+
+	var cmdRepartition = &cobra.Command{
+		Use: "repartition",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			if err = initColor(); err != nil {
+				return err
+			}
+			repartitionOpt.Global = globalOpt
+			if err = repartition.Repartition(&repartitionOpt); err != nil {
+				return err
+			}
+			return nil
+		},
+	}
+	cmdRepartition.SetHelpFunc(help)
+	cmdRepartition.Flags().StringVar(&repartitionOpt.Table, "table", "", "")
+	_ = cmdRepartition.MarkFlagRequired("table")
+	cmdRepartition.Flags().StringVar(&repartitionOpt.Granularity, "granularity", "", "")
+	_ = cmdRepartition.MarkFlagRequired("granularity")
+	_ = dirFlag(cmdRepartition, &repartitionOpt.Datadir)
+	_ = verboseFlag(cmdRepartition, &eout.EnableVerbose)
+	_ = traceFlag(cmdRepartition, &eout.EnableTrace)
+
+	var cmdReplay = &cobra.Command{
+		Use: "replay",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			if err = initColor(); err != nil {
+				return err
+			}
+			replayOpt.Global = globalOpt
+			if err = server.Replay(&replayOpt); err != nil {
+				return err
+			}
+			return nil
+		},
+	}
+	cmdReplay.SetHelpFunc(help)
+	cmdReplay.Flags().StringVar(&replayOpt.Source, "source", "", "")
+	_ = cmdReplay.MarkFlagRequired("source")
+	cmdReplay.Flags().StringVar(&replayOpt.SourceLog, "source-log", "", "")
+	_ = cmdReplay.MarkFlagRequired("source-log")
+	cmdReplay.Flags().BoolVar(&replayOpt.DryRun, "dry-run", false, "")
+	_ = dirFlag(cmdReplay, &replayOpt.Datadir)
+	_ = uuoptFlag(cmdReplay, &replayOpt.UUOpt)
+	_ = verboseFlag(cmdReplay, &eout.EnableVerbose)
+	_ = traceFlag(cmdReplay, &eout.EnableTrace)
+
 	var cmdVersion = &cobra.Command{
 		Use: "version",
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -260,7 +341,7 @@ func run() error {
 	//rootCmd.PersistentFlags().StringVar(&_, "client", metadbClientPort, ""+
 	//        "client port")
 	// Add commands.
-	rootCmd.AddCommand(cmdStart, cmdStop, cmdInit, cmdUpgrade, cmdSync, cmdEndSync, cmdMigrate, cmdVersion)
+	rootCmd.AddCommand(cmdStart, cmdStop, cmdInit, cmdUpgrade, cmdSync, cmdEndSync, cmdMigrate, cmdArchive, cmdRepartition, cmdReplay, cmdVersion)
 	var err error
 	if err = rootCmd.Execute(); err != nil {
 		return err
@@ -276,6 +357,9 @@ var helpUpgrade = "Upgrade Metadb instance to current version\n"
 var helpSync = "Begin synchronization with a data source\n"
 var helpEndSync = "End synchronization and remove leftover data\n"
 var helpMigrate = "Migrate historical data from LDP\n"
+var helpArchive = "Write history partitions to a Parquet file\n"
+var helpRepartition = "Change the partition granularity of a table\n"
+var helpReplay = "Process change events from a source log\n"
 var helpVersion = "Print metadb version\n"
 
 func help(cmd *cobra.Command, commandLine []string) {
@@ -295,6 +379,9 @@ func help(cmd *cobra.Command, commandLine []string) {
 			"  sync                        - " + helpSync +
 			"  endsync                     - " + helpEndSync +
 			"  migrate                     - " + helpMigrate +
+			"  archive                     - " + helpArchive +
+			"  repartition                 - " + helpRepartition +
+			"  replay                      - " + helpReplay +
 			"  version                     - " + helpVersion +
 			"\n" +
 			"Use \"metadb help <command>\" for more information about a command.\n")
@@ -308,13 +395,13 @@ func help(cmd *cobra.Command, commandLine []string) {
 			dirFlag(nil, nil) +
 			logFlag(nil, nil) +
 			//csvlogFlag(nil, nil) +
-			//listenFlag(nil, nil) +
+			listenFlag(nil, nil) +
 			portFlag(nil, nil) +
-			//certFlag(nil, nil) +
-			//keyFlag(nil, nil) +
+			certFlag(nil, nil) +
+			keyFlag(nil, nil) +
 			uuoptFlag(nil, nil) +
 			debugFlag(nil, nil) +
-			//noTLSFlag(nil, nil) +
+			noTLSFlag(nil, nil) +
 			traceLogFlag(nil, nil) +
 			noKafkaCommitFlag(nil, nil) +
 			logSourceFlag(nil, nil) +
@@ -395,6 +482,49 @@ func help(cmd *cobra.Command, commandLine []string) {
 			"  -D, --dir <d>               - Metadb data directory\n" +
 			traceFlag(nil, nil) +
 			"")
+	case "archive":
+		fmt.Print("" +
+			helpArchive +
+			"\n" +
+			"Usage:  metadb archive <options>\n" +
+			"\n" +
+			"Options:\n" +
+			"      --table <t>             - Main table whose history is archived\n" +
+			"      --year <y>              - Year of the history partitions\n" +
+			"      --output <d>            - Directory to write the Parquet file to\n" +
+			"      --drop                  - Drop the partitions after archiving them\n" +
+			dirFlag(nil, nil) +
+			verboseFlag(nil, nil) +
+			traceFlag(nil, nil) +
+			"")
+	case "repartition":
+		fmt.Print("" +
+			helpRepartition +
+			"\n" +
+			"Usage:  metadb repartition <options>\n" +
+			"\n" +
+			"Options:\n" +
+			"      --table <t>             - Main table whose history is repartitioned\n" +
+			"      --granularity <g>       - Partition by \"year\", \"quarter\", or \"month\"\n" +
+			dirFlag(nil, nil) +
+			verboseFlag(nil, nil) +
+			traceFlag(nil, nil) +
+			"")
+	case "replay":
+		fmt.Print("" +
+			helpReplay +
+			"\n" +
+			"Usage:  metadb replay <options>\n" +
+			"\n" +
+			"Options:\n" +
+			"      --source <s>            - Data source whose configuration is applied\n" +
+			"      --source-log <f>        - Source log file or directory to read\n" +
+			"      --dry-run               - Print commands without writing to the database\n" +
+			dirFlag(nil, nil) +
+			uuoptFlag(nil, nil) +
+			verboseFlag(nil, nil) +
+			traceFlag(nil, nil) +
+			"")
 	case "version":
 		fmt.Print("" +
 			helpVersion +
@@ -489,13 +619,13 @@ func traceLogFlag(cmd *cobra.Command, trace *bool) string {
 	return ""
 }
 
-//func listenFlag(cmd *cobra.Command, listen *string) string {
-//	if cmd != nil {
-//		cmd.Flags().StringVar(listen, "listen", "", "")
-//	}
-//	return "" +
-//		"      --listen <a>            - Address to listen on (default: 127.0.0.1)\n"
-//}
+func listenFlag(cmd *cobra.Command, listen *string) string {
+	if cmd != nil {
+		cmd.Flags().StringVar(listen, "listen", "", "")
+	}
+	return "" +
+		"      --listen <a>            - Address to listen on (default: 127.0.0.1)\n"
+}
 
 func portFlag(cmd *cobra.Command, adminPort *string) string {
 	if cmd != nil {
@@ -505,22 +635,22 @@ func portFlag(cmd *cobra.Command, adminPort *string) string {
 		"  -p, --port <p>              - Port to listen on (default: " + defaultPort + ")\n"
 }
 
-//func certFlag(cmd *cobra.Command, cert *string) string {
-//	if cmd != nil {
-//		cmd.Flags().StringVar(cert, "cert", "", "")
-//	}
-//	return "" +
-//		"      --cert <f>              - File name of server certificate, including the\n" +
-//		"                                CA's certificate and intermediates\n"
-//}
+func certFlag(cmd *cobra.Command, cert *string) string {
+	if cmd != nil {
+		cmd.Flags().StringVar(cert, "cert", "", "")
+	}
+	return "" +
+		"      --cert <f>              - File name of server certificate, including the\n" +
+		"                                CA's certificate and intermediates\n"
+}
 
-//func keyFlag(cmd *cobra.Command, key *string) string {
-//	if cmd != nil {
-//		cmd.Flags().StringVar(key, "key", "", "")
-//	}
-//	return "" +
-//		"      --key <f>               - File name of server private key\n"
-//}
+func keyFlag(cmd *cobra.Command, key *string) string {
+	if cmd != nil {
+		cmd.Flags().StringVar(key, "key", "", "")
+	}
+	return "" +
+		"      --key <f>               - File name of server private key\n"
+}
 
 func logFlag(cmd *cobra.Command, logfile *string) string {
 	if cmd != nil {
@@ -555,14 +685,14 @@ func dirFlag(cmd *cobra.Command, datadir *string) string {
 }
 */
 
-//func noTLSFlag(cmd *cobra.Command, noTLS *bool) string {
-//	if cmd != nil {
-//		cmd.Flags().BoolVar(noTLS, "notls", false, "")
-//	}
-//	return "" +
-//		"      --notls                 - Disable TLS in client connections [insecure,\n" +
-//		"                                use for testing only]\n"
-//}
+func noTLSFlag(cmd *cobra.Command, noTLS *bool) string {
+	if cmd != nil {
+		cmd.Flags().BoolVar(noTLS, "notls", false, "")
+	}
+	return "" +
+		"      --notls                 - Disable TLS in client connections [insecure,\n" +
+		"                                use for testing only]\n"
+}
 
 func memoryLimitFlag(cmd *cobra.Command, memoryLimit *float64) string {
 	if cmd != nil {
@@ -619,14 +749,13 @@ func validateServerOptions(opt *option.Server) error {
 			return fmt.Errorf("server private key not specified")
 		}
 	}
-	// Reject certificate or key with loopback default
-	if opt.Listen == "" {
-		if opt.TLSCert != "" {
-			return fmt.Errorf("server certificate specified, but no listen address")
-		}
-		if opt.TLSKey != "" {
-			return fmt.Errorf("server key specified, but no listen address")
-		}
+	// Require certificate and key to be specified together; with the
+	// loopback default, TLS is optional
+	if opt.TLSCert != "" && opt.TLSKey == "" {
+		return fmt.Errorf("server private key not specified")
+	}
+	if opt.TLSKey != "" && opt.TLSCert == "" {
+		return fmt.Errorf("server certificate not specified")
 	}
 	// Reject certificate or key with TLS disabled
 	if opt.NoTLS {
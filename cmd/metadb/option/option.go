@@ -68,6 +68,31 @@ type EndSync struct {
 	ForceAll bool
 }
 
+type Replay struct {
+	Global
+	Datadir   string
+	Source    string
+	SourceLog string
+	DryRun    bool
+	UUOpt     bool
+}
+
+type Archive struct {
+	Global
+	Datadir string
+	Table   string
+	Year    int
+	Dir     string
+	Drop    bool
+}
+
+type Repartition struct {
+	Global
+	Datadir     string
+	Table       string
+	Granularity string
+}
+
 type Migrate struct {
 	Global
 	Datadir string
@@ -14,6 +14,7 @@ type yySymType struct {
 	str               string
 	tableparamlist    []string
 	funcparamtypelist []string
+	strlist           []string
 	optlist           []ast.Option
 	node              ast.Node
 	pass              bool
@@ -139,150 +140,169 @@ var yyExca = [...]int8{
 
 const yyPrivate = 57344
 
-const yyLast = 257
-
-var yyAct = [...]uint8{
-	115, 180, 140, 167, 112, 179, 113, 187, 127, 221,
-	139, 206, 203, 158, 36, 114, 34, 35, 31, 202,
-	203, 60, 12, 37, 38, 58, 15, 191, 192, 155,
-	243, 184, 32, 33, 152, 60, 147, 151, 241, 58,
-	57, 39, 40, 117, 66, 178, 239, 70, 138, 41,
-	74, 139, 238, 235, 78, 79, 29, 18, 30, 234,
-	228, 226, 242, 209, 85, 204, 87, 200, 189, 186,
-	90, 182, 93, 176, 95, 60, 170, 169, 168, 58,
-	163, 146, 142, 92, 135, 123, 111, 110, 101, 100,
-	116, 96, 84, 82, 237, 122, 236, 141, 143, 67,
-	128, 77, 60, 69, 130, 131, 58, 133, 134, 225,
-	136, 42, 91, 60, 231, 43, 230, 58, 220, 144,
-	145, 205, 157, 148, 137, 132, 94, 86, 68, 165,
-	153, 109, 108, 156, 213, 208, 119, 44, 118, 83,
-	61, 63, 65, 88, 240, 164, 162, 224, 217, 73,
-	201, 150, 128, 64, 154, 177, 181, 129, 183, 181,
-	175, 72, 188, 171, 185, 149, 190, 107, 125, 124,
-	104, 98, 106, 197, 196, 103, 97, 81, 80, 76,
-	75, 89, 54, 160, 193, 194, 195, 105, 53, 48,
-	102, 121, 207, 49, 199, 198, 210, 211, 212, 214,
-	215, 71, 216, 174, 181, 218, 219, 173, 171, 222,
-	52, 45, 46, 56, 223, 55, 62, 172, 227, 47,
-	161, 229, 99, 51, 50, 232, 233, 1, 59, 166,
-	120, 159, 126, 11, 28, 14, 27, 26, 8, 7,
-	10, 9, 20, 19, 17, 13, 6, 25, 24, 4,
-	3, 2, 22, 21, 16, 23, 5,
+const yyLast = 298
+
+var yyAct = [...]int16{
+	130, 210, 160, 195, 127, 209, 128, 129, 147, 260,
+	159, 246, 247, 39, 217, 37, 38, 34, 242, 239,
+	66, 12, 40, 41, 64, 15, 238, 239, 225, 226,
+	214, 35, 36, 176, 66, 55, 175, 182, 64, 158,
+	42, 43, 159, 63, 208, 179, 169, 72, 44, 191,
+	76, 192, 284, 80, 190, 32, 18, 33, 82, 110,
+	87, 88, 81, 282, 280, 279, 276, 275, 109, 269,
+	94, 108, 96, 54, 267, 262, 99, 53, 104, 248,
+	106, 66, 198, 197, 196, 64, 245, 240, 236, 272,
+	233, 232, 224, 219, 216, 212, 125, 206, 193, 131,
+	187, 168, 162, 155, 141, 140, 139, 126, 116, 115,
+	107, 93, 91, 132, 283, 148, 278, 277, 161, 150,
+	151, 163, 153, 154, 83, 156, 101, 73, 66, 223,
+	167, 166, 64, 136, 164, 165, 135, 86, 75, 111,
+	271, 66, 45, 266, 259, 64, 46, 241, 181, 170,
+	177, 189, 157, 180, 152, 100, 102, 103, 105, 95,
+	74, 252, 124, 123, 244, 188, 186, 134, 47, 133,
+	92, 67, 201, 202, 97, 79, 148, 199, 281, 207,
+	211, 265, 213, 211, 205, 174, 218, 78, 215, 256,
+	220, 222, 237, 178, 149, 69, 71, 173, 122, 145,
+	144, 231, 230, 121, 227, 228, 229, 70, 119, 113,
+	112, 90, 89, 118, 85, 84, 51, 98, 120, 60,
+	52, 59, 243, 204, 184, 138, 235, 234, 117, 172,
+	249, 250, 251, 171, 199, 253, 254, 77, 255, 203,
+	211, 257, 258, 48, 49, 261, 143, 142, 263, 58,
+	62, 50, 61, 264, 68, 200, 185, 268, 114, 57,
+	270, 56, 1, 221, 65, 194, 273, 274, 137, 183,
+	146, 31, 30, 29, 11, 28, 14, 27, 26, 8,
+	7, 10, 9, 20, 19, 17, 13, 6, 25, 24,
+	4, 3, 2, 22, 21, 16, 23, 5,
 }
 
 var yyPact = [...]int16{
-	10, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000,
-	-1000, -1000, 94, -1000, -1000, 202, -1000, -1000, 172, -1000,
+	9, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000,
+	-1000, -1000, 125, -1000, -1000, 234, -1000, -1000, 199, -1000,
 	-1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000,
-	-1000, -1000, 216, 215, 193, 167, 161, 200, 198, 58,
-	107, 205, 123, 69, 88, 57, 58, 183, 131, 58,
-	156, 155, 54, 58, 58, 154, 153, 41, -1000, -1000,
-	-1000, 105, 40, 58, 87, 58, 114, -1000, 160, 58,
-	67, 58, 86, 58, 39, 151, 146, 212, 37, 36,
-	165, 162, -1000, 97, -1000, 95, 58, 34, 58, 58,
-	-8, 104, 102, 171, 58, 33, -1000, 143, 142, 58,
-	-1000, -1000, 129, 58, 58, 84, 58, 58, 32, 58,
-	83, -1000, -4, -1000, 47, -1000, 30, 48, 58, 58,
-	29, -17, 82, -1000, 138, 124, -18, -1000, -1000, 58,
-	126, -24, 58, 81, -40, -1000, 163, 210, -1000, 58,
-	-1000, -1000, -1000, 28, 58, 93, -1000, 31, 207, 190,
-	186, 58, -1000, 21, 58, -9, 19, 58, -23, 17,
-	-46, 58, -1000, -1000, 16, 58, -27, -1000, 58, 58,
-	58, 47, 58, 177, 176, -1000, -1000, 15, 122, -35,
-	-1000, -1000, -1000, 13, 80, -43, -1000, 58, 101, -1000,
-	11, -1000, 31, -1000, 47, 47, -1000, 100, 58, 58,
-	-1000, 58, 120, 58, -1000, 58, 77, -45, 58, -1000,
-	-1000, -1000, -1000, 58, 119, 68, 9, 58, -1000, 8,
-	58, -1000, 74, 72, 58, 58, -1000, 7, -1000, 1,
-	46, 44, 0, -6, -1000, -1000, 116, -14, -1000, -1000,
-	12, -1000, -22, -1000,
+	-1000, -1000, -1000, 25, -1000, 253, 251, 232, 200, 198,
+	237, 235, 84, 138, 243, 177, 97, 120, 92, 84,
+	219, 157, 84, -1000, 10, 74, 191, 190, 90, 84,
+	84, 188, 187, 60, -1000, -1000, -1000, 136, 59, 84,
+	119, 84, 145, -1000, 196, 84, 110, 84, 118, 84,
+	58, -1000, 19, 99, 185, 184, 248, 57, 56, 203,
+	193, -1000, 128, -1000, 126, 84, 55, 84, 84, 62,
+	135, 133, 88, 85, 205, 84, 53, -1000, -1000, 52,
+	230, 229, 174, 173, 84, -1000, -1000, 166, 84, 84,
+	113, 84, 84, 51, 84, 111, -1000, -13, -1000, 68,
+	-1000, 50, 71, 84, 84, 83, 82, 49, -7, 108,
+	-1000, -1000, 215, 211, 170, 158, -19, -1000, -1000, 84,
+	165, -8, 84, 107, -16, -1000, 204, 246, -1000, 84,
+	-1000, -1000, -1000, 48, 84, 115, 1, 46, -1000, 37,
+	245, 84, 84, 222, 206, 84, -1000, 45, 84, -10,
+	43, 84, -24, 42, -39, 84, -1000, -1000, 41, 84,
+	84, 81, 40, -1000, -26, -1000, 84, 84, 84, 68,
+	84, 39, 38, 209, 208, -1000, -1000, 36, 164, -28,
+	-1000, -1000, -1000, 35, 106, -36, -1000, 84, 130, -1000,
+	34, -43, -1000, 27, -1000, -1000, 37, -1000, 68, 68,
+	-1000, 127, -1000, -1000, 84, 84, -1000, 84, 161, 84,
+	-1000, 84, 103, -45, 84, -1000, 23, 84, -1000, -1000,
+	-1000, -1000, 84, 153, 102, 22, 84, -1000, 17, 84,
+	-1000, 98, -1000, -1000, 47, 84, 84, -1000, 15, -1000,
+	14, 67, 66, 13, 12, -1000, -1000, 150, 11, -1000,
+	-1000, 64, -1000, 0, -1000,
 }
 
 var yyPgo = [...]int16{
-	0, 256, 255, 254, 253, 252, 251, 250, 249, 248,
-	247, 246, 245, 244, 243, 242, 241, 240, 239, 238,
-	237, 236, 235, 234, 233, 8, 232, 1, 5, 231,
-	230, 4, 229, 6, 3, 15, 2, 0, 228, 227,
+	0, 297, 296, 295, 294, 293, 292, 291, 290, 289,
+	288, 287, 286, 285, 284, 283, 282, 281, 280, 279,
+	278, 277, 276, 275, 274, 273, 272, 271, 8, 270,
+	1, 5, 269, 268, 4, 265, 6, 3, 7, 2,
+	0, 264, 263, 262,
 }
 
 var yyR1 = [...]int8{
-	0, 39, 6, 7, 7, 7, 7, 7, 7, 7,
+	0, 43, 6, 7, 7, 7, 7, 7, 7, 7,
 	7, 7, 7, 7, 7, 7, 7, 7, 7, 7,
 	7, 7, 7, 7, 7, 7, 7, 7, 7, 7,
-	8, 1, 11, 18, 19, 16, 16, 3, 9, 9,
-	9, 9, 26, 26, 25, 28, 28, 27, 10, 10,
-	10, 10, 4, 2, 5, 17, 24, 22, 22, 12,
-	13, 29, 30, 31, 31, 32, 32, 33, 34, 34,
-	34, 34, 35, 36, 14, 15, 20, 21, 23, 37,
-	37, 38,
+	7, 7, 7, 8, 1, 11, 18, 19, 16, 16,
+	3, 9, 9, 9, 9, 29, 29, 28, 31, 31,
+	30, 10, 10, 10, 10, 4, 2, 5, 17, 24,
+	22, 22, 22, 22, 22, 22, 42, 42, 12, 13,
+	32, 33, 34, 34, 35, 35, 36, 37, 37, 37,
+	37, 38, 39, 14, 15, 20, 21, 23, 25, 25,
+	26, 26, 26, 27, 40, 40, 41,
 }
 
 var yyR2 = [...]int8{
 	0, 1, 1, 1, 1, 1, 1, 1, 1, 1,
 	1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
 	1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
-	1, 7, 8, 15, 5, 6, 3, 13, 7, 8,
-	10, 11, 1, 3, 1, 1, 3, 1, 7, 8,
-	10, 11, 6, 4, 4, 4, 6, 8, 9, 6,
-	5, 4, 4, 1, 3, 1, 3, 2, 2, 3,
-	3, 2, 1, 1, 12, 12, 3, 5, 3, 1,
-	1, 1,
+	1, 1, 1, 1, 7, 8, 15, 5, 6, 3,
+	13, 7, 8, 10, 11, 1, 3, 1, 1, 3,
+	1, 7, 8, 10, 11, 6, 4, 4, 4, 6,
+	8, 9, 10, 9, 8, 7, 1, 3, 6, 5,
+	4, 4, 1, 3, 1, 3, 2, 2, 3, 3,
+	2, 1, 1, 12, 12, 3, 5, 3, 2, 3,
+	4, 5, 8, 8, 1, 1, 1,
 }
 
 var yyChk = [...]int16{
-	-1000, -39, -6, -7, -8, -1, -11, -18, -19, -16,
+	-1000, -43, -6, -7, -8, -1, -11, -18, -19, -16,
 	-17, -24, 12, -12, -22, 16, -3, -13, 47, -14,
-	-15, -4, -5, -2, -9, -10, -20, -21, -23, 46,
-	48, 8, 22, 23, 6, 7, 4, 13, 14, 31,
-	32, 39, 17, 21, 43, 9, 10, 17, 17, 21,
-	8, 8, 17, 21, 21, 15, 15, -37, 48, -38,
-	44, 33, 11, 18, 30, 19, -37, 30, 40, 46,
-	-37, 18, 30, 18, -37, 24, 24, 47, -37, -37,
-	24, 24, 52, 34, 52, -37, 40, -37, 29, 21,
-	-37, 45, 16, -37, 40, -37, 52, 25, 25, 10,
-	52, 52, 25, 10, 5, 25, 10, 5, 35, 36,
-	-37, 52, -31, -33, -35, -37, -37, 51, 34, 34,
-	-30, 20, -37, 52, 26, 26, -26, -25, -37, 28,
-	-37, -37, 41, -37, -37, 52, -37, 41, 52, 55,
-	-36, 50, 52, 50, -37, -37, 52, 53, 41, 27,
-	27, 55, 52, -37, 28, 53, -37, 41, 53, -29,
-	20, 10, -33, 52, -37, 36, -32, -34, 47, 46,
-	45, -35, 10, 17, 17, -25, 52, -37, 54, -28,
-	-27, -37, 52, -37, 54, -28, 52, 53, -37, 52,
-	-37, 54, 55, -35, -35, -35, -36, -37, 18, 18,
-	52, 28, 54, 55, 52, 41, 54, -31, 34, 52,
-	-34, -36, -36, 34, -37, -37, -37, 28, -27, -37,
-	41, 54, -37, -37, 28, 41, 52, -37, 52, -37,
-	42, 42, -37, -37, 52, 52, 50, 50, 52, 52,
-	28, 52, 50, 52,
+	-15, -4, -5, -2, -9, -10, -20, -21, -23, -25,
+	-26, -27, 46, 48, 8, 22, 23, 6, 7, 4,
+	13, 14, 31, 32, 39, 17, 21, 43, 9, 10,
+	17, 17, 21, 52, 48, 10, 8, 8, 17, 21,
+	21, 15, 15, -40, 48, -41, 44, 33, 11, 18,
+	30, 19, -40, 30, 40, 46, -40, 18, 30, 18,
+	-40, 52, 48, 50, 24, 24, 47, -40, -40, 24,
+	24, 52, 34, 52, -40, 40, -40, 29, 21, -40,
+	45, 16, 46, 47, -40, 40, -40, 52, 52, 49,
+	40, 40, 25, 25, 10, 52, 52, 25, 10, 5,
+	25, 10, 5, 35, 36, -40, 52, -34, -36, -38,
+	-40, -40, 51, 34, 34, 48, 48, -33, 20, -40,
+	52, 52, 17, 17, 26, 26, -29, -28, -40, 28,
+	-40, -40, 41, -40, -40, 52, -40, 41, 52, 55,
+	-39, 50, 52, 50, -40, -40, 48, 48, 52, 53,
+	41, 18, 18, 27, 27, 55, 52, -40, 28, 53,
+	-40, 41, 53, -32, 20, 10, -36, 52, -40, 36,
+	53, 48, 50, 52, -35, -37, 47, 46, 45, -38,
+	10, -40, -40, 17, 17, -28, 52, -40, 54, -31,
+	-30, -40, 52, -40, 54, -31, 52, 53, -40, 52,
+	-40, -42, -40, 48, 52, 54, 55, -38, -38, -38,
+	-39, -40, 52, 52, 18, 18, 52, 28, 54, 55,
+	52, 41, 54, -34, 34, 52, 54, 55, 52, -37,
+	-39, -39, 34, -40, -40, -40, 28, -30, -40, 41,
+	54, -40, 52, -40, -40, 28, 41, 52, -40, 52,
+	-40, 42, 42, -40, -40, 52, 52, 50, 50, 52,
+	52, 28, 52, 50, 52,
 }
 
 var yyDef = [...]int8{
 	0, -2, 1, 2, 3, 4, 5, 6, 7, 8,
 	9, 10, 11, 12, 13, 14, 15, 16, 17, 18,
 	19, 20, 21, 22, 23, 24, 25, 26, 27, 28,
-	29, 30, 0, 0, 0, 0, 0, 0, 0, 0,
+	29, 30, 31, 32, 33, 0, 0, 0, 0, 0,
 	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
-	0, 0, 0, 0, 0, 0, 0, 0, 79, 80,
-	81, 0, 0, 0, 0, 0, 0, 36, 0, 0,
-	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
-	0, 0, 76, 0, 78, 0, 0, 0, 0, 0,
+	0, 0, 0, 88, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 94, 95, 96, 0, 0, 0,
+	0, 0, 0, 39, 0, 0, 0, 0, 0, 0,
+	0, 89, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 85, 0, 87, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 58, 90, 0,
+	0, 0, 0, 0, 0, 57, 56, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 37, 0, 72, 0,
+	81, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	69, 91, 0, 0, 0, 0, 0, 45, 47, 0,
+	0, 0, 0, 0, 0, 86, 0, 0, 38, 0,
+	76, 82, 59, 0, 0, 0, 0, 0, 68, 0,
 	0, 0, 0, 0, 0, 0, 55, 0, 0, 0,
-	54, 53, 0, 0, 0, 0, 0, 0, 0, 0,
-	0, 34, 0, 63, 0, 72, 0, 0, 0, 0,
-	0, 0, 0, 60, 0, 0, 0, 42, 44, 0,
-	0, 0, 0, 0, 0, 77, 0, 0, 35, 0,
-	67, 73, 56, 0, 0, 0, 59, 0, 0, 0,
-	0, 0, 52, 0, 0, 0, 0, 0, 0, 0,
-	0, 0, 64, 31, 0, 0, 0, 65, 0, 0,
-	0, 0, 0, 0, 0, 43, 38, 0, 0, 0,
-	45, 47, 48, 0, 0, 0, 32, 0, 0, 57,
-	0, 62, 0, 68, 0, 0, 71, 0, 0, 0,
-	39, 0, 0, 0, 49, 0, 0, 0, 0, 58,
-	66, 69, 70, 0, 0, 0, 0, 0, 46, 0,
-	0, 61, 0, 0, 0, 0, 40, 0, 50, 0,
-	0, 0, 0, 0, 41, 51, 0, 0, 74, 75,
-	0, 37, 0, 33,
+	0, 0, 0, 0, 0, 0, 73, 34, 0, 0,
+	0, 0, 0, 65, 0, 74, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 46, 41, 0, 0, 0,
+	48, 50, 51, 0, 0, 0, 35, 0, 0, 60,
+	0, 0, 66, 0, 64, 71, 0, 77, 0, 0,
+	80, 0, 92, 93, 0, 0, 42, 0, 0, 0,
+	52, 0, 0, 0, 0, 61, 0, 0, 63, 75,
+	78, 79, 0, 0, 0, 0, 0, 49, 0, 0,
+	70, 0, 62, 67, 0, 0, 0, 43, 0, 53,
+	0, 0, 0, 0, 0, 44, 54, 0, 0, 83,
+	84, 0, 40, 0, 36,
 }
 
 var yyTok1 = [...]int8{
@@ -781,269 +801,344 @@ yydefault:
 			yyVAL.node = yyDollar[1].node
 		}
 	case 28:
+		yyDollar = yyS[yypt-1 : yypt+1]
+		{
+			yyVAL.node = yyDollar[1].node
+		}
+	case 29:
+		yyDollar = yyS[yypt-1 : yypt+1]
+		{
+			yyVAL.node = yyDollar[1].node
+		}
+	case 30:
+		yyDollar = yyS[yypt-1 : yypt+1]
+		{
+			yyVAL.node = yyDollar[1].node
+		}
+	case 31:
 		yyDollar = yyS[yypt-1 : yypt+1]
 		{
 			yylex.(*lexer).pass = true
 			// $$ = nil
 		}
-	case 29:
+	case 32:
 		yyDollar = yyS[yypt-1 : yypt+1]
 		{
 			yylex.(*lexer).pass = true
 			// $$ = nil
 		}
-	case 30:
+	case 33:
 		yyDollar = yyS[yypt-1 : yypt+1]
 		{
 			yylex.(*lexer).pass = true
 			yyVAL.node = &ast.SelectStmt{}
 		}
-	case 31:
+	case 34:
 		yyDollar = yyS[yypt-7 : yypt+1]
 		{
 			yyVAL.node = &ast.AlterSystemStmt{ConfigParameter: yyDollar[4].str, Value: yyDollar[6].str}
 		}
-	case 32:
+	case 35:
 		yyDollar = yyS[yypt-8 : yypt+1]
 		{
 			yyVAL.node = &ast.CreateDataSourceStmt{DataSourceName: yyDollar[4].str, TypeName: yyDollar[6].str, Options: yyDollar[7].optlist}
 		}
-	case 33:
+	case 36:
 		yyDollar = yyS[yypt-15 : yypt+1]
 		{
 			yyVAL.node = &ast.CreateDataMappingStmt{TypeName: yyDollar[5].str, TableName: yyDollar[8].str, ColumnName: yyDollar[10].str, Path: yyDollar[12].str, TargetIdentifier: yyDollar[14].str}
 		}
-	case 34:
+	case 37:
 		yyDollar = yyS[yypt-5 : yypt+1]
 		{
 			yyVAL.node = &ast.CreateDataOriginStmt{OriginName: yyDollar[4].str}
 		}
-	case 35:
+	case 38:
 		yyDollar = yyS[yypt-6 : yypt+1]
 		{
 			yyVAL.node = &ast.CreateUserStmt{UserName: yyDollar[3].str, Options: yyDollar[5].optlist}
 		}
-	case 36:
+	case 39:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
 			yylex.(*lexer).pass = true
 		}
-	case 37:
+	case 40:
 		yyDollar = yyS[yypt-13 : yypt+1]
 		{
 			yyVAL.node = &ast.DropDataMappingStmt{TypeName: yyDollar[5].str, TableName: yyDollar[8].str, ColumnName: yyDollar[10].str, Path: yyDollar[12].str}
 		}
-	case 38:
+	case 41:
 		yyDollar = yyS[yypt-7 : yypt+1]
 		{
 			yyVAL.node = &ast.GrantAccessOnAllStmt{UserName: yyDollar[6].str}
 		}
-	case 39:
+	case 42:
 		yyDollar = yyS[yypt-8 : yypt+1]
 		{
 			yyVAL.node = &ast.GrantAccessOnTableStmt{TableName: yyDollar[5].str, UserName: yyDollar[7].str}
 		}
-	case 40:
+	case 43:
 		yyDollar = yyS[yypt-10 : yypt+1]
 		{
 			yyVAL.node = &ast.GrantAccessOnFunctionStmt{FunctionName: yyDollar[5].str, UserName: yyDollar[9].str}
 		}
-	case 41:
+	case 44:
 		yyDollar = yyS[yypt-11 : yypt+1]
 		{
 			yyVAL.node = &ast.GrantAccessOnFunctionStmt{FunctionName: yyDollar[5].str, FunctionParameterTypes: yyDollar[7].funcparamtypelist, UserName: yyDollar[10].str}
 		}
-	case 42:
+	case 45:
 		yyDollar = yyS[yypt-1 : yypt+1]
 		{
 			yyVAL.tableparamlist = yyDollar[1].tableparamlist
 		}
-	case 43:
+	case 46:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
 			yyVAL.tableparamlist = append(yyDollar[1].tableparamlist, yyDollar[3].tableparamlist...)
 		}
-	case 44:
+	case 47:
 		yyDollar = yyS[yypt-1 : yypt+1]
 		{
 			yyVAL.tableparamlist = []string{yyDollar[1].str}
 		}
-	case 45:
+	case 48:
 		yyDollar = yyS[yypt-1 : yypt+1]
 		{
 			yyVAL.funcparamtypelist = yyDollar[1].funcparamtypelist
 		}
-	case 46:
+	case 49:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
 			yyVAL.funcparamtypelist = append(yyDollar[1].funcparamtypelist, yyDollar[3].funcparamtypelist...)
 		}
-	case 47:
+	case 50:
 		yyDollar = yyS[yypt-1 : yypt+1]
 		{
 			yyVAL.funcparamtypelist = []string{yyDollar[1].str}
 		}
-	case 48:
+	case 51:
 		yyDollar = yyS[yypt-7 : yypt+1]
 		{
 			yyVAL.node = &ast.RevokeAccessOnAllStmt{UserName: yyDollar[6].str}
 		}
-	case 49:
+	case 52:
 		yyDollar = yyS[yypt-8 : yypt+1]
 		{
 			yyVAL.node = &ast.RevokeAccessOnTableStmt{TableName: yyDollar[5].str, UserName: yyDollar[7].str}
 		}
-	case 50:
+	case 53:
 		yyDollar = yyS[yypt-10 : yypt+1]
 		{
 			yyVAL.node = &ast.RevokeAccessOnFunctionStmt{FunctionName: yyDollar[5].str, UserName: yyDollar[9].str}
 		}
-	case 51:
+	case 54:
 		yyDollar = yyS[yypt-11 : yypt+1]
 		{
 			yyVAL.node = &ast.RevokeAccessOnFunctionStmt{FunctionName: yyDollar[5].str, FunctionParameterTypes: yyDollar[7].funcparamtypelist, UserName: yyDollar[10].str}
 		}
-	case 52:
+	case 55:
 		yyDollar = yyS[yypt-6 : yypt+1]
 		{
 			yyVAL.node = &ast.PurgeDataDropTableStmt{TableNames: yyDollar[5].tableparamlist}
 		}
-	case 53:
+	case 56:
 		yyDollar = yyS[yypt-4 : yypt+1]
 		{
 			yyVAL.node = &ast.DeregisterUserStmt{UserName: yyDollar[3].str}
 		}
-	case 54:
+	case 57:
 		yyDollar = yyS[yypt-4 : yypt+1]
 		{
 			yyVAL.node = &ast.RegisterUserStmt{UserName: yyDollar[3].str}
 		}
-	case 55:
+	case 58:
 		yyDollar = yyS[yypt-4 : yypt+1]
 		{
 			yyVAL.node = &ast.DropUserStmt{UserName: yyDollar[3].str}
 		}
-	case 56:
+	case 59:
 		yyDollar = yyS[yypt-6 : yypt+1]
 		{
 			yyVAL.node = &ast.CreateSchemaForUserStmt{UserName: yyDollar[5].str}
 		}
-	case 57:
+	case 60:
 		yyDollar = yyS[yypt-8 : yypt+1]
 		{
 			yyVAL.node = &ast.AlterTableAddColumnStmt{TableName: yyDollar[3].str, ColumnName: yyDollar[6].str, ColumnType: yyDollar[7].str}
 		}
-	case 58:
+	case 61:
 		yyDollar = yyS[yypt-9 : yypt+1]
 		{
 			yyVAL.node = &ast.AlterTableAlterColumnStmt{TableName: yyDollar[3].str, ColumnName: yyDollar[6].str, ColumnType: yyDollar[8].str}
 		}
-	case 59:
+	case 62:
+		yyDollar = yyS[yypt-10 : yypt+1]
+		{
+			yyVAL.node = setPrimaryKeyStmt(yylex.(*lexer), yyDollar[3].str, yyDollar[5].str, yyDollar[6].str, yyDollar[8].strlist, "", "")
+		}
+	case 63:
+		yyDollar = yyS[yypt-9 : yypt+1]
+		{
+			yyVAL.node = setPrimaryKeyStmt(yylex.(*lexer), yyDollar[3].str, yyDollar[5].str, yyDollar[6].str, nil, yyDollar[7].str, yyDollar[8].str)
+		}
+	case 64:
+		yyDollar = yyS[yypt-8 : yypt+1]
+		{
+			yyVAL.node = setHistoryRetentionStmt(yylex.(*lexer), yyDollar[3].str, yyDollar[5].str, yyDollar[6].str, yyDollar[7].str)
+		}
+	case 65:
+		yyDollar = yyS[yypt-7 : yypt+1]
+		{
+			yyVAL.node = alterTableDropStmt(yylex.(*lexer), yyDollar[3].str, yyDollar[5].str, yyDollar[6].str)
+		}
+	case 66:
+		yyDollar = yyS[yypt-1 : yypt+1]
+		{
+			yyVAL.strlist = []string{yyDollar[1].str}
+		}
+	case 67:
+		yyDollar = yyS[yypt-3 : yypt+1]
+		{
+			yyVAL.strlist = append(yyDollar[1].strlist, yyDollar[3].str)
+		}
+	case 68:
 		yyDollar = yyS[yypt-6 : yypt+1]
 		{
 			yyVAL.node = &ast.AlterDataSourceStmt{DataSourceName: yyDollar[4].str, Options: yyDollar[5].optlist}
 		}
-	case 60:
+	case 69:
 		yyDollar = yyS[yypt-5 : yypt+1]
 		{
 			yyVAL.node = &ast.DropDataSourceStmt{DataSourceName: yyDollar[4].str}
 		}
-	case 61:
+	case 70:
 		yyDollar = yyS[yypt-4 : yypt+1]
 		{
 			yyVAL.optlist = yyDollar[3].optlist
 		}
-	case 62:
+	case 71:
 		yyDollar = yyS[yypt-4 : yypt+1]
 		{
 			yyVAL.optlist = yyDollar[3].optlist
 		}
-	case 63:
+	case 72:
 		yyDollar = yyS[yypt-1 : yypt+1]
 		{
 			yyVAL.optlist = yyDollar[1].optlist
 		}
-	case 64:
+	case 73:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
 			yyVAL.optlist = append(yyDollar[1].optlist, yyDollar[3].optlist...)
 		}
-	case 65:
+	case 74:
 		yyDollar = yyS[yypt-1 : yypt+1]
 		{
 			yyVAL.optlist = yyDollar[1].optlist
 		}
-	case 66:
+	case 75:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
 			yyVAL.optlist = append(yyDollar[1].optlist, yyDollar[3].optlist...)
 		}
-	case 67:
+	case 76:
 		yyDollar = yyS[yypt-2 : yypt+1]
 		{
 			yyVAL.optlist = []ast.Option{ast.Option{Name: yyDollar[1].str, Val: yyDollar[2].str}}
 		}
-	case 68:
+	case 77:
 		yyDollar = yyS[yypt-2 : yypt+1]
 		{
 			yyVAL.optlist = []ast.Option{ast.Option{Action: "DROP", Name: yyDollar[2].str, Val: ""}}
 		}
-	case 69:
+	case 78:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
 			yyVAL.optlist = []ast.Option{ast.Option{Action: "SET", Name: yyDollar[2].str, Val: yyDollar[3].str}}
 		}
-	case 70:
+	case 79:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
 			yyVAL.optlist = []ast.Option{ast.Option{Action: "ADD", Name: yyDollar[2].str, Val: yyDollar[3].str}}
 		}
-	case 71:
+	case 80:
 		yyDollar = yyS[yypt-2 : yypt+1]
 		{
 			yyVAL.optlist = []ast.Option{ast.Option{Action: "ADD", Name: yyDollar[1].str, Val: yyDollar[2].str}}
 		}
-	case 72:
+	case 81:
 		yyDollar = yyS[yypt-1 : yypt+1]
 		{
 			yyVAL.str = yyDollar[1].str
 		}
-	case 73:
+	case 82:
 		yyDollar = yyS[yypt-1 : yypt+1]
 		{
 			yyVAL.str = yyDollar[1].str
 		}
-	case 74:
+	case 83:
 		yyDollar = yyS[yypt-12 : yypt+1]
 		{
 			yyVAL.node = &ast.AuthorizeStmt{DataSourceName: yyDollar[9].str, RoleName: yyDollar[11].str}
 		}
-	case 75:
+	case 84:
 		yyDollar = yyS[yypt-12 : yypt+1]
 		{
 			yyVAL.node = &ast.DeauthorizeStmt{DataSourceName: yyDollar[9].str, RoleName: yyDollar[11].str}
 		}
-	case 76:
+	case 85:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
 			yyVAL.node = &ast.ListStmt{Name: yyDollar[2].str}
 		}
-	case 77:
+	case 86:
 		yyDollar = yyS[yypt-5 : yypt+1]
 		{
 			yyVAL.node = &ast.RefreshInferredColumnTypesStmt{}
 		}
-	case 78:
+	case 87:
 		yyDollar = yyS[yypt-3 : yypt+1]
 		{
 			yyVAL.node = &ast.VerifyConsistencyStmt{}
 		}
-	case 79:
+	case 88:
+		yyDollar = yyS[yypt-2 : yypt+1]
+		{
+			yyVAL.node = transactionStmt(yylex.(*lexer), yyDollar[1].str, "")
+		}
+	case 89:
+		yyDollar = yyS[yypt-3 : yypt+1]
+		{
+			yyVAL.node = transactionStmt(yylex.(*lexer), yyDollar[1].str, yyDollar[2].str)
+		}
+	case 90:
+		yyDollar = yyS[yypt-4 : yypt+1]
+		{
+			yyVAL.node = deadLetterStmt(yylex.(*lexer), yyDollar[1].str, yyDollar[2].str, yyDollar[3].str, "", "")
+		}
+	case 91:
+		yyDollar = yyS[yypt-5 : yypt+1]
+		{
+			yyVAL.node = deadLetterStmt(yylex.(*lexer), yyDollar[1].str, yyDollar[2].str, yyDollar[3].str, yyDollar[4].str, "")
+		}
+	case 92:
+		yyDollar = yyS[yypt-8 : yypt+1]
+		{
+			yyVAL.node = deadLetterStmt(yylex.(*lexer), yyDollar[1].str, yyDollar[2].str, yyDollar[3].str, "", yyDollar[7].str)
+		}
+	case 93:
+		yyDollar = yyS[yypt-8 : yypt+1]
+		{
+			yyVAL.node = previewTableStmt(yylex.(*lexer), yyDollar[1].str, yyDollar[3].str, yyDollar[7].str)
+		}
+	case 94:
 		yyDollar = yyS[yypt-1 : yypt+1]
 		{
 			yyVAL.str = strings.ToLower(yyDollar[1].str)
 		}
-	case 80:
+	case 95:
 		yyDollar = yyS[yypt-1 : yypt+1]
 		{
 			yyVAL.str = yyDollar[1].str
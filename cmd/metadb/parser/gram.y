@@ -13,6 +13,7 @@ import (
 	str string
 	tableparamlist []string
 	funcparamtypelist []string
+	strlist []string
 	optlist []ast.Option
 	node ast.Node
 	pass bool
@@ -33,6 +34,9 @@ import (
 %type <node> alter_table_stmt
 %type <node> verify_consistency_stmt
 %type <node> create_schema_for_user_stmt
+%type <node> transaction_stmt
+%type <node> dead_letter_stmt
+%type <node> preview_table_stmt
 %type <tableparamlist> table_parameter
 %type <tableparamlist> table_parameter_list
 %type <funcparamtypelist> parameter_type
@@ -40,6 +44,7 @@ import (
 %type <optlist> options_clause alter_options_clause option_list alter_option_list option alter_option
 %type <str> option_name option_val
 %type <str> name unreserved_keyword
+%type <strlist> name_list
 /*
 %type <str> boolean
 */
@@ -184,6 +189,18 @@ stmt:
 		{
 			$$ = $1
 		}
+	| transaction_stmt
+		{
+			$$ = $1
+		}
+	| dead_letter_stmt
+		{
+			$$ = $1
+		}
+	| preview_table_stmt
+		{
+			$$ = $1
+		}
 	| SET
 		{
 			yylex.(*lexer).pass = true
@@ -349,6 +366,32 @@ alter_table_stmt:
 		{
 			$$ = &ast.AlterTableAlterColumnStmt{TableName: $3, ColumnName: $6, ColumnType: $8}
 		}
+	| ALTER TABLE name SET IDENT IDENT '(' name_list ')' ';'
+		{
+			$$ = setPrimaryKeyStmt(yylex.(*lexer), $3, $5, $6, $8, "", "")
+		}
+	| ALTER TABLE name SET IDENT IDENT IDENT IDENT ';'
+		{
+			$$ = setPrimaryKeyStmt(yylex.(*lexer), $3, $5, $6, nil, $7, $8)
+		}
+	| ALTER TABLE name SET IDENT IDENT SLITERAL ';'
+		{
+			$$ = setHistoryRetentionStmt(yylex.(*lexer), $3, $5, $6, $7)
+		}
+	| ALTER TABLE name DROP IDENT IDENT ';'
+		{
+			$$ = alterTableDropStmt(yylex.(*lexer), $3, $5, $6)
+		}
+
+name_list:
+	name
+		{
+			$$ = []string{$1}
+		}
+	| name_list ',' name
+		{
+			$$ = append($1, $3)
+		}
 
 alter_data_source_stmt:
 	ALTER DATA SOURCE name alter_options_clause ';'
@@ -460,6 +503,36 @@ verify_consistency_stmt:
 			$$ = &ast.VerifyConsistencyStmt{}
 		}
 
+transaction_stmt:
+	IDENT ';'
+		{
+			$$ = transactionStmt(yylex.(*lexer), $1, "")
+		}
+	| IDENT IDENT ';'
+		{
+			$$ = transactionStmt(yylex.(*lexer), $1, $2)
+		}
+
+dead_letter_stmt:
+	IDENT IDENT IDENT ';'
+		{
+			$$ = deadLetterStmt(yylex.(*lexer), $1, $2, $3, "", "")
+		}
+	| IDENT IDENT IDENT NUMBER ';'
+		{
+			$$ = deadLetterStmt(yylex.(*lexer), $1, $2, $3, $4, "")
+		}
+	| IDENT IDENT IDENT FOR DATA SOURCE name ';'
+		{
+			$$ = deadLetterStmt(yylex.(*lexer), $1, $2, $3, "", $7)
+		}
+
+preview_table_stmt:
+	IDENT TABLE SLITERAL FOR DATA SOURCE name ';'
+		{
+			$$ = previewTableStmt(yylex.(*lexer), $1, $3, $7)
+		}
+
 name:
 	IDENT
 		{
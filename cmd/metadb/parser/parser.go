@@ -3,6 +3,7 @@ package parser
 import (
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/metadb-project/metadb/cmd/metadb/ast"
@@ -82,3 +83,102 @@ func Parse(input string) (ast.Node, error, bool) {
 	}
 	return l.node, msg, l.pass
 }
+
+// transactionStmt returns the node for a transaction control statement
+// consisting of a keyword and an optional TRANSACTION or WORK.  Other
+// statements of this form are passed through.
+func transactionStmt(l *lexer, keyword, noise string) ast.Node {
+	keyword = strings.ToLower(keyword)
+	noise = strings.ToLower(noise)
+	switch {
+	case keyword == "start" && noise == "transaction":
+		return &ast.BeginStmt{}
+	case noise != "" && noise != "transaction" && noise != "work":
+	case keyword == "begin":
+		return &ast.BeginStmt{}
+	case keyword == "commit" || keyword == "end":
+		return &ast.CommitStmt{}
+	case keyword == "rollback" || keyword == "abort":
+		return &ast.RollbackStmt{}
+	}
+	l.pass = true
+	return nil
+}
+
+// deadLetterStmt returns a statement that retries or discards dead letters,
+// for the forms "retry dead letters", "retry dead letter <id>", and "retry
+// dead letters for data source <name>", or similarly with "discard".  Other
+// statements are passed through.
+func previewTableStmt(l *lexer, preview, table, source string) ast.Node {
+	if strings.ToLower(preview) != "preview" {
+		l.pass = true
+		return nil
+	}
+	return &ast.PreviewTableStmt{TableName: table, DataSourceName: source}
+}
+
+// setPrimaryKeyStmt returns a statement that sets a primary key override,
+// for the forms "set primary key (<columns>)" and "set primary key row
+// hash".  Other forms are passed through.
+func setPrimaryKeyStmt(l *lexer, table, primary, key string, columns []string, row, hash string) ast.Node {
+	if strings.ToLower(primary) != "primary" || strings.ToLower(key) != "key" {
+		l.pass = true
+		return nil
+	}
+	if columns != nil {
+		return &ast.AlterTableSetPrimaryKeyStmt{TableName: table, Columns: columns}
+	}
+	if strings.ToLower(row) != "row" || strings.ToLower(hash) != "hash" {
+		l.pass = true
+		return nil
+	}
+	return &ast.AlterTableSetPrimaryKeyStmt{TableName: table, RowHash: true}
+}
+
+// setHistoryRetentionStmt returns a statement that sets a history retention
+// policy, for the form "set history retention '<retention>'".  Other forms
+// are passed through.
+func setHistoryRetentionStmt(l *lexer, table, history, retention, value string) ast.Node {
+	if strings.ToLower(history) != "history" || strings.ToLower(retention) != "retention" {
+		l.pass = true
+		return nil
+	}
+	return &ast.AlterTableSetHistoryRetentionStmt{TableName: table, Retention: value}
+}
+
+// alterTableDropStmt returns a statement that removes a primary key override
+// or history retention policy, for the forms "drop primary key" and "drop
+// history retention".  Other forms are passed through.
+func alterTableDropStmt(l *lexer, table, word1, word2 string) ast.Node {
+	switch strings.ToLower(word1) + " " + strings.ToLower(word2) {
+	case "primary key":
+		return &ast.AlterTableDropPrimaryKeyStmt{TableName: table}
+	case "history retention":
+		return &ast.AlterTableDropHistoryRetentionStmt{TableName: table}
+	default:
+		l.pass = true
+		return nil
+	}
+}
+
+func deadLetterStmt(l *lexer, action, dead, letter, id, source string) ast.Node {
+	action = strings.ToLower(action)
+	letter = strings.ToLower(letter)
+	if (action != "retry" && action != "discard") || strings.ToLower(dead) != "dead" {
+		l.pass = true
+		return nil
+	}
+	if id != "" {
+		n, err := strconv.ParseInt(id, 10, 64)
+		if letter != "letter" || err != nil || n <= 0 {
+			l.pass = true
+			return nil
+		}
+		return &ast.DeadLetterStmt{Action: action, ID: n}
+	}
+	if letter != "letters" {
+		l.pass = true
+		return nil
+	}
+	return &ast.DeadLetterStmt{Action: action, DataSourceName: source}
+}
@@ -0,0 +1,119 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/metadb-project/metadb/cmd/metadb/ast"
+)
+
+func TestParseTransactionStmt(t *testing.T) {
+	tests := []struct {
+		query string
+		want  ast.Node
+	}{
+		{"begin;", &ast.BeginStmt{}},
+		{"BEGIN TRANSACTION;", &ast.BeginStmt{}},
+		{"start transaction;", &ast.BeginStmt{}},
+		{"commit work;", &ast.CommitStmt{}},
+		{"end;", &ast.CommitStmt{}},
+		{"rollback;", &ast.RollbackStmt{}},
+		{"abort transaction;", &ast.RollbackStmt{}},
+	}
+	for _, tt := range tests {
+		node, err, pass := Parse(tt.query)
+		if err != nil || pass {
+			t.Errorf("Parse(%q): err=%v pass=%v", tt.query, err, pass)
+			continue
+		}
+		if got, want := nodeType(node), nodeType(tt.want); got != want {
+			t.Errorf("Parse(%q) = %s; want %s", tt.query, got, want)
+		}
+	}
+	for _, q := range []string{"vacuum;", "start foo;", "select 1;"} {
+		if _, _, pass := Parse(q); !pass {
+			t.Errorf("Parse(%q): expected pass", q)
+		}
+	}
+}
+
+func nodeType(node ast.Node) string {
+	switch node.(type) {
+	case *ast.BeginStmt:
+		return "BEGIN"
+	case *ast.CommitStmt:
+		return "COMMIT"
+	case *ast.RollbackStmt:
+		return "ROLLBACK"
+	default:
+		return "other"
+	}
+}
+
+func TestParseDeadLetterStmt(t *testing.T) {
+	tests := []struct {
+		query string
+		want  ast.DeadLetterStmt
+	}{
+		{"retry dead letters;", ast.DeadLetterStmt{Action: "retry"}},
+		{"RETRY DEAD LETTER 42;", ast.DeadLetterStmt{Action: "retry", ID: 42}},
+		{"discard dead letters for data source sensor;", ast.DeadLetterStmt{Action: "discard", DataSourceName: "sensor"}},
+	}
+	for _, tt := range tests {
+		node, err, pass := Parse(tt.query)
+		if err != nil || pass {
+			t.Errorf("Parse(%q): err=%v pass=%v", tt.query, err, pass)
+			continue
+		}
+		got, ok := node.(*ast.DeadLetterStmt)
+		if !ok || *got != tt.want {
+			t.Errorf("Parse(%q) = %#v; want %#v", tt.query, node, tt.want)
+		}
+	}
+	for _, q := range []string{"retry dead letter;", "discard dead letters 1;", "vacuum full verbose;"} {
+		if _, _, pass := Parse(q); !pass {
+			t.Errorf("Parse(%q): expected pass", q)
+		}
+	}
+}
+
+func TestParsePreviewTableStmt(t *testing.T) {
+	node, err, pass := Parse("preview table 'mod_users.users' for data source folio;")
+	if err != nil || pass {
+		t.Fatalf("err=%v pass=%v", err, pass)
+	}
+	want := ast.PreviewTableStmt{TableName: "mod_users.users", DataSourceName: "folio"}
+	if got, ok := node.(*ast.PreviewTableStmt); !ok || *got != want {
+		t.Errorf("got %#v; want %#v", node, want)
+	}
+}
+
+func TestParseAlterTableStmt(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want ast.Node
+	}{
+		{"alter table library.loan__ set primary key (item_id, loan_date);",
+			&ast.AlterTableSetPrimaryKeyStmt{TableName: "library.loan__", Columns: []string{"item_id", "loan_date"}}},
+		{"ALTER TABLE library.loan__ SET PRIMARY KEY ROW HASH;",
+			&ast.AlterTableSetPrimaryKeyStmt{TableName: "library.loan__", RowHash: true}},
+		{"alter table library.loan__ drop primary key;",
+			&ast.AlterTableDropPrimaryKeyStmt{TableName: "library.loan__"}},
+		{"alter table library.loan__ set history retention '5';",
+			&ast.AlterTableSetHistoryRetentionStmt{TableName: "library.loan__", Retention: "5"}},
+		{"ALTER TABLE library.loan__ DROP HISTORY RETENTION;",
+			&ast.AlterTableDropHistoryRetentionStmt{TableName: "library.loan__"}},
+	}
+	for _, tt := range tests {
+		node, err, pass := Parse(tt.sql)
+		if err != nil || pass {
+			t.Fatalf("%s: err=%v pass=%v", tt.sql, err, pass)
+		}
+		if !reflect.DeepEqual(node, tt.want) {
+			t.Errorf("%s: got %#v; want %#v", tt.sql, node, tt.want)
+		}
+	}
+	if _, _, pass := Parse("alter table library.loan__ set unique key (id);"); !pass {
+		t.Error("expected pass for unknown keywords")
+	}
+}
@@ -0,0 +1,128 @@
+package parser
+
+import "strings"
+
+// SplitStatements splits a query string into statements separated by
+// semicolons.  Semicolons within quoted strings, quoted identifiers,
+// dollar-quoted strings, and comments are not treated as separators.  Each
+// statement retains its terminating semicolon, if any, and statements
+// consisting only of white space and comments are omitted.
+func SplitStatements(query string) []string {
+	var stmts []string
+	var start int
+	var empty = true
+	add := func(end int) {
+		if !empty {
+			stmts = append(stmts, strings.TrimSpace(query[start:end]))
+		}
+		start = end
+		empty = true
+	}
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == ';':
+			add(i + 1)
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			if j := strings.IndexByte(query[i:], '\n'); j >= 0 {
+				i += j
+			} else {
+				i = len(query) - 1
+			}
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			i = skipBlockComment(query, i)
+		case c == '\'':
+			empty = false
+			i = skipQuoted(query, i, c, isEscapeString(query, i))
+		case c == '"':
+			empty = false
+			i = skipQuoted(query, i, c, false)
+		case c == '$':
+			empty = false
+			if tag := dollarTag(query[i:]); tag != "" {
+				if j := strings.Index(query[i+len(tag):], tag); j >= 0 {
+					i += len(tag) + j + len(tag) - 1
+				} else {
+					i = len(query) - 1
+				}
+			}
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+		default:
+			empty = false
+		}
+	}
+	add(len(query))
+	return stmts
+}
+
+// skipQuoted returns the position of the closing quote of a string or
+// identifier beginning at position i, where a doubled quote character
+// represents the character itself.  If backslash is true, a backslash escapes
+// the following character, as in an escape string constant.
+func skipQuoted(query string, i int, quote byte, backslash bool) int {
+	for i++; i < len(query); i++ {
+		if backslash && query[i] == '\\' {
+			i++
+			continue
+		}
+		if query[i] == quote {
+			if i+1 < len(query) && query[i+1] == quote {
+				i++
+				continue
+			}
+			return i
+		}
+	}
+	return len(query) - 1
+}
+
+// isEscapeString returns true if the quote at position i begins an escape
+// string constant such as E'it\'s', i.e. it follows the letter E which is
+// not part of a longer identifier.
+func isEscapeString(query string, i int) bool {
+	if i == 0 || (query[i-1] != 'E' && query[i-1] != 'e') {
+		return false
+	}
+	if i == 1 {
+		return true
+	}
+	c := query[i-2]
+	return !(c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= 0x80)
+}
+
+// skipBlockComment returns the position of the end of a possibly nested
+// block comment beginning at position i.
+func skipBlockComment(query string, i int) int {
+	depth := 0
+	for ; i < len(query); i++ {
+		switch {
+		case strings.HasPrefix(query[i:], "/*"):
+			depth++
+			i++
+		case strings.HasPrefix(query[i:], "*/"):
+			depth--
+			i++
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(query) - 1
+}
+
+// dollarTag returns the dollar-quote tag, such as "$$" or "$body$", at the
+// beginning of s, or "" if s does not begin with a tag.
+func dollarTag(s string) string {
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '$':
+			return s[:i+1]
+		case c == '_' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= 0x80:
+		case c >= '0' && c <= '9' && i > 1:
+		default:
+			return ""
+		}
+	}
+	return ""
+}
@@ -0,0 +1,36 @@
+package parser
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", nil},
+		{" ; ;", nil},
+		{"list status", []string{"list status"}},
+		{"begin; grant access on all to u;\ncommit;",
+			[]string{"begin;", "grant access on all to u;", "commit;"}},
+		{"select ';', \"a;b\" from t; select 1",
+			[]string{"select ';', \"a;b\" from t;", "select 1"}},
+		{"select 'it''s;'; select 2;", []string{"select 'it''s;';", "select 2;"}},
+		{"-- comment;\nselect 1; /* a /* b; */ c; */ select 2;",
+			[]string{"-- comment;\nselect 1;", "/* a /* b; */ c; */ select 2;"}},
+		{"select $$a;b$$; select $x$;$x$;", []string{"select $$a;b$$;", "select $x$;$x$;"}},
+		{"select $1; -- end", []string{"select $1;"}},
+		{`select E'it\'s;'; select e'\\'; select 2`,
+			[]string{`select E'it\'s;';`, `select e'\\';`, "select 2"}},
+		{`select 'a\'; select name'b\'; select 2`,
+			[]string{`select 'a\';`, `select name'b\';`, "select 2"}},
+	}
+	for _, tt := range tests {
+		got := SplitStatements(tt.query)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("SplitStatements(%q) = %q; want %q", tt.query, got, tt.want)
+		}
+	}
+}
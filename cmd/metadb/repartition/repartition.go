@@ -0,0 +1,79 @@
+// Package repartition changes the granularity of the history partitions of
+// tables.
+package repartition
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/metadb-project/metadb/cmd/metadb/catalog"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+	"github.com/metadb-project/metadb/cmd/metadb/eout"
+	"github.com/metadb-project/metadb/cmd/metadb/option"
+	"github.com/metadb-project/metadb/cmd/metadb/process"
+	"github.com/metadb-project/metadb/cmd/metadb/util"
+)
+
+// Repartition replaces the history partitions of a table with partitions of
+// a new granularity, copying the existing history into them.  The server
+// must not be running, because it caches the list of partitions.
+func Repartition(opt *option.Repartition) error {
+	name, ok := strings.CutSuffix(opt.Table, "__")
+	if !ok {
+		return fmt.Errorf("%q is not a main table name", opt.Table)
+	}
+	table, err := dbx.ParseTable(name)
+	if err != nil || table.Schema == "" {
+		return fmt.Errorf("%q is not a valid table name", opt.Table)
+	}
+	if err = catalog.CheckGranularity(opt.Granularity); err != nil {
+		return err
+	}
+	db, err := util.ReadConfigDatabase(opt.Datadir)
+	if err != nil {
+		return err
+	}
+	// Check if server is already running.
+	running, pid, err := process.IsServerRunning(opt.Datadir)
+	if err != nil {
+		return err
+	}
+	if running {
+		return fmt.Errorf("lock file %q already exists and server (PID %d) appears to be running", util.SystemPIDFileName(opt.Datadir), pid)
+	}
+	// Write lock file for new server instance.
+	if err = process.WritePIDFile(opt.Datadir); err != nil {
+		return err
+	}
+	defer process.RemovePIDFile(opt.Datadir)
+	var dp *pgxpool.Pool
+	dp, err = dbx.NewPool(context.TODO(), db.ConnString(db.User, db.Password))
+	if err != nil {
+		return fmt.Errorf("creating database connection pool: %w", err)
+	}
+	defer dp.Close()
+	// Check that database version is compatible.
+	if err = catalog.CheckDatabaseCompatible(dp); err != nil {
+		return err
+	}
+	cat, err := catalog.Initialize(db, dp)
+	if err != nil {
+		return err
+	}
+	if !cat.TableExists(&table) {
+		return fmt.Errorf("table %q does not exist", opt.Table)
+	}
+	g := cat.PartitionGranularity(table)
+	if g == opt.Granularity {
+		eout.Info("table %s is already partitioned by %s", opt.Table, g)
+		return nil
+	}
+	eout.Info("repartitioning %s by %s (previously %s)", opt.Table, opt.Granularity, g)
+	if err = cat.Repartition(table, opt.Granularity); err != nil {
+		return err
+	}
+	eout.Info("created %d partitions", len(cat.Partitions(table)))
+	return nil
+}
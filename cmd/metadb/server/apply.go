@@ -0,0 +1,160 @@
+package server
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/metadb-project/metadb/cmd/metadb/catalog"
+	"github.com/metadb-project/metadb/cmd/metadb/command"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+	"github.com/metadb-project/metadb/cmd/metadb/dsync"
+	"github.com/metadb-project/metadb/cmd/metadb/log"
+)
+
+// maxApplyWorkers is the upper limit for the apply_concurrency configuration
+// parameter.
+const maxApplyWorkers = 32
+
+// partitionCommands groups the commands of a command graph by root table,
+// preserving the order of commands within each group.  The root table of a
+// command is found by calling root with the table of the command, or with
+// its parent table if it has one.  Since deletes and truncates are applied
+// to the transformed tables of their table, and since the primary key of a
+// record determines its table, the order of changes to each record is also
+// preserved.  Subcommands remain with their root commands.  Groups are
+// returned in order of their first command.
+func partitionCommands(cmdgraph *command.CommandGraph, root func(dbx.Table) dbx.Table) [][]*command.Command {
+	var groups [][]*command.Command
+	index := make(map[dbx.Table]int)
+	for e := cmdgraph.Commands.Front(); e != nil; e = e.Next() {
+		cmd := e.Value.(*command.Command)
+		table := dbx.Table{Schema: cmd.SchemaName, Table: cmd.TableName}
+		if cmd.ParentTable.Table != "" {
+			table = cmd.ParentTable
+		}
+		table = root(table)
+		i, ok := index[table]
+		if !ok {
+			i = len(groups)
+			index[table] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], cmd)
+	}
+	return groups
+}
+
+// applyPartitions calls apply for each partition using up to the specified
+// number of concurrent workers.  If an error occurs, no further partitions
+// are started, and the first error is returned.  The returned slice reports
+// which partitions were applied successfully.
+func applyPartitions(groups [][]*command.Command, workers int, apply func([]*command.Command) error) ([]bool, error) {
+	done := make([]bool, len(groups))
+	queue := make(chan int)
+	var mu sync.Mutex
+	var firstErr error
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return firstErr != nil
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < min(workers, len(groups)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				err := apply(groups[i])
+				mu.Lock()
+				if err == nil {
+					done[i] = true
+				} else if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range groups {
+		if failed() {
+			break
+		}
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+	return done, firstErr
+}
+
+// removeCommands removes the commands of the partitions that are done from
+// a command graph.
+func removeCommands(cmdgraph *command.CommandGraph, groups [][]*command.Command, done []bool) {
+	remove := make(map[*command.Command]bool)
+	for i, group := range groups {
+		if !done[i] {
+			continue
+		}
+		for _, cmd := range group {
+			remove[cmd] = true
+		}
+	}
+	var next *list.Element
+	for e := cmdgraph.Commands.Front(); e != nil; e = next {
+		next = e.Next()
+		if remove[e.Value.(*command.Command)] {
+			cmdgraph.Commands.Remove(e)
+		}
+	}
+}
+
+// execCommandGraphParallel executes a command graph using up to the
+// specified number of concurrent workers.  Commands are partitioned by root
+// table, and each partition is executed by a single worker with a separate
+// execbuffer, holding a read lock on catalog.ExecMutex until the partition
+// has been flushed.  Partitions are written in separate transactions and
+// cannot be rolled back together, so if an error occurs, the commands of
+// partitions that have been written are removed from the command graph
+// before the error is returned.  The caller can then apply the remaining
+// commands without applying any command twice.
+func execCommandGraphParallel(thread int, ctx context.Context, cat *catalog.Catalog, cmdgraph *command.CommandGraph, dp *pgxpool.Pool, source string, changeLog bool, uuopt bool, syncMode dsync.Mode, dedup *log.MessageSet, workers int) error {
+	if cmdgraph.Commands.Len() == 0 {
+		return nil
+	}
+	groups := partitionCommands(cmdgraph, cat.RootTable)
+	txnTime := time.Now()
+	done, err := applyPartitions(groups, workers, func(group []*command.Command) error {
+		catalog.ExecMutex.RLock()
+		defer catalog.ExecMutex.RUnlock()
+		ebuf := &execbuffer{
+			ctx:       ctx,
+			dp:        dp,
+			syncIDs:   make(map[dbx.Table][][]any),
+			merges:    make(map[dbx.Table]*mergeBatch),
+			syncMode:  syncMode,
+			source:    source,
+			changeLog: changeLog,
+		}
+		for _, cmd := range group {
+			if err := execCommandTree(thread, ebuf, cat, cmd, source, uuopt, syncMode, dedup); err != nil {
+				return err
+			}
+		}
+		if err := ebuf.flush(); err != nil {
+			return fmt.Errorf("exec command list: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		removeCommands(cmdgraph, groups, done)
+		return err
+	}
+	log.Trace("=================================================================")
+	log.Trace("exec: %d records, %d tables, %d workers %s", cmdgraph.Commands.Len(), len(groups),
+		min(workers, len(groups)), fmt.Sprintf("[%.4f s]", time.Since(txnTime).Seconds()))
+	log.Trace("=================================================================")
+	return nil
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/metadb-project/metadb/cmd/metadb/command"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+)
+
+func testCommand(table string, id string) *command.Command {
+	return &command.Command{
+		Op:         command.MergeOp,
+		SchemaName: "s",
+		TableName:  table,
+		Column:     []command.CommandColumn{{Name: "id", SQLData: &id, PrimaryKey: 1}},
+	}
+}
+
+// commandIDs returns the table and primary key of each command.
+func commandIDs(cmds []*command.Command) []string {
+	var ids []string
+	for _, cmd := range cmds {
+		ids = append(ids, cmd.TableName+":"+*cmd.Column[0].SQLData)
+	}
+	return ids
+}
+
+func testCommandGraph(cmds ...*command.Command) *command.CommandGraph {
+	cmdgraph := command.NewCommandGraph()
+	for _, cmd := range cmds {
+		cmdgraph.Commands.PushBack(cmd)
+	}
+	return cmdgraph
+}
+
+func graphCommands(cmdgraph *command.CommandGraph) []*command.Command {
+	var cmds []*command.Command
+	for e := cmdgraph.Commands.Front(); e != nil; e = e.Next() {
+		cmds = append(cmds, e.Value.(*command.Command))
+	}
+	return cmds
+}
+
+func TestPartitionCommands(t *testing.T) {
+	// Table c is transformed from table a, and table d from c.
+	parents := map[dbx.Table]dbx.Table{
+		{Schema: "s", Table: "c"}: {Schema: "s", Table: "a"},
+		{Schema: "s", Table: "d"}: {Schema: "s", Table: "c"},
+	}
+	root := func(table dbx.Table) dbx.Table {
+		for {
+			p, ok := parents[table]
+			if !ok {
+				return table
+			}
+			table = p
+		}
+	}
+	e := testCommand("e", "1")
+	e.ParentTable = dbx.Table{Schema: "s", Table: "b"}
+	cmdgraph := testCommandGraph(
+		testCommand("a", "1"),
+		testCommand("b", "1"),
+		testCommand("a", "2"),
+		testCommand("d", "1"),
+		testCommand("a", "1"),
+		e,
+		testCommand("c", "1"),
+		testCommand("b", "1"),
+	)
+	var got [][]string
+	for _, group := range partitionCommands(cmdgraph, root) {
+		got = append(got, commandIDs(group))
+	}
+	want := [][]string{
+		{"a:1", "a:2", "d:1", "a:1", "c:1"},
+		{"b:1", "e:1", "b:1"},
+	}
+	if !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("partitionCommands() = %v; want %v", got, want)
+	}
+}
+
+func TestApplyPartitions(t *testing.T) {
+	var groups [][]*command.Command
+	for _, table := range []string{"a", "b", "c", "d", "e"} {
+		groups = append(groups, []*command.Command{testCommand(table, "1"), testCommand(table, "2")})
+	}
+	var mu sync.Mutex
+	var applied [][]string
+	done, err := applyPartitions(groups, 3, func(group []*command.Command) error {
+		mu.Lock()
+		defer mu.Unlock()
+		applied = append(applied, commandIDs(group))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(done, []bool{true, true, true, true, true}) {
+		t.Errorf("done = %v", done)
+	}
+	if len(applied) != len(groups) {
+		t.Fatalf("applied %d partitions; want %d", len(applied), len(groups))
+	}
+	for _, ids := range applied {
+		if ids[0][2:] != "1" || ids[1][2:] != "2" {
+			t.Errorf("partition applied out of order: %v", ids)
+		}
+	}
+}
+
+func TestApplyPartitionsError(t *testing.T) {
+	var groups [][]*command.Command
+	for _, table := range []string{"a", "b", "c", "d", "e"} {
+		groups = append(groups, []*command.Command{testCommand(table, "1")})
+	}
+	failure := errors.New("failure")
+	// With one worker, partitions are applied in order, and none are
+	// started after the error.
+	var applied []string
+	done, err := applyPartitions(groups, 1, func(group []*command.Command) error {
+		applied = append(applied, group[0].TableName)
+		if group[0].TableName == "b" {
+			return failure
+		}
+		return nil
+	})
+	if err != failure {
+		t.Errorf("err = %v; want %v", err, failure)
+	}
+	if len(applied) > 3 {
+		t.Errorf("applied = %v; want at most one partition after the error", applied)
+	}
+	if !done[0] || done[1] || done[3] || done[4] {
+		t.Errorf("done = %v", done)
+	}
+	// The commands of partitions that were applied are removed, so that
+	// they are not applied again.
+	cmdgraph := testCommandGraph(groups[0][0], groups[1][0], groups[2][0], groups[3][0], groups[4][0])
+	removeCommands(cmdgraph, groups, done)
+	var want []*command.Command
+	for i := range groups {
+		if !done[i] {
+			want = append(want, groups[i][0])
+		}
+	}
+	if got := graphCommands(cmdgraph); !slices.Equal(got, want) {
+		t.Errorf("remaining commands = %v; want %v", commandIDs(got), commandIDs(want))
+	}
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/metadb-project/metadb/cmd/metadb/catalog"
+)
+
+// Classes of stream processing errors, which determine how quickly
+// processing is retried.
+const (
+	// retryConnection is an error connecting to a data source or the
+	// database, which is expected to be temporary.
+	retryConnection = "connection"
+	// retryData is any other error, such as a change event that cannot
+	// be applied, which is likely to recur until fixed.
+	retryData = "data"
+)
+
+// maxConnectionRetryInterval limits the backoff for connection errors, so
+// that processing resumes soon after a data source or the database becomes
+// available again.
+const maxConnectionRetryInterval = 5 * time.Minute
+
+// Retry intervals used if the configuration parameters are not valid.
+const (
+	defaultRetryInitialInterval = 10 * time.Second
+	defaultRetryMaxInterval     = 24 * time.Hour
+)
+
+// connectionErrorText lists error message fragments that indicate a
+// connection error, for errors that have been converted to strings.
+var connectionErrorText = []string{
+	"all broker connections are down",
+	"broken pipe",
+	"cannot connect now",
+	"connection refused",
+	"connection reset",
+	"could not connect",
+	"failed to connect",
+	"i/o timeout",
+	"no such host",
+	"server closed the connection",
+	"terminating connection",
+	"the database system is in recovery mode",
+	"the database system is shutting down",
+	"the database system is starting up",
+	"unexpected eof",
+}
+
+// classifyError returns the retry class of a stream processing error.
+func classifyError(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// Class 08 is connection exception; 57P01-57P03 are
+		// shutdown and startup conditions.
+		if strings.HasPrefix(pgErr.Code, "08") || strings.HasPrefix(pgErr.Code, "57P") {
+			return retryConnection
+		}
+		return retryData
+	}
+	var connectErr *pgconn.ConnectError
+	var netErr net.Error
+	if errors.As(err, &connectErr) || errors.As(err, &netErr) || pgconn.Timeout(err) {
+		return retryConnection
+	}
+	var kafkaErr kafka.Error
+	if errors.As(err, &kafkaErr) {
+		switch kafkaErr.Code() {
+		case kafka.ErrTransport, kafka.ErrAllBrokersDown, kafka.ErrTimedOut, kafka.ErrResolve:
+			return retryConnection
+		}
+	}
+	msg := strings.ToLower(err.Error())
+	for _, s := range connectionErrorText {
+		if strings.Contains(msg, s) {
+			return retryConnection
+		}
+	}
+	return retryData
+}
+
+// retryDelay returns the time to wait before retry attempt n (starting at
+// 1), doubling the initial interval for each attempt up to the maximum.
+func retryDelay(class string, n int, initial, maximum time.Duration) time.Duration {
+	if class == retryConnection {
+		maximum = min(maximum, maxConnectionRetryInterval)
+	}
+	d := initial
+	for i := 1; i < n && d < maximum; i++ {
+		d *= 2
+	}
+	return min(d, maximum)
+}
+
+// getConfigRetryIntervals reads the initial and maximum retry intervals.
+func getConfigRetryIntervals(cat *catalog.Catalog) (time.Duration, time.Duration, error) {
+	initial, err := getConfigSeconds(cat, "retry_initial_interval")
+	if err != nil {
+		return 0, 0, err
+	}
+	maximum, err := getConfigSeconds(cat, "retry_max_interval")
+	if err != nil {
+		return 0, 0, err
+	}
+	return initial, max(initial, maximum), nil
+}
+
+func getConfigSeconds(cat *catalog.Catalog, parameter string) (time.Duration, error) {
+	v, err := cat.GetConfig(parameter)
+	if err != nil {
+		return 0, err
+	}
+	s, err := strconv.Atoi(v)
+	if err != nil || s < 1 {
+		return 0, fmt.Errorf("invalid value %q for %s", v, parameter)
+	}
+	return time.Duration(s) * time.Second, nil
+}
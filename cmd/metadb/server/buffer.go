@@ -3,10 +3,15 @@ package server
 import (
 	"context"
 	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/metadb-project/metadb/cmd/metadb/catalog"
+	"github.com/metadb-project/metadb/cmd/metadb/command"
 	"github.com/metadb-project/metadb/cmd/metadb/dbx"
 	"github.com/metadb-project/metadb/cmd/metadb/dsync"
 	"github.com/metadb-project/metadb/cmd/metadb/log"
@@ -17,17 +22,156 @@ type execbuffer struct {
 	dp  *pgxpool.Pool
 	// syncIDs is a map of buffered IDs ready for COPY to sync tables.
 	syncIDs map[dbx.Table][][]any
-	// mergeData is a slice of buffered update-insert SQL statement pairs.
-	mergeData map[dbx.Table][][]string
-	syncMode  dsync.Mode
+	// merges is a map of buffered rows to be merged into each table.
+	merges   map[dbx.Table]*mergeBatch
+	syncMode dsync.Mode
+	// source is the name of the data source, and changeLog is true if
+	// changes are recorded in the change log.
+	source    string
+	changeLog bool
+}
+
+// mergeBatch is a list of rows to be merged into a table, in the order of
+// the merge commands.  Each row has a value for every column in columns,
+// except that rows may be shorter than columns if columns were added after
+// they were queued.
+type mergeBatch struct {
+	key     []string // Primary key columns
+	columns []string // All columns of the table
+	types   []string // Data types of the columns, if known
+	index   map[string]int
+	origins []string
+	starts  []string
+	rows    [][]*string
+	// unavailable lists the indexes of the columns in each row whose
+	// values were unavailable in the change event.
+	unavailable [][]int
+	// transformed is true if the table is transformed from another
+	// table, in which case changes are not recorded in the change log.
+	transformed bool
 }
 
 func (e *execbuffer) queueSyncID(table *dbx.Table, id int64) {
 	e.syncIDs[*table] = append(e.syncIDs[*table], []any{id})
 }
 
-func (e *execbuffer) queueMergeData(table *dbx.Table, update, insert *string) {
-	e.mergeData[*table] = append(e.mergeData[*table], []string{*update, *insert})
+// queueMerge adds the row of a merge command to the batch for a table.
+// The columns of the table that are not in the command are set to NULL,
+// as are columns that are added to the batch later.  The table schema maps
+// the columns of the table to their data types.  If the primary key
+// differs from that of the batch, the buffer is flushed first.
+func (e *execbuffer) queueMerge(table *dbx.Table, tableSchema map[string]string, cmd *command.Command) error {
+	var key []string
+	for _, col := range command.PrimaryKeyColumns(cmd.Column) {
+		key = append(key, col.Name)
+	}
+	m := e.merges[*table]
+	if m != nil && !slices.Equal(m.key, key) {
+		if err := e.flush(); err != nil {
+			return err
+		}
+		m = nil
+	}
+	if m == nil {
+		m = &mergeBatch{key: key, index: make(map[string]int), transformed: cmd.Transformed}
+		for _, c := range slices.Sorted(maps.Keys(tableSchema)) {
+			m.addColumn(c, tableSchema[c])
+		}
+		e.merges[*table] = m
+	}
+	for i := range cmd.Column {
+		m.addColumn(cmd.Column[i].Name, tableSchema[cmd.Column[i].Name])
+	}
+	row := make([]*string, len(m.columns))
+	var unavailable []int
+	for i := range cmd.Column {
+		j := m.index[cmd.Column[i].Name]
+		row[j] = cmd.Column[i].SQLData
+		if cmd.Column[i].Unavailable {
+			unavailable = append(unavailable, j)
+		}
+	}
+	m.origins = append(m.origins, cmd.Origin)
+	m.starts = append(m.starts, cmd.SourceTimestamp)
+	m.rows = append(m.rows, row)
+	m.unavailable = append(m.unavailable, unavailable)
+	return nil
+}
+
+func (m *mergeBatch) addColumn(column, dataType string) {
+	if _, ok := m.index[column]; ok {
+		return
+	}
+	m.index[column] = len(m.columns)
+	m.columns = append(m.columns, column)
+	m.types = append(m.types, dataType)
+}
+
+// textComparedTypes are the data types that have no equality operator, or
+// whose equality operator does not compare the entire value.  Values of
+// these types are compared as text.
+var textComparedTypes = map[string]bool{
+	"json":    true,
+	"xml":     true,
+	"point":   true,
+	"line":    true,
+	"lseg":    true,
+	"box":     true,
+	"path":    true,
+	"polygon": true,
+	"circle":  true,
+}
+
+// columnSQL returns a column of a row for use in a comparison.
+func (m *mergeBatch) columnSQL(row string, j int) string {
+	c := row + "\"" + m.columns[j] + "\""
+	if textComparedTypes[strings.TrimSuffix(m.types[j], "[]")] {
+		c += "::text"
+	}
+	return c
+}
+
+// keyEqualSQL returns a condition that is true if rows a and b have the
+// same primary key.
+func (m *mergeBatch) keyEqualSQL(a, b string) string {
+	var s strings.Builder
+	for i, k := range m.key {
+		if i != 0 {
+			s.WriteString(" AND ")
+		}
+		s.WriteString(m.columnSQL(a, m.index[k]) + "=" + m.columnSQL(b, m.index[k]))
+	}
+	return s.String()
+}
+
+// rowsEqualSQL returns a condition that is true if rows a and b have the
+// same values, not including the columns that are unavailable in the
+// staging table row s.
+func (m *mergeBatch) rowsEqualSQL(a, b string) string {
+	unavailable := make(map[int]bool)
+	for _, u := range m.unavailable {
+		for _, j := range u {
+			unavailable[j] = true
+		}
+	}
+	var as, bs, conds []string
+	for j := range m.columns {
+		if unavailable[j] {
+			conds = append(conds, "("+strconv.Itoa(j)+"=ANY(s.__merge_unavailable) OR "+
+				m.columnSQL(a, j)+" IS NOT DISTINCT FROM "+m.columnSQL(b, j)+")")
+			continue
+		}
+		as = append(as, m.columnSQL(a, j))
+		bs = append(bs, m.columnSQL(b, j))
+	}
+	if len(as) != 0 {
+		conds = append([]string{"(" + strings.Join(as, ",") + ") IS NOT DISTINCT FROM (" +
+			strings.Join(bs, ",") + ")"}, conds...)
+	}
+	if len(conds) == 0 {
+		return "TRUE"
+	}
+	return strings.Join(conds, " AND ")
 }
 
 func (e *execbuffer) flush() error {
@@ -38,7 +182,7 @@ func (e *execbuffer) flush() error {
 	defer tx.Rollback(e.ctx)
 	// Flush merge data.
 	log.Trace("FLUSH merge data")
-	if err = e.flushMergeData(tx); err != nil {
+	if err = e.flushMerges(tx); err != nil {
 		return fmt.Errorf("flushing exec buffer: writing merge data: %w", err)
 	}
 	// Flush sync IDs.
@@ -71,47 +215,176 @@ func (e *execbuffer) flushSyncIDs(tx pgx.Tx) error {
 	return nil
 }
 
-func (e *execbuffer) flushMergeData(tx pgx.Tx) error {
-	batchSize := 100
-	for t, a := range e.mergeData {
-		lena := len(a)
-		for i := 0; i < lena; i += batchSize {
-			batchEndIndex := min(i+batchSize, lena)
-			actualBatchSize := batchEndIndex - i
-			batch := pgx.Batch{}
-			ids := make([][]any, actualBatchSize)
-			for j := range ids {
-				ids[j] = []any{0}
-			}
-			for k := i; k < batchEndIndex; k++ {
-				// Queue UPDATE.
-				batch.Queue(a[k][0])
-				// Queue INSERT.
-				p := &(ids[k-i][0])
-				batch.Queue(a[k][1]).QueryRow(func(row pgx.Row) error {
-					return row.Scan(p)
-				})
-			}
-			if err := tx.SendBatch(e.ctx, &batch).Close(); err != nil {
-				return fmt.Errorf("update and insert: %w", err)
-			}
-			// If resync mode, flush IDs to sync table.
-			if e.syncMode == dsync.Resync {
-				//e.queueSyncID(&t, id)
-				synct := catalog.SyncTable(&t)
-				copyCount, err := tx.CopyFrom(
-					e.ctx,
-					pgx.Identifier{synct.Schema, synct.Table},
-					[]string{"__id"},
-					pgx.CopyFromRows(ids),
-				)
-				if err != nil {
-					return fmt.Errorf("copy to sync table: %w", err)
+// flushMerges merges the buffered rows into their tables.  For each table,
+// the rows are copied to a temporary staging table, and rows that are
+// identical to the previous version of the record, either earlier in the
+// batch or the current row in the table, are skipped.  The current rows
+// of records that have changed are then closed out, and the new versions
+// are inserted, with all but the last version of each record inserted as
+// no longer current.  In resync mode, the IDs of the inserted and matching
+// rows are written to the sync table.
+func (e *execbuffer) flushMerges(tx pgx.Tx) error {
+	for t, m := range e.merges {
+		if err := e.flushMergeBatch(tx, &t, m); err != nil {
+			return fmt.Errorf("merging into table %q: %w", t.String(), err)
+		}
+	}
+	e.merges = make(map[dbx.Table]*mergeBatch) // Clear buffers.
+	return nil
+}
+
+func (e *execbuffer) flushMergeBatch(tx pgx.Tx, table *dbx.Table, m *mergeBatch) error {
+	columns := make([]string, len(m.columns))
+	for i, c := range m.columns {
+		columns[i] = "\"" + c + "\""
+	}
+	list := func(prefix string, cols []string) string {
+		l := make([]string, len(cols))
+		for i := range cols {
+			l[i] = prefix + cols[i]
+		}
+		return strings.Join(l, ",")
+	}
+	key := make([]string, len(m.key))
+	for i, c := range m.key {
+		key[i] = m.columnSQL("", m.index[c])
+	}
+	// The staging table has the types of the table columns.
+	q := "CREATE TEMPORARY TABLE __merge_stage ON COMMIT DROP AS SELECT " +
+		"NULL::bigint AS __merge_seq,NULL::bigint AS __merge_prev,FALSE AS __merge_skip," +
+		"NULL::bigint AS __merge_id,NULL::integer[] AS __merge_unavailable,__start,__origin," + list("", columns) +
+		" FROM " + table.MainSQL() + " WITH NO DATA"
+	if _, err := tx.Exec(e.ctx, q); err != nil {
+		return fmt.Errorf("creating staging table: %w", err)
+	}
+	var b strings.Builder
+	for i, row := range m.rows {
+		b.WriteString(strconv.Itoa(i))
+		b.WriteByte('\t')
+		if len(m.unavailable[i]) == 0 {
+			b.WriteString("\\N")
+		} else {
+			b.WriteByte('{')
+			for k, j := range m.unavailable[i] {
+				if k != 0 {
+					b.WriteByte(',')
 				}
-				log.Trace("copy %d rows to table %q", copyCount, synct)
+				b.WriteString(strconv.Itoa(j))
 			}
+			b.WriteByte('}')
 		}
+		b.WriteByte('\t')
+		b.WriteString(m.starts[i])
+		b.WriteByte('\t')
+		dbx.EncodeCopyText(&b, &m.origins[i])
+		for j := range m.columns {
+			b.WriteByte('\t')
+			var v *string
+			if j < len(row) {
+				v = row[j]
+			}
+			dbx.EncodeCopyText(&b, v)
+		}
+		b.WriteByte('\n')
+	}
+	q = "COPY __merge_stage (__merge_seq,__merge_unavailable,__start,__origin," + list("", columns) + ") FROM STDIN"
+	if _, err := tx.Conn().PgConn().CopyFrom(e.ctx, strings.NewReader(b.String()), q); err != nil {
+		return fmt.Errorf("copying to staging table: %w", err)
 	}
-	e.mergeData = make(map[dbx.Table][][]string) // Clear buffers.
+	partition := "__origin," + list("", key)
+	batch := pgx.Batch{}
+	// Link each row to the previous version of the record in the batch.
+	batch.Queue("UPDATE __merge_stage s SET __merge_prev=p.prev FROM " +
+		"(SELECT __merge_seq,lag(__merge_seq) OVER (PARTITION BY " + partition + " ORDER BY __merge_seq) prev " +
+		"FROM __merge_stage) p WHERE s.__merge_seq=p.__merge_seq")
+	// Skip rows that are identical to the previous version in the batch.
+	batch.Queue("UPDATE __merge_stage s SET __merge_skip=TRUE FROM __merge_stage p " +
+		"WHERE s.__merge_prev=p.__merge_seq AND " + m.rowsEqualSQL("s.", "p."))
+	// Skip rows that are identical to the current row.
+	batch.Queue("UPDATE __merge_stage s SET __merge_skip=TRUE,__merge_id=c.__id FROM " + table.SQL() + " c " +
+		"WHERE s.__merge_prev IS NULL AND c.__origin=s.__origin AND " + m.keyEqualSQL("c.", "s.") +
+		" AND " + m.rowsEqualSQL("s.", "c."))
+	// Close out the current rows of changed records.
+	batch.Queue("UPDATE " + table.MainSQL() + " t SET __end=f.__start,__current=FALSE FROM " +
+		"(SELECT DISTINCT ON (" + partition + ") " + partition + ",__start FROM __merge_stage " +
+		"WHERE NOT __merge_skip ORDER BY " + partition + ",__merge_seq) f " +
+		"WHERE t.__current AND t.__origin=f.__origin AND " + m.keyEqualSQL("t.", "f."))
+	// Insert the new versions.
+	insert := "INSERT INTO " + table.MainSQL() + "(__start,__end,__current,__origin," + list("", columns) + ") " +
+		"SELECT __start,coalesce(lead(__start) OVER w,'9999-12-31 00:00:00Z'),lead(__merge_seq) OVER w IS NULL," +
+		"__origin," + list("", columns) + " FROM __merge_stage WHERE NOT __merge_skip " +
+		"WINDOW w AS (PARTITION BY " + partition + " ORDER BY __merge_seq) ORDER BY __merge_seq"
+	// The inserted rows are also recorded in the change log, if enabled.
+	// As with deletes and truncates, only changes to the table itself are
+	// recorded, not to its transformed tables.
+	changeLog := e.changeLog && !m.transformed
+	var changes string
+	switch {
+	case changeLog:
+		insert += returningSQL(append([]string{"__start"}, m.key...))
+		changes = e.changeLogSQL("merge", table, m.key, "i", "__start")
+	case e.syncMode == dsync.Resync:
+		insert += returningSQL(nil)
+	}
+	switch {
+	case e.syncMode == dsync.Resync:
+		synct := catalog.SyncTable(table)
+		with := "WITH i AS (" + insert + ") "
+		if changeLog {
+			with = "WITH i AS (" + insert + "), l AS (" + changes + ") "
+		}
+		batch.Queue(with + "INSERT INTO " + synct.SQL() + "(__id) " +
+			"SELECT __id FROM i UNION ALL SELECT __merge_id FROM __merge_stage WHERE __merge_id IS NOT NULL")
+	case changeLog:
+		batch.Queue("WITH i AS (" + insert + ") " + changes)
+	default:
+		batch.Queue(insert)
+	}
+	batch.Queue("DROP TABLE __merge_stage")
+	if err := tx.SendBatch(e.ctx, &batch).Close(); err != nil {
+		return err
+	}
+	log.Trace("merge %d rows into table %q", len(m.rows), table)
 	return nil
 }
+
+// changeLogSQL returns a statement that records changes to a table in the
+// change log.  The changed records are selected from rows, which has the
+// columns __id and the primary key columns, and timestamp is an SQL
+// expression for the source timestamp.  If rows is "", a single change is
+// recorded that applies to the whole table.
+func (e *execbuffer) changeLogSQL(op string, table *dbx.Table, key []string, rows, timestamp string) string {
+	var b strings.Builder
+	b.WriteString("INSERT INTO metadb.change_log" +
+		"(source_name,operation,schema_name,table_name,primary_key,__id,source_timestamp) SELECT ")
+	dbx.EncodeString(&b, e.source)
+	b.WriteString(",'" + op + "',")
+	dbx.EncodeString(&b, table.Schema)
+	b.WriteByte(',')
+	dbx.EncodeString(&b, table.Table)
+	if rows == "" {
+		b.WriteString(",NULL,NULL," + timestamp)
+		return b.String()
+	}
+	b.WriteString(",jsonb_build_object(")
+	for i, k := range key {
+		if i != 0 {
+			b.WriteByte(',')
+		}
+		dbx.EncodeString(&b, k)
+		b.WriteString(",\"" + k + "\"")
+	}
+	b.WriteString("),__id," + timestamp + " FROM " + rows)
+	return b.String()
+}
+
+// returningSQL returns a RETURNING clause for the column __id and other
+// columns.
+func returningSQL(columns []string) string {
+	var b strings.Builder
+	b.WriteString(" RETURNING __id")
+	for _, c := range columns {
+		b.WriteString(",\"" + c + "\"")
+	}
+	return b.String()
+}
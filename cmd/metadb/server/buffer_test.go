@@ -0,0 +1,216 @@
+package server
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/metadb-project/metadb/cmd/metadb/command"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+	"github.com/metadb-project/metadb/cmd/metadb/dsync"
+)
+
+// mergeCommand returns a merge command for the test table, with integer
+// primary key column id and other columns given as name and value pairs.
+// A value of "?" is unavailable.
+func mergeCommand(start string, id string, columns ...string) *command.Command {
+	cmd := &command.Command{
+		Op:              command.MergeOp,
+		SchemaName:      "metadb_test",
+		TableName:       "merge",
+		Origin:          "",
+		SourceTimestamp: start,
+		Column:          []command.CommandColumn{{Name: "id", SQLData: &id, PrimaryKey: 1}},
+	}
+	for i := 0; i < len(columns); i += 2 {
+		v := columns[i+1]
+		cmd.Column = append(cmd.Column, command.CommandColumn{Name: columns[i], SQLData: &v, Unavailable: v == "?"})
+	}
+	return cmd
+}
+
+var mergeTableSchema = map[string]string{"id": "integer", "doc": "json", "p": "point", "v": "text"}
+
+func TestMergeBatchSQL(t *testing.T) {
+	e := &execbuffer{merges: make(map[dbx.Table]*mergeBatch)}
+	table := &dbx.Table{Schema: "metadb_test", Table: "merge"}
+	for _, cmd := range []*command.Command{
+		mergeCommand("2020-01-01 00:00:00Z", "1", "v", "a"),
+		mergeCommand("2020-01-02 00:00:00Z", "1", "v", "?"),
+	} {
+		if err := e.queueMerge(table, mergeTableSchema, cmd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := e.merges[*table]
+	if !slices.Equal(m.columns, []string{"doc", "id", "p", "v"}) {
+		t.Fatalf("columns = %v", m.columns)
+	}
+	if got, want := m.keyEqualSQL("c.", "s."), `c."id"=s."id"`; got != want {
+		t.Errorf("keyEqualSQL() = %s; want %s", got, want)
+	}
+	// Columns without an equality operator are compared as text, and
+	// unavailable columns are not compared.
+	want := `(s."doc"::text,s."id",s."p"::text) IS NOT DISTINCT FROM (c."doc"::text,c."id",c."p"::text)` +
+		` AND (3=ANY(s.__merge_unavailable) OR s."v" IS NOT DISTINCT FROM c."v")`
+	if got := m.rowsEqualSQL("s.", "c."); got != want {
+		t.Errorf("rowsEqualSQL() =\n\t%s\nwant\n\t%s", got, want)
+	}
+}
+
+func testPool(t *testing.T) *pgxpool.Pool {
+	db, err := dbx.TestDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db == nil {
+		t.Skipf("%s not set", dbx.TestDatabaseEnv)
+	}
+	dp, err := dbx.NewPool(context.Background(), db.ConnString(db.User, db.Password))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(dp.Close)
+	return dp
+}
+
+// createMergeTable creates the test table with the structure of a main
+// table.
+func createMergeTable(t *testing.T, dp *pgxpool.Pool) {
+	ctx := context.Background()
+	drop := func() {
+		_, _ = dp.Exec(ctx, "DROP SCHEMA IF EXISTS metadb_test CASCADE")
+	}
+	drop()
+	t.Cleanup(drop)
+	for _, q := range []string{
+		"CREATE SCHEMA metadb_test",
+		"CREATE TABLE metadb_test.merge__ (__id bigint GENERATED BY DEFAULT AS IDENTITY, " +
+			"__start timestamptz NOT NULL, __end timestamptz NOT NULL, __current boolean NOT NULL, " +
+			"__origin varchar(63) NOT NULL DEFAULT '', id integer, doc json, p point, v text) " +
+			"PARTITION BY LIST (__current)",
+		"CREATE TABLE metadb_test.merge PARTITION OF metadb_test.merge__ FOR VALUES IN (TRUE)",
+		"CREATE TABLE metadb_test.zzz___merge___ PARTITION OF metadb_test.merge__ FOR VALUES IN (FALSE)",
+		"CREATE TABLE metadb_test.zzz___merge___sync (__id bigint)",
+	} {
+		if _, err := dp.Exec(ctx, q); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// mergeRows returns the rows of the test table as strings of the form
+// "id v start end current", ordered by __id.
+func mergeRows(t *testing.T, dp *pgxpool.Pool) []string {
+	rows, err := dp.Query(context.Background(), "SELECT concat_ws(' ', id, v, "+
+		"to_char(__start, 'MM-DD'), to_char(__end, 'MM-DD'), __current) FROM metadb_test.merge__ ORDER BY __id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for rows.Next() {
+		var s string
+		if err = rows.Scan(&s); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, s)
+	}
+	if err = rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func flushMerges(t *testing.T, dp *pgxpool.Pool, syncMode dsync.Mode, cmds ...*command.Command) {
+	t.Helper()
+	e := &execbuffer{
+		ctx:      context.Background(),
+		dp:       dp,
+		syncIDs:  make(map[dbx.Table][][]any),
+		merges:   make(map[dbx.Table]*mergeBatch),
+		syncMode: syncMode,
+	}
+	table := &dbx.Table{Schema: "metadb_test", Table: "merge"}
+	for _, cmd := range cmds {
+		if err := e.queueMerge(table, mergeTableSchema, cmd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkRows(t *testing.T, got, want []string) {
+	t.Helper()
+	if !slices.Equal(got, want) {
+		t.Errorf("got:\n\t%v\nwant:\n\t%v", got, want)
+	}
+}
+
+func TestFlushMerge(t *testing.T) {
+	dp := testPool(t)
+	createMergeTable(t, dp)
+	doc := `{"a": 1}`
+	// Versions of a record in a batch are chained by __start and __end,
+	// and versions identical to the previous one are skipped.
+	flushMerges(t, dp, dsync.NoSync,
+		mergeCommand("2020-01-01 00:00:00Z", "1", "v", "a", "doc", doc, "p", "(1,2)"),
+		mergeCommand("2020-01-02 00:00:00Z", "1", "v", "a", "doc", doc, "p", "(1,2)"),
+		mergeCommand("2020-01-03 00:00:00Z", "1", "v", "b", "doc", doc, "p", "(1,2)"),
+		mergeCommand("2020-01-01 00:00:00Z", "2", "v", "x"),
+		mergeCommand("2020-01-04 00:00:00Z", "1", "v", "c", "doc", doc, "p", "(1,2)"),
+	)
+	checkRows(t, mergeRows(t, dp), []string{
+		"1 a 01-01 01-03 false",
+		"1 b 01-03 01-04 false",
+		"2 x 01-01 12-31 true",
+		"1 c 01-04 12-31 true",
+	})
+	// Records identical to the current row are skipped, including json
+	// and point values and columns that are unavailable, and the current
+	// rows of changed records are closed out.
+	flushMerges(t, dp, dsync.NoSync,
+		mergeCommand("2020-01-05 00:00:00Z", "1", "v", "?", "doc", doc, "p", "(1,2)"),
+		mergeCommand("2020-01-05 00:00:00Z", "2", "v", "y"),
+	)
+	checkRows(t, mergeRows(t, dp), []string{
+		"1 a 01-01 01-03 false",
+		"1 b 01-03 01-04 false",
+		"2 x 01-01 01-05 false",
+		"1 c 01-04 12-31 true",
+		"2 y 01-05 12-31 true",
+	})
+}
+
+func TestFlushMergeResync(t *testing.T) {
+	dp := testPool(t)
+	createMergeTable(t, dp)
+	flushMerges(t, dp, dsync.NoSync, mergeCommand("2020-01-01 00:00:00Z", "1", "v", "a"))
+	// In resync mode, the IDs of both matching and inserted rows are
+	// written to the sync table.
+	flushMerges(t, dp, dsync.Resync,
+		mergeCommand("2020-01-02 00:00:00Z", "1", "v", "a"),
+		mergeCommand("2020-01-02 00:00:00Z", "2", "v", "x"),
+	)
+	rows, err := dp.Query(context.Background(), "SELECT m.id FROM metadb_test.zzz___merge___sync s "+
+		"JOIN metadb_test.merge m ON s.__id=m.__id ORDER BY m.id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int32
+	for rows.Next() {
+		var id int32
+		if err = rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(ids, []int32{1, 2}) {
+		t.Errorf("synced ids = %v; want [1 2]", ids)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/metadb-project/metadb/cmd/metadb/catalog"
 	"github.com/metadb-project/metadb/cmd/metadb/command"
@@ -13,22 +14,30 @@ import (
 )
 
 func addPartition(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Command) error {
-	yearStr := cmd.SourceTimestamp[0:4]
-	year, err := strconv.Atoi(yearStr)
+	table := dbx.Table{Schema: cmd.SchemaName, Table: cmd.TableName}
+	// Partitions begin at the start of a month or longer period, so only
+	// the year and month are needed.
+	year, err := strconv.Atoi(cmd.SourceTimestamp[0:4])
 	if err != nil {
-		return fmt.Errorf("adding partition for table %q: invalid year format: %q",
-			cmd.SchemaName+"."+cmd.TableName, yearStr)
+		return fmt.Errorf("adding partition for table %q: invalid year format: %q", table.String(),
+			cmd.SourceTimestamp)
 	}
-	if cat.PartYearExists(cmd.SchemaName, cmd.TableName, year) {
+	month, err := strconv.Atoi(cmd.SourceTimestamp[5:7])
+	if err != nil || month < 1 || month > 12 {
+		return fmt.Errorf("adding partition for table %q: invalid month format: %q", table.String(),
+			cmd.SourceTimestamp)
+	}
+	start := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+	if cat.PartitionExists(table, start) {
 		return nil
 	}
 	if err = ebuf.flush(); err != nil {
-		return fmt.Errorf("adding partition for table %q year %q: %v", cmd.SchemaName+"."+cmd.TableName,
-			yearStr, err)
+		return fmt.Errorf("adding partition for table %q time %q: %v", table.String(),
+			cmd.SourceTimestamp, err)
 	}
-	if err = cat.AddPartYear(cmd.SchemaName, cmd.TableName, year); err != nil {
-		return fmt.Errorf("adding partition for table %q year %q: %v", cmd.SchemaName+"."+cmd.TableName,
-			yearStr, err)
+	if err = cat.AddPartition(table, start); err != nil {
+		return fmt.Errorf("adding partition for table %q time %q: %v", table.String(),
+			cmd.SourceTimestamp, err)
 	}
 	return nil
 }
@@ -0,0 +1,249 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/metadb-project/metadb/cmd/metadb/catalog"
+	"github.com/metadb-project/metadb/cmd/metadb/change"
+	"github.com/metadb-project/metadb/cmd/metadb/command"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+	"github.com/metadb-project/metadb/cmd/metadb/dsync"
+	"github.com/metadb-project/metadb/cmd/metadb/log"
+)
+
+// Stages of processing at which a change event may fail.
+const (
+	deadLetterParse = "parse"
+	deadLetterApply = "apply"
+)
+
+// deadLetterWriter records change events that could not be parsed or
+// applied, so that processing of the source can continue.  Dead letters are
+// written to the table metadb.dead_letter or, if a topic is defined, to a
+// Kafka topic.
+type deadLetterWriter struct {
+	source   string
+	dp       *pgxpool.Pool
+	producer *kafka.Producer
+	topic    string
+}
+
+// newDeadLetterWriter returns a dead letter writer for a source, or nil if
+// dead letter mode is not enabled.
+func newDeadLetterWriter(spr *sproc) (*deadLetterWriter, error) {
+	w := &deadLetterWriter{source: spr.source.Name, dp: spr.svr.dp}
+	switch spr.source.DeadLetter {
+	case "":
+		return nil, nil
+	case "table":
+		return w, nil
+	case "kafka":
+		config := &kafka.ConfigMap{
+			"bootstrap.servers": spr.source.Brokers,
+			"security.protocol": spr.source.Security,
+		}
+		producer, err := kafka.NewProducer(config)
+		if err != nil {
+			return nil, fmt.Errorf("creating dead letter producer: %w", err)
+		}
+		w.producer = producer
+		w.topic = spr.source.DeadLetterTopic
+		return w, nil
+	default:
+		return nil, fmt.Errorf("invalid dead letter mode %q", spr.source.DeadLetter)
+	}
+}
+
+// write records a change event that failed at the specified stage.
+func (w *deadLetterWriter) write(msg *change.Message, stage string, cause error) error {
+	log.Warning("source %q: %s: writing dead letter: %s: %v", w.source, stage, msg.Position, cause)
+	if w.producer != nil {
+		return w.produce(msg, stage, cause)
+	}
+	q := "INSERT INTO metadb.dead_letter (source_name, topic, position, key, value, stage, error) " +
+		"VALUES ($1, $2, $3, $4, $5, $6, $7)"
+	if _, err := w.dp.Exec(context.TODO(), q, w.source, msg.Topic, msg.Position, msg.Key, msg.Value, stage,
+		cause.Error()); err != nil {
+		return fmt.Errorf("writing dead letter: %w", err)
+	}
+	return nil
+}
+
+// produce writes a dead letter to the Kafka topic.  The original key and
+// value are retained, and the source, topic, position, and error are
+// written as headers.
+func (w *deadLetterWriter) produce(msg *change.Message, stage string, cause error) error {
+	delivery := make(chan kafka.Event, 1)
+	err := w.producer.Produce(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &w.topic, Partition: kafka.PartitionAny},
+		Key:            msg.Key,
+		Value:          msg.Value,
+		Headers: []kafka.Header{
+			{Key: "metadb.source", Value: []byte(w.source)},
+			{Key: "metadb.topic", Value: []byte(msg.Topic)},
+			{Key: "metadb.position", Value: []byte(msg.Position)},
+			{Key: "metadb.stage", Value: []byte(stage)},
+			{Key: "metadb.error", Value: []byte(cause.Error())},
+		},
+	}, delivery)
+	if err != nil {
+		return fmt.Errorf("writing dead letter to topic %q: %w", w.topic, err)
+	}
+	// Wait for delivery, because the source position will be committed
+	// at the next checkpoint.
+	m := (<-delivery).(*kafka.Message)
+	if m.TopicPartition.Error != nil {
+		return fmt.Errorf("writing dead letter to topic %q: %w", w.topic, m.TopicPartition.Error)
+	}
+	return nil
+}
+
+func (w *deadLetterWriter) close() {
+	if w != nil && w.producer != nil {
+		w.producer.Close()
+	}
+}
+
+// execCommandsSeparately executes the commands in a command graph one at a
+// time, after the graph as a whole has failed.  Commands that fail with a
+// data error are written as dead letters.  A connection error is returned
+// instead, because it is likely to be temporary and the commands are
+// applied again when processing is retried.  Commands that were applied
+// before the failure are applied again, which has no effect on the data.
+func execCommandsSeparately(thread int, ctx context.Context, cat *catalog.Catalog, cmdgraph *command.CommandGraph,
+	spr *sproc, syncMode dsync.Mode, dedup *log.MessageSet, deadLetters *deadLetterWriter) error {
+	for e := cmdgraph.Commands.Front(); e != nil; e = e.Next() {
+		cmd := e.Value.(*command.Command)
+		g := command.NewCommandGraph()
+		_ = g.Commands.PushBack(cmd)
+		err := execCommandGraph(thread, ctx, cat, g, spr.svr.dp, spr.source.Name, spr.source.ChangeLog, spr.svr.opt.UUOpt, syncMode,
+			dedup)
+		if err == nil {
+			continue
+		}
+		if cmd.Message == nil || classifyError(err) == retryConnection {
+			return err
+		}
+		if err = deadLetters.write(cmd.Message, deadLetterApply, err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// retryDeadLetters processes dead letters of a source that have been marked
+// for retry.  Dead letters that are processed successfully are removed, and
+// others are updated with the new error.  A connection error is returned,
+// leaving the dead letter marked for retry.
+func retryDeadLetters(ctx context.Context, cat *catalog.Catalog, spr *sproc, syncMode dsync.Mode,
+	dedup *log.MessageSet) error {
+	q := "SELECT id, topic, position, key, value FROM metadb.dead_letter " +
+		"WHERE source_name=$1 AND retry ORDER BY id"
+	rows, err := spr.svr.dp.Query(ctx, q, spr.source.Name)
+	if err != nil {
+		return fmt.Errorf("reading dead letters: %w", err)
+	}
+	type deadLetter struct {
+		id  int64
+		msg change.Message
+	}
+	var letters []deadLetter
+	for rows.Next() {
+		var d deadLetter
+		if err = rows.Scan(&d.id, &d.msg.Topic, &d.msg.Position, &d.msg.Key, &d.msg.Value); err != nil {
+			rows.Close()
+			return fmt.Errorf("reading dead letters: %w", err)
+		}
+		letters = append(letters, d)
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("reading dead letters: %w", err)
+	}
+	for _, d := range letters {
+		stage, err := retryDeadLetter(ctx, cat, spr, syncMode, dedup, &d.msg)
+		if err != nil && classifyError(err) == retryConnection {
+			return fmt.Errorf("retrying dead letter %d: %w", d.id, err)
+		}
+		if err != nil {
+			log.Warning("source %q: retrying dead letter %d: %v", spr.source.Name, d.id, err)
+			q = "UPDATE metadb.dead_letter SET stage=$1, error=$2, attempts=attempts+1, retry=FALSE, " +
+				"updated=now() WHERE id=$3"
+			if _, err = spr.svr.dp.Exec(ctx, q, stage, err.Error(), d.id); err != nil {
+				return fmt.Errorf("updating dead letter %d: %w", d.id, err)
+			}
+			continue
+		}
+		log.Info("source %q: dead letter %d processed", spr.source.Name, d.id)
+		if _, err = spr.svr.dp.Exec(ctx, "DELETE FROM metadb.dead_letter WHERE id=$1", d.id); err != nil {
+			return fmt.Errorf("removing dead letter %d: %w", d.id, err)
+		}
+	}
+	return nil
+}
+
+// retryDeadLetter parses and applies a single dead letter.  If an error
+// occurs, it also returns the stage at which it occurred.
+func retryDeadLetter(ctx context.Context, cat *catalog.Catalog, spr *sproc, syncMode dsync.Mode,
+	dedup *log.MessageSet, msg *change.Message) (string, error) {
+	c, _, err := command.NewCommandFromMessage(cat, dedup, msg, eventFormat(spr.source), spr.schemaPassFilter,
+		spr.schemaStopFilter, spr.tableStopFilter, spr.source.TrimSchemaPrefix, spr.source.AddSchemaPrefix,
+		spr.source.MapPublicSchema, spr.renames)
+	if err != nil {
+		return deadLetterParse, fmt.Errorf("parsing command: %w", err)
+	}
+	if c == nil {
+		return "", nil
+	}
+	if err = spr.columnRules.Apply(c); err != nil {
+		return deadLetterParse, fmt.Errorf("masking columns: %w", err)
+	}
+	if err = checkStale(ctx, cat, spr.svr.dp, c); err != nil {
+		return deadLetterApply, err
+	}
+	cmdgraph := command.NewCommandGraph()
+	if c.Previous != nil {
+		_ = cmdgraph.Commands.PushBack(c.Previous)
+	}
+	_ = cmdgraph.Commands.PushBack(c)
+	if err = rewriteCommandGraph(cat, cmdgraph); err != nil {
+		return deadLetterApply, fmt.Errorf("rewriter: %w", err)
+	}
+	if err = execCommandGraph(0, ctx, cat, cmdgraph, spr.svr.dp, spr.source.Name, spr.source.ChangeLog, spr.svr.opt.UUOpt, syncMode,
+		dedup); err != nil {
+		return deadLetterApply, fmt.Errorf("executor: %w", err)
+	}
+	return "", nil
+}
+
+// checkStale returns an error if a dead letter is older than the current
+// record that it would change, i.e. the current record with the same key,
+// or for a truncation any current record, started after the change event.
+// Applying such an event would replace newer data with older data.
+func checkStale(ctx context.Context, cat *catalog.Catalog, dp *pgxpool.Pool, c *command.Command) error {
+	table := dbx.Table{Schema: c.SchemaName, Table: c.TableName}
+	if !cat.TableExists(&table) {
+		return nil
+	}
+	filter := ""
+	if c.Op != command.TruncateOp {
+		filter = wherePKDataEqualSQL(c.Column)
+	}
+	q := "SELECT max(__start) FROM " + table.MainSQL() + " WHERE __current AND __origin=$1" + filter +
+		" HAVING max(__start) > $2::timestamptz"
+	var start time.Time
+	err := dp.QueryRow(ctx, q, c.Origin, c.SourceTimestamp).Scan(&start)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return nil
+	case err != nil:
+		return fmt.Errorf("checking current record: %w", err)
+	}
+	return fmt.Errorf("change event at %s is older than the current record, which started at %s",
+		c.SourceTimestamp, start.UTC().Format("2006-01-02 15:04:05.000000Z"))
+}
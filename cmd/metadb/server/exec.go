@@ -17,7 +17,7 @@ import (
 	"github.com/metadb-project/metadb/cmd/metadb/types"
 )
 
-func execCommandGraph(thread int, ctx context.Context, cat *catalog.Catalog, cmdgraph *command.CommandGraph, dp *pgxpool.Pool, source string, uuopt bool, syncMode dsync.Mode, dedup *log.MessageSet) error {
+func execCommandGraph(thread int, ctx context.Context, cat *catalog.Catalog, cmdgraph *command.CommandGraph, dp *pgxpool.Pool, source string, changeLog bool, uuopt bool, syncMode dsync.Mode, dedup *log.MessageSet) error {
 	catalog.ExecMutex.Lock()
 	defer catalog.ExecMutex.Unlock()
 	if cmdgraph.Commands.Len() == 0 {
@@ -27,54 +27,16 @@ func execCommandGraph(thread int, ctx context.Context, cat *catalog.Catalog, cmd
 		ctx:       ctx,
 		dp:        dp,
 		syncIDs:   make(map[dbx.Table][][]any),
-		mergeData: make(map[dbx.Table][][]string),
+		merges:    make(map[dbx.Table]*mergeBatch),
 		syncMode:  syncMode,
+		source:    source,
+		changeLog: changeLog,
 	}
 	txnTime := time.Now()
 	for e := cmdgraph.Commands.Front(); e != nil; e = e.Next() {
-		cmd := e.Value.(*command.Command)
-		if log.IsLevelTrace() {
-			logTraceCommand(thread, cmd)
-		}
-		match, err := execCommand(ebuf, cat, cmd, source, syncMode, dedup)
-		if err != nil {
-			return fmt.Errorf("exec command: %w", err)
-		}
-		if cmd.Subcommands == nil {
-			continue
-		}
-		// This is an "unnecessary update" optimization in which we omit
-		// updating subcommand records if the parent command matched its
-		// equivalent record in the database.
-		if uuopt && match {
-			// We still need to match the transformed records, only in order to get the IDs
-			// to write them to sync tables.
-			if syncMode == dsync.Resync {
-				for f := cmd.Subcommands.Front(); f != nil; f = f.Next() {
-					tcmd := f.Value.(*command.Command)
-					table := &dbx.Table{Schema: tcmd.SchemaName, Table: tcmd.TableName}
-					delta, err := findDeltaSchema(cat, tcmd, table)
-					if err != nil {
-						return fmt.Errorf("finding schema delta: %w", err)
-					}
-					if err = execDeltaSchema(ebuf, cat, tcmd, delta, table); err != nil {
-						return fmt.Errorf("schema: %w", err)
-					}
-					m, id, err := isCurrentIdenticalMatch(ebuf.ctx, tcmd, ebuf.dp, table)
-					if err != nil {
-						return fmt.Errorf("matcher: %w", err)
-					}
-					if m {
-						ebuf.queueSyncID(table, id)
-					}
-				}
-			}
-		} else {
-			for f := cmd.Subcommands.Front(); f != nil; f = f.Next() {
-				if _, err := execCommand(ebuf, cat, f.Value.(*command.Command), source, syncMode, dedup); err != nil {
-					return fmt.Errorf("exec command: %w", err)
-				}
-			}
+		if err := execCommandTree(thread, ebuf, cat, e.Value.(*command.Command), source, uuopt, syncMode,
+			dedup); err != nil {
+			return err
 		}
 	}
 	if err := ebuf.flush(); err != nil {
@@ -86,47 +48,124 @@ func execCommandGraph(thread int, ctx context.Context, cat *catalog.Catalog, cmd
 	return nil
 }
 
-func execCommand(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Command, source string, syncMode dsync.Mode, dedup *log.MessageSet) (bool, error) {
-	// Make schema changes if needed by the command.
-	if cmd.Op == command.MergeOp {
-		table := &dbx.Table{Schema: cmd.SchemaName, Table: cmd.TableName}
-		delta, err := findDeltaSchema(cat, cmd, table)
-		if err != nil {
-			return false, fmt.Errorf("finding schema delta: %w", err)
-		}
-		if err = addTable(ebuf, cmd, cat, table, source); err != nil {
-			return false, fmt.Errorf("schema: %w", err)
-		}
-		if err = addPartition(ebuf, cat, cmd); err != nil {
-			return false, fmt.Errorf("schema: %w", err)
-		}
-		// Note that execDeltaSchema() may adjust data types in cmd.
-		if err = execDeltaSchema(ebuf, cat, cmd, delta, table); err != nil {
-			return false, fmt.Errorf("schema: %w", err)
-		}
-		// Ensure indexes are created on primary key columns.
-		for _, col := range cmd.Column {
-			if col.PrimaryKey != 0 {
-				column := &dbx.Column{Schema: table.Schema, Table: table.Table, Column: col.Name}
-				if cat.IndexExists(column) {
-					continue
+// execCommandTree executes a command and its subcommands.
+func execCommandTree(thread int, ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Command, source string, uuopt bool, syncMode dsync.Mode, dedup *log.MessageSet) error {
+	if log.IsLevelTrace() {
+		logTraceCommand(thread, cmd)
+	}
+	// The match result is only needed for the "unnecessary update"
+	// optimization of subcommands.
+	match, err := execCommand(ebuf, cat, cmd, source, syncMode, dedup, uuopt && cmd.Subcommands != nil)
+	if err != nil {
+		return fmt.Errorf("exec command: %w", err)
+	}
+	if cmd.Subcommands == nil {
+		return nil
+	}
+	// This is an "unnecessary update" optimization in which we omit
+	// updating subcommand records if the parent command matched its
+	// equivalent record in the database.
+	if uuopt && match {
+		// We still need to match the transformed records, only in order to get the IDs
+		// to write them to sync tables.
+		if syncMode == dsync.Resync {
+			for f := cmd.Subcommands.Front(); f != nil; f = f.Next() {
+				tcmd := f.Value.(*command.Command)
+				table := &dbx.Table{Schema: tcmd.SchemaName, Table: tcmd.TableName}
+				if err := execSubcommandSchema(ebuf, cat, tcmd, table); err != nil {
+					return err
 				}
-				if err = ebuf.flush(); err != nil {
-					return false, fmt.Errorf("creating indexes: %w", err)
+				m, id, err := isCurrentIdenticalMatch(ebuf.ctx, tcmd, ebuf.dp, table)
+				if err != nil {
+					return fmt.Errorf("matcher: %w", err)
 				}
-				if err = cat.AddIndex(column); err != nil {
-					return false, err
+				if m {
+					ebuf.queueSyncID(table, id)
 				}
 			}
 		}
+	} else {
+		for f := cmd.Subcommands.Front(); f != nil; f = f.Next() {
+			if _, err := execCommand(ebuf, cat, f.Value.(*command.Command), source, syncMode, dedup,
+				false); err != nil {
+				return fmt.Errorf("exec command: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// execCommand executes a command.  If matchCurrent is true, a merge command
+// is compared with the current record immediately, and true is returned if
+// they are identical.
+func execCommand(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Command, source string, syncMode dsync.Mode, dedup *log.MessageSet, matchCurrent bool) (bool, error) {
+	// Make schema changes if needed by the command.
+	if cmd.Op == command.MergeOp {
+		if err := execCommandSchema(ebuf, cat, cmd, source); err != nil {
+			return false, err
+		}
 	}
-	match, err := execCommandData(ebuf, cat, cmd, syncMode, dedup)
+	match, err := execCommandData(ebuf, cat, cmd, syncMode, dedup, matchCurrent)
 	if err != nil {
 		return false, fmt.Errorf("exec data: %w", err)
 	}
 	return match, nil
 }
 
+// execCommandSchema makes the schema changes needed by a merge command.
+// Schema changes are serialized by catalog.SchemaMutex, so that concurrent
+// workers do not modify the catalog at the same time.
+func execCommandSchema(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Command, source string) error {
+	catalog.SchemaMutex.Lock()
+	defer catalog.SchemaMutex.Unlock()
+	table := &dbx.Table{Schema: cmd.SchemaName, Table: cmd.TableName}
+	delta, err := findDeltaSchema(cat, cmd, table)
+	if err != nil {
+		return fmt.Errorf("finding schema delta: %w", err)
+	}
+	if err = addTable(ebuf, cmd, cat, table, source); err != nil {
+		return fmt.Errorf("schema: %w", err)
+	}
+	if err = addPartition(ebuf, cat, cmd); err != nil {
+		return fmt.Errorf("schema: %w", err)
+	}
+	// Note that execDeltaSchema() may adjust data types in cmd.
+	if err = execDeltaSchema(ebuf, cat, cmd, delta, table); err != nil {
+		return fmt.Errorf("schema: %w", err)
+	}
+	// Ensure indexes are created on primary key columns.
+	for _, col := range cmd.Column {
+		if col.PrimaryKey != 0 {
+			column := &dbx.Column{Schema: table.Schema, Table: table.Table, Column: col.Name}
+			if cat.IndexExists(column) {
+				continue
+			}
+			if err = ebuf.flush(); err != nil {
+				return fmt.Errorf("creating indexes: %w", err)
+			}
+			if err = cat.AddIndex(column); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// execSubcommandSchema makes schema changes to the columns of a transformed
+// table, for a subcommand whose data are not written.
+func execSubcommandSchema(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Command, table *dbx.Table) error {
+	catalog.SchemaMutex.Lock()
+	defer catalog.SchemaMutex.Unlock()
+	delta, err := findDeltaSchema(cat, cmd, table)
+	if err != nil {
+		return fmt.Errorf("finding schema delta: %w", err)
+	}
+	if err = execDeltaSchema(ebuf, cat, cmd, delta, table); err != nil {
+		return fmt.Errorf("schema: %w", err)
+	}
+	return nil
+}
+
 func findDeltaSchema(cat *catalog.Catalog, cmd *command.Command, table *dbx.Table) (*deltaSchema, error) {
 	schema1, err := selectTableSchema(cat, table)
 	if err != nil {
@@ -282,6 +321,35 @@ func execDeltaSchema(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Comman
 			continue
 		}
 
+		// If both the old and new types are arrays, change the column type if the
+		// element types allow a widening conversion as above.
+		if col.oldType.IsArray() && col.newType.IsArray() {
+			if col.oldType.Elem() == types.TextType {
+				// As with text columns, retain the array of text type.
+				for j := range cmd.Column {
+					if cmd.Column[j].Name == col.name {
+						cmd.Column[j].DType = col.oldType
+						cmd.Column[j].DTypeSize = 0
+					}
+				}
+				continue
+			}
+			elem, size, ok := widenArrayElem(col.oldType.Elem(), col.newType.Elem(), col.newTypeSize)
+			if ok && elem == col.oldType.Elem() && size <= col.oldTypeSize {
+				continue
+			}
+			if ok {
+				dtype := types.ArrayOf(elem)
+				if err := ebuf.flush(); err != nil {
+					return fmt.Errorf("altering column %q (%q) type to %v: %v", table, col.name, dtype, err)
+				}
+				if err := alterColumnType(ebuf.dp, cat, table, col.name, dtype, size, false); err != nil {
+					return fmt.Errorf("delta schema: altering column %q (%q) type to %v: %v", table, col.name, dtype, err)
+				}
+				continue
+			}
+		}
+
 		// If not a compatible change, adjust new type to text in all cases, unless it is
 		// already text.
 		if col.oldType != types.TextType {
@@ -299,10 +367,10 @@ func execDeltaSchema(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Comman
 	return nil
 }
 
-func execCommandData(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Command, syncMode dsync.Mode, dedup *log.MessageSet) (bool, error) {
+func execCommandData(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Command, syncMode dsync.Mode, dedup *log.MessageSet, matchCurrent bool) (bool, error) {
 	switch cmd.Op {
 	case command.MergeOp:
-		match, err := execMergeData(ebuf, cmd, syncMode, dedup)
+		match, err := execMergeData(ebuf, cat, cmd, syncMode, dedup, matchCurrent)
 		if err != nil {
 			return false, fmt.Errorf("merge: %w", err)
 		}
@@ -322,22 +390,30 @@ func execCommandData(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Comman
 	}
 }
 
-// execMergeData executes a merge command in the database.
-func execMergeData(ebuf *execbuffer, cmd *command.Command, syncMode dsync.Mode, dedup *log.MessageSet) (bool, error) {
+// execMergeData queues a merge command to be written to the database.
+// Unchanged records are detected when the buffer is flushed, unless
+// matchCurrent is true, in which case the current record is checked
+// immediately and the result returned.
+func execMergeData(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Command, syncMode dsync.Mode, dedup *log.MessageSet, matchCurrent bool) (bool, error) {
 	table := &dbx.Table{Schema: cmd.SchemaName, Table: cmd.TableName}
-	// Check if the current record (if any) is identical to the new one.  If so, we
-	// can avoid making any changes in the database.
-	match, id, err := isCurrentIdenticalMatch(ebuf.ctx, cmd, ebuf.dp, table)
-	if err != nil {
-		return false, fmt.Errorf("matcher: %w", err)
-	}
-	if match {
-		log.Trace("new command matches current record")
-		// If resync mode, write __id to sync table.
-		if syncMode == dsync.Resync {
-			ebuf.queueSyncID(table, id)
+	var err error
+	if matchCurrent {
+		// Check if the current record (if any) is identical to the new one.  If so, we
+		// can avoid making any changes in the database.
+		var match bool
+		var id int64
+		match, id, err = isCurrentIdenticalMatch(ebuf.ctx, cmd, ebuf.dp, table)
+		if err != nil {
+			return false, fmt.Errorf("matcher: %w", err)
+		}
+		if match {
+			log.Trace("new command matches current record")
+			// If resync mode, write __id to sync table.
+			if syncMode == dsync.Resync {
+				ebuf.queueSyncID(table, id)
+			}
+			return true, nil
 		}
-		return true, nil
 	}
 	primaryKeyFilter := wherePKDataEqualSQL(cmd.Column)
 	// If any columns are "unavailable," extract the previous values from the current record.
@@ -349,6 +425,12 @@ func execMergeData(ebuf *execbuffer, cmd *command.Command, syncMode dsync.Mode,
 		}
 	}
 	if len(unavailColumns) != 0 {
+		// Earlier changes to the record may be buffered.
+		if ebuf.merges[*table] != nil {
+			if err = ebuf.flush(); err != nil {
+				return false, err
+			}
+		}
 		var b strings.Builder
 		b.WriteString("SELECT ")
 		for i := range unavailColumns {
@@ -412,50 +494,9 @@ func execMergeData(ebuf *execbuffer, cmd *command.Command, syncMode dsync.Mode,
 			}
 		}
 	}
-	// Set the current row, if any, to __current=FALSE.
-	var b strings.Builder
-	b.WriteString("UPDATE \"")
-	b.WriteString(table.Schema)
-	b.WriteString("\".\"")
-	b.WriteString(table.Table)
-	b.WriteString("__\" SET __end='")
-	b.WriteString(cmd.SourceTimestamp)
-	b.WriteString("',__current='f'")
-	b.WriteString(" WHERE __current AND __origin='")
-	b.WriteString(cmd.Origin)
-	b.WriteByte('\'')
-	b.WriteString(primaryKeyFilter)
-	update := b.String()
-	// Insert the new row.
-	b.Reset()
-	b.WriteString("INSERT INTO \"")
-	b.WriteString(table.Schema)
-	b.WriteString("\".\"")
-	b.WriteString(table.Table)
-	b.WriteString("__\"(__start,__end,__current")
-	if cmd.Origin != "" {
-		b.WriteString(",__origin")
+	if err = ebuf.queueMerge(table, cat.TableSchema(table), cmd); err != nil {
+		return false, err
 	}
-	for i := range columns {
-		b.WriteString(",\"")
-		b.WriteString(columns[i].Name)
-		b.WriteByte('"')
-	}
-	b.WriteString(")VALUES('")
-	b.WriteString(cmd.SourceTimestamp)
-	b.WriteString("','9999-12-31 00:00:00Z','t'")
-	if cmd.Origin != "" {
-		b.WriteString(",'")
-		b.WriteString(cmd.Origin)
-		b.WriteByte('\'')
-	}
-	for i := range columns {
-		b.WriteString(",")
-		encodeSQLData(&b, columns[i].SQLData, columns[i].DType)
-	}
-	b.WriteString(") RETURNING __id")
-	insert := b.String()
-	ebuf.queueMergeData(table, &update, &insert)
 	return false, nil
 }
 
@@ -575,14 +616,25 @@ func execDeleteData(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Command
 	}
 	pkeyFilter := wherePKDataEqualSQL(cmd.Column)
 	rootFilter := wherePKDataEqualSQL(rootKey(cmd.Column))
+	var key []string
+	for _, col := range command.PrimaryKeyColumns(cmd.Column) {
+		key = append(key, col.Name)
+	}
 	// Find matching current records in table and descendants, and mark as not current.
 	batch := pgx.Batch{}
 	cat.TraverseDescendantTables(dbx.Table{Schema: cmd.SchemaName, Table: cmd.TableName},
 		func(level int, table dbx.Table) {
 			filter := selectFilter(level, pkeyFilter, rootFilter)
-			batch.Queue("UPDATE " + table.MainSQL() +
+			q := "UPDATE " + table.MainSQL() +
 				" SET __end='" + cmd.SourceTimestamp + "',__current=FALSE WHERE __current AND __origin='" +
-				cmd.Origin + "'" + filter)
+				cmd.Origin + "'" + filter
+			// Only changes to the table itself are recorded in the
+			// change log, not to its transformed tables.
+			if level == 0 && ebuf.changeLog {
+				q = "WITH d AS (" + q + returningSQL(key) + ") " +
+					ebuf.changeLogSQL("delete", &table, key, "d", "'"+cmd.SourceTimestamp+"'")
+			}
+			batch.Queue(q)
 		})
 	if err := ebuf.dp.SendBatch(ebuf.ctx, &batch).Close(); err != nil {
 		return fmt.Errorf("exec delete data: %w", err)
@@ -628,13 +680,38 @@ func wherePKDataEqualSQL(columns []command.CommandColumn) string {
 	return b.String()
 }
 
+// widenArrayElem returns the element type and size to which an array
+// column can be changed when its elements change from oldElem to newElem,
+// following the rules for scalar columns.  It returns false if there is no
+// such conversion.
+func widenArrayElem(oldElem, newElem types.DataType, newSize int64) (types.DataType, int64, bool) {
+	switch {
+	case oldElem == types.IntegerType && newElem == types.IntegerType:
+		return types.IntegerType, newSize, true
+	case oldElem == types.FloatType && newElem == types.FloatType,
+		oldElem == types.IntegerType && newElem == types.FloatType:
+		return types.FloatType, newSize, true
+	case (oldElem == types.IntegerType || oldElem == types.FloatType) && newElem == types.NumericType,
+		oldElem == types.FloatType && newElem == types.IntegerType:
+		return types.NumericType, 0, true
+	case oldElem == types.NumericType && (newElem == types.IntegerType || newElem == types.FloatType):
+		return types.NumericType, 0, true
+	default:
+		return 0, 0, false
+	}
+}
+
 func encodeSQLData(b *strings.Builder, sqldata *string, datatype types.DataType) {
 	if sqldata == nil {
 		b.WriteString("NULL")
 		return
 	}
+	if datatype.IsArray() {
+		dbx.EncodeString(b, *sqldata)
+		return
+	}
 	switch datatype {
-	case types.TextType, types.JSONType:
+	case types.TextType, types.JSONType, types.ByteaType, types.IntervalType:
 		dbx.EncodeString(b, *sqldata)
 	case types.UUIDType, types.DateType, types.TimeType, types.TimetzType, types.TimestampType, types.TimestamptzType:
 		b.WriteByte('\'')
@@ -660,6 +737,9 @@ func execTruncateData(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Comma
 		func(level int, table dbx.Table) {
 			batch.Queue("UPDATE " + table.MainSQL() + " SET __end='" +
 				cmd.SourceTimestamp + "',__current=FALSE WHERE __current AND __origin='" + cmd.Origin + "'")
+			if level == 0 && ebuf.changeLog {
+				batch.Queue(ebuf.changeLogSQL("truncate", &table, nil, "", "'"+cmd.SourceTimestamp+"'"))
+			}
 		})
 	if err := ebuf.dp.SendBatch(ebuf.ctx, &batch).Close(); err != nil {
 		return fmt.Errorf("exec truncate data: %w", err)
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/metadb-project/metadb/cmd/metadb/change"
+	"github.com/metadb-project/metadb/cmd/metadb/log"
+)
+
+// kafkaSource is a change event source that reads from a Kafka consumer.
+// If a schema registry is defined, messages in Avro format are converted to
+// JSON.
+type kafkaSource struct {
+	consumer *kafka.Consumer
+	registry *change.SchemaRegistry
+}
+
+func (s *kafkaSource) Read(timeout time.Duration) (*change.Message, error) {
+	ev := s.consumer.Poll(int(timeout.Milliseconds()))
+	if ev == nil {
+		return nil, nil
+	}
+	switch e := ev.(type) {
+	case *kafka.Message:
+		var topic string
+		if e.TopicPartition.Topic != nil {
+			topic = *e.TopicPartition.Topic
+		}
+		msg := &change.Message{
+			Key:      e.Key,
+			Value:    e.Value,
+			Topic:    topic,
+			Position: fmt.Sprintf("%s[%d]@%s", topic, e.TopicPartition.Partition, e.TopicPartition.Offset),
+		}
+		if s.registry != nil {
+			var err error
+			if msg.Key, err = s.registry.Decode(e.Key); err != nil {
+				return nil, fmt.Errorf("%s: key: %w", msg.Position, err)
+			}
+			if msg.Value, err = s.registry.Decode(e.Value); err != nil {
+				return nil, fmt.Errorf("%s: value: %w", msg.Position, err)
+			}
+		}
+		return msg, nil
+	//case kafka.PartitionEOF:
+	//	log.Trace("%s", e)
+	//	return nil, nil
+	case kafka.Error:
+		// In general, errors from the Kafka
+		// client can be reported and ignored,
+		// because the client will
+		// automatically try to recover.
+		if e.IsFatal() {
+			log.Warning("Kafka poll: %v", e)
+		} else {
+			log.Info("Kafka poll: %v", e)
+		}
+		// We could take some action if
+		// desired:
+		//if e.Code() == kafka.ErrAllBrokersDown {
+		//        // some action
+		//}
+	default:
+		log.Debug("ignoring: %v", e)
+	}
+	return nil, nil
+}
+
+// Commit commits the consumer offsets.  Errors are logged rather than
+// returned, because the offsets will be committed again at the next
+// checkpoint.
+func (s *kafkaSource) Commit() error {
+	if _, err := s.consumer.Commit(); err != nil {
+		var e kafka.Error
+		if !errors.As(err, &e) {
+			log.Warning("Kafka commit: %v", err)
+			return nil
+		}
+		if e.IsFatal() {
+			//return fmt.Errorf("Kafka commit: %v", e)
+			log.Warning("Kafka commit: %v", e)
+		} else {
+			switch e.Code() {
+			case kafka.ErrNoOffset:
+				log.Debug("Kafka commit: %v", e)
+			default:
+				log.Info("Kafka commit: %v", e)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *kafkaSource) Close() error {
+	return s.consumer.Close()
+}
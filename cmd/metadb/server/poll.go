@@ -4,9 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"regexp"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -29,44 +31,149 @@ func goPollLoop(ctx context.Context, cat *catalog.Catalog, svr *server) {
 	if svr.opt.NoKafkaCommit {
 		log.Info("Kafka commits disabled")
 	}
-	var spr *sproc
-	var err error
-	// For now, we support only one source
-	spr, err = waitForConfig(svr)
-	if err != nil {
-		log.Fatal("%s", err)
-		os.Exit(1)
+	// Set up source log
+	if svr.opt.LogSource != "" {
+		var err error
+		if svr.sourceLog, err = log.NewSourceLog(svr.opt.LogSource); err != nil {
+			log.Fatal("%s", err)
+			os.Exit(1)
+		}
 	}
 
-	err = logSyncMode(svr.dp, spr.source.Name)
-	if err != nil {
-		log.Fatal("%s", err)
-		os.Exit(1)
+	if svr.opt.Script {
+		spr, err := waitForConfig(svr)
+		if err != nil {
+			log.Fatal("%s", err)
+			os.Exit(1)
+		}
+		sourcePollLoop(ctx, cat, svr, spr)
+		return
 	}
 
-	folio, err := isFolioModulePresent(svr.db)
-	if err != nil {
-		log.Error("checking for folio module: %v", err)
-	}
-	reshare, err := isReshareModulePresent(svr.db)
-	if err != nil {
-		log.Error("checking for reshare module: %v", err)
+	go goMaintenance(svr.opt.Datadir, *(svr.db), svr.dp, cat, &svr.state.sources)
+
+	// Start a poll loop for each enabled source, and continue checking for
+	// changes to the source configuration.  When a source is altered,
+	// disabled, or dropped, its poll loop is stopped at the next checkpoint
+	// and, if the source is still enabled, restarted with the new
+	// configuration.
+	var running = make(map[string]*sproc)
+	for {
+		sources, err := sysdb.ReadSourceConnectors(svr.db)
+		if err != nil {
+			log.Error("reading data sources: %v", err)
+			time.Sleep(2 * time.Second)
+			continue
+		}
+		var config = make(map[string]*sysdb.SourceConnector)
+		for _, src := range sources {
+			config[src.Name] = src
+		}
+		for name, spr := range running {
+			if spr.stopRequested() {
+				if spr.stopped() {
+					delete(running, name)
+					svr.state.sources.Remove(name)
+					log.Info("stopped data source %q", name)
+				}
+				continue
+			}
+			src, ok := config[name]
+			switch {
+			case !ok:
+				log.Info("data source %q dropped; stopping", name)
+				spr.requestStop()
+			case !src.Enable:
+				log.Info("data source %q disabled; stopping", name)
+				spr.requestStop()
+			case !sourceConfigEqual(spr.source, src):
+				log.Info("data source %q altered; restarting", name)
+				spr.requestStop()
+			}
+		}
+		for _, src := range sources {
+			if _, ok := running[src.Name]; ok || !src.Enable {
+				continue
+			}
+			src.Status.Stream.Waiting()
+			svr.state.sources.Add(src)
+			spr := newSproc(svr, src)
+			running[src.Name] = spr
+			go sourcePollLoop(ctx, cat, svr, spr)
+		}
+		time.Sleep(2 * time.Second)
 	}
-	if !svr.opt.Script {
-		go goMaintenance(svr.opt.Datadir, *(svr.db), svr.dp, cat, spr.source.Name, folio, reshare)
+}
+
+// sourceConfigEqual returns true if the two source connectors have the same
+// configuration.
+func sourceConfigEqual(a, b *sysdb.SourceConnector) bool {
+	return a.Type == b.Type &&
+		a.Brokers == b.Brokers &&
+		a.Security == b.Security &&
+		slices.Equal(a.Topics, b.Topics) &&
+		a.Group == b.Group &&
+		a.SchemaRegistry == b.SchemaRegistry &&
+		a.Flattened == b.Flattened &&
+		a.Schemaless == b.Schemaless &&
+		a.DeadLetter == b.DeadLetter &&
+		a.DeadLetterTopic == b.DeadLetterTopic &&
+		slices.Equal(a.SchemaPassFilter, b.SchemaPassFilter) &&
+		slices.Equal(a.SchemaStopFilter, b.SchemaStopFilter) &&
+		slices.Equal(a.TableStopFilter, b.TableStopFilter) &&
+		slices.Equal(a.ColumnStopFilter, b.ColumnStopFilter) &&
+		slices.Equal(a.ColumnMask, b.ColumnMask) &&
+		a.ColumnMaskSalt == b.ColumnMaskSalt &&
+		a.TrimSchemaPrefix == b.TrimSchemaPrefix &&
+		a.AddSchemaPrefix == b.AddSchemaPrefix &&
+		a.MapPublicSchema == b.MapPublicSchema &&
+		slices.Equal(a.SchemaRename, b.SchemaRename) &&
+		slices.Equal(a.TableRename, b.TableRename) &&
+		a.Module == b.Module &&
+		a.Path == b.Path &&
+		a.Connection == b.Connection &&
+		a.Publication == b.Publication &&
+		a.Slot == b.Slot &&
+		a.ChangeLog == b.ChangeLog
+}
+
+// sourcePollLoop runs the poll loop for a single source, restarting it after
+// an error, until a stop is requested.
+func sourcePollLoop(ctx context.Context, cat *catalog.Catalog, svr *server, spr *sproc) {
+	defer close(spr.done)
+
+	if err := logSyncMode(svr.dp, spr.source.Name); err != nil {
+		log.Error("source %q: %v", spr.source.Name, err)
 	}
 
 	for {
 		err := launchPollLoop(ctx, cat, svr, spr)
-		if err == nil {
+		if err == nil || spr.stopRequested() {
 			break
 		}
 		spr.source.Status.Stream.Error()
-		if !svr.opt.Script {
-			time.Sleep(24 * time.Hour)
-		} else {
-			time.Sleep(1 * time.Hour)
+		initial, maximum, cerr := getConfigRetryIntervals(cat)
+		if cerr != nil {
+			log.Error("source %q: %v", spr.source.Name, cerr)
+			initial, maximum = defaultRetryInitialInterval, defaultRetryMaxInterval
+		}
+		// The number of attempts is reset when a checkpoint completes.
+		attempts := spr.source.Status.Retry.Get().Attempts + 1
+		class := classifyError(err)
+		wait := retryDelay(class, attempts, initial, maximum)
+		spr.source.Status.Retry.Wait(status.RetryState{
+			Attempts: attempts,
+			Class:    class,
+			Error:    err.Error(),
+			Next:     time.Now().Add(wait),
+		})
+		log.Info("source %q: %s error; retry %d in %s", spr.source.Name, class, attempts, wait)
+		select {
+		case <-spr.stop:
+			return
+		case <-time.After(wait):
 		}
+		spr.source.Status.Retry.Retrying()
 	}
 }
 
@@ -101,22 +208,14 @@ func launchPollLoop(ctx context.Context, cat *catalog.Catalog, svr *server, spr
 	}()
 	reterr = outerPollLoop(ctx, cat, svr, spr)
 	if reterr != nil {
-		panic(reterr.Error())
+		log.Error("%s", reterr)
 	}
 	return
 }
 
 func outerPollLoop(ctx context.Context, cat *catalog.Catalog, svr *server, spr *sproc) error {
-	var err error
-	// Set up source log
-	if svr.opt.LogSource != "" {
-		if spr.sourceLog, err = log.NewSourceLog(svr.opt.LogSource); err != nil {
-			return err
-		}
-	}
-
-	log.Debug("starting stream processor")
-	if err = pollLoop(ctx, cat, spr); err != nil {
+	log.Debug("starting stream processor for source %q", spr.source.Name)
+	if err := pollLoop(ctx, cat, spr); err != nil {
 		//log.Error("%s", err)
 		return err
 	}
@@ -201,21 +300,134 @@ func pollLoop(ctx context.Context, cat *catalog.Catalog, spr *sproc) error {
 	if err != nil {
 		return err
 	}
+	spr.renames, err = command.NewRenameRules(spr.source.Module, spr.source.SchemaRename, spr.source.TableRename)
+	if err != nil {
+		return err
+	}
+	spr.columnRules, err = command.NewColumnRules(spr.source.ColumnStopFilter, spr.source.ColumnMask,
+		spr.source.ColumnMaskSalt)
+	if err != nil {
+		return err
+	}
+	if err = checkUnmaskedEvents(cat, spr); err != nil {
+		return err
+	}
 	if spr.svr.opt.Script {
 		var errString string
-		processStream(0, nil, ctx, cat, spr, syncMode, dedup, nil, nil, 0, &errString)
+		var eof bool
+		processStream(0, nil, ctx, cat, spr, syncMode, dedup, nil, nil, nil, 0, &errString, &eof)
 		if errString != "" {
 			spr.source.Status.Stream.Error()
 			return errors.New(errString)
 		}
 		return nil
 	}
+	var checkpointSegmentSize int
+	if checkpointSegmentSize, err = getConfigCheckpointSegmentSize(cat); err != nil {
+		return err
+	}
+	if spr.applyWorkers, err = getConfigApplyConcurrency(cat); err != nil {
+		return err
+	}
+	// Concurrent workers commit in no particular order, which would allow
+	// a consumer of the change log to pass over entries that are not yet
+	// committed.
+	if spr.source.ChangeLog && spr.applyWorkers > 1 {
+		log.Info("source %q: change log enabled; applying changes sequentially", spr.source.Name)
+		spr.applyWorkers = 1
+	}
+	deadLetters, err := newDeadLetterWriter(spr)
+	if err != nil {
+		return err
+	}
+	defer deadLetters.close()
+
+	var rebalanceFlag int32 // Atomic used to signal a rebalance
+	var sources []change.Source
+	switch spr.source.Type {
+	case "file":
+		sources, err = openFileSource(spr)
+	case "postgresql":
+		sources, err = openPostgresqlSource(ctx, spr)
+	default:
+		sources, err = openKafkaSources(cat, spr, syncMode, &rebalanceFlag)
+	}
+	if err != nil {
+		spr.source.Status.Stream.Error()
+		return err
+	}
+	defer func(sources []change.Source) {
+		for _, source := range sources {
+			_ = source.Close()
+		}
+	}(sources)
+	var sourcesN = len(sources)
+
+	spr.source.Status.Stream.Active()
+
+	// One thread (goroutine) per source runs a stream processor in a loop.
+	// When a rebalance occurs, we synchronize the threads to prevent out-of-order database writes.
+	var firstEvent int32 // Atomic used to log that data have been received
+	atomic.StoreInt32(&firstEvent, int32(1))
+	for {
+		var waitStreamProcs sync.WaitGroup
+		errStrings := make([]string, sourcesN)
+		eofs := make([]bool, sourcesN)
+		atomic.StoreInt32(&rebalanceFlag, int32(0)) // Reset
+		for i := 0; i < sourcesN; i++ {
+			waitStreamProcs.Add(1)
+			go func(thread int, source change.Source, ctx context.Context, cat *catalog.Catalog, spr *sproc, syncMode dsync.Mode, dedup *log.MessageSet, rebalanceFlag *int32, firstEvent *int32, errString *string, eof *bool) {
+				defer waitStreamProcs.Done()
+				processStream(thread, source, ctx, cat, spr, syncMode, dedup, deadLetters, rebalanceFlag, firstEvent, checkpointSegmentSize, errString, eof)
+			}(i, sources[i], ctx, cat, spr, syncMode, dedup, &rebalanceFlag, &firstEvent, &(errStrings[i]), &(eofs[i]))
+		}
+
+		waitStreamProcs.Wait() // Synchronize the threads
+
+		// TODO This error handling is not quite right.
+		for i := 0; i < sourcesN; i++ {
+			if errStrings[i] != "" {
+				spr.source.Status.Stream.Error()
+				return errors.New(errStrings[i])
+			}
+		}
+		spr.source.Status.Retry.Clear()
+		if spr.svr.opt.Script {
+			break
+		}
+		// Dead letters marked for retry are processed between
+		// checkpoints, while the stream processors are stopped.
+		if err = retryDeadLetters(ctx, cat, spr, syncMode, dedup); err != nil {
+			spr.source.Status.Stream.Error()
+			return err
+		}
+		// A source that reaches the end of its input, such as a file
+		// source, is finished.
+		if !slices.Contains(eofs, false) {
+			log.Info("source %q: end of input", spr.source.Name)
+			spr.source.Status.Stream.Inactive()
+			break
+		}
+		// All threads have completed their checkpoints, and the
+		// sources will be closed on return.
+		if spr.stopRequested() {
+			spr.source.Status.Stream.Inactive()
+			break
+		}
+	}
+	return nil
+}
+
+// openKafkaSources creates the Kafka consumers for a source and subscribes
+// them to the source topics.  The rebalance callback sets rebalanceFlag.
+func openKafkaSources(cat *catalog.Catalog, spr *sproc, syncMode dsync.Mode, rebalanceFlag *int32) ([]change.Source, error) {
 	var brokers = spr.source.Brokers
 	var topics = spr.source.Topics
 	var group = spr.source.Group
 	var maxPollInterval int
+	var err error
 	if maxPollInterval, err = getConfigMaxPollInterval(cat); err != nil {
-		return err
+		return nil, err
 	}
 	log.Debug("connecting to %q, topics %q", brokers, topics)
 	log.Debug("connecting to source %q", spr.source.Name)
@@ -232,11 +444,6 @@ func pollLoop(ctx context.Context, cat *catalog.Catalog, spr *sproc) error {
 		"security.protocol":             spr.source.Security,
 	}
 
-	var checkpointSegmentSize int
-	if checkpointSegmentSize, err = getConfigCheckpointSegmentSize(cat); err != nil {
-		return err
-	}
-
 	var consumersN int // Number of concurrent consumers
 	if syncMode == dsync.NoSync {
 		// During normal operation, we run single-threaded to give priority to user queries.
@@ -246,11 +453,11 @@ func pollLoop(ctx context.Context, cat *catalog.Catalog, spr *sproc) error {
 		var kafkaConcurrency string
 		kafkaConcurrency, err = cat.GetConfig("kafka_sync_concurrency")
 		if err != nil {
-			return err
+			return nil, err
 		}
 		consumersN, err = strconv.Atoi(kafkaConcurrency)
 		if err != nil {
-			return fmt.Errorf("invalid value %q for kafka_sync_concurrency", kafkaConcurrency)
+			return nil, fmt.Errorf("invalid value %q for kafka_sync_concurrency", kafkaConcurrency)
 		}
 		if consumersN < 1 {
 			consumersN = 1
@@ -259,68 +466,56 @@ func pollLoop(ctx context.Context, cat *catalog.Catalog, spr *sproc) error {
 			consumersN = 32
 		}
 	}
+	// Avro messages are decoded using schemas from the registry, which
+	// is shared by the consumers.
+	var registry *change.SchemaRegistry
+	if spr.source.SchemaRegistry != "" {
+		registry = change.NewSchemaRegistry(spr.source.SchemaRegistry)
+	}
 	// First create the consumers.
-	consumers := make([]*kafka.Consumer, consumersN)
+	sources := make([]change.Source, consumersN)
 	for i := 0; i < consumersN; i++ {
-		consumers[i], err = kafka.NewConsumer(config)
+		var consumer *kafka.Consumer
+		consumer, err = kafka.NewConsumer(config)
 		if err != nil {
 			for j := 0; j < i; j++ {
-				_ = consumers[j].Close()
+				_ = sources[j].Close()
 			}
-			spr.source.Status.Stream.Error()
-			return err
+			return nil, err
 		}
+		sources[i] = &kafkaSource{consumer: consumer, registry: registry}
 	}
-	defer func(consumers []*kafka.Consumer) {
-		for i := 0; i < consumersN; i++ {
-			_ = consumers[i].Close()
-		}
-	}(consumers)
 	// Next subscribe to the topics and register a rebalance callback which sets rebalanceFlag.
-	var rebalanceFlag int32 // Atomic used to signal a rebalance
 	for i := 0; i < consumersN; i++ {
-		err = consumers[i].SubscribeTopics(topics, func(c *kafka.Consumer, event kafka.Event) error {
-			atomic.StoreInt32(&rebalanceFlag, int32(1))
+		err = sources[i].(*kafkaSource).consumer.SubscribeTopics(topics, func(c *kafka.Consumer, event kafka.Event) error {
+			atomic.StoreInt32(rebalanceFlag, int32(1))
 			return nil
 		})
 		if err != nil {
-			spr.source.Status.Stream.Error()
-			return err
+			for j := 0; j < consumersN; j++ {
+				_ = sources[j].Close()
+			}
+			return nil, err
 		}
 	}
+	return sources, nil
+}
 
-	spr.source.Status.Stream.Active()
-
-	// One thread (goroutine) per consumer runs a stream processor in a loop.
-	// When a rebalance occurs, we synchronize the threads to prevent out-of-order database writes.
-	var firstEvent int32 // Atomic used to log that data have been received
-	atomic.StoreInt32(&firstEvent, int32(1))
-	for {
-		var waitStreamProcs sync.WaitGroup
-		errStrings := make([]string, consumersN)
-		atomic.StoreInt32(&rebalanceFlag, int32(0)) // Reset
-		for i := 0; i < consumersN; i++ {
-			waitStreamProcs.Add(1)
-			go func(thread int, consumer *kafka.Consumer, ctx context.Context, cat *catalog.Catalog, spr *sproc, syncMode dsync.Mode, dedup *log.MessageSet, rebalanceFlag *int32, firstEvent *int32, errString *string) {
-				defer waitStreamProcs.Done()
-				processStream(thread, consumer, ctx, cat, spr, syncMode, dedup, rebalanceFlag, firstEvent, checkpointSegmentSize, errString)
-			}(i, consumers[i], ctx, cat, spr, syncMode, dedup, &rebalanceFlag, &firstEvent, &(errStrings[i]))
-		}
-
-		waitStreamProcs.Wait() // Synchronize the threads
-
-		// TODO This error handling is not quite right.
-		for i := 0; i < consumersN; i++ {
-			if errStrings[i] != "" {
-				spr.source.Status.Stream.Error()
-				return errors.New(errStrings[i])
-			}
-		}
-		if spr.svr.opt.Script {
-			break
-		}
+// openFileSource opens a file source, resuming from the position stored in
+// the catalog.
+func openFileSource(spr *sproc) ([]change.Source, error) {
+	position, err := sysdb.ReadSourcePosition(spr.svr.dp, spr.source.Name)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	log.Debug("reading source %q from %q", spr.source.Name, spr.source.Path)
+	source, err := change.NewFileSource(spr.source.Path, position, func(position string) error {
+		return sysdb.WriteSourcePosition(spr.svr.dp, spr.source.Name, position)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return []change.Source{source}, nil
 }
 
 func getConfigMaxPollInterval(cat *catalog.Catalog) (int, error) {
@@ -338,6 +533,51 @@ func getConfigMaxPollInterval(cat *catalog.Catalog) (int, error) {
 	return maxPollInterval, nil
 }
 
+// getConfigApplyConcurrency returns the number of concurrent workers that
+// apply commands, limited to the range 1 to maxApplyWorkers.
+// checkUnmaskedEvents returns an error if change events of a source with
+// column stop filters or masking rules would be written to the source log
+// or as dead letters.  These contain the events as read, before any columns
+// are filtered or masked, and so they are only allowed if enabled by the
+// configuration parameter allow_unmasked_events.
+func checkUnmaskedEvents(cat *catalog.Catalog, spr *sproc) error {
+	if spr.columnRules == nil {
+		return nil
+	}
+	var writers []string
+	if spr.sourceLog != nil {
+		writers = append(writers, "source log")
+	}
+	if spr.source.DeadLetter != "" {
+		writers = append(writers, "dead letters")
+	}
+	if len(writers) == 0 {
+		return nil
+	}
+	allow, err := cat.GetConfig("allow_unmasked_events")
+	if err != nil {
+		return err
+	}
+	if allow != "true" {
+		return fmt.Errorf("source %q: %s would contain values that are not masked; "+
+			"set allow_unmasked_events to 'true' to allow this", spr.source.Name, strings.Join(writers, " and "))
+	}
+	log.Warning("source %q: %s contain values that are not masked", spr.source.Name, strings.Join(writers, " and "))
+	return nil
+}
+
+func getConfigApplyConcurrency(cat *catalog.Catalog) (int, error) {
+	c, err := cat.GetConfig("apply_concurrency")
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(c)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q for apply_concurrency", c)
+	}
+	return max(1, min(n, maxApplyWorkers)), nil
+}
+
 func getConfigCheckpointSegmentSize(cat *catalog.Catalog) (int, error) {
 	var c string
 	var err error
@@ -353,7 +593,7 @@ func getConfigCheckpointSegmentSize(cat *catalog.Catalog) (int, error) {
 	return checkpointSegmentSize, nil
 }
 
-func processStream(thread int, consumer *kafka.Consumer, ctx context.Context, cat *catalog.Catalog, spr *sproc, syncMode dsync.Mode, dedup *log.MessageSet, rebalanceFlag *int32, firstEvent *int32, checkpointSegmentSize int, errString *string) {
+func processStream(thread int, source change.Source, ctx context.Context, cat *catalog.Catalog, spr *sproc, syncMode dsync.Mode, dedup *log.MessageSet, deadLetters *deadLetterWriter, rebalanceFlag *int32, firstEvent *int32, checkpointSegmentSize int, errString *string, eof *bool) {
 	// Parameters spr and syncMode are not thread-safe and should not be modified during stream processing.
 
 	for { // Stream processing main loop
@@ -363,10 +603,11 @@ func processStream(thread int, consumer *kafka.Consumer, ctx context.Context, ca
 		var err error
 		// Parse
 		if !spr.svr.opt.Script {
-			eventReadCount, err = parseChangeEvents(cat, dedup, consumer, cmdgraph, spr.schemaPassFilter,
+			eventReadCount, *eof, err = parseChangeEvents(cat, dedup, source, eventFormat(spr.source), cmdgraph,
+				spr.schemaPassFilter,
 				spr.schemaStopFilter, spr.tableStopFilter, spr.source.TrimSchemaPrefix,
-				spr.source.AddSchemaPrefix, spr.source.MapPublicSchema, spr.sourceLog,
-				checkpointSegmentSize)
+				spr.source.AddSchemaPrefix, spr.source.MapPublicSchema, spr.renames, spr.columnRules,
+				spr.sourceLog, deadLetters, checkpointSegmentSize)
 			if err != nil {
 				*errString = fmt.Sprintf("parser: %v", err)
 				return
@@ -387,28 +628,32 @@ func processStream(thread int, consumer *kafka.Consumer, ctx context.Context, ca
 		}
 
 		// Execute
-		if err = execCommandGraph(thread, ctx, cat, cmdgraph, spr.svr.dp, spr.source.Name, spr.svr.opt.UUOpt, syncMode, dedup); err != nil {
-			*errString = fmt.Sprintf("executor: %v", err)
-			return
+		if spr.applyWorkers > 1 {
+			err = execCommandGraphParallel(thread, ctx, cat, cmdgraph, spr.svr.dp, spr.source.Name,
+				spr.source.ChangeLog, spr.svr.opt.UUOpt, syncMode, dedup, spr.applyWorkers)
+		} else {
+			err = execCommandGraph(thread, ctx, cat, cmdgraph, spr.svr.dp, spr.source.Name, spr.source.ChangeLog,
+				spr.svr.opt.UUOpt, syncMode, dedup)
+		}
+		if err != nil {
+			if deadLetters == nil || classifyError(err) == retryConnection {
+				*errString = fmt.Sprintf("executor: %v", err)
+				return
+			}
+			// Find the commands that failed.
+			log.Warning("[%d] executor: %v; applying commands separately", thread, err)
+			if err = execCommandsSeparately(thread, ctx, cat, cmdgraph, spr, syncMode, dedup, deadLetters); err != nil {
+				*errString = fmt.Sprintf("executor: %v", err)
+				return
+			}
 		}
 
 		if !spr.svr.opt.Script {
-			// Commit Kafka consumer
+			// Commit source position
 			if eventReadCount > 0 && !spr.svr.opt.NoKafkaCommit {
-				_, err = consumer.Commit()
-				if err != nil {
-					e := err.(kafka.Error)
-					if e.IsFatal() {
-						//return fmt.Errorf("Kafka commit: %v", e)
-						log.Warning("Kafka commit: %v", e)
-					} else {
-						switch e.Code() {
-						case kafka.ErrNoOffset:
-							log.Debug("Kafka commit: %v", e)
-						default:
-							log.Info("Kafka commit: %v", e)
-						}
-					}
+				if err = source.Commit(); err != nil {
+					*errString = fmt.Sprintf("commit: %v", err)
+					return
 				}
 			}
 		}
@@ -431,42 +676,61 @@ func processStream(thread int, consumer *kafka.Consumer, ctx context.Context, ca
 			}
 		}
 
-		if !spr.svr.opt.Script {
-			if atomic.LoadInt32(rebalanceFlag) == 1 { // Exit thread on rebalance
-				log.Trace("[%d] rebalance", thread)
-				break
-			}
-		}
-
 		if spr.svr.opt.Script {
 			break
 		}
+		if *eof { // Exit thread at end of input
+			log.Trace("[%d] end of input", thread)
+			break
+		}
+		if atomic.LoadInt32(rebalanceFlag) == 1 { // Exit thread on rebalance
+			log.Trace("[%d] rebalance", thread)
+			break
+		}
+		if spr.stopRequested() { // Exit thread at checkpoint when source is stopped
+			log.Trace("[%d] stop", thread)
+			break
+		}
 	}
 
 }
 
-func parseChangeEvents(cat *catalog.Catalog, dedup *log.MessageSet, consumer *kafka.Consumer, cmdgraph *command.CommandGraph, schemaPassFilter, schemaStopFilter, tableStopFilter []*regexp.Regexp, trimSchemaPrefix, addSchemaPrefix, mapPublicSchema string, sourceLog *log.SourceLog, checkpointSegmentSize int) (int, error) {
-	kafkaPollTimeout := 100     // Poll timeout in milliseconds.
-	pollTimeoutCountLimit := 20 // Maximum allowable number of consecutive poll timeouts.
-	pollLoopTimeout := 120.0    // Overall pool loop timeout in seconds.
+// eventFormat returns the format of change events read from a source.
+func eventFormat(src *sysdb.SourceConnector) command.EventFormat {
+	return command.EventFormat{Flattened: src.Flattened, Schemaless: src.Schemaless}
+}
+
+// parseChangeEvents reads change events from a source and adds the
+// resulting commands to cmdgraph.  It returns the number of events read, and
+// true if the end of the source was reached.
+func parseChangeEvents(cat *catalog.Catalog, dedup *log.MessageSet, source change.Source, format command.EventFormat, cmdgraph *command.CommandGraph, schemaPassFilter, schemaStopFilter, tableStopFilter []*regexp.Regexp, trimSchemaPrefix, addSchemaPrefix, mapPublicSchema string, renames *command.RenameRules, columnRules *command.ColumnRules, sourceLog *log.SourceLog, deadLetters *deadLetterWriter, checkpointSegmentSize int) (int, bool, error) {
+	pollTimeout := 100 * time.Millisecond // Poll timeout.
+	pollTimeoutCountLimit := 20           // Maximum allowable number of consecutive poll timeouts.
+	pollLoopTimeout := 120.0              // Overall pool loop timeout in seconds.
 	snapshot := false
+	var eof bool
 	var eventReadCount int
 	pollTimeoutCount := 0
 	startTime := time.Now()
 	for x := 0; x < checkpointSegmentSize; x++ {
 		// Catch the possibility of many poll timeouts between messages, because each
-		// poll timeouts takes kafkaPollTimeout ms.  This also provides an overall timeout
+		// poll timeouts takes pollTimeout.  This also provides an overall timeout
 		// for the poll loop.
 		if time.Since(startTime).Seconds() >= pollLoopTimeout {
 			log.Trace("poll timeout")
 			break
 		}
-		var err error
-		var msg *kafka.Message
-		if msg, err = readChangeEvent(consumer, sourceLog, kafkaPollTimeout); err != nil {
-			return 0, fmt.Errorf("reading message from Kafka: %w", err)
+		c, snap, ok, err := readCommand(cat, dedup, source, format, pollTimeout, schemaPassFilter, schemaStopFilter,
+			tableStopFilter, trimSchemaPrefix, addSchemaPrefix, mapPublicSchema, renames, columnRules, sourceLog,
+			deadLetters)
+		if errors.Is(err, io.EOF) {
+			eof = true
+			break
 		}
-		if msg == nil { // Poll timeout is indicated by the nil return.
+		if err != nil {
+			return 0, false, err
+		}
+		if !ok { // Poll timeout
 			pollTimeoutCount++
 			if pollTimeoutCount >= pollTimeoutCountLimit {
 				break // Prevent processing of a small batch from being delayed.
@@ -477,26 +741,15 @@ func parseChangeEvents(cat *catalog.Catalog, dedup *log.MessageSet, consumer *ka
 			pollTimeoutCount = 0 // We are only interested in consecutive timeouts.
 		}
 		eventReadCount++
-
-		var ce *change.Event
-		ce, err = change.NewEvent(msg)
-		if err != nil {
-			log.Error("%s", err)
-			ce = nil
-		}
-
-		c, snap, err := command.NewCommand(cat, dedup, ce, schemaPassFilter, schemaStopFilter, tableStopFilter,
-			trimSchemaPrefix, addSchemaPrefix, mapPublicSchema)
-		if err != nil {
-			log.Debug("%v", *ce)
-			return 0, fmt.Errorf("parsing command: %w", err)
-		}
 		if c == nil {
 			continue
 		}
 		if snap {
 			snapshot = true
 		}
+		if c.Previous != nil {
+			_ = cmdgraph.Commands.PushBack(c.Previous)
+		}
 		_ = cmdgraph.Commands.PushBack(c)
 	}
 	commandsN := cmdgraph.Commands.Len()
@@ -506,50 +759,91 @@ func parseChangeEvents(cat *catalog.Catalog, dedup *log.MessageSet, consumer *ka
 	if snapshot {
 		cat.ResetLastSnapshotRecord()
 	}
-	return eventReadCount, nil
+	return eventReadCount, eof, nil
 }
 
-func readChangeEvent(consumer *kafka.Consumer, sourceLog *log.SourceLog, kafkaPollTimeout int) (*kafka.Message, error) {
-	ev := consumer.Poll(kafkaPollTimeout)
-	if ev == nil {
-		return nil, nil
-	}
-	switch e := ev.(type) {
-	case *kafka.Message:
-		msg := e
-		if msg != nil { // received message
-			if sourceLog != nil {
-				sourceLog.Log("#")
-				sourceLog.Log(string(msg.Key))
-				sourceLog.Log(string(msg.Value))
-			}
+// commandSource is implemented by sources that decode change events
+// directly into commands, rather than returning messages.
+type commandSource interface {
+	// ReadCommand returns the next command, or nil if no command is
+	// available before the timeout expires.  The command has the schema
+	// and table names of the source.  The boolean result is true if the
+	// command is part of a snapshot.
+	ReadCommand(timeout time.Duration) (*command.Command, bool, error)
+}
+
+// readCommand reads a change event from a source and returns the resulting
+// command, which may be nil if the event is filtered or does not produce a
+// command.  It also returns true if the command is part of a snapshot, and
+// true if an event was read before the timeout expired.  If deadLetters is
+// not nil, an event that cannot be parsed is written as a dead letter.  The
+// source log and dead letters contain the event before columns are masked.
+func readCommand(cat *catalog.Catalog, dedup *log.MessageSet, source change.Source, format command.EventFormat, timeout time.Duration, schemaPassFilter, schemaStopFilter, tableStopFilter []*regexp.Regexp, trimSchemaPrefix, addSchemaPrefix, mapPublicSchema string, renames *command.RenameRules, columnRules *command.ColumnRules, sourceLog *log.SourceLog, deadLetters *deadLetterWriter) (*command.Command, bool, bool, error) {
+	if cs, ok := source.(commandSource); ok {
+		c, snap, err := cs.ReadCommand(timeout)
+		if err != nil {
+			return nil, false, false, fmt.Errorf("reading command: %w", err)
 		}
-		return e, nil
-	//case kafka.PartitionEOF:
-	//	log.Trace("%s", e)
-	//	return nil, nil
-	case kafka.Error:
-		// In general, errors from the Kafka
-		// client can be reported and ignored,
-		// because the client will
-		// automatically try to recover.
-		if e.IsFatal() {
-			log.Warning("Kafka poll: %v", e)
-		} else {
-			log.Info("Kafka poll: %v", e)
+		if c == nil {
+			return nil, false, false, nil
 		}
-		// We could take some action if
-		// desired:
-		//if e.Code() == kafka.ErrAllBrokersDown {
-		//        // some action
-		//}
-	default:
-		log.Debug("ignoring: %v", e)
+		if !c.SetTable(cat, c.SchemaName, c.TableName, schemaPassFilter, schemaStopFilter, tableStopFilter,
+			trimSchemaPrefix, addSchemaPrefix, mapPublicSchema, renames) {
+			return nil, false, true, nil
+		}
+		if err = columnRules.Apply(c); err != nil {
+			return nil, false, false, fmt.Errorf("masking columns: %w", err)
+		}
+		return c, snap, true, nil
+	}
+	msg, err := source.Read(timeout)
+	if errors.Is(err, io.EOF) {
+		return nil, false, false, err
+	}
+	if err != nil {
+		return nil, false, false, fmt.Errorf("reading message: %w", err)
+	}
+	if msg == nil { // Poll timeout is indicated by the nil return.
+		return nil, false, false, nil
+	}
+	if sourceLog != nil {
+		// Write the record as a single entry, so that records
+		// from concurrent sources do not interleave.  The record is
+		// not masked (see checkUnmaskedEvents).
+		sourceLog.Log("#\n" + string(msg.Key) + "\n" + string(msg.Value))
 	}
-	return nil, nil
+	c, snap, err := command.NewCommandFromMessage(cat, dedup, msg, format, schemaPassFilter, schemaStopFilter,
+		tableStopFilter, trimSchemaPrefix, addSchemaPrefix, mapPublicSchema, renames)
+	if err == nil && c != nil {
+		if err = columnRules.Apply(c); err != nil {
+			err = fmt.Errorf("masking columns: %w", err)
+		}
+	}
+	if err != nil && deadLetters != nil {
+		if err = deadLetters.write(msg, deadLetterParse, err); err != nil {
+			return nil, false, false, err
+		}
+		return nil, false, true, nil
+	}
+	if err != nil {
+		return nil, false, false, fmt.Errorf("parsing command: %w", err)
+	}
+	if c != nil && deadLetters != nil {
+		c.Message = msg
+		if c.Previous != nil {
+			c.Previous.Message = msg
+		}
+	}
+	return c, snap, true, nil
 }
 
 func logTraceCommand(thread int, c *command.Command) {
+	log.Trace("[%d] %s", thread, commandString(c))
+}
+
+// commandString returns a summary of a command, consisting of the operation,
+// table, and primary key values.
+func commandString(c *command.Command) string {
 	var schemaTable string
 	if c.SchemaName == "" {
 		schemaTable = c.TableName
@@ -558,7 +852,7 @@ func logTraceCommand(thread int, c *command.Command) {
 	}
 	var pkey = command.PrimaryKeyColumns(c.Column)
 	var b strings.Builder
-	_, _ = fmt.Fprintf(&b, "[%d] %s: %s", thread, c.Op, schemaTable)
+	_, _ = fmt.Fprintf(&b, "%s: %s", c.Op, schemaTable)
 	if c.Op != command.TruncateOp {
 		_, _ = fmt.Fprintf(&b, " (")
 		var x int
@@ -571,60 +865,27 @@ func logTraceCommand(thread int, c *command.Command) {
 		}
 		_, _ = fmt.Fprintf(&b, ")")
 	}
-	log.Trace("%s", b.String())
+	return b.String()
 }
 
+// waitForConfig waits until an enabled source is configured and returns a
+// stream processor for it.  It is used in script mode, which processes only a
+// single source.
 func waitForConfig(svr *server) (*sproc, error) {
-	var databases = dbxToConnector(svr.db)
-	var sources []*sysdb.SourceConnector
-	var ready bool
-	var err error
 	for {
-		sources, ready, err = waitForConfigSource(svr)
+		sources, err := sysdb.ReadSourceConnectors(svr.db)
 		if err != nil {
 			return nil, err
 		}
-		if ready {
-			break
-		}
-	}
-	var src *sysdb.SourceConnector = sources[0]
-	var spr = &sproc{
-		source:    src,
-		databases: databases,
-		svr:       svr,
-	}
-	return spr, nil
-}
-
-func waitForConfigSource(svr *server) ([]*sysdb.SourceConnector, bool, error) {
-	svr.state.mu.Lock()
-	defer svr.state.mu.Unlock()
-
-	// var databases []*sysdb.DatabaseConnector
-	var sources []*sysdb.SourceConnector
-	var err error
-	// if databases, err = sysdb.ReadDatabaseConnectors(); err != nil {
-	// 	return nil, nil, false, err
-	// }
-	if sources, err = sysdb.ReadSourceConnectors(svr.db); err != nil {
-		return nil, false, err
-	}
-	if len(sources) > 0 {
-		if sources[0].Enable {
-			// Reread connectors in case configuration was incomplete.
-			if sources, err = sysdb.ReadSourceConnectors(svr.db); err != nil {
-				return nil, false, err
-			}
-			if len(sources) > 0 {
-				sources[0].Status.Stream.Waiting()
-				svr.state.sources = sources
+		for _, src := range sources {
+			if src.Enable {
+				src.Status.Stream.Waiting()
+				svr.state.sources.Add(src)
+				return newSproc(svr, src), nil
 			}
-			return sources, true, nil
 		}
+		time.Sleep(2 * time.Second)
 	}
-	time.Sleep(2 * time.Second)
-	return nil, false, nil
 }
 
 func dbxToConnector(db *dbx.DB) []*sysdb.DatabaseConnector {
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/metadb-project/metadb/cmd/metadb/change"
+	"github.com/metadb-project/metadb/cmd/metadb/log"
+	"github.com/metadb-project/metadb/cmd/metadb/logrepl"
+	"github.com/metadb-project/metadb/cmd/metadb/sysdb"
+)
+
+// postgresqlSource is a change event source that reads from a PostgreSQL
+// publication using logical replication.  It implements commandSource, and
+// so it is read using ReadCommand rather than Read.
+type postgresqlSource struct {
+	*logrepl.Source
+}
+
+func (s *postgresqlSource) Read(timeout time.Duration) (*change.Message, error) {
+	return nil, errors.New("postgresql source does not return messages")
+}
+
+// openPostgresqlSource connects to a publication, resuming from the LSN
+// stored in the catalog.
+func openPostgresqlSource(ctx context.Context, spr *sproc) ([]change.Source, error) {
+	position, err := sysdb.ReadSourcePosition(spr.svr.dp, spr.source.Name)
+	if err != nil {
+		return nil, err
+	}
+	log.Debug("connecting to source %q", spr.source.Name)
+	source, err := logrepl.Open(ctx, spr.source.Connection, spr.source.Slot, spr.source.Publication, position,
+		func(position string) error {
+			return sysdb.WriteSourcePosition(spr.svr.dp, spr.source.Name, position)
+		})
+	if err != nil {
+		return nil, err
+	}
+	return []change.Source{&postgresqlSource{Source: source}}, nil
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/metadb-project/metadb/cmd/metadb/catalog"
+	"github.com/metadb-project/metadb/cmd/metadb/change"
+	"github.com/metadb-project/metadb/cmd/metadb/command"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+	"github.com/metadb-project/metadb/cmd/metadb/dsync"
+	"github.com/metadb-project/metadb/cmd/metadb/eout"
+	"github.com/metadb-project/metadb/cmd/metadb/log"
+	"github.com/metadb-project/metadb/cmd/metadb/option"
+	"github.com/metadb-project/metadb/cmd/metadb/process"
+	"github.com/metadb-project/metadb/cmd/metadb/sysdb"
+	"github.com/metadb-project/metadb/cmd/metadb/util"
+)
+
+// Replay reads change events from a source log, as written by the server
+// option --logsource, and processes them in the same way as events received
+// from the specified data source.  In dry-run mode, the resulting commands
+// are printed instead of being written to the database.
+func Replay(opt *option.Replay) error {
+	db, err := util.ReadConfigDatabase(opt.Datadir)
+	if err != nil {
+		return err
+	}
+	if !opt.DryRun {
+		// Check if server is already running.
+		running, pid, err := process.IsServerRunning(opt.Datadir)
+		if err != nil {
+			return err
+		}
+		if running {
+			return fmt.Errorf("lock file %q already exists and server (PID %d) appears to be running", util.SystemPIDFileName(opt.Datadir), pid)
+		}
+		// Write lock file for new server instance.
+		if err = process.WritePIDFile(opt.Datadir); err != nil {
+			return err
+		}
+		defer process.RemovePIDFile(opt.Datadir)
+	}
+	var dp *pgxpool.Pool
+	dp, err = dbx.NewPool(context.TODO(), db.ConnString(db.User, db.Password))
+	if err != nil {
+		return fmt.Errorf("creating database connection pool: %w", err)
+	}
+	defer dp.Close()
+	// Check that database version is compatible.
+	if err = catalog.CheckDatabaseCompatible(dp); err != nil {
+		return err
+	}
+	cat, err := catalog.Initialize(db, dp)
+	if err != nil {
+		return err
+	}
+
+	sources, err := sysdb.ReadSourceConnectors(db)
+	if err != nil {
+		return fmt.Errorf("reading data sources: %w", err)
+	}
+	var src *sysdb.SourceConnector
+	for _, s := range sources {
+		if s.Name == opt.Source {
+			src = s
+		}
+	}
+	if src == nil {
+		return fmt.Errorf("data source %q does not exist", opt.Source)
+	}
+	schemaPassFilter, err := util.CompileRegexps(src.SchemaPassFilter)
+	if err != nil {
+		return err
+	}
+	schemaStopFilter, err := util.CompileRegexps(src.SchemaStopFilter)
+	if err != nil {
+		return err
+	}
+	tableStopFilter, err := util.CompileRegexps(src.TableStopFilter)
+	if err != nil {
+		return err
+	}
+	renames, err := command.NewRenameRules(src.Module, src.SchemaRename, src.TableRename)
+	if err != nil {
+		return err
+	}
+	columnRules, err := command.NewColumnRules(src.ColumnStopFilter, src.ColumnMask, src.ColumnMaskSalt)
+	if err != nil {
+		return err
+	}
+	syncMode, err := dsync.ReadSyncMode(dp, src.Name)
+	if err != nil {
+		return err
+	}
+	checkpointSegmentSize, err := getConfigCheckpointSegmentSize(cat)
+	if err != nil {
+		return err
+	}
+
+	source, err := change.NewFileSource(opt.SourceLog, "", nil)
+	if err != nil {
+		return err
+	}
+	defer func(source *change.FileSource) {
+		_ = source.Close()
+	}(source)
+
+	dedup := log.NewMessageSet()
+	var eventsN, commandsN int
+	for {
+		cmdgraph := command.NewCommandGraph()
+		n, eof, err := parseChangeEvents(cat, dedup, source, eventFormat(src), cmdgraph, schemaPassFilter,
+			schemaStopFilter, tableStopFilter, src.TrimSchemaPrefix, src.AddSchemaPrefix, src.MapPublicSchema,
+			renames, columnRules, nil, nil, checkpointSegmentSize)
+		if err != nil {
+			return fmt.Errorf("parser: %w", err)
+		}
+		if err = rewriteCommandGraph(cat, cmdgraph); err != nil {
+			return fmt.Errorf("rewriter: %w", err)
+		}
+		if opt.DryRun {
+			for e := cmdgraph.Commands.Front(); e != nil; e = e.Next() {
+				_, _ = fmt.Fprintln(os.Stdout, commandString(e.Value.(*command.Command)))
+			}
+		} else {
+			if err = execCommandGraph(0, context.TODO(), cat, cmdgraph, dp, src.Name, src.ChangeLog, opt.UUOpt, syncMode, dedup); err != nil {
+				return fmt.Errorf("executor: %w", err)
+			}
+		}
+		eventsN += n
+		commandsN += cmdgraph.Commands.Len()
+		eout.Verbose("replay: read %d events", eventsN)
+		if eof {
+			break
+		}
+	}
+	if opt.DryRun {
+		eout.Info("replay: dry run: %d events, %d commands", eventsN, commandsN)
+	} else {
+		eout.Info("replay: %d events, %d commands", eventsN, commandsN)
+	}
+	return nil
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/metadb-project/metadb/cmd/metadb/catalog"
+	"github.com/metadb-project/metadb/cmd/metadb/command"
 	"github.com/metadb-project/metadb/cmd/metadb/dbx"
 	"github.com/metadb-project/metadb/cmd/metadb/dsync"
 	"github.com/metadb-project/metadb/cmd/metadb/libpq"
@@ -30,8 +31,8 @@ import (
 	"github.com/metadb-project/metadb/cmd/metadb/util"
 )
 
-// The server thread handling needs to be reworked.  It currently runs an HTTP
-// server and a single poll loop in two goroutines.
+// The server runs the libpq listener, a maintenance goroutine, and one poll
+// loop per enabled data source, each in its own goroutine.
 
 type server struct {
 	opt   *option.Server
@@ -39,14 +40,15 @@ type server struct {
 	db    *dbx.DB
 	//dc      *pgx.Conn
 	//dcsuper *pgx.Conn
-	dp *pgxpool.Pool
+	dp        *pgxpool.Pool
+	sourceLog *log.SourceLog
 }
 
 // serverstate is shared between goroutines.
 type serverstate struct {
 	mu        sync.Mutex
 	databases []*sysdb.DatabaseConnector
-	sources   []*sysdb.SourceConnector
+	sources   sysdb.SourceList
 }
 
 // sproc stores state for a single poll loop.
@@ -54,10 +56,51 @@ type sproc struct {
 	schemaPassFilter []*regexp.Regexp
 	schemaStopFilter []*regexp.Regexp
 	tableStopFilter  []*regexp.Regexp
+	columnRules      *command.ColumnRules
+	renames          *command.RenameRules
+	applyWorkers     int // Number of concurrent workers applying commands
 	source           *sysdb.SourceConnector
 	databases        []*sysdb.DatabaseConnector
 	sourceLog        *log.SourceLog
 	svr              *server
+	stop             chan struct{} // Closed to request that the poll loop stop
+	done             chan struct{} // Closed when the poll loop has stopped
+}
+
+func newSproc(svr *server, src *sysdb.SourceConnector) *sproc {
+	return &sproc{
+		source:    src,
+		databases: dbxToConnector(svr.db),
+		sourceLog: svr.sourceLog,
+		svr:       svr,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// requestStop signals the poll loop to stop at the next checkpoint.
+func (spr *sproc) requestStop() {
+	if !spr.stopRequested() {
+		close(spr.stop)
+	}
+}
+
+func (spr *sproc) stopRequested() bool {
+	select {
+	case <-spr.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (spr *sproc) stopped() bool {
+	select {
+	case <-spr.done:
+		return true
+	default:
+		return false
+	}
 }
 
 func Start(opt *option.Server) error {
@@ -144,7 +187,7 @@ func mainServer(svr *server, cat *catalog.Catalog) error {
 	log.Info("starting Metadb %s", util.GetMetadbVersion())
 
 	if !svr.opt.Script {
-		go libpq.Listen(cat, svr.opt.Listen, svr.opt.Port, svr.db, &svr.state.sources)
+		go libpq.Listen(cat, svr.opt, svr.db, &svr.state.sources)
 	}
 
 	// Create database functions.
@@ -166,21 +209,6 @@ func mainServer(svr *server, cat *catalog.Catalog) error {
 		goPollLoop(ctx, cat, svr)
 	}
 
-	/*	folio, err := isFolioModulePresent(svr.db)
-		if err != nil {
-			return fmt.Errorf("checking for folio module: %w", err)
-		}
-		reshare, err := isReshareModulePresent(svr.db)
-		if err != nil {
-			return fmt.Errorf("checking for reshare module: %w", err)
-		}
-		source, err := util.GetOneSource(svr.dp)
-		if err != nil {
-			log.Info("reading source: %v", err)
-		}
-		go goMaintenance(svr.opt.Datadir, *(svr.db), cat, source, folio, reshare)
-	*/
-
 	if !svr.opt.Script {
 		for {
 			if process.Stop() {
@@ -193,64 +221,32 @@ func mainServer(svr *server, cat *catalog.Catalog) error {
 	return nil
 }
 
-func isFolioModulePresent(db *dbx.DB) (bool, error) {
-	dc, err := db.Connect()
-	if err != nil {
-		return false, fmt.Errorf("connecting to database: %w", err)
-	}
-	defer dbx.Close(dc)
-	q := "SELECT 1 FROM metadb.source WHERE module='folio' LIMIT 1"
-	var n int32
-	err = dc.QueryRow(context.TODO(), q).Scan(&n)
-	switch {
-	case errors.Is(err, pgx.ErrNoRows):
-		return false, nil
-	case err != nil:
-		return false, fmt.Errorf("selecting module: %w", err)
-	default:
-		return true, nil
-	}
-}
-
-func isReshareModulePresent(db *dbx.DB) (bool, error) {
-	dc, err := db.Connect()
-	if err != nil {
-		return false, fmt.Errorf("connecting to database: %w", err)
-	}
-	defer dbx.Close(dc)
-	q := "SELECT 1 FROM metadb.source WHERE module='reshare' LIMIT 1"
-	var n int32
-	err = dc.QueryRow(context.TODO(), q).Scan(&n)
-	switch {
-	case errors.Is(err, pgx.ErrNoRows):
-		return false, nil
-	case err != nil:
-		return false, fmt.Errorf("selecting module: %w", err)
-	default:
-		return true, nil
-	}
-}
-
-func goMaintenance(datadir string, db dbx.DB, dp *pgxpool.Pool, cat *catalog.Catalog, source string, folio, reshare bool) {
+func goMaintenance(datadir string, db dbx.DB, dp *pgxpool.Pool, cat *catalog.Catalog, sources *sysdb.SourceList) {
 	for {
 		time.Sleep(5 * time.Minute)
-		syncMode, err := dsync.ReadSyncMode(dp, source)
-		if err != nil {
-			log.Error("unable to read sync mode: %v", err)
-		}
-		if folio && syncMode == dsync.NoSync {
-			if err := marctab.RunMarctab(db, datadir, cat); err != nil {
-				log.Error("marct: %v", err)
+		for _, src := range sources.All() {
+			if src.Module != "folio" {
+				continue
+			}
+			syncMode, err := dsync.ReadSyncMode(dp, src.Name)
+			if err != nil {
+				log.Error("unable to read sync mode: %v", err)
+			}
+			if syncMode == dsync.NoSync {
+				if err := marctab.RunMarctab(db, datadir, cat); err != nil {
+					log.Error("marct: %v", err)
+				}
+				break
 			}
 		}
-		if err := checkTimeDailyMaintenance(datadir, db, dp, cat, source, folio, reshare, syncMode); err != nil {
+		if err := checkTimeDailyMaintenance(datadir, db, dp, cat, sources.All()); err != nil {
 			log.Error("%v", err)
 		}
 		time.Sleep(55 * time.Minute)
 	}
 }
 
-func checkTimeDailyMaintenance(datadir string, db dbx.DB, dp *pgxpool.Pool, cat *catalog.Catalog, source string, folio, reshare bool, syncMode dsync.Mode) error {
+func checkTimeDailyMaintenance(datadir string, db dbx.DB, dp *pgxpool.Pool, cat *catalog.Catalog, sources []*sysdb.SourceConnector) error {
 	var overdue bool
 	q := "SELECT CURRENT_TIMESTAMP > next_maintenance_time FROM metadb.maintenance"
 	err := dp.QueryRow(context.TODO(), q).Scan(&overdue)
@@ -267,93 +263,42 @@ func checkTimeDailyMaintenance(datadir string, db dbx.DB, dp *pgxpool.Pool, cat
 
 	log.Debug("starting maintenance")
 
-	if folio && syncMode == dsync.NoSync {
-		tries := 0
-		for {
-			tries++
-			var spec string
-			spec, err = cat.GetConfig("external_sql_folio")
-			if err != nil {
-				return err
-			}
-			if spec == "" {
-				break
-			}
-			var url, ref string
-			url, ref, err = parseRef(spec)
-			if err != nil {
-				return fmt.Errorf("runsql: %v", err)
-			}
-			path := "sql_metadb/derived_tables"
-			schema := "folio_derived"
-			if err = runsql.RunSQL(datadir, cat, db, url, ref, path, schema, source); err != nil {
-				log.Info("runsql: %v: repository=%s ref=%s path=%s", err, url, ref, path)
-				if tries >= 12 {
-					break
-				}
-				time.Sleep(1 * time.Hour)
-				continue
-			}
-			break
+	// External SQL is run once for each module, even if several data
+	// sources use the module, and only if none of them is synchronizing.
+	// The tables it creates are attributed to the first of the sources.
+	moduleSource := make(map[string]string)
+	syncing := make(map[string]bool)
+	for _, src := range sources {
+		if src.Module != "folio" && src.Module != "reshare" {
+			continue
+		}
+		syncMode, err := dsync.ReadSyncMode(dp, src.Name)
+		if err != nil {
+			log.Error("unable to read sync mode: %v", err)
+		}
+		if syncMode != dsync.NoSync {
+			syncing[src.Module] = true
+		}
+		if s, ok := moduleSource[src.Module]; !ok || src.Name < s {
+			moduleSource[src.Module] = src.Name
 		}
 	}
-	if reshare && syncMode == dsync.NoSync {
-		tries := 0
-		for {
-			tries++
-			var spec string
-			spec, err = cat.GetConfig("external_sql_reshare")
-			if err != nil {
-				return err
-			}
-			if spec == "" {
-				break
-			}
-			var url, ref string
-			url, ref, err = parseRef(spec)
-			if err != nil {
-				return fmt.Errorf("runsql: %v", err)
-			}
-			path := "reports"
-			schema := "report"
-			if err = sqlfunc.SQLFunc(datadir, cat, db, url, ref, path, schema, source); err != nil {
-				log.Info("sqlfunc: %v: repository=%s ref=%s path=%s", err, url, ref, path)
-				if tries >= 12 {
-					break
-				}
-				time.Sleep(1 * time.Hour)
-				continue
-			}
-			break
+	_, folio := moduleSource["folio"]
+	if source, ok := moduleSource["folio"]; ok && !syncing["folio"] {
+		if err = runExternalSQLFolio(datadir, db, cat, source); err != nil {
+			return err
 		}
 	}
-	if reshare && syncMode == dsync.NoSync {
-		tries := 0
-		for {
-			tries++
-			url := "https://github.com/openlibraryenvironment/reshare-analytics.git"
-			var ref string
-			ref, err = cat.GetConfig("external_sql_reshare")
-			if err != nil {
-				return err
-			}
-			if ref == "" {
-				break
-			}
-			path := "sql/derived_tables"
-			schema := "reshare_derived"
-			if err = runsql.RunSQL(datadir, cat, db, url, ref, path, schema, source); err != nil {
-				log.Info("runsql: %v: repository=%s ref=%s path=%s", err, url, ref, path)
-				if tries >= 12 {
-					break
-				}
-				time.Sleep(1 * time.Hour)
-				continue
-			}
-			break
+	if source, ok := moduleSource["reshare"]; ok && !syncing["reshare"] {
+		if err = runExternalSQLReshare(datadir, db, cat, source); err != nil {
+			return err
 		}
 	}
 
+	if err = enforceHistoryRetention(dp, cat); err != nil {
+		log.Error("history retention: %v", err)
+	}
+
 	// Schedule next maintenance
 	q = "UPDATE metadb.maintenance " +
 		"SET next_maintenance_time = next_maintenance_time +" +
@@ -371,6 +316,117 @@ func checkTimeDailyMaintenance(datadir string, db dbx.DB, dp *pgxpool.Pool, cat
 	return nil
 }
 
+// enforceHistoryRetention drops history partitions that have expired under
+// the retention policies of their tables.  It holds catalog.ExecMutex so that
+// partitions are not dropped while changes are being written to them.
+func enforceHistoryRetention(dp *pgxpool.Pool, cat *catalog.Catalog) error {
+	catalog.ExecMutex.Lock()
+	defer catalog.ExecMutex.Unlock()
+	parts, err := cat.HistoryPartitions(dp, time.Now())
+	if err != nil {
+		return err
+	}
+	for _, p := range parts {
+		if !p.Expired {
+			continue
+		}
+		// An empty partition may have been kept for current records.
+		var empty bool
+		if err = dp.QueryRow(context.TODO(), "SELECT NOT EXISTS (SELECT 1 FROM "+p.SQL()+")").Scan(&empty); err != nil {
+			return fmt.Errorf("selecting from partition %s: %w", p.SQL(), err)
+		}
+		if empty {
+			continue
+		}
+		if _, err = cat.DropPartition(p.Table, p.Partition); err != nil {
+			return err
+		}
+		log.Info("history retention: dropped partition %s (retention %q)", p.SQL(), p.Retention)
+	}
+	return nil
+}
+
+func runExternalSQLFolio(datadir string, db dbx.DB, cat *catalog.Catalog, source string) error {
+	tries := 0
+	for {
+		tries++
+		spec, err := cat.GetConfig("external_sql_folio")
+		if err != nil {
+			return err
+		}
+		if spec == "" {
+			return nil
+		}
+		url, ref, err := parseRef(spec)
+		if err != nil {
+			return fmt.Errorf("runsql: %v", err)
+		}
+		path := "sql_metadb/derived_tables"
+		schema := "folio_derived"
+		if err = runsql.RunSQL(datadir, cat, db, url, ref, path, schema, source); err != nil {
+			log.Info("runsql: %v: repository=%s ref=%s path=%s", err, url, ref, path)
+			if tries >= 12 {
+				return nil
+			}
+			time.Sleep(1 * time.Hour)
+			continue
+		}
+		return nil
+	}
+}
+
+func runExternalSQLReshare(datadir string, db dbx.DB, cat *catalog.Catalog, source string) error {
+	tries := 0
+	for {
+		tries++
+		spec, err := cat.GetConfig("external_sql_reshare")
+		if err != nil {
+			return err
+		}
+		if spec == "" {
+			break
+		}
+		url, ref, err := parseRef(spec)
+		if err != nil {
+			return fmt.Errorf("runsql: %v", err)
+		}
+		path := "reports"
+		schema := "report"
+		if err = sqlfunc.SQLFunc(datadir, cat, db, url, ref, path, schema, source); err != nil {
+			log.Info("sqlfunc: %v: repository=%s ref=%s path=%s", err, url, ref, path)
+			if tries >= 12 {
+				break
+			}
+			time.Sleep(1 * time.Hour)
+			continue
+		}
+		break
+	}
+	tries = 0
+	for {
+		tries++
+		url := "https://github.com/openlibraryenvironment/reshare-analytics.git"
+		ref, err := cat.GetConfig("external_sql_reshare")
+		if err != nil {
+			return err
+		}
+		if ref == "" {
+			return nil
+		}
+		path := "sql/derived_tables"
+		schema := "reshare_derived"
+		if err = runsql.RunSQL(datadir, cat, db, url, ref, path, schema, source); err != nil {
+			log.Info("runsql: %v: repository=%s ref=%s path=%s", err, url, ref, path)
+			if tries >= 12 {
+				return nil
+			}
+			time.Sleep(1 * time.Hour)
+			continue
+		}
+		return nil
+	}
+}
+
 // parses external_sql_folio or external_sql_reshare, and returns
 // the URL and ref
 func parseRef(spec string) (string, string, error) {
@@ -1,12 +1,15 @@
 package status
 
 import (
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
 type Source struct {
 	Stream Stream
 	Sync   Sync
+	Retry  Retry
 }
 
 type Stream int32
@@ -40,6 +43,10 @@ func (st *Stream) Get() Stream {
 	return Stream(atomic.LoadInt32((*int32)(st)))
 }
 
+func (st *Stream) Inactive() {
+	st.set(StreamInactive)
+}
+
 func (st *Stream) Waiting() {
 	st.set(StreamWaiting)
 }
@@ -96,3 +103,46 @@ func (sy *Sync) SnapshotComplete() {
 func (sy *Sync) set(s Sync) {
 	atomic.StoreInt32((*int32)(sy), int32(s))
 }
+
+// Retry records the state of retries after a stream processing error.
+type Retry struct {
+	mu    sync.Mutex
+	state RetryState
+}
+
+// RetryState describes the most recent error and when processing will be
+// retried.  Attempts is 0 if no retry is pending.
+type RetryState struct {
+	Attempts int
+	Class    string
+	Error    string
+	Next     time.Time
+}
+
+// Wait records that the stream is waiting to retry after an error.
+func (r *Retry) Wait(state RetryState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.state = state
+}
+
+// Retrying records that the wait has ended and processing is being retried.
+// The error and number of attempts are retained until Clear is called.
+func (r *Retry) Retrying() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.state.Next = time.Time{}
+}
+
+// Clear resets the retry state.
+func (r *Retry) Clear() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.state = RetryState{}
+}
+
+func (r *Retry) Get() RetryState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.state
+}
@@ -2,6 +2,7 @@ package sysdb
 
 import (
 	"context"
+	"fmt"
 	"strings"
 
 	"github.com/jackc/pgx/v5"
@@ -19,30 +20,50 @@ func ReadSourceConnectors(db *dbx.DB) ([]*SourceConnector, error) {
 
 	var rows pgx.Rows
 	rows, err = dbc.Query(context.TODO(), ""+
-		"SELECT name,enable,coalesce(brokers,''),coalesce(security,''),coalesce(topics,''),"+
-		"coalesce(consumer_group,''),coalesce(schema_pass_filter,''),coalesce(schema_stop_filter,''),"+
-		"coalesce(table_stop_filter,''),coalesce(trim_schema_prefix,''),coalesce(add_schema_prefix,''),"+
-		"coalesce(map_public_schema,''),coalesce(module,'') FROM metadb.source")
+		"SELECT name,type,enable,coalesce(brokers,''),coalesce(security,''),coalesce(topics,''),"+
+		"coalesce(consumer_group,''),coalesce(schema_registry,''),"+
+		"coalesce(flattened,'')='true',coalesce(schemaless,'')='true',"+
+		"coalesce(dead_letter,''),coalesce(dead_letter_topic,''),coalesce(schema_pass_filter,''),coalesce(schema_stop_filter,''),"+
+		"coalesce(table_stop_filter,''),coalesce(column_stop_filter,''),coalesce(column_mask,''),"+
+		"coalesce(column_mask_salt,''),coalesce(schema_rename,''),coalesce(table_rename,''),"+
+		"coalesce(trim_schema_prefix,''),coalesce(add_schema_prefix,''),"+
+		"coalesce(map_public_schema,''),coalesce(module,''),coalesce(path,''),coalesce(connection,''),"+
+		"coalesce(publication,''),coalesce(slot,''),coalesce(history_retention,''),"+
+		"coalesce(change_log,'')='true' FROM metadb.source")
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	var src = make([]*SourceConnector, 0)
 	for rows.Next() {
-		var name, brokers, security string
+		var name, srctype, brokers, security string
 		var enable bool
 		var topics string
 		var consumerGroup string
+		var schemaRegistry string
+		var flattened, schemaless bool
+		var deadLetter, deadLetterTopic string
 		var schemaPassFilter string
 		var schemaStopFilter string
 		var tableStopFilter string
+		var columnStopFilter, columnMask, columnMaskSalt string
+		var schemaRename, tableRename string
 		var trimSchemaPrefix string
 		var addSchemaPrefix string
 		var mapPublicSchema string
 		var module string
-		if err := rows.Scan(&name, &enable, &brokers, &security, &topics, &consumerGroup, &schemaPassFilter,
-			&schemaStopFilter, &tableStopFilter, &trimSchemaPrefix, &addSchemaPrefix, &mapPublicSchema,
-			&module); err != nil {
+		var path string
+		var connection, publication, slot string
+		var historyRetention string
+		var changeLog bool
+		if err := rows.Scan(&name, &srctype, &enable, &brokers, &security, &topics, &consumerGroup, &schemaRegistry, &flattened, &schemaless,
+			&deadLetter, &deadLetterTopic,
+			&schemaPassFilter,
+			&schemaStopFilter, &tableStopFilter, &columnStopFilter, &columnMask, &columnMaskSalt,
+			&schemaRename, &tableRename,
+			&trimSchemaPrefix, &addSchemaPrefix, &mapPublicSchema,
+			&module, &path, &connection, &publication, &slot, &historyRetention,
+			&changeLog); err != nil {
 			return nil, err
 		}
 		if security == "" {
@@ -50,18 +71,35 @@ func ReadSourceConnectors(db *dbx.DB) ([]*SourceConnector, error) {
 		}
 		src = append(src, &SourceConnector{
 			Name:             name,
+			Type:             srctype,
 			Enable:           enable,
 			Brokers:          brokers,
 			Security:         security,
 			Topics:           strings.Split(topics, ","),
 			Group:            consumerGroup,
+			SchemaRegistry:   schemaRegistry,
+			Flattened:        flattened,
+			Schemaless:       schemaless,
+			DeadLetter:       deadLetter,
+			DeadLetterTopic:  deadLetterTopic,
 			SchemaPassFilter: util.SplitList(schemaPassFilter),
 			SchemaStopFilter: util.SplitList(schemaStopFilter),
 			TableStopFilter:  util.SplitList(tableStopFilter),
+			ColumnStopFilter: util.SplitList(columnStopFilter),
+			ColumnMask:       util.SplitList(columnMask),
+			ColumnMaskSalt:   columnMaskSalt,
+			SchemaRename:     util.SplitList(schemaRename),
+			TableRename:      util.SplitList(tableRename),
 			TrimSchemaPrefix: trimSchemaPrefix,
 			AddSchemaPrefix:  addSchemaPrefix,
 			MapPublicSchema:  mapPublicSchema,
 			Module:           module,
+			Path:             path,
+			Connection:       connection,
+			Publication:      publication,
+			Slot:             slot,
+			HistoryRetention: historyRetention,
+			ChangeLog:        changeLog,
 		})
 	}
 	if err := rows.Err(); err != nil {
@@ -69,3 +107,28 @@ func ReadSourceConnectors(db *dbx.DB) ([]*SourceConnector, error) {
 	}
 	return src, nil
 }
+
+// ReadSourcePosition returns the position up to which change events from a
+// source have been processed, or "" if no position has been stored.  It is
+// used by sources that do not store their own positions.
+func ReadSourcePosition(dq dbx.Queryable, sourceName string) (string, error) {
+	var position *string
+	q := "SELECT position FROM metadb.source WHERE name=$1"
+	if err := dq.QueryRow(context.TODO(), q, sourceName).Scan(&position); err != nil {
+		return "", fmt.Errorf("reading position of source %q: %w", sourceName, util.PGErr(err))
+	}
+	if position == nil {
+		return "", nil
+	}
+	return *position, nil
+}
+
+// WriteSourcePosition stores the position up to which change events from a
+// source have been processed.
+func WriteSourcePosition(dq dbx.Queryable, sourceName, position string) error {
+	q := "UPDATE metadb.source SET position=$1 WHERE name=$2"
+	if _, err := dq.Exec(context.TODO(), q, position, sourceName); err != nil {
+		return fmt.Errorf("writing position of source %q: %w", sourceName, util.PGErr(err))
+	}
+	return nil
+}
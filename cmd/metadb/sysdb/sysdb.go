@@ -1,6 +1,9 @@
 package sysdb
 
 import (
+	"sort"
+	"sync"
+
 	"github.com/metadb-project/metadb/cmd/metadb/status"
 )
 
@@ -24,21 +27,83 @@ type DatabaseConnector struct {
 type SourceConnector struct {
 	ID               int64
 	Name             string
+	Type             string
 	Enable           bool
 	Brokers          string
 	Security         string
 	Topics           []string
 	Group            string
+	SchemaRegistry   string
+	Flattened        bool
+	Schemaless       bool
+	DeadLetter       string
+	DeadLetterTopic  string
 	SchemaPassFilter []string
 	SchemaStopFilter []string
 	TableStopFilter  []string
+	ColumnStopFilter []string
+	ColumnMask       []string
+	ColumnMaskSalt   string
+	SchemaRename     []string
+	TableRename      []string
 	TrimSchemaPrefix string
 	AddSchemaPrefix  string
 	MapPublicSchema  string
 	Module           string
+	Path             string
+	Connection       string
+	Publication      string
+	Slot             string
+	HistoryRetention string
+	ChangeLog        bool
 	Status           status.Source
 }
 
+// SourceList is the set of data sources for which a poll loop has been
+// started.  It is shared between goroutines.
+type SourceList struct {
+	mu      sync.Mutex
+	sources []*SourceConnector
+}
+
+// Add adds a source to the list, replacing any existing source that has the
+// same name.
+func (l *SourceList) Add(src *SourceConnector) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, s := range l.sources {
+		if s.Name == src.Name {
+			l.sources[i] = src
+			return
+		}
+	}
+	l.sources = append(l.sources, src)
+	sort.Slice(l.sources, func(i, j int) bool {
+		return l.sources[i].Name < l.sources[j].Name
+	})
+}
+
+// Remove removes the named source from the list, if present.
+func (l *SourceList) Remove(name string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, s := range l.sources {
+		if s.Name == name {
+			l.sources = append(l.sources[:i], l.sources[i+1:]...)
+			return
+		}
+	}
+}
+
+// All returns a copy of the list, sorted by source name.
+func (l *SourceList) All() []*SourceConnector {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	sources := make([]*SourceConnector, len(l.sources))
+	copy(sources, l.sources)
+	return sources
+}
+
 //var sysMu dsync.Mutex
 //var db *sql.DB
 
@@ -22,9 +22,33 @@ const (
 	TimetzType      = 10
 	UUIDType        = 11
 	TextType        = 12
+	ByteaType       = 13
+	IntervalType    = 14
+
+	// ArrayType is combined with the type of the elements to form an
+	// array type.  The type size of an array is that of its elements.
+	ArrayType = 1 << 8
 )
 
+// ArrayOf returns the array type having elements of type d.
+func ArrayOf(d DataType) DataType {
+	return d | ArrayType
+}
+
+// IsArray returns true if d is an array type.
+func (d DataType) IsArray() bool {
+	return d&ArrayType != 0
+}
+
+// Elem returns the type of the elements of an array type.
+func (d DataType) Elem() DataType {
+	return d &^ ArrayType
+}
+
 func (d DataType) String() string {
+	if d.IsArray() {
+		return "ArrayType(" + d.Elem().String() + ")"
+	}
 	switch d {
 	case BooleanType:
 		return "BooleanType"
@@ -50,6 +74,10 @@ func (d DataType) String() string {
 		return "UUIDType"
 	case TextType:
 		return "TextType"
+	case ByteaType:
+		return "ByteaType"
+	case IntervalType:
+		return "IntervalType"
 	default:
 		log.Error("data type to string: unknown data type: %d", d)
 		return "(unknown type)"
@@ -57,22 +85,29 @@ func (d DataType) String() string {
 }
 
 func MakeDataType(dataType string) (DataType, int64) {
+	if elem, ok := strings.CutSuffix(dataType, "[]"); ok {
+		dtype, size := MakeDataType(elem)
+		if dtype == UnknownType {
+			return UnknownType, 0
+		}
+		return ArrayOf(dtype), size
+	}
 	switch strings.ToLower(dataType) {
 	case "text", "varchar", "character varying":
 		return TextType, 0
-	case "smallint":
+	case "smallint", "int2":
 		return IntegerType, 2
-	case "integer":
+	case "integer", "int4":
 		return IntegerType, 4
-	case "bigint":
+	case "bigint", "int8":
 		return IntegerType, 8
-	case "real":
+	case "real", "float4":
 		return FloatType, 4
-	case "double precision":
+	case "double precision", "float8":
 		return FloatType, 8
 	case "numeric":
 		return NumericType, 0
-	case "boolean":
+	case "boolean", "bool":
 		return BooleanType, 0
 	case "date":
 		return DateType, 0
@@ -88,6 +123,10 @@ func MakeDataType(dataType string) (DataType, int64) {
 		return UUIDType, 0
 	case "jsonb":
 		return JSONType, 0
+	case "bytea":
+		return ByteaType, 0
+	case "interval":
+		return IntervalType, 0
 	default:
 		log.Error("make data type new: unknown data type: %s", dataType)
 		return UnknownType, 0
@@ -96,6 +135,9 @@ func MakeDataType(dataType string) (DataType, int64) {
 
 // DataTypeToSQL convert a data type and type size to a database type.
 func DataTypeToSQL(dtype DataType, typeSize int64) string {
+	if dtype.IsArray() {
+		return DataTypeToSQL(dtype.Elem(), typeSize) + "[]"
+	}
 	switch dtype {
 	case TextType:
 		return "text"
@@ -137,6 +179,10 @@ func DataTypeToSQL(dtype DataType, typeSize int64) string {
 		return "uuid"
 	case JSONType:
 		return "jsonb"
+	case ByteaType:
+		return "bytea"
+	case IntervalType:
+		return "interval"
 	default:
 		return "(unknown)"
 	}
@@ -311,13 +311,12 @@ func queueMigrationRecord(cat *catalog.Catalog, metadbTable dbx.Table, encoder *
 }
 
 func makeRecordPartition(cat *catalog.Catalog, metadbTable dbx.Table, timestamp time.Time) error {
-	year := timestamp.Year()
-	if cat.PartYearExists(metadbTable.Schema, metadbTable.Table, year) {
+	if cat.PartitionExists(metadbTable, timestamp) {
 		return nil
 	}
-	if err := cat.AddPartYear(metadbTable.Schema, metadbTable.Table, year); err != nil {
-		return fmt.Errorf("adding partition for table %q year %d: %v", metadbTable.Main().String(),
-			year, err)
+	if err := cat.AddPartition(metadbTable, timestamp); err != nil {
+		return fmt.Errorf("adding partition for table %q time %v: %v", metadbTable.Main().String(),
+			timestamp, err)
 	}
 	return nil
 }
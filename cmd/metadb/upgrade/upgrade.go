@@ -439,6 +439,7 @@ var updbList = []updbFunc{
 	updb32,
 	updb33,
 	updb34,
+	updb35,
 }
 
 func updb8(opt *dbopt) error {
@@ -2372,6 +2373,164 @@ func updb34(opt *dbopt) error {
 
 var updb34ExtraManagedTables = []string{"folio_source_record.marc__t"}
 
+func updb35(opt *dbopt) error {
+	dc, err := opt.DB.Connect()
+	if err != nil {
+		return err
+	}
+	defer dbx.Close(dc)
+
+	tx, err := dc.Begin(context.TODO())
+	if err != nil {
+		return err
+	}
+	defer dbx.Rollback(tx)
+
+	// Client authentication remains disabled in an upgraded database, as
+	// in previous versions, so that existing clients are not locked out.
+	q := "INSERT INTO metadb.config (parameter, value) VALUES " +
+		"('allow_unmasked_events', 'false'), " +
+		"('apply_concurrency', '1'), " +
+		"('client_auth_method', 'trust'), " +
+		"('client_database_names', 'metadb'), " +
+		"('retry_initial_interval', '10'), " +
+		"('retry_max_interval', '86400')"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return fmt.Errorf("writing to table metadb.config: %w", err)
+	}
+
+	q = "ALTER TABLE metadb.source " +
+		"ADD COLUMN type text NOT NULL DEFAULT 'kafka', " +
+		"ADD COLUMN schema_registry text, " +
+		"ADD COLUMN flattened text, " +
+		"ADD COLUMN schemaless text, " +
+		"ADD COLUMN dead_letter text, " +
+		"ADD COLUMN dead_letter_topic text, " +
+		"ADD COLUMN column_stop_filter text, " +
+		"ADD COLUMN column_mask text, " +
+		"ADD COLUMN column_mask_salt text, " +
+		"ADD COLUMN schema_rename text, " +
+		"ADD COLUMN table_rename text, " +
+		"ADD COLUMN path text, " +
+		"ADD COLUMN connection text, " +
+		"ADD COLUMN publication text, " +
+		"ADD COLUMN slot text, " +
+		"ADD COLUMN history_retention text, " +
+		"ADD COLUMN change_log text, " +
+		"ADD COLUMN position text"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return fmt.Errorf("altering table metadb.source: %w", err)
+	}
+	// Schema names were previously rewritten in the same way for all data
+	// sources.  This is now the default only for the folio and reshare
+	// modules, and other sources retain it as explicit rename rules.
+	q = "UPDATE metadb.source SET schema_rename='^mod_:,_storage$:,^(.*?)_mod_:${1}_' " +
+		"WHERE module IS NULL OR module NOT IN ('folio', 'reshare')"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return fmt.Errorf("writing to table metadb.source: %w", err)
+	}
+
+	q = "CREATE TABLE metadb.dead_letter (" +
+		"id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY, " +
+		"source_name text NOT NULL, " +
+		"topic text NOT NULL, " +
+		"position text NOT NULL, " +
+		"key bytea, " +
+		"value bytea, " +
+		"stage text NOT NULL CHECK (stage IN ('parse', 'apply')), " +
+		"error text NOT NULL, " +
+		"attempts integer NOT NULL DEFAULT 1, " +
+		"retry boolean NOT NULL DEFAULT FALSE, " +
+		"created timestamptz NOT NULL DEFAULT now(), " +
+		"updated timestamptz NOT NULL DEFAULT now())"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return fmt.Errorf("creating table metadb.dead_letter: %w", err)
+	}
+
+	q = "CREATE TABLE metadb.primary_key_override (" +
+		"schema_name varchar(63) NOT NULL, " +
+		"table_name varchar(63) NOT NULL, " +
+		"column_names text[], " +
+		"row_hash boolean NOT NULL DEFAULT FALSE, " +
+		"PRIMARY KEY (schema_name, table_name))"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return fmt.Errorf("creating table metadb.primary_key_override: %w", err)
+	}
+
+	q = "CREATE TABLE metadb.history_retention (" +
+		"schema_name varchar(63) NOT NULL, " +
+		"table_name varchar(63) NOT NULL, " +
+		"retention text NOT NULL, " +
+		"PRIMARY KEY (schema_name, table_name))"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return fmt.Errorf("creating table metadb.history_retention: %w", err)
+	}
+
+	q = "CREATE TABLE metadb.archive (" +
+		"schema_name varchar(63) NOT NULL, " +
+		"table_name varchar(63) NOT NULL, " +
+		"partition_name text NOT NULL, " +
+		"path text NOT NULL, " +
+		"row_count bigint NOT NULL, " +
+		"archived timestamptz NOT NULL, " +
+		"dropped boolean NOT NULL, " +
+		"PRIMARY KEY (schema_name, table_name, partition_name))"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return fmt.Errorf("creating table metadb.archive: %w", err)
+	}
+
+	q = "CREATE TABLE metadb.change_log (" +
+		"id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY, " +
+		"source_name text NOT NULL, " +
+		"operation text NOT NULL CHECK (operation IN ('merge', 'delete', 'truncate')), " +
+		"schema_name varchar(63) NOT NULL, " +
+		"table_name varchar(63) NOT NULL, " +
+		"primary_key jsonb, " +
+		"__id bigint, " +
+		"source_timestamp timestamptz NOT NULL, " +
+		"commit_time timestamptz NOT NULL DEFAULT now())"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return fmt.Errorf("creating table metadb.change_log: %w", err)
+	}
+
+	q = "ALTER TABLE metadb.base_table ADD COLUMN partition_granularity text NOT NULL DEFAULT 'year'"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return fmt.Errorf("altering table metadb.base_table: %w", err)
+	}
+
+	// Create "as of" functions for existing tables.
+	rows, err := tx.Query(context.TODO(), "SELECT schema_name, table_name FROM metadb.base_table")
+	if err != nil {
+		return fmt.Errorf("selecting table list: %w", err)
+	}
+	var tables []dbx.Table
+	for rows.Next() {
+		var t dbx.Table
+		if err = rows.Scan(&t.Schema, &t.Table); err != nil {
+			rows.Close()
+			return fmt.Errorf("reading table list: %w", err)
+		}
+		tables = append(tables, t)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("reading table list: %w", err)
+	}
+	for i := range tables {
+		if err = catalog.CreateAsOfFunction(tx, &tables[i]); err != nil {
+			return err
+		}
+	}
+
+	if err = metadata.WriteDatabaseVersion(tx, 35); err != nil {
+		return err
+	}
+	if err = tx.Commit(context.TODO()); err != nil {
+		return err
+	}
+	return nil
+}
+
 //func toPostgresArray(slice []string) string {
 //	var b strings.Builder
 //	b.WriteString("ARRAY[")
@@ -8,13 +8,12 @@ import (
 	"regexp"
 	"strings"
 
-	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/metadb-project/metadb/cmd/metadb/dbx"
 	"gopkg.in/ini.v1"
 )
 
-const DatabaseVersion = 34
+const DatabaseVersion = 35
 
 // MetadbVersion is defined at build time via -ldflags.
 var MetadbVersion = ""
@@ -57,6 +56,10 @@ func SystemPIDFileName(datadir string) string {
 	return filepath.Join(datadir, "metadb.pid")
 }
 
+func PasswordFileName(datadir string) string {
+	return filepath.Join(datadir, "metadb.passwd")
+}
+
 func SysdbFileName(datadir string) string {
 	return filepath.Join(SystemDirName(datadir), "systemdb")
 }
@@ -99,18 +102,6 @@ func CompileRegexps(strs []string) ([]*regexp.Regexp, error) {
 	return res, nil
 }
 
-func KafkaMessageString(m *kafka.Message) string {
-	var b strings.Builder
-	_, _ = fmt.Fprintf(&b, "topic partition = %s\n", m.TopicPartition)
-	_, _ = fmt.Fprintf(&b, "key = %s\n", m.Key)
-	_, _ = fmt.Fprintf(&b, "value = %s\n", m.Value)
-	_, _ = fmt.Fprintf(&b, "timestamp = %s\n", m.Timestamp)
-	_, _ = fmt.Fprintf(&b, "timestamp type = %s\n", m.TimestampType)
-	_, _ = fmt.Fprintf(&b, "opaque = %s\n", m.Opaque)
-	_, _ = fmt.Fprintf(&b, "headers = %s\n", m.Headers)
-	return b.String()
-}
-
 //func RequireFileExists(filename string) error {
 //        var err error
 //        var ok bool